@@ -43,12 +43,14 @@ const (
 	registerFlag            = "register"
 	fingerprintFlag         = "fingerprint"
 	similarityThresholdFlag = "similarityThreshold"
+	versionFlag             = "version"
 )
 
 var (
 	instanceIDPtr, regionPtr             *string
 	activationCode, activationID, region string
 	register, clear, force, fpFlag       bool
+	showVersion                          bool
 	similarityThreshold                  int
 	registrationFile                     = filepath.Join(appconfig.DefaultDataStorePath, "registration")
 )
@@ -29,6 +29,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/managedInstances/registration"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
 	"github.com/aws/amazon-ssm-agent/agent/ssm/anonauth"
+	"github.com/aws/amazon-ssm-agent/agent/version"
 )
 
 // parseFlags displays flags and handles them
@@ -56,6 +57,9 @@ func parseFlags(log logger.T) {
 	// force flag
 	flag.BoolVar(&force, "y", false, "")
 
+	// version flag
+	flag.BoolVar(&showVersion, versionFlag, false, "")
+
 	flag.Parse()
 
 	if flag.NFlag() > 0 {
@@ -64,6 +68,9 @@ func parseFlags(log logger.T) {
 			exitCode = processRegistration(log)
 		} else if fpFlag {
 			exitCode = processFingerprint(log)
+		} else if showVersion {
+			fmt.Fprintf(os.Stdout, "SSM Agent version: %v\n", version.Version)
+			exitCode = 0
 		} else {
 			flagUsage()
 		}
@@ -82,6 +89,7 @@ func flagUsage() {
 	fmt.Fprintln(os.Stderr, "\t\t-region\tSSM region       \t(REQUIRED)")
 	fmt.Fprintln(os.Stderr, "\n\t\t-clear\tClears the previously saved SSM registration")
 	fmt.Fprintln(os.Stderr, "\n\t-y\tAnswer yes for all questions")
+	fmt.Fprintln(os.Stderr, "\n\t-version\tPrint the agent version")
 }
 
 // processRegistration handles flags related to the registration category
@@ -27,6 +27,11 @@ func parser(config *SsmagentConfig) {
 	config.Agent.Name = getStringValue(config.Agent.Name, DefaultAgentName)
 	config.Agent.OrchestrationRootDir = getStringValue(config.Agent.OrchestrationRootDir, defaultOrchestrationRootDirName)
 	config.Agent.Region = getStringValue(config.Agent.Region, "")
+	config.Agent.UpdateExecutionTimeoutSeconds = getNumericValue(
+		config.Agent.UpdateExecutionTimeoutSeconds,
+		DefaultUpdateExecutionTimeoutSecondsMin,
+		DefaultUpdateExecutionTimeoutSecondsMax,
+		0)
 
 	// MDS config
 	config.Mds.CommandWorkersLimit = getNumericValue(
@@ -92,3 +92,22 @@ func TestGetNumeric64Value(t *testing.T) {
 		assert.Equal(t, test.Output, output)
 	}
 }
+
+func TestParserUpdateExecutionTimeout(t *testing.T) {
+	testCases := []struct {
+		input  int
+		output int
+	}{
+		{0, 0},
+		{600, 600},
+		{1, 0},
+		{DefaultUpdateExecutionTimeoutSecondsMax + 1, 0},
+	}
+
+	for _, test := range testCases {
+		config := DefaultConfig()
+		config.Agent.UpdateExecutionTimeoutSeconds = test.input
+		parser(&config)
+		assert.Equal(t, test.output, config.Agent.UpdateExecutionTimeoutSeconds)
+	}
+}
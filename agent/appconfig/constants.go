@@ -31,6 +31,10 @@ const (
 	DefaultStopTimeoutMillisMin = 10000
 	DefaultStopTimeoutMillisMax = 1000000
 
+	// DefaultUpdateExecutionTimeoutSecondsMin and Max bound the update execution timeout, 0 means the updater default is used
+	DefaultUpdateExecutionTimeoutSecondsMin = 10
+	DefaultUpdateExecutionTimeoutSecondsMax = 3600
+
 	// SSM defaults
 	DefaultSsmHealthFrequencyMinutes    = 5
 	DefaultSsmHealthFrequencyMinutesMin = 5
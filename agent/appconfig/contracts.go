@@ -51,6 +51,21 @@ type AgentInfo struct {
 	OrchestrationRootDir string
 	DownloadRootDir      string
 	ContainerMode        bool
+	// UpdateExecutionTimeoutSeconds overrides the default timeout of the update scripts
+	UpdateExecutionTimeoutSeconds int
+	// KeepUpdateArtifacts keeps the downloaded update packages so an update to the same version can reuse them
+	KeepUpdateArtifacts bool
+	// UpdateCABundlePath is a PEM bundle of additional CAs trusted by the update downloads
+	UpdateCABundlePath string
+	// UpdateCABundleOnly trusts only the UpdateCABundlePath CAs instead of adding them to the system roots
+	UpdateCABundleOnly bool
+	// ApprovedUpdateVersions restricts the update to the listed target versions, an empty list allows any version
+	ApprovedUpdateVersions []string
+	// ApprovedUpdateVersionsPath is a file listing one approved target version per line, the versions are
+	// added to ApprovedUpdateVersions
+	ApprovedUpdateVersionsPath string
+	// UpdateValidationScriptPath is a script run after the agent is updated, the update is rolled back when it fails
+	UpdateValidationScriptPath string
 }
 
 // MgsConfig represents configuration for Message Gateway service
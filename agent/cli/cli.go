@@ -122,6 +122,9 @@ func parseCommand(args []string) (err error, options []string, command string, s
 				return
 			}
 			if _, exists := parameters[parameterName]; exists {
+				if cliutil.IsRepeatableFlag(parameterName) {
+					continue
+				}
 				// aws cli doesn't valid this
 				err = fmt.Errorf("duplicate parameter %v", parameterName)
 				return
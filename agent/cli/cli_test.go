@@ -68,3 +68,24 @@ func TestCliCmdExecSuccess(t *testing.T) {
 	assert.Equal(t, cliutil.CLI_SUCCESS_EXITCODE, exitCode, "command execution success return exit code 0")
 	cliCmdMock.AssertExpectations(t)
 }
+
+func TestParseCommandWithRepeatableFlag(t *testing.T) {
+	cliutil.RegisterRepeatableFlag("repeatable")
+	args := []string{"ssm-cli", "cli-command-mock", "--repeatable", "a=1", "--content", "fakefile.json", "--repeatable", "b=2", "c=3"}
+
+	err, _, command, _, parameters := parseCommand(args)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cli-command-mock", command)
+	assert.Equal(t, []string{"a=1", "b=2", "c=3"}, parameters["repeatable"])
+	assert.Equal(t, []string{"fakefile.json"}, parameters["content"])
+}
+
+func TestParseCommandWithDuplicateFlag(t *testing.T) {
+	args := []string{"ssm-cli", "cli-command-mock", "--content", "fakefile.json", "--output", "text", "--output", "json"}
+
+	err, _, _, _, _ := parseCommand(args)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate parameter output")
+}
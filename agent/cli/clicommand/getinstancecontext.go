@@ -0,0 +1,164 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/aws/amazon-ssm-agent/agent/cli/cliutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+)
+
+const (
+	getInstanceContextCommand = "get-instance-context"
+	getInstanceContextOutput  = "output"
+	outputTable               = "table"
+)
+
+// createInstanceContext resolves the instance context the updater uses to select the update artifacts
+var createInstanceContext = func(log log.T) (*updateutil.InstanceContext, error) {
+	util := &updateutil.Utility{}
+	return util.CreateInstanceContext(log)
+}
+
+const getInstanceContextCommandHelp = `NAME:
+    {{.GetInstanceContextCommandName}}
+
+DESCRIPTION
+SYNOPSIS
+    {{.GetInstanceContextCommandName}}
+    [{{.OutputFlag}}]
+
+PARAMETERS
+    {{.OutputFlag}} (string) json or table, the format of the instance context. Defaults to json.
+
+EXAMPLES
+    This example returns the instance context the agent updater resolves to select the update artifacts.
+
+    Command:
+
+      {{.SsmCliName}} {{.GetInstanceContextCommandName}}
+
+    Output:
+      {
+        "region": "us-west-2",
+        "platform": "linux",
+        "platform-version": "2",
+        "installer": "linux",
+        "arch": "amd64",
+        "compress-format": "tar.gz"
+      }
+
+OUTPUT
+    Instance context containing region, platform, platform version, installer, arch and compress format
+`
+
+type getInstanceContextHelpParams struct {
+	SsmCliName                    string
+	GetInstanceContextCommandName string
+	OutputFlag                    string
+}
+
+func init() {
+	cliutil.Register(&GetInstanceContextCommand{})
+}
+
+type GetInstanceContextCommand struct {
+	helpText string
+}
+
+// Execute validates and executes the get-instance-context cli command
+func (c *GetInstanceContextCommand) Execute(subcommands []string, parameters map[string][]string) (error, string) {
+	validation := c.validateGetInstanceContextCommandInput(subcommands, parameters)
+	// return validation errors if any were found
+	if len(validation) > 0 {
+		return errors.New(strings.Join(validation, "\n")), ""
+	}
+
+	context, err := createInstanceContext(log.NewMockLog())
+	if err != nil {
+		return fmt.Errorf("failed to resolve the instance context, %v", err), ""
+	}
+
+	fields := [][]string{
+		{"region", context.Region},
+		{"platform", context.Platform},
+		{"platform-version", context.PlatformVersion},
+		{"installer", context.InstallerName},
+		{"arch", context.Arch},
+		{"compress-format", context.CompressFormat},
+	}
+
+	if output := parameters[getInstanceContextOutput]; len(output) == 1 && output[0] == outputTable {
+		buf := new(bytes.Buffer)
+		writer := tabwriter.NewWriter(buf, 0, 0, 4, ' ', 0)
+		for _, field := range fields {
+			fmt.Fprintf(writer, "%v\t%v\n", field[0], field[1])
+		}
+		writer.Flush()
+		return nil, strings.TrimSuffix(buf.String(), "\n")
+	}
+
+	information := make(map[string]string)
+	for _, field := range fields {
+		information[field[0]] = field[1]
+	}
+	result, _ := jsonutil.Marshal(information)
+	return nil, result
+}
+
+// Help prints help for the get-instance-context cli command
+func (c *GetInstanceContextCommand) Help() string {
+	if len(c.helpText) == 0 {
+		t, _ := template.New("GetInstanceContextCommandHelp").Parse(getInstanceContextCommandHelp)
+		params := getInstanceContextHelpParams{cliutil.SsmCliName, getInstanceContextCommand, cliutil.FormatFlag(getInstanceContextOutput)}
+		buf := new(bytes.Buffer)
+		t.Execute(buf, params)
+		c.helpText = buf.String()
+	}
+	return c.helpText
+}
+
+// Name is the command name used in the cli
+func (GetInstanceContextCommand) Name() string {
+	return getInstanceContextCommand
+}
+
+// validateGetInstanceContextCommandInput checks the subcommands and parameters for required values, format, and unsupported values
+func (GetInstanceContextCommand) validateGetInstanceContextCommandInput(subcommands []string, parameters map[string][]string) []string {
+	validation := make([]string, 0)
+	if subcommands != nil && len(subcommands) > 0 {
+		validation = append(validation, fmt.Sprintf("%v does not support subcommand %v", getInstanceContextCommand, subcommands), "")
+		return validation // invalid subcommand is an attempt to execute something that really isn't this command, so the rest of the validation is skipped in this case
+	}
+
+	for key, values := range parameters {
+		if key != getInstanceContextOutput {
+			validation = append(validation, fmt.Sprintf("unknown parameter %v", cliutil.FormatFlag(key)))
+		} else if len(values) != 1 {
+			validation = append(validation, fmt.Sprintf("expected 1 value for parameter %v", cliutil.FormatFlag(key)))
+		} else if values[0] != outputJson && values[0] != outputTable {
+			validation = append(validation, fmt.Sprintf("%v value must be %v or %v", cliutil.FormatFlag(key), outputJson, outputTable))
+		}
+	}
+	return validation
+}
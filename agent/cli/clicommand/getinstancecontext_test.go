@@ -0,0 +1,91 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubInstanceContext(context *updateutil.InstanceContext, err error) func() {
+	original := createInstanceContext
+	createInstanceContext = func(log log.T) (*updateutil.InstanceContext, error) {
+		return context, err
+	}
+	return func() { createInstanceContext = original }
+}
+
+var testInstanceContext = &updateutil.InstanceContext{
+	Region:          "us-west-2",
+	Platform:        updateutil.PlatformLinux,
+	PlatformVersion: "2",
+	InstallerName:   updateutil.PlatformLinux,
+	Arch:            "amd64",
+	CompressFormat:  updateutil.CompressFormatTarGz,
+}
+
+func TestGetInstanceContextJson(t *testing.T) {
+	defer stubInstanceContext(testInstanceContext, nil)()
+
+	err, output := (&GetInstanceContextCommand{}).Execute(nil, map[string][]string{})
+
+	assert.NoError(t, err)
+	var information map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(output), &information))
+	assert.Equal(t, map[string]string{
+		"region":           "us-west-2",
+		"platform":         "linux",
+		"platform-version": "2",
+		"installer":        "linux",
+		"arch":             "amd64",
+		"compress-format":  "tar.gz",
+	}, information)
+}
+
+func TestGetInstanceContextTable(t *testing.T) {
+	defer stubInstanceContext(testInstanceContext, nil)()
+
+	err, output := (&GetInstanceContextCommand{}).Execute(nil, map[string][]string{getInstanceContextOutput: {outputTable}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `region              us-west-2
+platform            linux
+platform-version    2
+installer           linux
+arch                amd64
+compress-format     tar.gz`, output)
+}
+
+func TestGetInstanceContextDetectionFailed(t *testing.T) {
+	defer stubInstanceContext(nil, fmt.Errorf("Failed to get region"))()
+
+	err, output := (&GetInstanceContextCommand{}).Execute(nil, map[string][]string{})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to resolve the instance context, Failed to get region")
+	assert.Empty(t, output)
+}
+
+func TestGetInstanceContextInvalidInput(t *testing.T) {
+	command := &GetInstanceContextCommand{}
+	assert.NotEmpty(t, command.validateGetInstanceContextCommandInput([]string{"run"}, nil))
+	assert.NotEmpty(t, command.validateGetInstanceContextCommandInput(nil, map[string][]string{getInstanceContextOutput: {"yaml"}}))
+	assert.NotEmpty(t, command.validateGetInstanceContextCommandInput(nil, map[string][]string{"region": {"us-east-1"}}))
+}
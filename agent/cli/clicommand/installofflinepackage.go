@@ -0,0 +1,224 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/cli/cliutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+)
+
+const (
+	installOfflinePackageCommand  = "install-offline-package"
+	installOfflinePackagePackage  = "package"
+	installOfflinePackageVersion  = "version"
+	installOfflinePackageChecksum = "checksum"
+)
+
+// offlineUpdateRoot is the folder the package is staged in and the updater looks for the update trigger in
+var offlineUpdateRoot = appconfig.UpdaterArtifactsRoot
+
+// offlineInstanceContext loads the platform and arch the package is verified for
+var offlineInstanceContext = func(log log.T) (*updateutil.InstanceContext, error) {
+	return (&updateutil.Utility{}).CreateInstanceContext(log)
+}
+
+const installOfflinePackageCommandHelp = `NAME:
+    {{.InstallOfflinePackageCommandName}}
+
+DESCRIPTION
+SYNOPSIS
+    {{.InstallOfflinePackageCommandName}}
+    {{.PackageFlag}}
+    {{.VersionFlag}}
+    {{.ChecksumFlag}}
+
+PARAMETERS
+    {{.PackageFlag}} (string) Local path of the agent update package, e.g. amazon-ssm-agent-linux-amd64.tar.gz.
+    The package must be built for the platform and arch of the instance.
+
+    {{.VersionFlag}} (string) Version of the agent in the package.
+
+    {{.ChecksumFlag}} (string) Expected sha256 checksum of the package in hex.
+    The package is rejected when its checksum does not match.
+
+EXAMPLES
+    This example stages a package copied to the instance for the next update.
+
+    Command:
+
+      {{.SsmCliName}} {{.InstallOfflinePackageCommandName}} {{.PackageFlag}} /tmp/amazon-ssm-agent-linux-amd64.tar.gz {{.VersionFlag}} 3.0.100.0 {{.ChecksumFlag}} 3c95870b46ad5e35c35b008a98d169cea73d85c1f6f4b6602e9173905b67db93
+
+    Output:
+
+      Staged amazon-ssm-agent 3.0.100.0 in /var/lib/amazon/ssm/update/amazon-ssm-agent/3.0.100.0
+
+OUTPUT
+    The folder the package is staged in, the updater installs it when it runs without a target location
+`
+
+type installOfflinePackageHelpParams struct {
+	SsmCliName                       string
+	InstallOfflinePackageCommandName string
+	PackageFlag                      string
+	VersionFlag                      string
+	ChecksumFlag                     string
+}
+
+func init() {
+	cliutil.Register(&InstallOfflinePackageCommand{})
+}
+
+type InstallOfflinePackageCommand struct {
+	helpText string
+}
+
+// Execute validates and executes the install-offline-package cli command
+func (c *InstallOfflinePackageCommand) Execute(subcommands []string, parameters map[string][]string) (error, string) {
+	validation := c.validateInstallOfflinePackageCommandInput(subcommands, parameters)
+	// return validation errors if any were found
+	if len(validation) > 0 {
+		return errors.New(strings.Join(validation, "\n")), ""
+	}
+
+	packagePath := parameters[installOfflinePackagePackage][0]
+	version := parameters[installOfflinePackageVersion][0]
+	checksum := strings.ToLower(parameters[installOfflinePackageChecksum][0])
+	logger := log.NewMockLog()
+
+	if _, err := os.Stat(packagePath); err != nil {
+		return fmt.Errorf("failed to access package %v, %v", packagePath, err), ""
+	}
+	input := artifact.DownloadInput{
+		SourceURL:       packagePath,
+		SourceChecksums: map[string]string{updateutil.HashType: checksum},
+	}
+	if matched, err := artifact.VerifyHash(logger, input, artifact.DownloadOutput{LocalFilePath: packagePath}); !matched {
+		return fmt.Errorf("checksum of package %v does not match %v, %v", packagePath, checksum, err), ""
+	}
+
+	context, err := offlineInstanceContext(logger)
+	if err != nil {
+		return fmt.Errorf("failed to load the instance context, %v", err), ""
+	}
+	if err = updateutil.VerifyPackageForContext(logger, packagePath, context); err != nil {
+		return err, ""
+	}
+
+	folder := updateutil.UpdateArtifactFolder(offlineUpdateRoot, appconfig.DefaultAgentName, version)
+	stagedPath := filepath.Join(folder, filepath.Base(packagePath))
+	if err = stagePackage(packagePath, stagedPath); err != nil {
+		return fmt.Errorf("failed to stage package %v in %v, %v", packagePath, folder, err), ""
+	}
+
+	trigger := &updateutil.OfflineUpdateTrigger{
+		PackageName:    appconfig.DefaultAgentName,
+		TargetVersion:  version,
+		TargetLocation: stagedPath,
+		TargetHash:     checksum,
+		StagedDateTime: time.Now().UTC(),
+	}
+	if err = updateutil.SaveOfflineUpdateTrigger(offlineUpdateRoot, trigger); err != nil {
+		return fmt.Errorf("failed to save the offline update trigger, %v", err), ""
+	}
+	return nil, fmt.Sprintf("Staged %v %v in %v", appconfig.DefaultAgentName, version, folder)
+}
+
+// Help prints help for the install-offline-package cli command
+func (c *InstallOfflinePackageCommand) Help() string {
+	if len(c.helpText) == 0 {
+		t, _ := template.New("InstallOfflinePackageCommandHelp").Parse(installOfflinePackageCommandHelp)
+		params := installOfflinePackageHelpParams{
+			cliutil.SsmCliName,
+			installOfflinePackageCommand,
+			cliutil.FormatFlag(installOfflinePackagePackage),
+			cliutil.FormatFlag(installOfflinePackageVersion),
+			cliutil.FormatFlag(installOfflinePackageChecksum),
+		}
+		buf := new(bytes.Buffer)
+		t.Execute(buf, params)
+		c.helpText = buf.String()
+	}
+	return c.helpText
+}
+
+// Name is the command name used in the cli
+func (InstallOfflinePackageCommand) Name() string {
+	return installOfflinePackageCommand
+}
+
+// validateInstallOfflinePackageCommandInput checks the subcommands and parameters for required values, format, and unsupported values
+func (InstallOfflinePackageCommand) validateInstallOfflinePackageCommandInput(subcommands []string, parameters map[string][]string) []string {
+	validation := make([]string, 0)
+	if subcommands != nil && len(subcommands) > 0 {
+		validation = append(validation, fmt.Sprintf("%v does not support subcommand %v", installOfflinePackageCommand, subcommands), "")
+		return validation // invalid subcommand is an attempt to execute something that really isn't this command, so the rest of the validation is skipped in this case
+	}
+
+	required := []string{installOfflinePackagePackage, installOfflinePackageVersion, installOfflinePackageChecksum}
+	for _, name := range required {
+		if values, exists := parameters[name]; !exists {
+			validation = append(validation, fmt.Sprintf("%v is required", cliutil.FormatFlag(name)))
+		} else if len(values) != 1 {
+			validation = append(validation, fmt.Sprintf("expected 1 value for parameter %v", cliutil.FormatFlag(name)))
+		}
+	}
+	if values := parameters[installOfflinePackageVersion]; len(values) == 1 {
+		if _, err := updateutil.VersionCompare(values[0], values[0]); err != nil {
+			validation = append(validation, fmt.Sprintf("invalid version %v", values[0]))
+		}
+	}
+
+	for key := range parameters {
+		if key != installOfflinePackagePackage && key != installOfflinePackageVersion && key != installOfflinePackageChecksum {
+			validation = append(validation, fmt.Sprintf("unknown parameter %v", cliutil.FormatFlag(key)))
+		}
+	}
+	return validation
+}
+
+// stagePackage copies the package to the staged path, a partial copy is removed
+func stagePackage(packagePath string, stagedPath string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(stagedPath), appconfig.ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+	var in, out *os.File
+	if in, err = os.Open(packagePath); err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if out, err = os.OpenFile(stagedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, appconfig.ReadWriteAccess); err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(stagedPath)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const offlinePackageContent = "package content"
+
+// prepareOfflinePackage writes a package for the stubbed linux amd64 instance and stages it in a temp update root
+func prepareOfflinePackage(t *testing.T) (packagePath string, checksum string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "offlinepackage")
+	assert.NoError(t, err)
+	packagePath = filepath.Join(dir, "amazon-ssm-agent-linux-amd64.tar.gz")
+	assert.NoError(t, ioutil.WriteFile(packagePath, []byte(offlinePackageContent), 0600))
+	sum := sha256.Sum256([]byte(offlinePackageContent))
+
+	offlineUpdateRoot = filepath.Join(dir, "update")
+	offlineInstanceContext = func(log log.T) (*updateutil.InstanceContext, error) {
+		return &updateutil.InstanceContext{
+			Region:          "us-east-1",
+			Platform:        updateutil.PlatformLinux,
+			PlatformVersion: "2",
+			InstallerName:   updateutil.PlatformLinux,
+			Arch:            "amd64",
+			CompressFormat:  updateutil.CompressFormatTarGz,
+		}, nil
+	}
+	return packagePath, hex.EncodeToString(sum[:]), func() {
+		offlineUpdateRoot = appconfig.UpdaterArtifactsRoot
+		os.RemoveAll(dir)
+	}
+}
+
+func TestInstallOfflinePackageStagesPackage(t *testing.T) {
+	packagePath, checksum, cleanup := prepareOfflinePackage(t)
+	defer cleanup()
+
+	err, output := (&InstallOfflinePackageCommand{}).Execute(nil, map[string][]string{
+		installOfflinePackagePackage:  {packagePath},
+		installOfflinePackageVersion:  {"3.0.100.0"},
+		installOfflinePackageChecksum: {checksum},
+	})
+
+	assert.NoError(t, err)
+	folder := updateutil.UpdateArtifactFolder(offlineUpdateRoot, appconfig.DefaultAgentName, "3.0.100.0")
+	assert.Equal(t, "Staged amazon-ssm-agent 3.0.100.0 in "+folder, output)
+
+	stagedPath := filepath.Join(folder, "amazon-ssm-agent-linux-amd64.tar.gz")
+	content, err := ioutil.ReadFile(stagedPath)
+	assert.NoError(t, err)
+	assert.Equal(t, offlinePackageContent, string(content))
+
+	trigger, err := updateutil.LoadOfflineUpdateTrigger(offlineUpdateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, appconfig.DefaultAgentName, trigger.PackageName)
+	assert.Equal(t, "3.0.100.0", trigger.TargetVersion)
+	assert.Equal(t, stagedPath, trigger.TargetLocation)
+	assert.Equal(t, checksum, trigger.TargetHash)
+}
+
+func TestInstallOfflinePackageRejectsChecksumMismatch(t *testing.T) {
+	packagePath, _, cleanup := prepareOfflinePackage(t)
+	defer cleanup()
+
+	otherSum := sha256.Sum256([]byte("other content"))
+	err, output := (&InstallOfflinePackageCommand{}).Execute(nil, map[string][]string{
+		installOfflinePackagePackage:  {packagePath},
+		installOfflinePackageVersion:  {"3.0.100.0"},
+		installOfflinePackageChecksum: {hex.EncodeToString(otherSum[:])},
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match")
+	assert.Empty(t, output)
+	_, statErr := os.Stat(offlineUpdateRoot)
+	assert.True(t, os.IsNotExist(statErr), "nothing is staged for a rejected package")
+}
+
+func TestInstallOfflinePackageRejectsOtherArch(t *testing.T) {
+	packagePath, checksum, cleanup := prepareOfflinePackage(t)
+	defer cleanup()
+	armPackagePath := filepath.Join(filepath.Dir(packagePath), "amazon-ssm-agent-linux-arm64.tar.gz")
+	assert.NoError(t, os.Rename(packagePath, armPackagePath))
+
+	err, _ := (&InstallOfflinePackageCommand{}).Execute(nil, map[string][]string{
+		installOfflinePackagePackage:  {armPackagePath},
+		installOfflinePackageVersion:  {"3.0.100.0"},
+		installOfflinePackageChecksum: {checksum},
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
+	_, statErr := os.Stat(offlineUpdateRoot)
+	assert.True(t, os.IsNotExist(statErr), "nothing is staged for a rejected package")
+}
+
+func TestInstallOfflinePackageInput(t *testing.T) {
+	command := InstallOfflinePackageCommand{}
+	valid := map[string][]string{
+		installOfflinePackagePackage:  {"a.tar.gz"},
+		installOfflinePackageVersion:  {"3.0.100.0"},
+		installOfflinePackageChecksum: {"abc"},
+	}
+
+	assert.Empty(t, command.validateInstallOfflinePackageCommandInput(nil, valid))
+	assert.NotEmpty(t, command.validateInstallOfflinePackageCommandInput([]string{"sub"}, valid))
+	assert.Len(t, command.validateInstallOfflinePackageCommandInput(nil, map[string][]string{}), 3)
+	assert.NotEmpty(t, command.validateInstallOfflinePackageCommandInput(nil, map[string][]string{
+		installOfflinePackagePackage:  {"a.tar.gz"},
+		installOfflinePackageVersion:  {"latest"},
+		installOfflinePackageChecksum: {"abc"},
+	}))
+	assert.NotEmpty(t, command.validateInstallOfflinePackageCommandInput(nil, map[string][]string{
+		installOfflinePackagePackage:  {"a.tar.gz", "b.tar.gz"},
+		installOfflinePackageVersion:  {"3.0.100.0"},
+		installOfflinePackageChecksum: {"abc"},
+		"output":                      {"json"},
+	}))
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/aws/amazon-ssm-agent/agent/cli/cliutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+)
+
+const (
+	listCommands       = "list-offline-commands"
+	listCommandsOutput = "output"
+)
+
+const (
+	documentStatePending   = "pending"
+	documentStateSubmitted = "submitted"
+	documentStateInvalid   = "invalid"
+)
+
+const listCommandsHelp = `NAME:
+    {{.ListCommandsName}}
+
+DESCRIPTION
+SYNOPSIS
+    {{.ListCommandsName}}
+    [{{.OutputFlag}}]
+
+PARAMETERS
+    {{.OutputFlag}} (string) text or json, the format of the documents. Defaults to text.
+
+EXAMPLES
+    This example lists the documents submitted with {{.SendCommandName}}.
+
+    Command:
+
+      {{.SsmCliName}} {{.ListCommandsName}}
+
+    Output:
+
+      pending:
+          9b1deb4d-3b7d-4bad-9bdd-2b0d7b3dcb6d
+      submitted:
+          1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed    01234567-890a-bcde-f012-34567890abcd
+      invalid:
+
+OUTPUT
+    The documents grouped by state, pending documents are not picked up by the agent yet
+`
+
+type listCommandsHelpParams struct {
+	SsmCliName       string
+	ListCommandsName string
+	SendCommandName  string
+	OutputFlag       string
+}
+
+// offlineDocument is a document submitted with send-offline-command, the command id is set once the agent
+// processed the document
+type offlineDocument struct {
+	DocumentName string `json:"documentName"`
+	CommandId    string `json:"commandId,omitempty"`
+}
+
+func init() {
+	cliutil.Register(&ListOfflineCommands{})
+}
+
+type ListOfflineCommands struct {
+	helpText string
+}
+
+// Execute validates and executes the list-offline-commands cli command
+func (c *ListOfflineCommands) Execute(subcommands []string, parameters map[string][]string) (error, string) {
+	validation := c.validateListCommandsInput(subcommands, parameters)
+	// return validation errors if any were found
+	if len(validation) > 0 {
+		return errors.New(strings.Join(validation, "\n")), ""
+	}
+
+	states := []string{documentStatePending, documentStateSubmitted, documentStateInvalid}
+	documents := map[string][]offlineDocument{
+		documentStatePending:   listDocuments(localCommandRoot, false),
+		documentStateSubmitted: listDocuments(localCommandRootSubmitted, true),
+		documentStateInvalid:   listDocuments(localCommandRootInvalid, true),
+	}
+
+	if output := parameters[listCommandsOutput]; len(output) == 1 && output[0] == outputJson {
+		result, err := jsonutil.Marshal(documents)
+		return err, result
+	}
+
+	buf := new(bytes.Buffer)
+	writer := tabwriter.NewWriter(buf, 0, 0, 4, ' ', 0)
+	for _, state := range states {
+		fmt.Fprintf(writer, "%v:\n", state)
+		for _, document := range documents[state] {
+			if document.CommandId == "" {
+				fmt.Fprintf(writer, "    %v\n", document.DocumentName)
+			} else {
+				fmt.Fprintf(writer, "    %v\t%v\n", document.DocumentName, document.CommandId)
+			}
+		}
+	}
+	writer.Flush()
+	return nil, strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Help prints help for the list-offline-commands cli command
+func (c *ListOfflineCommands) Help() string {
+	if len(c.helpText) == 0 {
+		t, _ := template.New("ListOfflineCommandsHelp").Parse(listCommandsHelp)
+		params := listCommandsHelpParams{cliutil.SsmCliName, listCommands, sendCommand, cliutil.FormatFlag(listCommandsOutput)}
+		buf := new(bytes.Buffer)
+		t.Execute(buf, params)
+		c.helpText = buf.String()
+	}
+	return c.helpText
+}
+
+// Name is the command name used in the cli
+func (ListOfflineCommands) Name() string {
+	return listCommands
+}
+
+// validateListCommandsInput checks the subcommands and parameters for format and unsupported values
+func (ListOfflineCommands) validateListCommandsInput(subcommands []string, parameters map[string][]string) []string {
+	validation := make([]string, 0)
+	if subcommands != nil && len(subcommands) > 0 {
+		validation = append(validation, fmt.Sprintf("%v does not support subcommand %v", listCommands, subcommands), "")
+		return validation // invalid subcommand is an attempt to execute something that really isn't this command, so the rest of the validation is skipped in this case
+	}
+
+	for key, values := range parameters {
+		if key != listCommandsOutput {
+			validation = append(validation, fmt.Sprintf("unknown parameter %v", cliutil.FormatFlag(key)))
+		} else if len(values) != 1 {
+			validation = append(validation, fmt.Sprintf("expected 1 value for parameter %v", cliutil.FormatFlag(key)))
+		} else if values[0] != outputText && values[0] != outputJson {
+			validation = append(validation, fmt.Sprintf("%v value must be %v or %v", cliutil.FormatFlag(key), outputText, outputJson))
+		}
+	}
+	return validation
+}
+
+// listDocuments returns the documents of the folder, the command id is parsed from the names of the processed
+// documents, a folder that does not exist has no documents
+func listDocuments(folder string, processed bool) []offlineDocument {
+	documents := make([]offlineDocument, 0)
+	files, _ := fileutil.GetFileNames(folder)
+	for _, file := range files {
+		if !processed {
+			documents = append(documents, offlineDocument{DocumentName: file})
+			continue
+		}
+		if documentName, commandId, isProcessed := splitProcessedDocument(file); isProcessed {
+			documents = append(documents, offlineDocument{DocumentName: documentName, CommandId: commandId})
+		}
+	}
+	return documents
+}
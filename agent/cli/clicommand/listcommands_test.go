@@ -0,0 +1,105 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestLocalCommandFolders points the local command folders to a temp folder with the documents of each state
+func useTestLocalCommandFolders(t *testing.T) (restore func()) {
+	dir, err := ioutil.TempDir("", "listcommands")
+	assert.NoError(t, err)
+	localCommandRoot = filepath.Join(dir, "localcommands")
+	localCommandRootSubmitted = filepath.Join(localCommandRoot, "submitted")
+	localCommandRootInvalid = filepath.Join(localCommandRoot, "invalid")
+	for folder, files := range map[string][]string{
+		localCommandRoot:          {"pending-document"},
+		localCommandRootSubmitted: {"submitted-document.01234567-890a-bcde-f012-34567890abcd"},
+		localCommandRootInvalid:   {"invalid-document.11234567-890a-bcde-f012-34567890abcd"},
+	} {
+		assert.NoError(t, os.MkdirAll(folder, 0700))
+		for _, file := range files {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(folder, file), []byte("{}"), 0600))
+		}
+	}
+	return func() {
+		os.RemoveAll(dir)
+		localCommandRoot = appconfig.LocalCommandRoot
+		localCommandRootSubmitted = appconfig.LocalCommandRootSubmitted
+		localCommandRootInvalid = appconfig.LocalCommandRootInvalid
+	}
+}
+
+func TestListOfflineCommandsText(t *testing.T) {
+	defer useTestLocalCommandFolders(t)()
+
+	err, output := (&ListOfflineCommands{}).Execute(nil, map[string][]string{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `pending:
+    pending-document
+submitted:
+    submitted-document    01234567-890a-bcde-f012-34567890abcd
+invalid:
+    invalid-document    11234567-890a-bcde-f012-34567890abcd`, output)
+}
+
+func TestListOfflineCommandsJson(t *testing.T) {
+	defer useTestLocalCommandFolders(t)()
+
+	err, output := (&ListOfflineCommands{}).Execute(nil, map[string][]string{listCommandsOutput: {outputJson}})
+
+	assert.NoError(t, err)
+	var documents map[string][]offlineDocument
+	assert.NoError(t, json.Unmarshal([]byte(output), &documents))
+	assert.Equal(t, map[string][]offlineDocument{
+		documentStatePending:   {{DocumentName: "pending-document"}},
+		documentStateSubmitted: {{DocumentName: "submitted-document", CommandId: "01234567-890a-bcde-f012-34567890abcd"}},
+		documentStateInvalid:   {{DocumentName: "invalid-document", CommandId: "11234567-890a-bcde-f012-34567890abcd"}},
+	}, documents)
+}
+
+func TestListOfflineCommandsWithoutFolders(t *testing.T) {
+	defer useTestLocalCommandFolders(t)()
+	localCommandRoot = filepath.Join(localCommandRoot, "missing")
+	localCommandRootSubmitted = filepath.Join(localCommandRoot, "submitted")
+	localCommandRootInvalid = filepath.Join(localCommandRoot, "invalid")
+
+	err, output := (&ListOfflineCommands{}).Execute(nil, map[string][]string{listCommandsOutput: {outputJson}})
+
+	assert.NoError(t, err)
+	var documents map[string][]offlineDocument
+	assert.NoError(t, json.Unmarshal([]byte(output), &documents))
+	assert.Equal(t, map[string][]offlineDocument{
+		documentStatePending:   {},
+		documentStateSubmitted: {},
+		documentStateInvalid:   {},
+	}, documents)
+}
+
+func TestValidateListCommandsInput(t *testing.T) {
+	assert.Empty(t, ListOfflineCommands{}.validateListCommandsInput(nil, map[string][]string{listCommandsOutput: {outputText}}))
+	assert.NotEmpty(t, ListOfflineCommands{}.validateListCommandsInput([]string{"all"}, map[string][]string{}))
+	assert.NotEmpty(t, ListOfflineCommands{}.validateListCommandsInput(nil, map[string][]string{listCommandsOutput: {"table"}}))
+	assert.NotEmpty(t, ListOfflineCommands{}.validateListCommandsInput(nil, map[string][]string{"state": {"pending"}}))
+}
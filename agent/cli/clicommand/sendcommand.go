@@ -19,10 +19,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/cli/cliutil"
@@ -35,10 +41,62 @@ import (
 )
 
 const (
-	sendCommand        = "send-offline-command"
-	sendCommandContent = "content"
+	sendCommand           = "send-offline-command"
+	sendCommandContent    = "content"
+	sendCommandParameters = "parameters"
+	sendCommandOutput     = "output"
+	sendCommandRegion     = "region"
+	sendCommandNoWait     = "no-wait"
 )
 
+// downloadContent downloads the document from a URL
+var downloadContent = artifact.Download
+
+// localCommandRoot is the folder the documents are submitted to
+var localCommandRoot = appconfig.LocalCommandRoot
+
+// localCommandRootSubmitted and localCommandRootInvalid are the folders the agent moves the processed documents to
+var localCommandRootSubmitted = appconfig.LocalCommandRootSubmitted
+var localCommandRootInvalid = appconfig.LocalCommandRootInvalid
+
+// waitForSubmit polls the submit status of the document
+var waitForSubmit = (*SendOfflineCommand).waitForSubmitStatus
+
+// maxContentSources is the number of --content values that can be merged, a document and an overlay
+const maxContentSources = 2
+
+// maxContentSize is the maximum size in bytes of the document content, larger content is rejected before it is parsed
+var maxContentSize int64 = 1024 * 1024
+
+// regionPattern matches the aws region names, e.g. us-east-1
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+const (
+	outputText = "text"
+	outputJson = "json"
+)
+
+// validation failure codes reported with --output json
+const (
+	validationUnsupportedSubcommand = "UNSUPPORTED_SUBCOMMAND"
+	validationMissingContent        = "MISSING_CONTENT"
+	validationTooManyValues         = "TOO_MANY_VALUES"
+	validationInvalidFormat         = "INVALID_FORMAT"
+	validationUnknownParam          = "UNKNOWN_PARAM"
+)
+
+// validationFailure is a validation rule that failed for the send-offline-command input
+type validationFailure struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// parameterReference matches the {{ parameterName }} references in the document
+var parameterReference = regexp.MustCompile(`{{\s*([a-zA-Z0-9]+)\s*}}`)
+
+// parameterName matches the valid document parameter names
+var parameterName = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
 const sendCommandHelp = `NAME:
     {{.SendCommandName}}
 
@@ -46,11 +104,31 @@ DESCRIPTION
 SYNOPSIS
     {{.SendCommandName}}
     {{.ContentFlag}}
+    [{{.ParametersFlag}}]
+    [{{.OutputFlag}}]
+    [{{.RegionFlag}}]
+    [{{.NoWaitFlag}}]
 
 PARAMETERS
     {{.ContentFlag}} (string) JSON or URL to command document.
     A valid command document is a configuration document with all parameters filled in.
     For information about writing a configuration document, see Configuration Document in the SSM API Reference.
+    The flag can be repeated once to supply an overlay, the schemaVersion, description and mainSteps of the
+    overlay replace the ones of the document while its parameters and runtimeConfig are merged by name.
+
+    {{.ParametersFlag}} (string) key=value pairs of document parameters.
+    The values override the default values of the parameters defined in the document.
+    The flag can be repeated, values of a StringList parameter are collected in order.
+
+    {{.OutputFlag}} (string) text or json, the format of the validation failures. Defaults to text.
+    With json each failure is reported with a code, one of
+    MISSING_CONTENT, TOO_MANY_VALUES, INVALID_FORMAT, UNKNOWN_PARAM or UNSUPPORTED_SUBCOMMAND.
+
+    {{.RegionFlag}} (string) Region of the S3 bucket when {{.ContentFlag}} is an s3:// or S3 URL.
+    The flag is ignored for json and file:// content.
+
+    {{.NoWaitFlag}} Return once the document is submitted without waiting for the agent to pick it up.
+    The command id is not reported and the command is not confirmed, only the submitted document name is printed.
 
 EXAMPLES
     This example runs a command in a document in S3.
@@ -63,6 +141,12 @@ EXAMPLES
 
       Successfully submitted with command id 01234567-890a-bcde-f012-34567890abcd
 
+    This example runs a command in a local document and supplies the value of its commands parameter.
+
+    Command:
+
+      {{.SsmCliName}} {{.SendCommandName}} {{.ContentFlag}} file:///tmp/document.json {{.ParametersFlag}} commands=ifconfig
+
 OUTPUT
     Success message with command id or failure message - failure usually happens because you are not admin or provided invalid JSON
 `
@@ -71,10 +155,16 @@ type sendCommandHelpParams struct {
 	SsmCliName      string
 	SendCommandName string
 	ContentFlag     string
+	ParametersFlag  string
+	OutputFlag      string
+	RegionFlag      string
+	NoWaitFlag      string
 }
 
 func init() {
 	cliutil.Register(&SendOfflineCommand{})
+	cliutil.RegisterRepeatableFlag(sendCommandParameters)
+	cliutil.RegisterRepeatableFlag(sendCommandContent)
 }
 
 type SendOfflineCommand struct {
@@ -86,19 +176,30 @@ func (c *SendOfflineCommand) Execute(subcommands []string, parameters map[string
 	validation := c.validateSendCommandInput(subcommands, parameters)
 	// return validation errors if any were found
 	if len(validation) > 0 {
-		return errors.New(strings.Join(validation, "\n")), ""
+		return formatValidationFailures(validation, parameters[sendCommandOutput]), ""
 	}
 
-	if err, content := c.loadContent(parameters[sendCommandContent][0]); err != nil {
+	var overrides []string
+	region := ""
+	if len(parameters[sendCommandRegion]) == 1 {
+		region = parameters[sendCommandRegion][0]
+	}
+	if err, content := c.loadContents(parameters[sendCommandContent], region); err != nil {
+		return err, ""
+	} else if overrides, err = c.applyParameters(&content, parameters[sendCommandParameters]); err != nil {
 		return err, ""
 	} else if err := c.validateContent(content); err != nil {
 		return err, ""
 	} else if contentString, err := jsonutil.Marshal(content); err != nil {
 		return err, ""
+	} else if err := verifyRoundTrip(content, contentString); err != nil {
+		return err, ""
 	} else if err, documentName := c.submitCommandDocument(contentString); err != nil {
 		return err, ""
+	} else if _, noWait := parameters[sendCommandNoWait]; noWait {
+		return nil, strings.Join(append(overrides, fmt.Sprintf("submitted document %v, the command was not confirmed since %v was specified", documentName, cliutil.FormatFlag(sendCommandNoWait))), "\n")
 	} else {
-		return nil, c.waitForSubmitStatus(documentName)
+		return nil, strings.Join(append(overrides, waitForSubmit(c, documentName)), "\n")
 	}
 }
 
@@ -106,7 +207,7 @@ func (c *SendOfflineCommand) Execute(subcommands []string, parameters map[string
 func (c *SendOfflineCommand) Help() string {
 	if len(c.helpText) == 0 {
 		t, _ := template.New("SendOfflineCommandHelp").Parse(sendCommandHelp)
-		params := sendCommandHelpParams{cliutil.SsmCliName, sendCommand, cliutil.FormatFlag(sendCommandContent)}
+		params := sendCommandHelpParams{cliutil.SsmCliName, sendCommand, cliutil.FormatFlag(sendCommandContent), cliutil.FormatFlag(sendCommandParameters), cliutil.FormatFlag(sendCommandOutput), cliutil.FormatFlag(sendCommandRegion), cliutil.FormatFlag(sendCommandNoWait)}
 		buf := new(bytes.Buffer)
 		t.Execute(buf, params)
 		c.helpText = buf.String()
@@ -120,56 +221,272 @@ func (SendOfflineCommand) Name() string {
 }
 
 // validateSendCommandInput checks the subcommands and parameters for required values, format, and unsupported values
-func (SendOfflineCommand) validateSendCommandInput(subcommands []string, parameters map[string][]string) []string {
-	validation := make([]string, 0)
+func (SendOfflineCommand) validateSendCommandInput(subcommands []string, parameters map[string][]string) []validationFailure {
+	validation := make([]validationFailure, 0)
+	fail := func(code string, format string, params ...interface{}) {
+		validation = append(validation, validationFailure{Code: code, Message: fmt.Sprintf(format, params...)})
+	}
 	if subcommands != nil && len(subcommands) > 0 {
-		validation = append(validation, fmt.Sprintf("%v does not support subcommand %v", sendCommand, subcommands), "")
+		fail(validationUnsupportedSubcommand, "%v does not support subcommand %v", sendCommand, subcommands)
 		return validation // invalid subcommand is an attempt to execute something that really isn't this command, so the rest of the validation is skipped in this case
 	}
 
 	// look for required parameters
 	if _, exists := parameters[sendCommandContent]; !exists {
-		validation = append(validation, fmt.Sprintf("%v is required", cliutil.FormatFlag(sendCommandContent)))
-	} else if len(parameters[sendCommandContent]) != 1 {
-		validation = append(validation, fmt.Sprintf("expected 1 value for parameter %v", cliutil.FormatFlag(sendCommandContent)))
+		fail(validationMissingContent, "%v is required", cliutil.FormatFlag(sendCommandContent))
+	} else if len(parameters[sendCommandContent]) == 0 {
+		fail(validationMissingContent, "expected 1 value for parameter %v", cliutil.FormatFlag(sendCommandContent))
+	} else if len(parameters[sendCommandContent]) > maxContentSources {
+		fail(validationTooManyValues, "expected at most %v values for parameter %v", maxContentSources, cliutil.FormatFlag(sendCommandContent))
 	} else {
 		// must be valid json or a valid URI
-		val := parameters[sendCommandContent][0]
-		if !cliutil.ValidJson(val) && !cliutil.ValidUrl(val) {
-			validation = append(validation, fmt.Sprintf("%v value must be valid json or a URL", cliutil.FormatFlag(sendCommandContent)))
+		for _, val := range parameters[sendCommandContent] {
+			if !cliutil.ValidJson(val) && !cliutil.ValidUrl(val) {
+				fail(validationInvalidFormat, "%v value must be valid json or a URL", cliutil.FormatFlag(sendCommandContent))
+			}
+		}
+	}
+
+	// parameters must be key=value pairs
+	for _, val := range parameters[sendCommandParameters] {
+		if _, _, err := parseParameter(val); err != nil {
+			fail(validationInvalidFormat, "%v %v", cliutil.FormatFlag(sendCommandParameters), err)
 		}
 	}
 
+	if output, exists := parameters[sendCommandOutput]; exists {
+		if len(output) != 1 {
+			fail(validationTooManyValues, "expected 1 value for parameter %v", cliutil.FormatFlag(sendCommandOutput))
+		} else if output[0] != outputText && output[0] != outputJson {
+			fail(validationInvalidFormat, "%v value must be %v or %v", cliutil.FormatFlag(sendCommandOutput), outputText, outputJson)
+		}
+	}
+
+	if region, exists := parameters[sendCommandRegion]; exists {
+		if len(region) == 0 {
+			fail(validationInvalidFormat, "expected 1 value for parameter %v", cliutil.FormatFlag(sendCommandRegion))
+		} else if len(region) != 1 {
+			fail(validationTooManyValues, "expected 1 value for parameter %v", cliutil.FormatFlag(sendCommandRegion))
+		} else if !regionPattern.MatchString(region[0]) {
+			fail(validationInvalidFormat, "%v value %v is not a valid region", cliutil.FormatFlag(sendCommandRegion), region[0])
+		}
+	}
+
+	if noWait, exists := parameters[sendCommandNoWait]; exists && len(noWait) > 0 {
+		fail(validationTooManyValues, "parameter %v does not take a value", cliutil.FormatFlag(sendCommandNoWait))
+	}
+
 	// look for unsupported parameters
 	for key := range parameters {
-		if key != sendCommandContent {
-			validation = append(validation, fmt.Sprintf("unknown parameter %v", cliutil.FormatFlag(key)))
+		if key != sendCommandContent && key != sendCommandParameters && key != sendCommandOutput && key != sendCommandRegion && key != sendCommandNoWait {
+			fail(validationUnknownParam, "unknown parameter %v", cliutil.FormatFlag(key))
 		}
 	}
 	return validation
 }
 
-// loadContent loads raw json or json obtained from a URL into DocumentContent
-func (SendOfflineCommand) loadContent(rawContent string) (error, contracts.DocumentContent) {
+// formatValidationFailures returns the validation failures as text, or as json with the failure codes when requested
+func formatValidationFailures(validation []validationFailure, output []string) error {
+	if len(output) == 1 && output[0] == outputJson {
+		if result, err := jsonutil.Marshal(map[string][]validationFailure{"validationErrors": validation}); err == nil {
+			return errors.New(result)
+		}
+	}
+
+	messages := make([]string, 0, len(validation))
+	for _, failure := range validation {
+		messages = append(messages, failure.Message)
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// loadContents loads the document content and merges the overlay content into it when a second value is supplied
+func (c SendOfflineCommand) loadContents(rawContents []string, region string) (error, contracts.DocumentContent) {
+	err, content := c.loadContent(rawContents[0], region)
+	if err != nil || len(rawContents) == 1 {
+		return err, content
+	}
+	err, overlay := c.loadContent(rawContents[1], region)
+	if err != nil {
+		return err, content
+	}
+	return nil, mergeContent(content, overlay)
+}
+
+// mergeContent shallow merges the overlay into the base document, the scalar fields and the main steps of the
+// overlay win when they are set while the parameters and the runtime config are merged by name
+func mergeContent(base contracts.DocumentContent, overlay contracts.DocumentContent) contracts.DocumentContent {
+	if overlay.SchemaVersion != "" {
+		base.SchemaVersion = overlay.SchemaVersion
+	}
+	if overlay.Description != "" {
+		base.Description = overlay.Description
+	}
+	if len(overlay.MainSteps) > 0 {
+		base.MainSteps = overlay.MainSteps
+	}
+	if len(overlay.RuntimeConfig) > 0 {
+		runtimeConfig := make(map[string]*contracts.PluginConfig)
+		for name, config := range base.RuntimeConfig {
+			runtimeConfig[name] = config
+		}
+		for name, config := range overlay.RuntimeConfig {
+			runtimeConfig[name] = config
+		}
+		base.RuntimeConfig = runtimeConfig
+	}
+	if len(overlay.Parameters) > 0 {
+		params := make(map[string]*contracts.Parameter)
+		for name, param := range base.Parameters {
+			params[name] = param
+		}
+		for name, param := range overlay.Parameters {
+			params[name] = param
+		}
+		base.Parameters = params
+	}
+	return base
+}
+
+// loadContent loads raw json or json obtained from a URL into DocumentContent, the region is used for
+// s3 URLs only and is ignored for json and local files
+func (SendOfflineCommand) loadContent(rawContent string, region string) (error, contracts.DocumentContent) {
 	var content contracts.DocumentContent
 	if cliutil.ValidJson(rawContent) {
-		err := json.Unmarshal([]byte(rawContent), &content)
-		return err, content
+		return parseContent([]byte(rawContent), "content")
 	}
 	var url = rawContent
 	// TODO:MF: Write a URI loader utility - artifact really doesn't do that job
 	if strings.HasPrefix(strings.ToLower(url), "file://") {
 		url = url[7:]
+		region = ""
+	} else if strings.HasPrefix(strings.ToLower(url), "s3://") {
+		url = s3ContentURL(url[5:], region)
 	}
 
-	input := &artifact.DownloadInput{SourceURL: url}
-	if output, err := artifact.Download(log.NewMockLog(), *input); err != nil {
+	input := &artifact.DownloadInput{SourceURL: url, Region: region}
+	if output, err := downloadContent(log.NewMockLog(), *input); err != nil {
 		return err, content
-	} else {
-		err = jsonutil.UnmarshalFile(output.LocalFilePath, &content)
+	} else if info, err := os.Stat(output.LocalFilePath); err != nil {
+		return err, content
+	} else if info.Size() > maxContentSize {
+		return fmt.Errorf("content of %v is too large, %v bytes exceeds the maximum of %v bytes", rawContent, info.Size(), maxContentSize), content
+	} else if data, err := ioutil.ReadFile(output.LocalFilePath); err != nil {
 		// TODO:MF: ideally we'd delete the file if we downloaded it - but it might've been a local file and we don't have a good way to tell
 		return err, content
+	} else {
+		return parseContent(data, rawContent)
+	}
+}
+
+// parseContent unmarshals the document content after checking it is not too large and looks like a json object
+func parseContent(data []byte, source string) (error, contracts.DocumentContent) {
+	var content contracts.DocumentContent
+	if int64(len(data)) > maxContentSize {
+		return fmt.Errorf("content of %v is too large, %v bytes exceeds the maximum of %v bytes", source, len(data), maxContentSize), content
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '{' || !utf8.Valid(trimmed) {
+		return fmt.Errorf("content of %v is not JSON, a JSON document is expected", source), content
+	}
+	err := json.Unmarshal(trimmed, &content)
+	return err, content
+}
+
+// applyParameters merges the key=value parameters into the document parameters, the messages returned report
+// the default values of the document that were overridden
+func (SendOfflineCommand) applyParameters(content *contracts.DocumentContent, values []string) (overrides []string, err error) {
+	overrides = make([]string, 0)
+	if len(values) == 0 {
+		return overrides, nil
+	}
+
+	supplied := make(map[string]interface{})
+	order := make([]string, 0)
+	for _, val := range values {
+		name, value, parseErr := parseParameter(val)
+		if parseErr != nil {
+			return overrides, parseErr
+		}
+		param, exists := content.Parameters[name]
+		if !exists || param == nil {
+			return overrides, fmt.Errorf("parameter %v is not defined in the document", name)
+		}
+
+		previous, isSupplied := supplied[name]
+		if param.ParamType == "StringList" {
+			if !isSupplied {
+				previous = []interface{}{}
+				order = append(order, name)
+			}
+			supplied[name] = append(previous.([]interface{}), value)
+			continue
+		}
+		if isSupplied {
+			if previous != value {
+				return overrides, fmt.Errorf("conflicting values %v and %v for parameter %v", previous, value, name)
+			}
+			continue
+		}
+		supplied[name] = value
+		order = append(order, name)
+	}
+
+	for _, name := range order {
+		param := content.Parameters[name]
+		if param.DefaultVal != nil && !reflect.DeepEqual(param.DefaultVal, supplied[name]) {
+			overrides = append(overrides, fmt.Sprintf("parameter %v default value %v is overridden with %v", name, param.DefaultVal, supplied[name]))
+		}
+		param.DefaultVal = supplied[name]
+	}
+	return overrides, nil
+}
+
+// parseParameter splits a key=value parameter into the parameter name and value
+func parseParameter(val string) (name string, value string, err error) {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", "", fmt.Errorf("value %v must be in the format key=value", val)
+	}
+	if !parameterName.MatchString(parts[0]) {
+		return "", "", fmt.Errorf("invalid parameter name %v", parts[0])
+	}
+	return parts[0], parts[1], nil
+}
+
+// unboundParameters returns the parameters referenced in the document steps that have no value
+func unboundParameters(content contracts.DocumentContent) (unbound []string, err error) {
+	var steps []byte
+	if steps, err = json.Marshal([]interface{}{content.RuntimeConfig, content.MainSteps}); err != nil {
+		return nil, err
+	}
+
+	unbound = make([]string, 0)
+	found := make(map[string]bool)
+	for _, match := range parameterReference.FindAllStringSubmatch(string(steps), -1) {
+		name := match[1]
+		if found[name] {
+			continue
+		}
+		found[name] = true
+		if param, exists := content.Parameters[name]; !exists || param == nil || param.DefaultVal == nil {
+			unbound = append(unbound, name)
+		}
 	}
+	sort.Strings(unbound)
+	return unbound, nil
+}
+
+// s3ContentURL returns the path style S3 URL of the bucket/key location in the region
+func s3ContentURL(bucketAndKey string, region string) string {
+	if region == "" {
+		return "https://s3.amazonaws.com/" + bucketAndKey
+	}
+	domain := "amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		domain = "amazonaws.com.cn"
+	}
+	return fmt.Sprintf("https://s3.%v.%v/%v", region, domain, bucketAndKey)
 }
 
 //validateContent checks to see that content has at least one runtimeConfig for 1.2 or mainSteps for 2.0 and no unbound parameters
@@ -188,39 +505,116 @@ func (SendOfflineCommand) validateContent(content contracts.DocumentContent) err
 
 	}
 
+	if unbound, err := unboundParameters(content); err != nil {
+		return err
+	} else if len(unbound) > 0 {
+		return fmt.Errorf("parameters %v have no value, use %v to supply them", strings.Join(unbound, ", "), cliutil.FormatFlag(sendCommandParameters))
+	}
+
 	return nil
 }
 
-// submitCommandDocument
+// verifyRoundTrip checks the marshalled document parses back into the same content,
+// so a lossy marshal never submits a document that differs from the one that was validated
+func verifyRoundTrip(content contracts.DocumentContent, contentString string) error {
+	var parsed contracts.DocumentContent
+	if err := json.Unmarshal([]byte(contentString), &parsed); err != nil {
+		return fmt.Errorf("marshalled document cannot be parsed, %v", err)
+	}
+	mismatch := func(field string) error {
+		return fmt.Errorf("marshalled document does not match the content, %v differs", field)
+	}
+
+	if parsed.SchemaVersion != content.SchemaVersion {
+		return mismatch("schemaVersion")
+	}
+	if parsed.Description != content.Description {
+		return mismatch("description")
+	}
+	if len(parsed.MainSteps) != len(content.MainSteps) {
+		return mismatch("mainSteps")
+	}
+	for i, step := range content.MainSteps {
+		parsedStep := parsed.MainSteps[i]
+		if step == nil || parsedStep == nil {
+			if step != parsedStep {
+				return mismatch(fmt.Sprintf("mainSteps[%v]", i))
+			}
+			continue
+		}
+		if parsedStep.Action != step.Action || parsedStep.Name != step.Name ||
+			fmt.Sprintf("%v", parsedStep.Inputs) != fmt.Sprintf("%v", step.Inputs) {
+			return mismatch(fmt.Sprintf("mainSteps[%v]", i))
+		}
+	}
+	if len(parsed.RuntimeConfig) != len(content.RuntimeConfig) {
+		return mismatch("runtimeConfig")
+	}
+	for name := range content.RuntimeConfig {
+		if _, exists := parsed.RuntimeConfig[name]; !exists {
+			return mismatch(fmt.Sprintf("runtimeConfig %v", name))
+		}
+	}
+	if len(parsed.Parameters) != len(content.Parameters) {
+		return mismatch("parameters")
+	}
+	for name, param := range content.Parameters {
+		parsedParam, exists := parsed.Parameters[name]
+		if !exists {
+			return mismatch(fmt.Sprintf("parameter %v", name))
+		}
+		if param == nil || parsedParam == nil {
+			if (param == nil) != (parsedParam == nil) {
+				return mismatch(fmt.Sprintf("parameter %v", name))
+			}
+			continue
+		}
+		if parsedParam.ParamType != param.ParamType ||
+			fmt.Sprintf("%v", parsedParam.DefaultVal) != fmt.Sprintf("%v", param.DefaultVal) {
+			return mismatch(fmt.Sprintf("parameter %v", name))
+		}
+	}
+	return nil
+}
+
+// submitCommandDocument writes the document to the folder watched by the agent, the content is normalized
+// so the same bytes are written on every platform
 func (SendOfflineCommand) submitCommandDocument(content string) (error, string) {
 	documentName := uuid.NewV4().String()
-	documentPath := filepath.Join(appconfig.LocalCommandRoot, documentName)
+	documentPath := filepath.Join(localCommandRoot, documentName)
 
-	if err := fileutil.MakeDirs(appconfig.LocalCommandRoot); err != nil {
+	if err := fileutil.MakeDirs(localCommandRoot); err != nil {
 		return errors.New("failed to submit command"), ""
-	} else if err := fileutil.WriteAllText(documentPath, content); err != nil {
+	} else if err := fileutil.WriteAllText(documentPath, normalizeDocument(content)); err != nil {
 		return err, ""
 	}
 	return nil, documentName
 }
 
+// normalizeDocument removes the byte order mark and converts the line endings of the document to LF
+func normalizeDocument(content string) string {
+	content = strings.TrimPrefix(content, "\xef\xbb\xbf")
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	return strings.Replace(content, "\r", "\n", -1)
+}
+
 // waitForSubmitStatus
 func (c *SendOfflineCommand) waitForSubmitStatus(documentName string) string {
 	for i := 0; i < 10; i++ {
-		if processed, commandId := c.isDocumentProcessed(documentName, appconfig.LocalCommandRootSubmitted); processed {
+		if processed, commandId := c.isDocumentProcessed(documentName, localCommandRootSubmitted); processed {
 			return fmt.Sprintf("successfully submitted with command id: %v", commandId)
 		}
-		if processed, _ := c.isDocumentProcessed(documentName, appconfig.LocalCommandRootInvalid); processed {
+		if processed, _ := c.isDocumentProcessed(documentName, localCommandRootInvalid); processed {
 			return "failed to submit document: document was invalid"
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
-	documentPath := filepath.Join(appconfig.LocalCommandRoot, documentName)
+	documentPath := filepath.Join(localCommandRoot, documentName)
 	fileutil.DeleteFile(documentPath)
-	if processed, commandId := c.isDocumentProcessed(documentName, appconfig.LocalCommandRootSubmitted); processed {
+	if processed, commandId := c.isDocumentProcessed(documentName, localCommandRootSubmitted); processed {
 		return fmt.Sprintf("successfully submitted with command id: %v", commandId)
 	}
-	if processed, _ := c.isDocumentProcessed(documentName, appconfig.LocalCommandRootInvalid); processed {
+	if processed, _ := c.isDocumentProcessed(documentName, localCommandRootInvalid); processed {
 		return "failed to submit document: document was invalid"
 	}
 	return "failed to submit document: timed out"
@@ -230,9 +624,19 @@ func (c *SendOfflineCommand) waitForSubmitStatus(documentName string) string {
 func (SendOfflineCommand) isDocumentProcessed(documentName string, folder string) (bool, string) {
 	files, _ := fileutil.GetFileNames(folder)
 	for _, file := range files {
-		if strings.HasPrefix(file, documentName) && strings.Contains(file, ".") {
-			return true, file[strings.LastIndex(file, ".")+1:]
+		if processedName, commandId, processed := splitProcessedDocument(file); processed && strings.HasPrefix(processedName, documentName) {
+			return true, commandId
 		}
 	}
 	return false, ""
 }
+
+// splitProcessedDocument splits the name of a processed document, the agent appends the command id
+// to the document name when it moves the document out of the local command folder
+func splitProcessedDocument(file string) (documentName string, commandId string, processed bool) {
+	separator := strings.LastIndex(file, ".")
+	if separator < 0 {
+		return file, "", false
+	}
+	return file[:separator], file[separator+1:], true
+}
@@ -0,0 +1,445 @@
+// Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/jsonutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const unboundDocument = `{
+	"schemaVersion": "2.2",
+	"parameters": {
+		"commands": {"type": "StringList"},
+		"workingDirectory": {"type": "String", "default": "/tmp"},
+		"executionTimeout": {"type": "String"}
+	},
+	"mainSteps": [{
+		"action": "aws:runShellScript",
+		"name": "runShellScript",
+		"inputs": {
+			"runCommand": "{{ commands }}",
+			"workingDirectory": "{{ workingDirectory }}",
+			"timeoutSeconds": "{{executionTimeout}}"
+		}
+	}]
+}`
+
+func loadTestContent(t *testing.T, rawContent string) contracts.DocumentContent {
+	var content contracts.DocumentContent
+	assert.NoError(t, json.Unmarshal([]byte(rawContent), &content))
+	return content
+}
+
+func TestValidateContentWithUnboundParameters(t *testing.T) {
+	content := loadTestContent(t, unboundDocument)
+
+	err := SendOfflineCommand{}.validateContent(content)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "commands, executionTimeout")
+	assert.NotContains(t, err.Error(), "workingDirectory")
+}
+
+func TestApplyParametersBindsParameters(t *testing.T) {
+	content := loadTestContent(t, unboundDocument)
+
+	overrides, err := SendOfflineCommand{}.applyParameters(&content,
+		[]string{"commands=ifconfig", "executionTimeout=600", "commands=echo done"})
+
+	assert.NoError(t, err)
+	assert.Empty(t, overrides)
+	assert.Equal(t, []interface{}{"ifconfig", "echo done"}, content.Parameters["commands"].DefaultVal)
+	assert.Equal(t, "600", content.Parameters["executionTimeout"].DefaultVal)
+	assert.Equal(t, "/tmp", content.Parameters["workingDirectory"].DefaultVal)
+	assert.NoError(t, SendOfflineCommand{}.validateContent(content))
+}
+
+func TestApplyParametersReportsOverriddenDefaults(t *testing.T) {
+	content := loadTestContent(t, unboundDocument)
+
+	overrides, err := SendOfflineCommand{}.applyParameters(&content,
+		[]string{"commands=ifconfig", "executionTimeout=600", "workingDirectory=/var/tmp"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(overrides))
+	assert.Contains(t, overrides[0], "workingDirectory default value /tmp is overridden with /var/tmp")
+	assert.Equal(t, "/var/tmp", content.Parameters["workingDirectory"].DefaultVal)
+	assert.NoError(t, SendOfflineCommand{}.validateContent(content))
+}
+
+func TestApplyParametersWithInvalidParameters(t *testing.T) {
+	testCases := map[string][]string{
+		"conflicting values": {"executionTimeout=600", "executionTimeout=300"},
+		"is not defined":     {"unknown=value"},
+		"key=value":          {"executionTimeout"},
+	}
+
+	for expectedError, values := range testCases {
+		content := loadTestContent(t, unboundDocument)
+		_, err := SendOfflineCommand{}.applyParameters(&content, values)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expectedError)
+	}
+}
+
+func TestValidateSendCommandInputWithParameters(t *testing.T) {
+	parameters := map[string][]string{
+		sendCommandContent:    {"file:///tmp/document.json"},
+		sendCommandParameters: {"commands=ifconfig", "executionTimeout=600"},
+	}
+	assert.Empty(t, SendOfflineCommand{}.validateSendCommandInput(nil, parameters))
+
+	parameters[sendCommandParameters] = []string{"commands", "=ifconfig", "invalid-name=1"}
+	validation := SendOfflineCommand{}.validateSendCommandInput(nil, parameters)
+	assert.Equal(t, 3, len(validation))
+	for _, failure := range validation {
+		assert.Equal(t, validationInvalidFormat, failure.Code)
+	}
+}
+
+func TestValidateSendCommandInputFailureCodes(t *testing.T) {
+	testCases := []struct {
+		subcommands  []string
+		parameters   map[string][]string
+		expectedCode string
+	}{
+		{[]string{"run"}, map[string][]string{sendCommandContent: {"file:///tmp/document.json"}}, validationUnsupportedSubcommand},
+		{nil, map[string][]string{}, validationMissingContent},
+		{nil, map[string][]string{sendCommandContent: {}}, validationMissingContent},
+		{nil, map[string][]string{sendCommandContent: {"file:///tmp/a.json", "file:///tmp/b.json", "file:///tmp/c.json"}}, validationTooManyValues},
+		{nil, map[string][]string{sendCommandContent: {"not json or url"}}, validationInvalidFormat},
+		{nil, map[string][]string{sendCommandContent: {"file:///tmp/document.json"}, sendCommandOutput: {"yaml"}}, validationInvalidFormat},
+		{nil, map[string][]string{sendCommandContent: {"file:///tmp/document.json"}, sendCommandOutput: {"json", "text"}}, validationTooManyValues},
+		{nil, map[string][]string{sendCommandContent: {"file:///tmp/document.json"}, "document-name": {"doc"}}, validationUnknownParam},
+	}
+
+	for _, test := range testCases {
+		validation := SendOfflineCommand{}.validateSendCommandInput(test.subcommands, test.parameters)
+		assert.Equal(t, 1, len(validation), "%v", test.parameters)
+		if len(validation) == 1 {
+			assert.Equal(t, test.expectedCode, validation[0].Code, validation[0].Message)
+		}
+	}
+}
+
+func TestExecuteValidationFailureOutput(t *testing.T) {
+	command := &SendOfflineCommand{}
+	parameters := map[string][]string{"document-name": {"doc"}}
+
+	err, _ := command.Execute(nil, parameters)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--content is required")
+	assert.Contains(t, err.Error(), "unknown parameter --document-name")
+	assert.NotContains(t, err.Error(), validationMissingContent)
+
+	parameters[sendCommandOutput] = []string{outputJson}
+	err, _ = command.Execute(nil, parameters)
+	assert.Error(t, err)
+
+	var result map[string][]validationFailure
+	assert.NoError(t, json.Unmarshal([]byte(err.Error()), &result))
+	codes := []string{}
+	for _, failure := range result["validationErrors"] {
+		codes = append(codes, failure.Code)
+	}
+	assert.Equal(t, []string{validationMissingContent, validationUnknownParam}, codes)
+}
+
+func TestLoadContentPassesRegionToDownload(t *testing.T) {
+	documentFile := writeTestDocument(t)
+	defer os.RemoveAll(filepath.Dir(documentFile))
+
+	testCases := []struct {
+		rawContent     string
+		region         string
+		expectedURL    string
+		expectedRegion string
+	}{
+		{"s3://bucketname/keypath/document.json", "eu-west-1", "https://s3.eu-west-1.amazonaws.com/bucketname/keypath/document.json", "eu-west-1"},
+		{"s3://bucketname/keypath/document.json", "cn-north-1", "https://s3.cn-north-1.amazonaws.com.cn/bucketname/keypath/document.json", "cn-north-1"},
+		{"s3://bucketname/keypath/document.json", "", "https://s3.amazonaws.com/bucketname/keypath/document.json", ""},
+		{"https://s3.us-east-1.amazonaws.com/bucketname/document.json", "eu-west-1", "https://s3.us-east-1.amazonaws.com/bucketname/document.json", "eu-west-1"},
+		{"file://" + documentFile, "eu-west-1", documentFile, ""},
+	}
+
+	for _, test := range testCases {
+		var input artifact.DownloadInput
+		downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+			input = downloadInput
+			return artifact.DownloadOutput{LocalFilePath: documentFile}, nil
+		}
+
+		err, content := SendOfflineCommand{}.loadContent(test.rawContent, test.region)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "2.2", content.SchemaVersion)
+		assert.Equal(t, test.expectedURL, input.SourceURL)
+		assert.Equal(t, test.expectedRegion, input.Region)
+	}
+	downloadContent = artifact.Download
+}
+
+func TestLoadContentIgnoresRegionForJson(t *testing.T) {
+	downloadCalled := false
+	downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+		downloadCalled = true
+		return artifact.DownloadOutput{}, nil
+	}
+	defer func() { downloadContent = artifact.Download }()
+
+	err, content := SendOfflineCommand{}.loadContent(unboundDocument, "eu-west-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2.2", content.SchemaVersion)
+	assert.False(t, downloadCalled)
+}
+
+func TestValidateSendCommandInputWithRegion(t *testing.T) {
+	parameters := map[string][]string{
+		sendCommandContent: {"s3://bucketname/keypath/document.json"},
+		sendCommandRegion:  {"ap-southeast-2"},
+	}
+	assert.Empty(t, SendOfflineCommand{}.validateSendCommandInput(nil, parameters))
+
+	parameters[sendCommandRegion] = []string{"not a region"}
+	validation := SendOfflineCommand{}.validateSendCommandInput(nil, parameters)
+	assert.Equal(t, 1, len(validation))
+	assert.Equal(t, validationInvalidFormat, validation[0].Code)
+
+	parameters[sendCommandRegion] = []string{"us-east-1", "us-west-2"}
+	validation = SendOfflineCommand{}.validateSendCommandInput(nil, parameters)
+	assert.Equal(t, 1, len(validation))
+	assert.Equal(t, validationTooManyValues, validation[0].Code)
+}
+
+func TestLoadContentRejectsOversizedContent(t *testing.T) {
+	documentFile := writeTestDocument(t)
+	defer os.RemoveAll(filepath.Dir(documentFile))
+	downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+		return artifact.DownloadOutput{LocalFilePath: documentFile}, nil
+	}
+	originalMaxContentSize := maxContentSize
+	defer func() {
+		downloadContent = artifact.Download
+		maxContentSize = originalMaxContentSize
+	}()
+	maxContentSize = int64(len(unboundDocument) - 1)
+
+	err, _ := SendOfflineCommand{}.loadContent("https://s3.amazonaws.com/bucketname/document.json", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too large")
+
+	err, _ = SendOfflineCommand{}.loadContent(unboundDocument, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too large")
+}
+
+func TestLoadContentRejectsBinaryContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sendcommand")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	binaryFile := filepath.Join(dir, "document.json")
+	assert.NoError(t, ioutil.WriteFile(binaryFile, []byte{0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe}, 0600))
+	downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+		return artifact.DownloadOutput{LocalFilePath: binaryFile}, nil
+	}
+	defer func() { downloadContent = artifact.Download }()
+
+	err, _ = SendOfflineCommand{}.loadContent("https://s3.amazonaws.com/bucketname/document.json", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not JSON")
+}
+
+func TestLoadContentAcceptsDocumentWithByteOrderMark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sendcommand")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	documentFile := filepath.Join(dir, "document.json")
+	assert.NoError(t, ioutil.WriteFile(documentFile, append([]byte("\xef\xbb\xbf\n"), unboundDocument...), 0600))
+	downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+		return artifact.DownloadOutput{LocalFilePath: documentFile}, nil
+	}
+	defer func() { downloadContent = artifact.Download }()
+
+	err, content := SendOfflineCommand{}.loadContent("https://s3.amazonaws.com/bucketname/document.json", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2.2", content.SchemaVersion)
+}
+
+func TestLoadContentsMergesOverlay(t *testing.T) {
+	overlay := `{
+		"description": "overlay description",
+		"parameters": {
+			"executionTimeout": {"type": "String", "default": "600"},
+			"outputPath": {"type": "String", "default": "/var/log"}
+		}
+	}`
+
+	err, content := SendOfflineCommand{}.loadContents([]string{unboundDocument, overlay}, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2.2", content.SchemaVersion)
+	assert.Equal(t, "overlay description", content.Description)
+	assert.Equal(t, 1, len(content.MainSteps))
+	assert.Equal(t, 4, len(content.Parameters))
+	assert.Equal(t, "StringList", content.Parameters["commands"].ParamType)
+	assert.Equal(t, "/tmp", content.Parameters["workingDirectory"].DefaultVal)
+	assert.Equal(t, "600", content.Parameters["executionTimeout"].DefaultVal)
+	assert.Equal(t, "/var/log", content.Parameters["outputPath"].DefaultVal)
+}
+
+func TestLoadContentsWithSingleContent(t *testing.T) {
+	err, content := SendOfflineCommand{}.loadContents([]string{unboundDocument}, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, loadTestContent(t, unboundDocument), content)
+}
+
+func TestValidateSendCommandInputWithOverlay(t *testing.T) {
+	parameters := map[string][]string{
+		sendCommandContent: {"file:///tmp/document.json", "file:///tmp/overlay.json"},
+	}
+	assert.Empty(t, SendOfflineCommand{}.validateSendCommandInput(nil, parameters))
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	content := loadTestContent(t, unboundDocument)
+	// numeric defaults set in code are parsed back as float64
+	content.Parameters["executionTimeout"].DefaultVal = 600
+
+	contentString, err := jsonutil.Marshal(content)
+	assert.NoError(t, err)
+	assert.NoError(t, verifyRoundTrip(content, contentString))
+}
+
+func TestVerifyRoundTripWithMarshalDrift(t *testing.T) {
+	// invalid utf-8 is replaced when the document is marshalled
+	content := loadTestContent(t, unboundDocument)
+	content.Description = "caf\xe9 document"
+	contentString, err := jsonutil.Marshal(content)
+	assert.NoError(t, err)
+	err = verifyRoundTrip(content, contentString)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "description differs")
+
+	content = loadTestContent(t, unboundDocument)
+	content.Parameters["workingDirectory"].DefaultVal = "/tmp/\xff"
+	contentString, err = jsonutil.Marshal(content)
+	assert.NoError(t, err)
+	err = verifyRoundTrip(content, contentString)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter workingDirectory differs")
+
+	content = loadTestContent(t, unboundDocument)
+	content.MainSteps[0].Inputs = map[string]interface{}{"runCommand": []interface{}{"echo \xfe"}}
+	contentString, err = jsonutil.Marshal(content)
+	assert.NoError(t, err)
+	err = verifyRoundTrip(content, contentString)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mainSteps[0] differs")
+}
+
+func writeTestDocument(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sendcommand")
+	assert.NoError(t, err)
+	documentFile := filepath.Join(dir, "document.json")
+	assert.NoError(t, ioutil.WriteFile(documentFile, []byte(unboundDocument), 0600))
+	return documentFile
+}
+
+func TestExecuteWithNoWaitDoesNotPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sendcommand")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localCommandRoot = dir
+	pollCount := 0
+	waitForSubmit = func(c *SendOfflineCommand, documentName string) string {
+		pollCount++
+		return "successfully submitted with command id: id"
+	}
+	defer func() {
+		localCommandRoot = appconfig.LocalCommandRoot
+		waitForSubmit = (*SendOfflineCommand).waitForSubmitStatus
+	}()
+	parameters := map[string][]string{
+		sendCommandContent:    {unboundDocument},
+		sendCommandParameters: {"commands=ifconfig", "executionTimeout=600"},
+		sendCommandNoWait:     {},
+	}
+
+	err, result := (&SendOfflineCommand{}).Execute(nil, parameters)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pollCount)
+	assert.Contains(t, result, "not confirmed")
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	if len(files) == 1 {
+		assert.Contains(t, result, files[0].Name())
+	}
+
+	delete(parameters, sendCommandNoWait)
+	err, result = (&SendOfflineCommand{}).Execute(nil, parameters)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pollCount)
+	assert.Equal(t, "successfully submitted with command id: id", result)
+}
+
+func TestValidateSendCommandInputWithNoWait(t *testing.T) {
+	parameters := map[string][]string{
+		sendCommandContent: {"file:///tmp/document.json"},
+		sendCommandNoWait:  {},
+	}
+	assert.Empty(t, SendOfflineCommand{}.validateSendCommandInput(nil, parameters))
+
+	parameters[sendCommandNoWait] = []string{"true"}
+	validation := SendOfflineCommand{}.validateSendCommandInput(nil, parameters)
+	assert.Equal(t, 1, len(validation))
+	assert.Equal(t, validationTooManyValues, validation[0].Code)
+}
+
+func TestSubmitCommandDocumentWritesLFWithoutBOM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sendcommand")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	localCommandRoot = dir
+	defer func() { localCommandRoot = appconfig.LocalCommandRoot }()
+
+	err, documentName := SendOfflineCommand{}.submitCommandDocument("\xef\xbb\xbf{\r\n  \"schemaVersion\": \"2.2\",\r  \"description\": \"line\\r\\nbreak\"\r\n}")
+
+	assert.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, documentName))
+	assert.NoError(t, err)
+	assert.False(t, bytes.HasPrefix(data, []byte("\xef\xbb\xbf")))
+	assert.False(t, bytes.Contains(data, []byte("\r")))
+	assert.Equal(t, "{\n  \"schemaVersion\": \"2.2\",\n  \"description\": \"line\\r\\nbreak\"\n}", string(data))
+	var content contracts.DocumentContent
+	assert.NoError(t, json.Unmarshal(data, &content))
+	assert.Equal(t, "line\r\nbreak", content.Description)
+}
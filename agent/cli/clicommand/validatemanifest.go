@@ -0,0 +1,154 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/aws/amazon-ssm-agent/agent/cli/cliutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/plugins/updatessmagent"
+)
+
+const (
+	validateManifestCommand  = "validate-manifest"
+	validateManifestManifest = "manifest"
+)
+
+const validateManifestCommandHelp = `NAME:
+    {{.ValidateManifestCommandName}}
+
+DESCRIPTION
+SYNOPSIS
+    {{.ValidateManifestCommandName}}
+    {{.ManifestFlag}}
+
+PARAMETERS
+    {{.ManifestFlag}} (string) Path or URL of the agent update manifest.
+    The manifest is checked for structural errors, missing checksums, invalid or duplicated version
+    entries and file names no instance looks up.
+
+EXAMPLES
+    This example validates a local manifest before it is published.
+
+    Command:
+
+      {{.SsmCliName}} {{.ValidateManifestCommandName}} {{.ManifestFlag}} file:///tmp/ssm-agent-manifest.json
+
+    Output:
+
+      file amazon-ssm-agent-linux-amd64.tar.gz version 3.0.100.0 has no checksum
+
+OUTPUT
+    Success message or the list of problems found in the manifest
+`
+
+type validateManifestHelpParams struct {
+	SsmCliName                  string
+	ValidateManifestCommandName string
+	ManifestFlag                string
+}
+
+func init() {
+	cliutil.Register(&ValidateManifestCommand{})
+}
+
+// ValidateManifestCommand checks an agent update manifest for the problems that would make updates fail
+type ValidateManifestCommand struct {
+	helpText string
+}
+
+// Execute validates and executes the validate-manifest cli command
+func (c *ValidateManifestCommand) Execute(subcommands []string, parameters map[string][]string) (error, string) {
+	validation := c.validateValidateManifestCommandInput(subcommands, parameters)
+	// return validation errors if any were found
+	if len(validation) > 0 {
+		return errors.New(strings.Join(validation, "\n")), ""
+	}
+
+	source := parameters[validateManifestManifest][0]
+	manifestPath, err := loadManifestFile(source)
+	if err != nil {
+		return fmt.Errorf("failed to load manifest %v, %v", source, err), ""
+	}
+	manifest, err := updatessmagent.LoadManifest(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest %v, %v", source, err), ""
+	}
+	if problems := manifest.Problems(); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n")), ""
+	}
+	return nil, fmt.Sprintf("Manifest %v is valid", source)
+}
+
+// Help prints help for the validate-manifest cli command
+func (c *ValidateManifestCommand) Help() string {
+	if len(c.helpText) == 0 {
+		t, _ := template.New("ValidateManifestCommandHelp").Parse(validateManifestCommandHelp)
+		params := validateManifestHelpParams{cliutil.SsmCliName, validateManifestCommand, cliutil.FormatFlag(validateManifestManifest)}
+		buf := new(bytes.Buffer)
+		t.Execute(buf, params)
+		c.helpText = buf.String()
+	}
+	return c.helpText
+}
+
+// Name is the command name used in the cli
+func (ValidateManifestCommand) Name() string {
+	return validateManifestCommand
+}
+
+// validateValidateManifestCommandInput checks the subcommands and parameters for required values, format, and unsupported values
+func (ValidateManifestCommand) validateValidateManifestCommandInput(subcommands []string, parameters map[string][]string) []string {
+	validation := make([]string, 0)
+	if subcommands != nil && len(subcommands) > 0 {
+		validation = append(validation, fmt.Sprintf("%v does not support subcommand %v", validateManifestCommand, subcommands), "")
+		return validation // invalid subcommand is an attempt to execute something that really isn't this command, so the rest of the validation is skipped in this case
+	}
+
+	if values, exists := parameters[validateManifestManifest]; !exists {
+		validation = append(validation, fmt.Sprintf("%v is required", cliutil.FormatFlag(validateManifestManifest)))
+	} else if len(values) != 1 {
+		validation = append(validation, fmt.Sprintf("expected 1 value for parameter %v", cliutil.FormatFlag(validateManifestManifest)))
+	}
+
+	for key := range parameters {
+		if key != validateManifestManifest {
+			validation = append(validation, fmt.Sprintf("unknown parameter %v", cliutil.FormatFlag(key)))
+		}
+	}
+	return validation
+}
+
+// loadManifestFile returns the local path of the manifest, URLs are downloaded while file:// URLs and paths are used as is
+func loadManifestFile(source string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(source), "file://") {
+		return source[7:], nil
+	}
+	if !strings.Contains(source, "://") {
+		return source, nil
+	}
+
+	output, err := downloadContent(log.NewMockLog(), artifact.DownloadInput{SourceURL: source})
+	if err != nil {
+		return "", err
+	}
+	return output.LocalFilePath, nil
+}
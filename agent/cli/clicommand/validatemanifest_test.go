@@ -0,0 +1,151 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package clicommand contains the implementation of all commands for the ssm agent cli
+package clicommand
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const validManifest = `{
+	"SchemaVersion": "1.0",
+	"UriFormat": "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{Version}/{FileName}",
+	"Packages": [{
+		"Name": "amazon-ssm-agent",
+		"Files": [{
+			"Name": "amazon-ssm-agent-linux-amd64.tar.gz",
+			"AvailableVersions": [
+				{"Version": "3.0.100.0", "Checksum": "3c95870b46ad5e35c35b008a98d169cea73d85c1f6f4b6602e9173905b67db93"},
+				{"Version": "3.0.200.0-beta", "Checksum": "3c95870b46ad5e35c35b008a98d169cea73d85c1f6f4b6602e9173905b67db93"}
+			]
+		}]
+	}]
+}`
+
+func writeManifest(t *testing.T, content string) (manifestPath string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.NoError(t, err)
+	manifestPath = filepath.Join(dir, "ssm-agent-manifest.json")
+	assert.NoError(t, ioutil.WriteFile(manifestPath, []byte(content), 0600))
+	return manifestPath, func() { os.RemoveAll(dir) }
+}
+
+func TestValidateManifestValid(t *testing.T) {
+	manifestPath, cleanup := writeManifest(t, validManifest)
+	defer cleanup()
+
+	for _, source := range []string{manifestPath, "file://" + manifestPath} {
+		err, output := (&ValidateManifestCommand{}).Execute(nil, map[string][]string{validateManifestManifest: {source}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Manifest "+source+" is valid", output)
+	}
+}
+
+func TestValidateManifestDownloadsURL(t *testing.T) {
+	manifestPath, cleanup := writeManifest(t, validManifest)
+	defer cleanup()
+	var input artifact.DownloadInput
+	downloadContent = func(log log.T, downloadInput artifact.DownloadInput) (artifact.DownloadOutput, error) {
+		input = downloadInput
+		return artifact.DownloadOutput{LocalFilePath: manifestPath}, nil
+	}
+	defer func() { downloadContent = artifact.Download }()
+
+	source := "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/ssm-agent-manifest.json"
+	err, _ := (&ValidateManifestCommand{}).Execute(nil, map[string][]string{validateManifestManifest: {source}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, source, input.SourceURL)
+}
+
+func TestValidateManifestInvalid(t *testing.T) {
+	testCases := []struct {
+		manifest string
+		problems []string
+	}{
+		{
+			`{"SchemaVersion": "1.0", "Packages": []}`,
+			[]string{"UriFormat is missing", "no packages are declared"},
+		},
+		{
+			`{"UriFormat": "{FileName}", "Packages": [{"Name": "amazon-ssm-agent", "Files": [{
+				"Name": "amazon-ssm-agent-linux-amd64.tar.gz",
+				"AvailableVersions": [{"Version": "3.0.100.0"}, {"Version": "3.0.100.0", "Checksum": "abc"}]
+			}]}]}`,
+			[]string{
+				"file amazon-ssm-agent-linux-amd64.tar.gz version 3.0.100.0 has no checksum",
+				"file amazon-ssm-agent-linux-amd64.tar.gz declares version 3.0.100.0 more than once",
+			},
+		},
+		{
+			`{"UriFormat": "{FileName}", "Packages": [{"Name": "amazon-ssm-agent", "Files": [{
+				"Name": "ssm-agent-linux.rpm",
+				"AvailableVersions": [{"Version": "latest", "Checksum": "abc"}]
+			}]}]}`,
+			[]string{
+				"file ssm-agent-linux.rpm of package amazon-ssm-agent does not match the amazon-ssm-agent-<platform>-<arch>.<format> name instances look up",
+				`file ssm-agent-linux.rpm has invalid version "latest"`,
+			},
+		},
+		{
+			`{"UriFormat": "{FileName}", "Packages": [{"Name": "amazon-ssm-agent"}, {"Name": "amazon-ssm-agent"}]}`,
+			[]string{
+				"package amazon-ssm-agent has no files",
+				"package amazon-ssm-agent is declared more than once",
+				"package amazon-ssm-agent has no files",
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		manifestPath, cleanup := writeManifest(t, test.manifest)
+
+		err, output := (&ValidateManifestCommand{}).Execute(nil, map[string][]string{validateManifestManifest: {manifestPath}})
+
+		assert.Error(t, err)
+		assert.Empty(t, output)
+		for _, problem := range test.problems {
+			assert.Contains(t, err.Error(), problem)
+		}
+		cleanup()
+	}
+}
+
+func TestValidateManifestMalformedJson(t *testing.T) {
+	manifestPath, cleanup := writeManifest(t, `{"Packages": [`)
+	defer cleanup()
+
+	err, _ := (&ValidateManifestCommand{}).Execute(nil, map[string][]string{validateManifestManifest: {manifestPath}})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse manifest")
+}
+
+func TestValidateManifestInput(t *testing.T) {
+	command := ValidateManifestCommand{}
+
+	assert.NotEmpty(t, command.validateValidateManifestCommandInput(nil, map[string][]string{}))
+	assert.NotEmpty(t, command.validateValidateManifestCommandInput([]string{"sub"}, map[string][]string{validateManifestManifest: {"a"}}))
+	assert.NotEmpty(t, command.validateValidateManifestCommandInput(nil, map[string][]string{validateManifestManifest: {"a", "b"}}))
+	assert.NotEmpty(t, command.validateValidateManifestCommandInput(nil, map[string][]string{validateManifestManifest: {"a"}, "output": {"json"}}))
+	assert.Empty(t, command.validateValidateManifestCommandInput(nil, map[string][]string{validateManifestManifest: {"a"}}))
+}
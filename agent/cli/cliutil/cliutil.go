@@ -43,9 +43,13 @@ type CliCommand interface {
 	Name() string
 }
 
+// repeatableFlags is the set of flags that can be specified more than once
+var repeatableFlags map[string]bool
+
 // init creates the map of commands - all imported commands will add themselves to the map
 func init() {
 	CliCommands = make(map[string]CliCommand)
+	repeatableFlags = make(map[string]bool)
 }
 
 // Register
@@ -53,6 +57,16 @@ func Register(command CliCommand) {
 	CliCommands[command.Name()] = command
 }
 
+// RegisterRepeatableFlag allows a flag to be specified more than once, the values of all occurrences are collected
+func RegisterRepeatableFlag(flagName string) {
+	repeatableFlags[strings.ToLower(flagName)] = true
+}
+
+// IsRepeatableFlag returns true if the flag can be specified more than once
+func IsRepeatableFlag(flagName string) bool {
+	return repeatableFlags[flagName]
+}
+
 // FormatFlag returns a parameter name formatted as a command line flag
 func FormatFlag(flagName string) string {
 	return fmt.Sprintf("%v%v", flagPrefix, flagName)
@@ -15,11 +15,14 @@
 package artifact
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"net/url"
@@ -34,6 +37,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/s3util"
 	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -44,82 +48,184 @@ type DownloadOutput struct {
 	LocalFilePath string
 	IsUpdated     bool
 	IsHashMatched bool
+	// resumed is set when the http download appended to a partial file of an earlier attempt
+	resumed bool
 }
 
+// partialFileSuffix is appended to the destination file of an http download while it is in progress
+const partialFileSuffix = ".partial"
+
 // DownloadInput specifies the input to file download operation
 type DownloadInput struct {
 	SourceURL            string
 	DestinationDirectory string
 	SourceChecksums      map[string]string
+	// Region overrides the region parsed from the S3 URL when set
+	Region string
+	// UseChecksumCache uses the hash cached for the unchanged file instead of hashing it again, the file is
+	// hashed by every verification when it is not set
+	UseChecksumCache bool
+	// Credentials sign the s3 downloads when set, the agent credentials are used when it is nil
+	Credentials *credentials.Credentials
+	// AdaptiveTimeout cancels an http download that does not complete within a deadline extended from the measured
+	// download speed, http downloads have no overall deadline when it is not set
+	AdaptiveTimeout bool
 }
 
-// httpDownload attempts to download a file via http/s call
-func httpDownload(log log.T, fileURL string, destFile string) (output DownloadOutput, err error) {
+// httpDownload attempts to download a file via http/s call, the content is written to a partial file first
+// so a download interrupted by a flaky link is resumed with a Range request when the server supports it and
+// the eTag of the partial file was recorded.
+// The download is canceled when adaptiveTimeout is set and it exceeds the deadline adapted to the measured speed.
+func httpDownload(log log.T, fileURL string, destFile string, adaptiveTimeout bool) (output DownloadOutput, err error) {
 	log.Debugf("attempting to download as http/https download %v", destFile)
 	eTagFile := destFile + ".etag"
+	partialFile := destFile + partialFileSuffix
+	partialETagFile := partialFile + ".etag"
 	var check http.Client
 	var request *http.Request
 	request, err = http.NewRequest("GET", fileURL, nil)
 	if err != nil {
 		return
 	}
-	if fileutil.Exists(destFile) == true && fileutil.Exists(eTagFile) == true {
+	var offset int64
+	if info, statErr := os.Stat(partialFile); statErr == nil && info.Size() > 0 {
+		// without the eTag of the partial file If-Range cannot make the server send the whole file when it
+		// changed since the earlier attempt, the partial file is resumed only when its eTag was recorded
+		if partialETag, readErr := fileutil.ReadAllText(partialETagFile); readErr == nil && partialETag != "" {
+			offset = info.Size()
+			log.Debugf("resuming download of %v from byte %v", destFile, offset)
+			request.Header.Add("Range", fmt.Sprintf("bytes=%v-", offset))
+			request.Header.Add("If-Range", partialETag)
+		} else {
+			log.Debugf("partial file %v has no eTag, downloading the whole file", partialFile)
+			deletePartialFile(partialFile)
+		}
+	}
+	if offset == 0 && fileutil.Exists(destFile) == true && fileutil.Exists(eTagFile) == true {
 		var existingETag string
 		existingETag, err = fileutil.ReadAllText(eTagFile)
 		request.Header.Add("If-None-Match", existingETag)
 	}
 
+	var transport *http.Transport
+	if transport, err = newDownloadTransport(log); err != nil {
+		return
+	}
 	check = http.Client{
 		CheckRedirect: func(r *http.Request, via []*http.Request) error {
 			r.URL.Opaque = r.URL.Path
 			return nil
 		},
 	}
+	if transport != nil {
+		check.Transport = transport
+	}
+
+	var deadline *downloadDeadline
+	if adaptiveTimeout {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		deadline = newDownloadDeadline(cancel, downloadTimeout, maxDownloadTimeout)
+		defer deadline.stop()
+		request = request.WithContext(ctx)
+	}
 
 	var resp *http.Response
 	resp, err = check.Do(request)
 	if err != nil {
+		err = deadline.timeoutError(err)
+		// the partial file is kept so the next attempt resumes the download
 		log.Debug("failed to download from http/https, ", err)
 		fileutil.DeleteFile(destFile)
 		fileutil.DeleteFile(eTagFile)
 		return
 	}
+	defer resp.Body.Close()
 
+	resumed := false
 	if resp.StatusCode == http.StatusNotModified {
 		log.Debugf("Unchanged file.")
 		output.IsUpdated = false
 		output.LocalFilePath = destFile
 		return output, nil
+	} else if resp.StatusCode == http.StatusPartialContent && offset > 0 {
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %v-", offset)) {
+			deletePartialFile(partialFile)
+			err = fmt.Errorf("http request failed. unexpected content range %v for resumed download from byte %v", resp.Header.Get("Content-Range"), offset)
+			return
+		}
+		resumed = true
+	} else if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		log.Debugf("range of partial file %v is not satisfiable, downloading the whole file", partialFile)
+		deletePartialFile(partialFile)
+		return httpDownload(log, fileURL, destFile, adaptiveTimeout)
 	} else if resp.StatusCode != http.StatusOK {
 		log.Debug("failed to download from http/https, ", err)
 		fileutil.DeleteFile(destFile)
 		fileutil.DeleteFile(eTagFile)
-		err = fmt.Errorf("http request failed. status:%v statuscode:%v", resp.Status, resp.StatusCode)
+		deletePartialFile(partialFile)
+		err = &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 		return
+	} else if offset > 0 {
+		log.Debugf("server ignored the range of partial file %v, downloading the whole file", partialFile)
 	}
-	defer resp.Body.Close()
+
 	eTagValue := resp.Header.Get("Etag")
 	if eTagValue != "" {
 		log.Debug("file eTagValue is ", eTagValue)
-		err = fileutil.WriteAllText(eTagFile, eTagValue)
-		if err != nil {
-			log.Errorf("failed to write eTagfile %v, %v ", eTagFile, err)
+		if err = fileutil.WriteAllText(partialETagFile, eTagValue); err != nil {
+			log.Errorf("failed to write eTagfile %v, %v ", partialETagFile, err)
 			return
 		}
+	} else {
+		fileutil.DeleteFile(partialETagFile)
 	}
-	_, err = FileCopy(log, destFile, resp.Body)
-	if err == nil {
-		output.LocalFilePath = destFile
-		output.IsUpdated = true
+
+	var body io.Reader = resp.Body
+	if deadline != nil {
+		body = newThroughputReader(log, resp.Body, resp.ContentLength, deadline)
+	}
+	if resumed {
+		_, err = fileAppend(log, partialFile, body)
 	} else {
-		log.Errorf("failed to write destFile %v, %v ", destFile, err)
+		_, err = FileCopy(log, partialFile, body)
+	}
+	if err != nil {
+		err = deadline.timeoutError(err)
+		log.Errorf("failed to write destFile %v, %v ", partialFile, err)
+		return
+	}
+
+	fileutil.DeleteFile(eTagFile)
+	if err = os.Rename(partialFile, destFile); err != nil {
+		log.Errorf("failed to move %v to destFile %v, %v ", partialFile, destFile, err)
+		return
+	}
+	if eTagValue != "" {
+		if err = os.Rename(partialETagFile, eTagFile); err != nil {
+			log.Errorf("failed to write eTagfile %v, %v ", eTagFile, err)
+			return
+		}
 	}
+	output.LocalFilePath = destFile
+	output.IsUpdated = true
+	output.resumed = resumed
 	return
 }
 
-// awsConfig creates a config and sets region and credential information given an S3 URL
+// deletePartialFile deletes the partial file of an http download and its eTag file
+func deletePartialFile(partialFile string) {
+	fileutil.DeleteFile(partialFile)
+	fileutil.DeleteFile(partialFile + ".etag")
+}
+
+// agentAwsConfig returns the config with the agent credentials
+var agentAwsConfig = sdkutil.AwsConfig
+
+// awsConfig creates a config and sets region and credential information given an S3 URL, an error is returned when
+// the download transport cannot be created
 func awsConfig(log log.T, amazonS3URL s3util.AmazonS3URL) (config *aws.Config, err error) {
-	config = sdkutil.AwsConfig()
+	config = agentAwsConfig()
 	var appConfig appconfig.SsmagentConfig
 	appConfig, errConfig := appconfig.Config(false)
 	if errConfig != nil {
@@ -137,6 +243,14 @@ func awsConfig(log log.T, amazonS3URL s3util.AmazonS3URL) (config *aws.Config, e
 			}
 		}
 	}
+	// the http client of the sdk is replaced only to trust the CA bundle configured in appconfig
+	transport, err := newDownloadTransport(log)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		config.HTTPClient = &http.Client{Transport: transport}
+	}
 	config.S3ForcePathStyle = aws.Bool(amazonS3URL.IsPathStyle)
 	config.Region = aws.String(amazonS3URL.Region)
 	return config, nil
@@ -144,7 +258,11 @@ func awsConfig(log log.T, amazonS3URL s3util.AmazonS3URL) (config *aws.Config, e
 
 // CanGetS3Object returns true if it is possible to fetch an object because it exists, is not deleted, and read permissions exist for this request
 func CanGetS3Object(log log.T, amazonS3URL s3util.AmazonS3URL) bool {
-	config, _ := awsConfig(log, amazonS3URL)
+	config, err := awsConfig(log, amazonS3URL)
+	if err != nil {
+		log.Debugf("CanGetS3Object err: %v", err)
+		return false
+	}
 	bucketName := amazonS3URL.Bucket
 	objectKey := amazonS3URL.Key
 
@@ -159,7 +277,6 @@ func CanGetS3Object(log log.T, amazonS3URL s3util.AmazonS3URL) bool {
 
 	s3client := s3.New(sess)
 	var res *s3.HeadObjectOutput
-	var err error
 	if res, err = s3client.HeadObject(params); err != nil {
 		log.Debugf("CanGetS3Object err: %v", err)
 		return false
@@ -171,7 +288,10 @@ func CanGetS3Object(log log.T, amazonS3URL s3util.AmazonS3URL) bool {
 // ListS3Folders returns the folders under a given S3 URL where folders are keys whose prefix is the URL key
 // and contain a / after the prefix.  The folder name is the part between the prefix and the /.
 func ListS3Folders(log log.T, amazonS3URL s3util.AmazonS3URL) (folderNames []string, err error) {
-	config, _ := awsConfig(log, amazonS3URL)
+	config, err := awsConfig(log, amazonS3URL)
+	if err != nil {
+		return nil, err
+	}
 	prefix := amazonS3URL.Key
 	if !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
@@ -205,7 +325,10 @@ func ListS3Folders(log log.T, amazonS3URL s3util.AmazonS3URL) (folderNames []str
 // ListS3Directory returns all the objects (files and folders) under a given S3 URL where folders are keys whose prefix
 // is the URL key and contain a / after the prefix.
 func ListS3Directory(log log.T, amazonS3URL s3util.AmazonS3URL) (folderNames []string, err error) {
-	config, _ := awsConfig(log, amazonS3URL)
+	config, err := awsConfig(log, amazonS3URL)
+	if err != nil {
+		return nil, err
+	}
 	var params *s3.ListObjectsInput
 	prefix := amazonS3URL.Key
 	if prefix != "" {
@@ -244,11 +367,14 @@ func ListS3Directory(log log.T, amazonS3URL s3util.AmazonS3URL) (folderNames []s
 }
 
 // s3Download attempts to download a file via the aws sdk.
-func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (output DownloadOutput, err error) {
+func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string, creds *credentials.Credentials) (output DownloadOutput, err error) {
 	log.Debugf("attempting to download as s3 download %v", destFile)
 	eTagFile := destFile + ".etag"
 
-	config, _ := awsConfig(log, amazonS3URL)
+	var config *aws.Config
+	if config, err = s3DownloadConfig(log, amazonS3URL, creds); err != nil {
+		return
+	}
 	params := &s3.GetObjectInput{
 		Bucket: aws.String(amazonS3URL.Bucket),
 		Key:    aws.String(amazonS3URL.Key),
@@ -305,6 +431,18 @@ func s3Download(log log.T, amazonS3URL s3util.AmazonS3URL, destFile string) (out
 	return
 }
 
+// s3DownloadConfig creates the config of an s3 download, the credentials replace the agent credentials when set
+func s3DownloadConfig(log log.T, amazonS3URL s3util.AmazonS3URL, creds *credentials.Credentials) (*aws.Config, error) {
+	config, err := awsConfig(log, amazonS3URL)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		config.Credentials = creds
+	}
+	return config, nil
+}
+
 // FileCopy copies the content from reader to destinationPath file
 func FileCopy(log log.T, destinationPath string, src io.Reader) (written int64, err error) {
 
@@ -321,6 +459,20 @@ func FileCopy(log log.T, destinationPath string, src io.Reader) (written int64,
 	return
 }
 
+// fileAppend appends the content from reader to the destinationPath file
+func fileAppend(log log.T, destinationPath string, src io.Reader) (written int64, err error) {
+	var file *os.File
+	file, err = os.OpenFile(destinationPath, os.O_WRONLY|os.O_APPEND, appconfig.ReadWriteAccess)
+	if err != nil {
+		log.Errorf("failed to open file. %v", err)
+		return
+	}
+	defer file.Close()
+	written, err = io.Copy(file, src)
+	log.Infof("%s with %v bytes appended", destinationPath, written)
+	return
+}
+
 // Download is a generic utility which attempts to download smartly.
 func Download(log log.T, input DownloadInput) (output DownloadOutput, err error) {
 	// parse the url
@@ -366,24 +518,40 @@ func Download(log log.T, input DownloadInput) (output DownloadOutput, err error)
 		output.LocalFilePath = filepath.Join(destinationDir, fmt.Sprintf("%x", urlHash))
 
 		amazonS3URL := s3util.ParseAmazonS3URL(log, fileURL)
+		if input.Region != "" {
+			amazonS3URL.Region = input.Region
+		}
 		if amazonS3URL.IsBucketAndKeyPresent() {
 			// source is s3
 			var tempOutput DownloadOutput
-			tempOutput, err = s3Download(log, amazonS3URL, output.LocalFilePath)
+			tempOutput, err = s3Download(log, amazonS3URL, output.LocalFilePath, input.Credentials)
 			// if s3 download fails, attempt http/https download as fallback
 			if err != nil {
-				tempOutput, err = httpDownload(log, input.SourceURL, output.LocalFilePath)
+				tempOutput, err = httpDownload(log, input.SourceURL, output.LocalFilePath, input.AdaptiveTimeout)
 			}
 			output = tempOutput
 		} else {
 			// simple http/https download
-			output, err = httpDownload(log, input.SourceURL, output.LocalFilePath)
+			output, err = httpDownload(log, input.SourceURL, output.LocalFilePath, input.AdaptiveTimeout)
 		}
 
 		if err != nil {
 			return
 		}
 
+		// a resumed download is concatenated from several responses, download the whole file again
+		// when the result does not match the checksum
+		if output.resumed {
+			if matched, _ := VerifyHash(log, input, output); !matched {
+				log.Warnf("resumed download of %v does not match the checksum, downloading the whole file", input.SourceURL)
+				fileutil.DeleteFile(output.LocalFilePath)
+				fileutil.DeleteFile(output.LocalFilePath + ".etag")
+				if output, err = httpDownload(log, input.SourceURL, output.LocalFilePath, input.AdaptiveTimeout); err != nil {
+					return
+				}
+			}
+		}
+
 		isLocalFile, err = fileutil.LocalFileExist(output.LocalFilePath)
 		if isLocalFile == true {
 			output.IsHashMatched, err = VerifyHash(log, input, output)
@@ -393,6 +561,14 @@ func Download(log log.T, input DownloadInput) (output DownloadOutput, err error)
 	return
 }
 
+// hashers maps the supported hash algorithm names to their hash constructor, md5 is discouraged
+// but is still published by some mirrors
+var hashers = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"md5":    md5.New,
+}
+
 // VerifyHash verifies the hash of the url file as per specified hash algorithm type and its value
 func VerifyHash(log log.T, input DownloadInput, output DownloadOutput) (bool, error) {
 	hasMatchingHash := false
@@ -415,23 +591,22 @@ func VerifyHash(log log.T, input DownloadInput, output DownloadOutput) (bool, er
 	}
 
 	for hashAlgorithm, hashValue := range checksums {
-		var computedHashValue string
-		var err error
 		// check the sha256 algorithm by default
-		if hashAlgorithm == "" || strings.EqualFold(hashAlgorithm, "sha256") {
-			computedHashValue, err = Sha256HashValue(log, output.LocalFilePath)
-		} else if strings.EqualFold(hashAlgorithm, "md5") {
-			computedHashValue, err = Md5HashValue(log, output.LocalFilePath)
-		} else {
-			continue
+		if hashAlgorithm == "" {
+			hashAlgorithm = "sha256"
+		}
+		newHasher, ok := hashers[strings.ToLower(hashAlgorithm)]
+		if !ok {
+			return false, fmt.Errorf("unsupported hash algorithm %v for downloadinput %v", hashAlgorithm, input)
 		}
 
+		computedHashValue, err := cachedHashValue(log, output.LocalFilePath, strings.ToLower(hashAlgorithm), newHasher, input.UseChecksumCache)
 		if err != nil {
 			return false, fmt.Errorf("the algorithm returned an error when trying to compute the checksum %v", input)
 		}
 
 		if !strings.EqualFold(hashValue, computedHashValue) {
-			return false, fmt.Errorf("failed to verify hash of downloadinput %v", input)
+			return false, &checksumMismatchError{message: fmt.Sprintf("failed to verify hash of downloadinput %v", input)}
 		}
 
 		hasMatchingHash = true
@@ -447,29 +622,21 @@ func VerifyHash(log log.T, input DownloadInput, output DownloadOutput) (bool, er
 
 // Sha256HashValue gets the sha256 hash value
 func Sha256HashValue(log log.T, filePath string) (hash string, err error) {
-	var exists = false
-	exists, err = fileutil.LocalFileExist(filePath)
-	if err != nil || exists == false {
-		return
-	}
+	return computeHashValue(log, filePath, sha256.New())
+}
 
-	var f *os.File
-	f, err = os.Open(filePath)
-	if err != nil {
-		log.Error(err)
-	}
-	defer f.Close()
-	hasher := sha256.New()
-	if _, err = io.Copy(hasher, f); err != nil {
-		log.Error(err)
-	}
-	hash = hex.EncodeToString(hasher.Sum(nil))
-	log.Debugf("Hash=%v, FilePath=%v", hash, filePath)
-	return
+// Sha512HashValue gets the sha512 hash value
+func Sha512HashValue(log log.T, filePath string) (hash string, err error) {
+	return computeHashValue(log, filePath, sha512.New())
 }
 
 // Md5HashValue gets the md5 hash value
 func Md5HashValue(log log.T, filePath string) (hash string, err error) {
+	return computeHashValue(log, filePath, md5.New())
+}
+
+// computeHashValue gets the hash value of the file computed by the hasher
+func computeHashValue(log log.T, filePath string, hasher hash.Hash) (hash string, err error) {
 	var exists = false
 	exists, err = fileutil.LocalFileExist(filePath)
 	if err != nil || exists == false {
@@ -482,7 +649,6 @@ func Md5HashValue(log log.T, filePath string) (hash string, err error) {
 		log.Error(err)
 	}
 	defer f.Close()
-	hasher := md5.New()
 	if _, err = io.Copy(hasher, f); err != nil {
 		log.Error(err)
 	}
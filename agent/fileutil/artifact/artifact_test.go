@@ -0,0 +1,277 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/s3util"
+	"github.com/aws/amazon-ssm-agent/agent/sdkutil"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+var checkMyHashPath = filepath.Join("testdata", "CheckMyHash.txt")
+
+func TestVerifyHashSupportedAlgorithms(t *testing.T) {
+	checksums := map[string]string{
+		"":       "090c1965e46155b2b23ba9093ed7c67243957a397e3ad5531a693d57958a760a",
+		"sha256": "090c1965e46155b2b23ba9093ed7c67243957a397e3ad5531a693d57958a760a",
+		"SHA512": "1772bb8f8804d5f2173298683931470c883c3a5ddd2e91821b0d5ace7f335d8bba7049977be733c21669d22289a7863d7592d4a0d7b5786e5786c69fecd083e8",
+		"md5":    "e84913ff3a8eef39238b32170e657ba8",
+	}
+	output := DownloadOutput{LocalFilePath: checkMyHashPath}
+
+	for hashType, hashValue := range checksums {
+		input := DownloadInput{SourceChecksums: map[string]string{hashType: hashValue}}
+		matched, err := VerifyHash(log.NewMockLog(), input, output)
+		assert.NoError(t, err, hashType)
+		assert.True(t, matched, hashType)
+	}
+
+	input := DownloadInput{SourceChecksums: checksums}
+	matched, err := VerifyHash(log.NewMockLog(), input, output)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+}
+
+func TestVerifyHashMismatch(t *testing.T) {
+	output := DownloadOutput{LocalFilePath: checkMyHashPath}
+
+	for _, hashType := range []string{"sha256", "sha512", "md5"} {
+		input := DownloadInput{SourceChecksums: map[string]string{hashType: "0123456789abcdef"}}
+		matched, err := VerifyHash(log.NewMockLog(), input, output)
+		assert.Error(t, err, hashType)
+		assert.False(t, matched, hashType)
+	}
+}
+
+func TestVerifyHashUnsupportedAlgorithm(t *testing.T) {
+	output := DownloadOutput{LocalFilePath: checkMyHashPath}
+	input := DownloadInput{SourceChecksums: map[string]string{
+		"sha256": "090c1965e46155b2b23ba9093ed7c67243957a397e3ad5531a693d57958a760a",
+		"crc32":  "12345678",
+	}}
+
+	matched, err := VerifyHash(log.NewMockLog(), input, output)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported hash algorithm crc32")
+	assert.False(t, matched)
+}
+
+const resumeContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// startResumeServer serves resumeContent, Range requests are honored when rangeCapable is set and
+// the requested ranges are recorded
+func startResumeServer(rangeCapable bool, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		w.Header().Set("Etag", `"resume"`)
+		if rangeCapable {
+			http.ServeContent(w, r, "artifact.zip", time.Time{}, strings.NewReader(resumeContent))
+			return
+		}
+		w.Write([]byte(resumeContent))
+	}))
+}
+
+// writePartialDownload writes the first bytes of resumeContent to the partial file of the download of url
+func writePartialDownload(t *testing.T, dir string, url string) string {
+	destFile := filepath.Join(dir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+	assert.NoError(t, ioutil.WriteFile(destFile+partialFileSuffix, []byte(resumeContent[:10]), 0600))
+	assert.NoError(t, ioutil.WriteFile(destFile+partialFileSuffix+".etag", []byte(`"resume"`), 0600))
+	return destFile
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rangeCapable  bool
+		expectedRange string
+	}{
+		{"range capable", true, "bytes=10-"},
+		{"range incapable", false, "bytes=10-"},
+	}
+
+	for _, test := range testCases {
+		var ranges []string
+		server := startResumeServer(test.rangeCapable, &ranges)
+		dir, err := ioutil.TempDir("", "artifact")
+		assert.NoError(t, err)
+		url := server.URL + "/artifact.zip"
+		destFile := writePartialDownload(t, dir, url)
+
+		output, err := Download(log.NewMockLog(), DownloadInput{
+			SourceURL:            url,
+			DestinationDirectory: dir,
+			SourceChecksums:      map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))},
+		})
+
+		assert.NoError(t, err, test.name)
+		assert.True(t, output.IsHashMatched, test.name)
+		assert.Equal(t, test.rangeCapable, output.resumed, test.name)
+		assert.Equal(t, []string{test.expectedRange}, ranges, test.name)
+		content, err := ioutil.ReadFile(destFile)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, resumeContent, string(content), test.name)
+		_, err = os.Stat(destFile + partialFileSuffix)
+		assert.True(t, os.IsNotExist(err), test.name)
+
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDownloadRestartsPartialFileWithoutETag(t *testing.T) {
+	var ranges []string
+	server := startResumeServer(true, &ranges)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	url := server.URL + "/artifact.zip"
+	destFile := writePartialDownload(t, dir, url)
+	assert.NoError(t, os.Remove(destFile+partialFileSuffix+".etag"))
+
+	output, err := Download(log.NewMockLog(), DownloadInput{
+		SourceURL:            url,
+		DestinationDirectory: dir,
+		SourceChecksums:      map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, output.IsHashMatched)
+	assert.False(t, output.resumed)
+	assert.Equal(t, []string{""}, ranges)
+	content, err := ioutil.ReadFile(destFile)
+	assert.NoError(t, err)
+	assert.Equal(t, resumeContent, string(content))
+}
+
+func TestDownloadKeepsPartialFileOnInterruptedTransfer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%v", len(resumeContent)))
+		w.Write([]byte(resumeContent[:10]))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	destFile := filepath.Join(dir, "artifact.zip")
+
+	_, err = httpDownload(log.NewMockLog(), server.URL+"/artifact.zip", destFile, false)
+
+	assert.Error(t, err)
+	content, err := ioutil.ReadFile(destFile + partialFileSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, resumeContent[:10], string(content))
+	assert.False(t, fileExists(destFile))
+}
+
+func TestDownloadRetriesResumedFileWithChecksumMismatch(t *testing.T) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			// a range response with content that does not continue the partial file
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%v/%v", len(resumeContent)-1, len(resumeContent)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(bytes.ToUpper([]byte(resumeContent[10:])))
+			return
+		}
+		w.Write([]byte(resumeContent))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	url := server.URL + "/artifact.zip"
+	destFile := writePartialDownload(t, dir, url)
+
+	output, err := Download(log.NewMockLog(), DownloadInput{
+		SourceURL:            url,
+		DestinationDirectory: dir,
+		SourceChecksums:      map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, output.IsHashMatched)
+	assert.Equal(t, []string{"bytes=10-", ""}, ranges)
+	content, err := ioutil.ReadFile(destFile)
+	assert.NoError(t, err)
+	assert.Equal(t, resumeContent, string(content))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestS3DownloadConfigUsesInjectedCredentials(t *testing.T) {
+	defer func() { agentAwsConfig = sdkutil.AwsConfig }()
+	agentCredentials := credentials.NewStaticCredentials("AGENTKEY", "agentsecret", "")
+	agentAwsConfig = func() *aws.Config { return &aws.Config{Credentials: agentCredentials} }
+
+	injected := credentials.NewStaticCredentials("ACTIVATIONKEY", "activationsecret", "")
+	amazonS3URL := s3util.AmazonS3URL{Bucket: "bucket", Key: "key", Region: "us-east-1"}
+	config, err := s3DownloadConfig(log.NewMockLog(), amazonS3URL, injected)
+	assert.NoError(t, err)
+
+	assert.Equal(t, injected, config.Credentials)
+	value, err := config.Credentials.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ACTIVATIONKEY", value.AccessKeyID)
+	assert.Equal(t, "us-east-1", aws.StringValue(config.Region))
+}
+
+func TestS3DownloadConfigDefaultsToAgentCredentials(t *testing.T) {
+	defer func() { agentAwsConfig = sdkutil.AwsConfig }()
+	agentCredentials := credentials.NewStaticCredentials("AGENTKEY", "agentsecret", "")
+	agentAwsConfig = func() *aws.Config { return &aws.Config{Credentials: agentCredentials} }
+
+	amazonS3URL := s3util.AmazonS3URL{Bucket: "bucket", Key: "key", Region: "us-east-1"}
+	config, err := s3DownloadConfig(log.NewMockLog(), amazonS3URL, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, agentCredentials, config.Credentials)
+}
+
+func TestS3DownloadConfigKeepsHTTPClientWithoutCABundle(t *testing.T) {
+	defer func() { agentAwsConfig = sdkutil.AwsConfig }()
+	agentHTTPClient := &http.Client{}
+	agentAwsConfig = func() *aws.Config { return &aws.Config{HTTPClient: agentHTTPClient} }
+	defer func() { loadAppConfig = appconfig.Config }()
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return appconfig.DefaultConfig(), nil }
+
+	amazonS3URL := s3util.AmazonS3URL{Bucket: "bucket", Key: "key", Region: "us-east-1"}
+	config, err := s3DownloadConfig(log.NewMockLog(), amazonS3URL, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, agentHTTPClient, config.HTTPClient)
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"hash"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// checksumCacheSize represents the number of hashes kept before the cache is cleared
+	checksumCacheSize = 64
+)
+
+var computeHash = computeHashValue
+
+// checksumCacheKey identifies a hash of a file, any change of the size or the modification time of the file
+// results in a different key so a changed file is hashed again
+type checksumCacheKey struct {
+	path      string
+	algorithm string
+	size      int64
+	modTime   time.Time
+}
+
+// checksumCache holds the hashes computed by VerifyHash so retries of unchanged large artifacts are not hashed again
+var checksumCache = struct {
+	sync.Mutex
+	hashes map[checksumCacheKey]string
+}{hashes: make(map[checksumCacheKey]string)}
+
+// cachedHashValue returns the hash of the file, the file is hashed unless useCache is set. With useCache the cached
+// hash is returned when the file is unchanged and the computed hash is cached.
+func cachedHashValue(log log.T, filePath string, algorithm string, newHasher func() hash.Hash, useCache bool) (string, error) {
+	if !useCache {
+		return computeHash(log, filePath, newHasher())
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return computeHash(log, filePath, newHasher())
+	}
+	key := checksumCacheKey{path: filePath, algorithm: algorithm, size: info.Size(), modTime: info.ModTime()}
+
+	checksumCache.Lock()
+	cached, found := checksumCache.hashes[key]
+	checksumCache.Unlock()
+	if found {
+		log.Debugf("Hash=%v, FilePath=%v (cached)", cached, filePath)
+		return cached, nil
+	}
+
+	computed, err := computeHash(log, filePath, newHasher())
+	if err != nil || computed == "" {
+		return computed, err
+	}
+
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	if len(checksumCache.hashes) >= checksumCacheSize {
+		checksumCache.hashes = make(map[checksumCacheKey]string)
+	}
+	checksumCache.hashes[key] = computed
+	return computed, nil
+}
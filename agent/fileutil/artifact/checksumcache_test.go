@@ -0,0 +1,123 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// countHashes counts the files hashed by VerifyHash and returns a func restoring computeHash
+func countHashes(count *int) (restore func()) {
+	computeHash = func(log log.T, filePath string, hasher hash.Hash) (string, error) {
+		*count++
+		return computeHashValue(log, filePath, hasher)
+	}
+	return func() { computeHash = computeHashValue }
+}
+
+func TestVerifyHashUsesCacheForUnchangedFile(t *testing.T) {
+	hashes := 0
+	defer countHashes(&hashes)()
+	dir, err := ioutil.TempDir("", "checksumcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "artifact")
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(resumeContent), 0644))
+	input := DownloadInput{
+		SourceChecksums:  map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))},
+		UseChecksumCache: true,
+	}
+	output := DownloadOutput{LocalFilePath: filePath}
+
+	for i := 0; i < 3; i++ {
+		matched, err := VerifyHash(log.NewMockLog(), input, output)
+		assert.NoError(t, err)
+		assert.True(t, matched)
+	}
+	assert.Equal(t, 1, hashes)
+
+	// the hash is computed again when the cache is not used
+	input.UseChecksumCache = false
+	matched, err := VerifyHash(log.NewMockLog(), input, output)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	assert.Equal(t, 2, hashes)
+}
+
+func TestVerifyHashRehashesByDefault(t *testing.T) {
+	hashes := 0
+	defer countHashes(&hashes)()
+	dir, err := ioutil.TempDir("", "checksumcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "artifact")
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(resumeContent), 0644))
+	input := DownloadInput{SourceChecksums: map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))}}
+	output := DownloadOutput{LocalFilePath: filePath}
+
+	for i := 0; i < 3; i++ {
+		matched, err := VerifyHash(log.NewMockLog(), input, output)
+		assert.NoError(t, err)
+		assert.True(t, matched)
+	}
+	assert.Equal(t, 3, hashes)
+}
+
+func TestVerifyHashRehashesChangedFile(t *testing.T) {
+	hashes := 0
+	defer countHashes(&hashes)()
+	dir, err := ioutil.TempDir("", "checksumcache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "artifact")
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(resumeContent), 0644))
+	input := DownloadInput{
+		SourceChecksums:  map[string]string{"sha256": fmt.Sprintf("%x", sha256.Sum256([]byte(resumeContent)))},
+		UseChecksumCache: true,
+	}
+	output := DownloadOutput{LocalFilePath: filePath}
+
+	matched, err := VerifyHash(log.NewMockLog(), input, output)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	// a different size invalidates the cached hash
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte(resumeContent+"tampered"), 0644))
+	matched, err = VerifyHash(log.NewMockLog(), input, output)
+	assert.Error(t, err)
+	assert.False(t, matched)
+	assert.Equal(t, 2, hashes)
+
+	// the same size with a different modification time invalidates the cached hash as well
+	tampered := []byte(resumeContent)
+	tampered[0] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(filePath, tampered, 0644))
+	modTime := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filePath, modTime, modTime))
+	matched, err = VerifyHash(log.NewMockLog(), input, output)
+	assert.Error(t, err)
+	assert.False(t, matched)
+	assert.Equal(t, 3, hashes)
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	// downloadAttempts represents the number of attempts of DownloadWithRetry
+	downloadAttempts = 3
+)
+
+// downloadRetryInterval represents the wait before the first retry, the wait doubles after each retry
+var downloadRetryInterval = 2 * time.Second
+
+var download = Download
+var downloadRetrySleep = time.Sleep
+
+// HTTPStatusError represents an http download that was answered with an unexpected status code
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error returns the message of the http status error
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http request failed. status:%v statuscode:%v", e.Status, e.StatusCode)
+}
+
+// checksumMismatchError represents a downloaded file that does not match the expected checksum
+type checksumMismatchError struct {
+	message string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return e.message
+}
+
+// DownloadWithRetry downloads the file with Download and retries the transient failures reported by
+// IsRetryableDownloadError, permanent failures are returned right away
+func DownloadWithRetry(log log.T, input DownloadInput) (output DownloadOutput, err error) {
+	retryInterval := downloadRetryInterval
+	for attempt := 1; ; attempt++ {
+		if output, err = download(log, input); err == nil {
+			return output, nil
+		}
+		if attempt == downloadAttempts || !IsRetryableDownloadError(err) {
+			return output, err
+		}
+		log.Warnf("download of %v failed with a transient error, retrying in %v, %v", input.SourceURL, retryInterval, err)
+		downloadRetrySleep(retryInterval)
+		retryInterval *= 2
+	}
+}
+
+// IsRetryableDownloadError returns true for the transient download failures, i.e. timeouts, interrupted or
+// refused connections and 5xx or 429 responses. Other http statuses, checksum mismatches and unknown errors
+// are permanent.
+func IsRetryableDownloadError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *HTTPStatusError:
+			return isRetryableStatusCode(e.StatusCode)
+		case *checksumMismatchError:
+			return false
+		case awserr.RequestFailure:
+			return isRetryableStatusCode(e.StatusCode())
+		case *url.Error:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ECONNRESET || e == syscall.ECONNREFUSED || e == syscall.ECONNABORTED || e == syscall.EPIPE
+		case net.Error:
+			return e.Timeout()
+		default:
+			return err == io.ErrUnexpectedEOF || err == io.EOF
+		}
+	}
+	return false
+}
+
+// DownloadStatusCode returns the http status code the failed download was answered with, 0 is returned when the
+// download failed before a response was received
+func DownloadStatusCode(err error) int {
+	switch e := err.(type) {
+	case *HTTPStatusError:
+		return e.StatusCode
+	case awserr.RequestFailure:
+		return e.StatusCode()
+	default:
+		return 0
+	}
+}
+
+func isRetryableStatusCode(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
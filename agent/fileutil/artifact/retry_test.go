@@ -0,0 +1,145 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableDownloadError(t *testing.T) {
+	connectionReset := &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "read", Net: "tcp",
+		Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}}
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"nil", nil, false},
+		{"timeout", &url.Error{Op: "Get", URL: "https://example.com", Err: timeoutError{}}, true},
+		{"dial timeout", &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}, true},
+		{"connection reset", connectionReset, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, true},
+		{"interrupted transfer", io.ErrUnexpectedEOF, true},
+		{"500", &HTTPStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"429", &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"403", &HTTPStatusError{StatusCode: http.StatusForbidden}, false},
+		{"404", &HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{"s3 503", awserr.NewRequestFailure(awserr.New("SlowDown", "slow down", nil), http.StatusServiceUnavailable, "id"), true},
+		{"s3 403", awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), http.StatusForbidden, "id"), false},
+		{"checksum mismatch", &checksumMismatchError{message: "failed to verify hash"}, false},
+		{"unknown", fmt.Errorf("url parsing failed"), false},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.retryable, IsRetryableDownloadError(test.err), test.name)
+	}
+}
+
+func TestDownloadStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, DownloadStatusCode(&HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}))
+	assert.Equal(t, http.StatusForbidden, DownloadStatusCode(awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), http.StatusForbidden, "id")))
+	assert.Equal(t, 0, DownloadStatusCode(fmt.Errorf("connection refused")))
+	assert.Equal(t, 0, DownloadStatusCode(nil))
+}
+
+func TestDownloadReturnsClassifiedErrors(t *testing.T) {
+	statusCode := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		w.Write([]byte(resumeContent))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	input := DownloadInput{SourceURL: server.URL + "/artifact.zip", DestinationDirectory: dir}
+
+	_, err = Download(log.NewMockLog(), input)
+	assert.Error(t, err)
+	assert.False(t, IsRetryableDownloadError(err))
+
+	statusCode = http.StatusBadGateway
+	_, err = Download(log.NewMockLog(), input)
+	assert.Error(t, err)
+	assert.True(t, IsRetryableDownloadError(err))
+
+	statusCode = http.StatusOK
+	input.SourceChecksums = map[string]string{"sha256": "0000"}
+	_, err = Download(log.NewMockLog(), input)
+	assert.Error(t, err)
+	assert.False(t, IsRetryableDownloadError(err))
+}
+
+func TestDownloadWithRetry(t *testing.T) {
+	defer func() {
+		download = Download
+		downloadRetrySleep = time.Sleep
+	}()
+	var sleeps []time.Duration
+	downloadRetrySleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	testCases := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int
+		expectError      bool
+	}{
+		{"succeeds", []error{nil}, 1, false},
+		{"transient then succeeds", []error{&HTTPStatusError{StatusCode: 503}, io.ErrUnexpectedEOF, nil}, 3, false},
+		{"permanent", []error{&HTTPStatusError{StatusCode: 404}, nil}, 1, true},
+		{"transient exhausted", []error{&HTTPStatusError{StatusCode: 500}, &HTTPStatusError{StatusCode: 500}, &HTTPStatusError{StatusCode: 500}, nil}, downloadAttempts, true},
+	}
+
+	for _, test := range testCases {
+		sleeps = nil
+		attempts := 0
+		errs := test.errs
+		download = func(log log.T, input DownloadInput) (DownloadOutput, error) {
+			err := errs[attempts]
+			attempts++
+			return DownloadOutput{LocalFilePath: "artifact"}, err
+		}
+
+		_, err := DownloadWithRetry(log.NewMockLog(), DownloadInput{SourceURL: "https://example.com/artifact.zip"})
+
+		assert.Equal(t, test.expectError, err != nil, test.name)
+		assert.Equal(t, test.expectedAttempts, attempts, test.name)
+		assert.Equal(t, test.expectedAttempts-1, len(sleeps), test.name)
+		for i := 1; i < len(sleeps); i++ {
+			assert.Equal(t, 2*sleeps[i-1], sleeps[i], test.name)
+		}
+	}
+}
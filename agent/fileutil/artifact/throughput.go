@@ -0,0 +1,189 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// downloadTimeoutSafetyFactor pads the estimated download time so a link slowing down a bit does not time out
+const downloadTimeoutSafetyFactor = 1.5
+
+var (
+	// downloadTimeout is the time an http download is given before its throughput is measured
+	downloadTimeout = 10 * time.Minute
+	// maxDownloadTimeout bounds the deadline extended for a slow link
+	maxDownloadTimeout = 60 * time.Minute
+	// throughputSampleSize is the number of bytes read between the estimates of the time of the whole download
+	throughputSampleSize int64 = 1024 * 1024
+
+	downloadNow = time.Now
+)
+
+// downloadTimeoutError represents an http download that did not complete before its deadline, it is a net.Error
+// reporting a timeout so DownloadWithRetry retries it
+type downloadTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *downloadTimeoutError) Error() string {
+	return fmt.Sprintf("download did not complete within %v", e.timeout)
+}
+
+// Timeout returns true, the download timed out
+func (e *downloadTimeoutError) Timeout() bool { return true }
+
+// Temporary returns true, the download can be retried
+func (e *downloadTimeoutError) Temporary() bool { return true }
+
+// downloadDeadline cancels the download when it expires, unlike a context deadline it can be extended up to
+// the hard limit
+type downloadDeadline struct {
+	mutex     sync.Mutex
+	start     time.Time
+	expiry    time.Time
+	hardLimit time.Time
+	timer     *time.Timer
+	expired   bool
+}
+
+// newDownloadDeadline creates a deadline expiring after timeout which calls cancel when it expires, the deadline
+// cannot be extended beyond maxTimeout after the start
+func newDownloadDeadline(cancel func(), timeout time.Duration, maxTimeout time.Duration) *downloadDeadline {
+	if maxTimeout < timeout {
+		maxTimeout = timeout
+	}
+	start := downloadNow()
+	deadline := &downloadDeadline{
+		start:     start,
+		expiry:    start.Add(timeout),
+		hardLimit: start.Add(maxTimeout),
+	}
+	deadline.timer = time.AfterFunc(timeout, func() {
+		deadline.mutex.Lock()
+		deadline.expired = true
+		deadline.mutex.Unlock()
+		cancel()
+	})
+	return deadline
+}
+
+// extendTo moves the expiry to the time, clamped to the hard limit, an earlier time keeps the current expiry.
+// The expiry of the deadline is returned.
+func (d *downloadDeadline) extendTo(expiry time.Time) time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.expired || !expiry.After(d.expiry) {
+		return d.expiry
+	}
+	if expiry.After(d.hardLimit) {
+		expiry = d.hardLimit
+	}
+	if d.timer.Stop() {
+		d.expiry = expiry
+		d.timer.Reset(expiry.Sub(downloadNow()))
+	}
+	return d.expiry
+}
+
+// timeoutError returns a downloadTimeoutError replacing err when the deadline expired, err is returned otherwise
+// and when the download has no deadline
+func (d *downloadDeadline) timeoutError(err error) error {
+	if d == nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err == nil || !d.expired {
+		return err
+	}
+	return &downloadTimeoutError{timeout: d.expiry.Sub(d.start)}
+}
+
+// stop releases the timer of the deadline
+func (d *downloadDeadline) stop() {
+	if d == nil {
+		return
+	}
+	d.timer.Stop()
+}
+
+// estimateDownloadDuration returns the time the download of totalBytes takes at the speed of reading readBytes in
+// elapsed, 0 is returned when the speed or the size is unknown
+func estimateDownloadDuration(readBytes int64, elapsed time.Duration, totalBytes int64) time.Duration {
+	if readBytes <= 0 || totalBytes <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * float64(totalBytes) / float64(readBytes))
+}
+
+// throughputReader measures the speed of the download every sampleSize bytes and extends the deadline when the
+// download would not complete in time at that speed
+type throughputReader struct {
+	log        log.T
+	reader     io.Reader
+	deadline   *downloadDeadline
+	totalBytes int64
+	sampleSize int64
+	start      time.Time
+	readBytes  int64
+	nextSample int64
+}
+
+// newThroughputReader wraps the body of a download of totalBytes, totalBytes is negative when the size is unknown
+func newThroughputReader(log log.T, reader io.Reader, totalBytes int64, deadline *downloadDeadline) *throughputReader {
+	return &throughputReader{
+		log:        log,
+		reader:     reader,
+		deadline:   deadline,
+		totalBytes: totalBytes,
+		sampleSize: throughputSampleSize,
+		start:      downloadNow(),
+		nextSample: throughputSampleSize,
+	}
+}
+
+// Read reads from the body and adapts the deadline each time a sample is read
+func (r *throughputReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.readBytes += int64(n)
+	if r.readBytes >= r.nextSample {
+		r.nextSample = r.readBytes + r.sampleSize
+		r.adaptDeadline()
+	}
+	return n, err
+}
+
+// adaptDeadline extends the deadline to the estimated completion of the download padded by
+// downloadTimeoutSafetyFactor
+func (r *throughputReader) adaptDeadline() {
+	now := downloadNow()
+	elapsed := now.Sub(r.start)
+	estimate := estimateDownloadDuration(r.readBytes, elapsed, r.totalBytes)
+	if estimate == 0 {
+		r.log.Debugf("download size or speed is unknown after %v bytes, keeping the download timeout", r.readBytes)
+		return
+	}
+
+	remaining := time.Duration(float64(estimate-elapsed) * downloadTimeoutSafetyFactor)
+	expiry := r.deadline.extendTo(now.Add(remaining))
+	r.log.Debugf("download speed is %.0f bytes/s, estimated download time %v, download deadline %v",
+		float64(r.readBytes)/elapsed.Seconds(), estimate, expiry)
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBody returns size bytes and advances the fake clock by the time reading them takes at bytesPerSecond
+type fakeBody struct {
+	remaining      int64
+	bytesPerSecond int64
+	now            *time.Time
+}
+
+func (b *fakeBody) Read(p []byte) (n int, err error) {
+	if b.remaining == 0 {
+		return 0, io.EOF
+	}
+	n = 64 * 1024
+	if n > len(p) {
+		n = len(p)
+	}
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+	}
+	b.remaining -= int64(n)
+	*b.now = b.now.Add(time.Duration(int64(n) * int64(time.Second) / b.bytesPerSecond))
+	return n, nil
+}
+
+// readWithFakeClock reads a body of size bytes at bytesPerSecond and returns the deadline of the download
+func readWithFakeClock(t *testing.T, size int64, bytesPerSecond int64, contentLength int64) (start time.Time, deadline *downloadDeadline) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	start = now
+	downloadNow = func() time.Time { return now }
+	defer func() { downloadNow = time.Now }()
+
+	deadline = newDownloadDeadline(func() {}, 10*time.Minute, 60*time.Minute)
+	body := newThroughputReader(log.NewMockLog(), &fakeBody{remaining: size, bytesPerSecond: bytesPerSecond, now: &now}, contentLength, deadline)
+	written, err := io.Copy(ioutil.Discard, body)
+	assert.NoError(t, err)
+	assert.Equal(t, size, written)
+	return start, deadline
+}
+
+func TestEstimateDownloadDuration(t *testing.T) {
+	assert.Equal(t, 100*time.Second, estimateDownloadDuration(1024, 10*time.Second, 10240))
+	assert.Equal(t, time.Duration(0), estimateDownloadDuration(0, 10*time.Second, 10240))
+	assert.Equal(t, time.Duration(0), estimateDownloadDuration(1024, 10*time.Second, -1))
+}
+
+func TestThroughputReaderFastBodyKeepsTimeout(t *testing.T) {
+	size := int64(10 * 1024 * 1024)
+	start, deadline := readWithFakeClock(t, size, 100*1024*1024, size)
+	defer deadline.stop()
+
+	assert.Equal(t, start.Add(10*time.Minute), deadline.expiry)
+}
+
+func TestThroughputReaderSlowBodyExtendsTimeout(t *testing.T) {
+	// 1 MB is read in 102.4s, the 10 MB download takes 1024s
+	size := int64(10 * 1024 * 1024)
+	start, deadline := readWithFakeClock(t, size, 10*1024, size)
+	defer deadline.stop()
+
+	sampled := start.Add(102400 * time.Millisecond)
+	expected := sampled.Add(time.Duration(float64(1024*time.Second-102400*time.Millisecond) * downloadTimeoutSafetyFactor))
+	assert.WithinDuration(t, expected, deadline.expiry, time.Second)
+	assert.True(t, deadline.expiry.After(start.Add(10*time.Minute)))
+}
+
+func TestThroughputReaderBodySlowingDownExtendsTimeout(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	downloadNow = func() time.Time { return now }
+	defer func() { downloadNow = time.Now }()
+	deadline := newDownloadDeadline(func() {}, 10*time.Minute, 60*time.Minute)
+	defer deadline.stop()
+
+	// the first sample is fast and keeps the timeout, the rest of the 10 MB download is slow
+	size := int64(10 * 1024 * 1024)
+	reader := io.MultiReader(
+		&fakeBody{remaining: 1024 * 1024, bytesPerSecond: 100 * 1024 * 1024, now: &now},
+		&fakeBody{remaining: size - 1024*1024, bytesPerSecond: 10 * 1024, now: &now})
+	body := newThroughputReader(log.NewMockLog(), reader, size, deadline)
+	_, err := io.Copy(ioutil.Discard, body)
+
+	assert.NoError(t, err)
+	assert.True(t, deadline.expiry.After(start.Add(10*time.Minute)))
+}
+
+func TestThroughputReaderVerySlowBodyIsBoundedByMaxTimeout(t *testing.T) {
+	size := int64(10 * 1024 * 1024)
+	start, deadline := readWithFakeClock(t, size, 1024, size)
+	defer deadline.stop()
+
+	assert.Equal(t, start.Add(60*time.Minute), deadline.expiry)
+}
+
+func TestThroughputReaderUnknownSizeKeepsTimeout(t *testing.T) {
+	start, deadline := readWithFakeClock(t, 2*1024*1024, 1024, -1)
+	defer deadline.stop()
+
+	assert.Equal(t, start.Add(10*time.Minute), deadline.expiry)
+}
+
+func TestHTTPDownloadTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("01234"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadTimeout, maxDownloadTimeout = 100*time.Millisecond, 100*time.Millisecond
+	defer func() { downloadTimeout, maxDownloadTimeout = 10*time.Minute, 60*time.Minute }()
+
+	_, err = httpDownload(log.NewMockLog(), server.URL+"/artifact.zip", filepath.Join(dir, "artifact.zip"), true)
+
+	assert.Error(t, err)
+	assert.IsType(t, &downloadTimeoutError{}, err)
+	assert.True(t, IsRetryableDownloadError(err))
+}
+
+func TestHTTPDownloadWithoutAdaptiveTimeoutHasNoDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("01234"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("56789"))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadTimeout, maxDownloadTimeout = 100*time.Millisecond, 100*time.Millisecond
+	defer func() { downloadTimeout, maxDownloadTimeout = 10*time.Minute, 60*time.Minute }()
+
+	output, err := httpDownload(log.NewMockLog(), server.URL+"/artifact.zip", filepath.Join(dir, "artifact.zip"), false)
+
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(output.LocalFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(content))
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+var loadAppConfig = appconfig.Config
+var systemCertPool = x509.SystemCertPool
+
+// newDownloadTransport creates the transport trusting the CA bundle configured in appconfig, the settings of
+// http.DefaultTransport are used so hosts are dialed dual-stack. Nil is returned to use http.DefaultTransport when
+// no CA bundle is configured. An error is returned when the transport cannot trust the CA bundle that is
+// configured as the only trusted one.
+func newDownloadTransport(log log.T) (*http.Transport, error) {
+	tlsConfig, err := downloadTLSConfig(log)
+	if err != nil || tlsConfig == nil {
+		return nil, err
+	}
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
+
+// downloadTLSConfig returns the tls config trusting the CA bundle configured in appconfig, nil is returned
+// to use the default trust store when no bundle is configured. A bundle that cannot be loaded falls back to the
+// default trust store unless UpdateCABundleOnly is set, an error is returned then so the download fails closed.
+func downloadTLSConfig(log log.T) (*tls.Config, error) {
+	config, err := loadAppConfig(false)
+	if err != nil || config.Agent.UpdateCABundlePath == "" {
+		return nil, nil
+	}
+
+	rootCAs, err := loadRootCAs(log, config.Agent.UpdateCABundlePath, config.Agent.UpdateCABundleOnly)
+	if err != nil {
+		if config.Agent.UpdateCABundleOnly {
+			return nil, fmt.Errorf("failed to load CA bundle %v, it is the only trusted CA bundle, %v", config.Agent.UpdateCABundlePath, err)
+		}
+		log.Errorf("failed to load CA bundle %v, using the default trust store, %v", config.Agent.UpdateCABundlePath, err)
+		return nil, nil
+	}
+	return &tls.Config{RootCAs: rootCAs}, nil
+}
+
+// loadRootCAs adds the certificates of the PEM bundle to the system roots, or to an empty pool when bundleOnly is set
+func loadRootCAs(log log.T, bundlePath string, bundleOnly bool) (pool *x509.CertPool, err error) {
+	if !bundleOnly {
+		if pool, err = systemCertPool(); err != nil {
+			log.Warnf("system roots are not available, only CA bundle %v is trusted, %v", bundlePath, err)
+		}
+	}
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	var bundle []byte
+	if bundle, err = ioutil.ReadFile(bundlePath); err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in %v", bundlePath)
+	}
+	return pool, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifact contains utilities for working downloading files.
+package artifact
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func startDownloadServer(t *testing.T, network string, address string) *httptest.Server {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Skipf("%v is not available, %v", address, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("manifest"))
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	return server
+}
+
+func testHTTPDownloadWithAddress(t *testing.T, network string, address string) {
+	server := startDownloadServer(t, network, address)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	destFile := filepath.Join(dir, "manifest.json")
+
+	output, err := httpDownload(log.NewMockLog(), server.URL+"/manifest.json", destFile, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, destFile, output.LocalFilePath)
+	content, err := ioutil.ReadFile(destFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "manifest", string(content))
+}
+
+func TestHTTPDownloadWithIPv6Host(t *testing.T) {
+	testHTTPDownloadWithAddress(t, "tcp6", "[::1]:0")
+}
+
+func TestHTTPDownloadWithIPv4Host(t *testing.T) {
+	testHTTPDownloadWithAddress(t, "tcp4", "127.0.0.1:0")
+}
+
+// writeCABundle writes the certificates to a PEM bundle in the directory
+func writeCABundle(t *testing.T, dir string, certs ...[]byte) string {
+	bundlePath := filepath.Join(dir, "ca-bundle.pem")
+	bundle := []byte{}
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+	}
+	assert.NoError(t, ioutil.WriteFile(bundlePath, bundle, 0600))
+	return bundlePath
+}
+
+// createUnrelatedCA creates a self-signed CA that did not sign the test server certificate
+func createUnrelatedCA(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "unrelated CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return cert
+}
+
+func testHTTPSDownloadWithCABundle(t *testing.T, bundleCerts func(server *httptest.Server) [][]byte, bundleOnly bool) error {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("manifest"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func() { loadAppConfig = appconfig.Config }()
+	config := appconfig.DefaultConfig()
+	if certs := bundleCerts(server); len(certs) > 0 {
+		config.Agent.UpdateCABundlePath = writeCABundle(t, dir, certs...)
+	}
+	config.Agent.UpdateCABundleOnly = bundleOnly
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return config, nil }
+
+	_, err = httpDownload(log.NewMockLog(), server.URL+"/manifest.json", filepath.Join(dir, "manifest.json"), false)
+	return err
+}
+
+func TestHTTPSDownloadTrustsCABundle(t *testing.T) {
+	serverCA := func(server *httptest.Server) [][]byte { return [][]byte{server.Certificate().Raw} }
+
+	// the bundle is added to the system roots
+	assert.NoError(t, testHTTPSDownloadWithCABundle(t, serverCA, false))
+	// the bundle replaces the system roots
+	assert.NoError(t, testHTTPSDownloadWithCABundle(t, serverCA, true))
+}
+
+func TestHTTPSDownloadRejectsUntrustedCA(t *testing.T) {
+	noBundle := func(server *httptest.Server) [][]byte { return nil }
+	unrelatedCA := func(server *httptest.Server) [][]byte { return [][]byte{createUnrelatedCA(t)} }
+
+	assert.Error(t, testHTTPSDownloadWithCABundle(t, noBundle, false))
+	assert.Error(t, testHTTPSDownloadWithCABundle(t, unrelatedCA, false))
+	assert.Error(t, testHTTPSDownloadWithCABundle(t, unrelatedCA, true))
+}
+
+func TestLoadRootCAsKeepsSystemRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundlePath := writeCABundle(t, dir, createUnrelatedCA(t))
+
+	defer func() { systemCertPool = x509.SystemCertPool }()
+	systemRoot, err := x509.ParseCertificate(createUnrelatedCA(t))
+	assert.NoError(t, err)
+	systemRoots := x509.NewCertPool()
+	systemRoots.AddCert(systemRoot)
+	systemCertPool = func() (*x509.CertPool, error) { return systemRoots, nil }
+
+	pool, err := loadRootCAs(log.NewMockLog(), bundlePath, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pool.Subjects()))
+
+	pool, err = loadRootCAs(log.NewMockLog(), bundlePath, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pool.Subjects()))
+
+	assert.NoError(t, ioutil.WriteFile(bundlePath, []byte("not a certificate"), 0600))
+	_, err = loadRootCAs(log.NewMockLog(), bundlePath, true)
+	assert.Error(t, err)
+}
+
+func TestDownloadTLSConfigWithInvalidCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundlePath := filepath.Join(dir, "ca-bundle.pem")
+	assert.NoError(t, ioutil.WriteFile(bundlePath, []byte("not a certificate"), 0600))
+
+	defer func() { loadAppConfig = appconfig.Config }()
+	config := appconfig.DefaultConfig()
+	config.Agent.UpdateCABundlePath = bundlePath
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return config, nil }
+
+	// the default trust store is used when the bundle is added to it
+	tlsConfig, err := downloadTLSConfig(log.NewMockLog())
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	// the download fails when the bundle is the only trusted one
+	config.Agent.UpdateCABundleOnly = true
+	_, err = downloadTLSConfig(log.NewMockLog())
+	assert.Error(t, err)
+	_, err = httpDownload(log.NewMockLog(), "https://localhost/manifest.json", filepath.Join(dir, "manifest.json"), false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only trusted CA bundle")
+}
@@ -17,6 +17,7 @@ package fileutil
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -36,6 +37,9 @@ const (
 	ByteOrderMarkSkip ByteOrderMark = iota
 )
 
+// ErrXzNotFound is returned when the xz command that decompresses tar.xz packages is not installed
+var ErrXzNotFound = errors.New("xz cannot be found, it is required to decompress tar.xz packages")
+
 func CreateUTF8ByteOrderMark() (result []byte) {
 	return []byte{0xEF, 0xBB, 0xBF}
 }
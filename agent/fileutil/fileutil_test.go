@@ -269,3 +269,13 @@ func TestAppendToFile(t *testing.T) {
 	assert.NoError(t, err, "expected no error")
 	fmt.Println(filePath)
 }
+
+func TestGetDiskSpaceInfoForPath(t *testing.T) {
+	diskSpaceInfo, err := GetDiskSpaceInfoForPath("testdata")
+	assert.NoError(t, err)
+	assert.True(t, diskSpaceInfo.TotalBytes > 0)
+	assert.True(t, diskSpaceInfo.AvailBytes <= diskSpaceInfo.TotalBytes)
+
+	_, err = GetDiskSpaceInfoForPath(filepath.Join("testdata", "doesnotexist"))
+	assert.Error(t, err)
+}
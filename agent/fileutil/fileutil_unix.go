@@ -18,10 +18,15 @@ package fileutil
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
@@ -42,9 +47,69 @@ func Uncompress(log log.T, src, dest string) error {
 	}
 	defer gr.Close()
 
+	return untar(log, gr, file.Name(), dest)
+}
+
+// UncompressTarXz untar the xz compressed installation package
+func UncompressTarXz(log log.T, src, dest string) error {
+	xr, err := OpenXz(src)
+	if err != nil {
+		return err
+	}
+
+	untarErr := untar(log, xr, src, dest)
+	if err = xr.Close(); err != nil {
+		return err
+	}
+	return untarErr
+}
+
+// OpenXz starts xz to decompress src and returns the decompressed stream, ErrXzNotFound is
+// returned when xz is not installed, closing the stream waits for xz and reports its failure
+func OpenXz(src string) (io.ReadCloser, error) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		return nil, ErrXzNotFound
+	}
+	cmd := exec.Command("xz", "--decompress", "--stdout", src)
+	xr := &xzReader{cmd: cmd, src: src}
+	cmd.Stderr = &xr.stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	xr.stdout = stdout
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start xz to decompress %v, %v", src, err)
+	}
+	return xr, nil
+}
+
+// xzReader reads the output of the xz process decompressing src
+type xzReader struct {
+	cmd    *exec.Cmd
+	src    string
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+}
+
+func (xr *xzReader) Read(p []byte) (int, error) {
+	return xr.stdout.Read(p)
+}
+
+func (xr *xzReader) Close() error {
+	// drain the remaining output so that xz can exit
+	io.Copy(ioutil.Discard, xr.stdout)
+	if err := xr.cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to decompress %v, %v %v", xr.src, err, strings.TrimSpace(xr.stderr.String()))
+	}
+	return nil
+}
+
+// untar extracts the tar stream to dest
+func untar(log log.T, r io.Reader, srcName, dest string) error {
 	os.MkdirAll(dest, appconfig.ReadWriteExecuteAccess)
 
-	tr := tar.NewReader(gr)
+	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -54,13 +119,15 @@ func Uncompress(log log.T, src, dest string) error {
 		}
 		itemPath := dest + string(os.PathSeparator) + hdr.Name
 		if !isUnderDir(itemPath, dest) {
-			return fmt.Errorf("%v attepts to place files outside %v subtree", file.Name(), dest)
+			return fmt.Errorf("%v attepts to place files outside %v subtree", srcName, dest)
 		}
 		if hdr.FileInfo().IsDir() {
 			os.MkdirAll(itemPath, hdr.FileInfo().Mode())
 		} else {
 			mode := hdr.FileInfo().Mode()
 			log.Debugf("Uncompressing file %v with %v mode", itemPath, mode.Perm().String())
+			// archives are not required to carry the directory entries of the files
+			os.MkdirAll(filepath.Dir(itemPath), appconfig.ReadWriteExecuteAccess)
 			fw, err := os.OpenFile(itemPath, appconfig.FileFlagsCreateOrTruncate, mode)
 			if err != nil {
 				return err
@@ -83,7 +150,6 @@ func Uncompress(log log.T, src, dest string) error {
 
 // GetDiskSpaceInfo returns DiskSpaceInfo with available, free, and total bytes from system disk space
 func GetDiskSpaceInfo() (diskSpaceInfo DiskSpaceInfo, err error) {
-	var stat syscall.Statfs_t
 	var wd string
 
 	// get a rooted path name
@@ -91,8 +157,17 @@ func GetDiskSpaceInfo() (diskSpaceInfo DiskSpaceInfo, err error) {
 		return
 	}
 
+	return GetDiskSpaceInfoForPath(wd)
+}
+
+// GetDiskSpaceInfoForPath returns DiskSpaceInfo with available, free, and total bytes of the filesystem the path is on
+func GetDiskSpaceInfoForPath(path string) (diskSpaceInfo DiskSpaceInfo, err error) {
+	var stat syscall.Statfs_t
+
 	// get filesystem statistics
-	syscall.Statfs(wd, &stat)
+	if err = syscall.Statfs(path, &stat); err != nil {
+		return
+	}
 
 	// get block size
 	bSize := uint64(stat.Bsize)
@@ -17,6 +17,8 @@
 package fileutil
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"syscall"
 	"unsafe"
@@ -30,25 +32,45 @@ func Uncompress(log log.T, src, dest string) error {
 	return Unzip(src, dest)
 }
 
+// UncompressTarXz is not supported on windows, the installation packages are zip files
+func UncompressTarXz(log log.T, src, dest string) error {
+	return fmt.Errorf("tar.xz packages are not supported on windows")
+}
+
+// OpenXz is not supported on windows, the installation packages are zip files
+func OpenXz(src string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("tar.xz packages are not supported on windows")
+}
+
 // GetDiskSpaceInfo returns available, free, and total bytes respectively from system disk space
 func GetDiskSpaceInfo() (diskSpaceInfo DiskSpaceInfo, err error) {
 	var wd string
-	var availBytes, totalBytes, freeBytes int64
 
 	// Get a rooted path name
 	if wd, err = os.Getwd(); err != nil {
 		return
 	}
 
+	return GetDiskSpaceInfoForPath(wd)
+}
+
+// GetDiskSpaceInfoForPath returns available, free, and total bytes respectively of the volume the path is on
+func GetDiskSpaceInfoForPath(path string) (diskSpaceInfo DiskSpaceInfo, err error) {
+	var availBytes, totalBytes, freeBytes int64
+
 	// Load kernel32.dll and find GetDiskFreeSpaceEX function
 	getDiskFreeSpace := syscall.MustLoadDLL("kernel32.dll").MustFindProc("GetDiskFreeSpaceExW")
 
 	// Get the available bytes (for arguments, GetDiskFreeSpace function takes dir name, avail, total, and free respectively)
-	_, _, err = getDiskFreeSpace.Call(
-		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(wd))),
+	ret, _, callErr := getDiskFreeSpace.Call(
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(path))),
 		uintptr(unsafe.Pointer(&availBytes)),
 		uintptr(unsafe.Pointer(&totalBytes)),
 		uintptr(unsafe.Pointer(&freeBytes)))
+	// GetDiskFreeSpaceExW returns 0 when it fails, the error of Call is only meaningful then
+	if ret == 0 {
+		return diskSpaceInfo, callErr
+	}
 
 	return DiskSpaceInfo{
 		AvailBytes: availBytes,
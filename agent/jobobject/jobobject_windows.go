@@ -112,6 +112,11 @@ func createJobObject(jobAttrs *syscall.SecurityAttributes, name *uint16) (handle
 
 // Function AttachProcessToJobObject attached child processes to the SSM agent job object.
 func AttachProcessToJobObject(Pid uint32) (err error) {
+	return AssignProcessToJob(SSMjobObject, Pid)
+}
+
+// Function AssignProcessToJob attaches the process to the given job object.
+func AssignProcessToJob(job syscall.Handle, Pid uint32) (err error) {
 	handle, err := syscall.OpenProcess(processSetQuotaAccess|processTerminateAccess, childprocessNotInheritHandle, Pid)
 	if err != nil {
 		return err
@@ -119,7 +124,7 @@ func AttachProcessToJobObject(Pid uint32) (err error) {
 	defer syscall.CloseHandle(handle)
 
 	r1, _, e1 := AssignProcessToJobObject.Call(
-		uintptr(SSMjobObject),
+		uintptr(job),
 		uintptr(handle))
 
 	if r1 == 0 {
@@ -132,6 +137,24 @@ func AttachProcessToJobObject(Pid uint32) (err error) {
 	return err
 }
 
+// Function CreateKillOnCloseJobObject creates a job object which terminates all the attached processes
+// when the last handle of the job object is closed.
+func CreateKillOnCloseJobObject() (job syscall.Handle, err error) {
+	if job, err = createJobObject(nil, nil); err != nil {
+		return 0, err
+	}
+
+	var jobinfo JobObjectExtendedLimit
+	jobinfo.BasicLimitInformation.LimitFlags = jobObjectLimitkillonClose
+
+	err = setInformationJobObject(job, JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&jobinfo)), uint32(unsafe.Sizeof(jobinfo)))
+	if err != nil {
+		syscall.Close(job)
+		return 0, err
+	}
+	return job, nil
+}
+
 // Set up a job object for the SSM agent process on Windows. This is to control the lifetime of daemon processes
 // launched via the ConfigureDaemon/RunDaemon plugin.
 // The init function is automatically invoked prior to main function being invoked.
@@ -139,19 +162,9 @@ func init() {
 	log := ssmlog.SSMLogger(true)
 
 	var err error
-	SSMjobObject, err = createJobObject(nil, nil)
-	if err != nil {
-		log.Infof("SSM Agent CreateJobObject failed: %v", err)
-		return
-	}
-
-	var jobinfo JobObjectExtendedLimit
-	jobinfo.BasicLimitInformation.LimitFlags = jobObjectLimitkillonClose
-
-	err = setInformationJobObject(SSMjobObject, JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&jobinfo)), uint32(unsafe.Sizeof(jobinfo)))
+	SSMjobObject, err = CreateKillOnCloseJobObject()
 	if err != nil {
-		log.Infof("SetInformationJobObject failed: %v", err)
-		syscall.Close(SSMjobObject)
+		log.Infof("SSM Agent job object creation failed: %v", err)
 		return
 	}
 	log.Infof("Windows Only: Job object creation on SSM agent successful")
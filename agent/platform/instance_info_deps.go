@@ -16,6 +16,7 @@ package platform
 
 import (
 	"runtime"
+	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/containers"
 	"github.com/aws/amazon-ssm-agent/agent/managedInstances/registration"
@@ -50,10 +51,11 @@ func (instanceInfo) InstanceType() string { return registration.InstanceType() }
 // AvailabilityZone returns the managed instance availabilityZone
 func (instanceInfo) AvailabilityZone() string { return registration.AvailabilityZone() }
 
+// sdkMetadataRequestTimeout is the timeout the sdk applies to the metadata requests
+const sdkMetadataRequestTimeout = 5 * time.Second
+
 // dependency for metadata
-var metadata metadataClient = instanceMetadata{
-	Client: ec2metadata.New(session.New(aws.NewConfig().WithMaxRetries(10).WithEC2MetadataDisableTimeoutOverride(false))),
-}
+var metadata metadataClient = newInstanceMetadata(10, false, sdkMetadataRequestTimeout)
 
 type metadataClient interface {
 	GetMetadata(p string) (string, error)
@@ -66,9 +68,7 @@ func init() {
 	// Set our retries to just one and make sure we're using the shorter overrides
 	// Macs don't have instance metadata
 	if runtime.GOOS == "darwin" {
-		metadata = instanceMetadata{
-			Client: ec2metadata.New(session.New(aws.NewConfig().WithMaxRetries(0).WithEC2MetadataDisableTimeoutOverride(true))),
-		}
+		metadata = newInstanceMetadata(0, true, 0)
 	}
 }
 
@@ -76,6 +76,15 @@ type instanceMetadata struct {
 	Client *ec2metadata.EC2Metadata
 }
 
+// newInstanceMetadata creates the sdk metadata client, requests to the metadata service bypass any configured proxy
+func newInstanceMetadata(maxRetries int, disableTimeoutOverride bool, timeout time.Duration) instanceMetadata {
+	return instanceMetadata{
+		Client: ec2metadata.New(session.New(aws.NewConfig().WithMaxRetries(maxRetries).
+			WithEC2MetadataDisableTimeoutOverride(disableTimeoutOverride).
+			WithHTTPClient(NewMetadataHTTPClient(timeout)))),
+	}
+}
+
 // GetMetadata uses the path provided to request
 func (c instanceMetadata) GetMetadata(p string) (string, error) {
 	return c.Client.GetMetadata(p)
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"time"
 )
@@ -111,8 +112,26 @@ var metadata_token = ""
 
 // NewEC2MetadataClient creates new EC2MetadataClient
 func NewEC2MetadataClient() *EC2MetadataClient {
-	httpClient := &http.Client{Timeout: EC2MetadataRequestTimeout}
-	return &EC2MetadataClient{client: httpClient}
+	return &EC2MetadataClient{client: NewMetadataHTTPClient(EC2MetadataRequestTimeout)}
+}
+
+// NewMetadataHTTPClient creates the http client for instance metadata requests, the client bypasses any
+// configured proxy since the link-local metadata address cannot be reached through a forward proxy
+func NewMetadataHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
 }
 
 // InstanceIdentityDocument returns the instance document details querying the metadata
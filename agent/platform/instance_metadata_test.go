@@ -19,6 +19,8 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 
@@ -234,3 +236,48 @@ func testFormatPendingTime(t *testing.T, pendingTimeAsTime time.Time, pendingTim
 
 	assert.Equal(t, pendingTimeAsString, iid.PendingTimeAsString)
 }
+
+func TestMetadataHTTPClientBypassesProxy(t *testing.T) {
+	proxyRequests := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyRequests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	metadataServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("us-east-1"))
+	}))
+	defer metadataServer.Close()
+
+	for _, env := range []string{"HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy"} {
+		original, isSet := os.LookupEnv(env)
+		if isSet {
+			defer os.Setenv(env, original)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+	os.Setenv("HTTP_PROXY", proxy.URL)
+	os.Setenv("http_proxy", proxy.URL)
+	os.Unsetenv("NO_PROXY")
+	os.Unsetenv("no_proxy")
+
+	client := NewMetadataHTTPClient(EC2MetadataRequestTimeout)
+	transport, ok := client.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Nil(t, transport.Proxy)
+
+	resp, err := client.Get(metadataServer.URL + "/latest/meta-data/placement/region")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "us-east-1", string(body))
+	assert.Equal(t, 0, proxyRequests)
+}
+
+func TestSdkMetadataClientBypassesProxy(t *testing.T) {
+	sdkMetadata := newInstanceMetadata(10, false, sdkMetadataRequestTimeout)
+	transport, ok := sdkMetadata.Client.Config.HTTPClient.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Nil(t, transport.Proxy)
+}
@@ -178,7 +178,7 @@ func TestSuccessfulDownloadArtifact(t *testing.T) {
 	tracer.BeginSection("test segment root")
 
 	mockObj := new(SSMS3Mock)
-	mockObj.On("Download", mock.Anything, mock.Anything).Return(artifact.DownloadOutput{"somePath", false, true}, nil)
+	mockObj.On("Download", mock.Anything, mock.Anything).Return(artifact.DownloadOutput{LocalFilePath: "somePath", IsUpdated: false, IsHashMatched: true}, nil)
 
 	networkdep = mockObj
 
@@ -194,7 +194,7 @@ func TestDownloadArtifactWithError(t *testing.T) {
 	tracer.BeginSection("test segment root")
 
 	mockObj := new(SSMS3Mock)
-	mockObj.On("Download", mock.Anything, mock.Anything).Return(artifact.DownloadOutput{"somePath", false, true}, errors.New("testerror"))
+	mockObj.On("Download", mock.Anything, mock.Anything).Return(artifact.DownloadOutput{LocalFilePath: "somePath", IsUpdated: false, IsHashMatched: true}, errors.New("testerror"))
 
 	networkdep = mockObj
 
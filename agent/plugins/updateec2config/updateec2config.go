@@ -188,7 +188,9 @@ func runUpdateAgent(
 	// If disk space is not sufficient, fail the update to prevent installation and notify user in output
 	// If loading disk space fails, continue to update (agent update is backed by rollback handler)
 	log.Infof("Checking available disk space ...")
-	if isDiskSpaceSufficient, err := util.IsDiskSpaceSufficientForUpdate(log); err == nil && !isDiskSpaceSufficient {
+	if isDiskSpaceSufficient, err := util.IsDiskSpaceSufficientForUpdate(log, 0); err != nil {
+		log.Warnf("Continuing update without disk space check, %v", err)
+	} else if !isDiskSpaceSufficient {
 		output.MarkAsFailed(errors.New("Insufficient available disk space"))
 		return
 	}
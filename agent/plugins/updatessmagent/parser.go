@@ -18,6 +18,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/aws/amazon-ssm-agent/agent/log"
@@ -29,12 +31,16 @@ type Manifest struct {
 	SchemaVersion string            `json:"SchemaVersion"`
 	URIFormat     string            `json:"UriFormat"`
 	Packages      []*PackageContent `json:"Packages"`
+	// MinimumPlatformVersions maps the platform names to the minimum platform version supported by the agent
+	MinimumPlatformVersions map[string]string `json:"MinimumPlatformVersions,omitempty"`
 }
 
 // PackageContent section in the Manifest json.
 type PackageContent struct {
 	Name  string         `json:"Name"`
 	Files []*FileContent `json:"Files"`
+	// FileNameTemplate is the name template of the package files, updateutil.DefaultFileNameTemplate is used when it is empty
+	FileNameTemplate string `json:"FileNameTemplate,omitempty"`
 }
 
 // FileContent holds the file name and available versions
@@ -47,11 +53,15 @@ type FileContent struct {
 type PackageVersion struct {
 	Version  string `json:"Version"`
 	Checksum string `json:"Checksum"`
+	// Size is the declared size of the package in bytes, it is 0 when the manifest does not declare it
+	Size int64 `json:"Size,omitempty"`
 }
 
 const (
 	minimumVersion = "0"
 
+	prereleaseSeparator = "-"
+
 	//ManifestPath is path of manifest in the s3 bucket
 	ManifestPath = "/amazon-ssm-{Region}/ssm-agent-manifest.json"
 
@@ -62,11 +72,31 @@ const (
 	ChinaManifestURL = "https://s3.{Region}.amazonaws.com.cn" + ManifestPath
 )
 
+// manifestVersionPattern matches the versions of the manifest, e.g. 2.3.100.0 or 3.0.0.0-beta
+var manifestVersionPattern = regexp.MustCompile(`^\d+(\.\d+)*(-[0-9A-Za-z.]+)?$`)
+
+// manifestFileExtensions are the compress formats of the artifacts the instances look up
+var manifestFileExtensions = []string{
+	"." + updateutil.CompressFormatTarGz,
+	"." + updateutil.CompressFormatTarXz,
+	"." + updateutil.CompressFormatZip,
+}
+
 // ParseManifest parses the public manifest file to provide agent update information.
 func ParseManifest(log log.T,
 	fileName string,
 	context *updateutil.InstanceContext,
 	packageName string) (parsedManifest *Manifest, err error) {
+	if parsedManifest, err = LoadManifest(fileName); err != nil {
+		return
+	}
+
+	err = validateManifest(log, parsedManifest, context, packageName)
+	return
+}
+
+// LoadManifest loads and parses the manifest file without validating it against an instance
+func LoadManifest(fileName string) (parsedManifest *Manifest, err error) {
 	//Load specified file from file system
 	var result = []byte{}
 	if result, err = ioutil.ReadFile(fileName); err != nil {
@@ -76,17 +106,143 @@ func ParseManifest(log log.T,
 	if err = json.Unmarshal([]byte(result), &parsedManifest); err != nil {
 		return
 	}
-
-	err = validateManifest(log, parsedManifest, context, packageName)
+	if parsedManifest == nil {
+		return nil, fmt.Errorf("manifest %v is empty", fileName)
+	}
 	return
 }
 
+// Problems returns the structural problems of the manifest for every platform, version entries with a missing
+// checksum, an invalid version or a file name no instance looks up are reported as well as duplicated entries
+func (m *Manifest) Problems() (problems []string) {
+	report := func(format string, params ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, params...))
+	}
+
+	if len(m.URIFormat) == 0 {
+		report("UriFormat is missing")
+	}
+	if len(m.Packages) == 0 {
+		report("no packages are declared")
+	}
+
+	packageNames := make(map[string]bool)
+	for i, p := range m.Packages {
+		if len(p.Name) == 0 {
+			report("package %v has no name", i)
+			continue
+		}
+		if packageNames[p.Name] {
+			report("package %v is declared more than once", p.Name)
+		}
+		packageNames[p.Name] = true
+		if len(p.Files) == 0 {
+			report("package %v has no files", p.Name)
+		}
+		if p.FileNameTemplate != "" {
+			if err := updateutil.ValidateFileNameTemplate(p.FileNameTemplate); err != nil {
+				report("package %v has an invalid file name template, %v", p.Name, err)
+			}
+		}
+
+		fileNames := make(map[string]bool)
+		for _, f := range p.Files {
+			if fileNames[f.Name] {
+				report("file %v of package %v is declared more than once", f.Name, p.Name)
+			}
+			fileNames[f.Name] = true
+			if p.FileNameTemplate == "" && !isReachableFileName(p.Name, f.Name) {
+				report("file %v of package %v does not match the %v-<platform>-<arch>.<format> name instances look up",
+					f.Name, p.Name, p.Name)
+			}
+			if len(f.AvailableVersions) == 0 {
+				report("file %v has no available versions", f.Name)
+			}
+
+			versions := make(map[string]bool)
+			for _, v := range f.AvailableVersions {
+				if !manifestVersionPattern.MatchString(v.Version) {
+					report("file %v has invalid version %q", f.Name, v.Version)
+				}
+				if versions[v.Version] {
+					report("file %v declares version %v more than once", f.Name, v.Version)
+				}
+				versions[v.Version] = true
+				if len(v.Checksum) == 0 {
+					report("file %v version %v has no checksum", f.Name, v.Version)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// isReachableFileName returns true if the file name is the name instances look up for the package
+func isReachableFileName(packageName string, fileName string) bool {
+	if !strings.HasPrefix(fileName, packageName+"-") {
+		return false
+	}
+	for _, extension := range manifestFileExtensions {
+		if strings.HasSuffix(fileName, extension) {
+			platformAndArch := strings.TrimSuffix(strings.TrimPrefix(fileName, packageName+"-"), extension)
+			return len(strings.SplitN(platformAndArch, "-", 2)) == 2
+		}
+	}
+	return false
+}
+
+// fileName returns the name of the package file for the instance, the file name template of the package is used
+// when the manifest declares one
+func (m *Manifest) fileName(context *updateutil.InstanceContext, packageName string) string {
+	return m.fileContext(context, packageName).FileNameWithTemplate(m.fileNameTemplate(packageName), packageName)
+}
+
+// fileNameTemplate returns the file name template the manifest declares for the package
+func (m *Manifest) fileNameTemplate(packageName string) string {
+	for _, p := range m.Packages {
+		if p.Name == packageName {
+			return p.FileNameTemplate
+		}
+	}
+	return ""
+}
+
+// fileContext returns the instance context the package file is named with, the context of the universal
+// updateutil.ArchAny file is returned when the package has no file for the arch of the instance
+func (m *Manifest) fileContext(context *updateutil.InstanceContext, packageName string) *updateutil.InstanceContext {
+	template := m.fileNameTemplate(packageName)
+	if context.Arch == updateutil.ArchAny || m.hasFile(packageName, context.FileNameWithTemplate(template, packageName)) {
+		return context
+	}
+
+	universal := *context
+	universal.Arch = updateutil.ArchAny
+	if m.hasFile(packageName, universal.FileNameWithTemplate(template, packageName)) {
+		return &universal
+	}
+	return context
+}
+
+// hasFile returns true if the manifest declares the file for the package
+func (m *Manifest) hasFile(packageName string, fileName string) bool {
+	for _, p := range m.Packages {
+		if p.Name == packageName {
+			for _, f := range p.Files {
+				if f.Name == fileName {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // HasVersion returns if manifest file has particular version for package
 func (m *Manifest) HasVersion(context *updateutil.InstanceContext, packageName string, version string) bool {
 	for _, p := range m.Packages {
 		if p.Name == packageName {
 			for _, f := range p.Files {
-				if f.Name == context.FileName(packageName) {
+				if f.Name == m.fileName(context, packageName) {
 					for _, v := range f.AvailableVersions {
 						if v.Version == version || version == updateutil.PipelineTestVersion {
 							return true
@@ -107,7 +263,7 @@ func (m *Manifest) LatestVersion(log log.T, context *updateutil.InstanceContext,
 	for _, p := range m.Packages {
 		if p.Name == packageName {
 			for _, f := range p.Files {
-				if f.Name == context.FileName(packageName) {
+				if f.Name == m.fileName(context, packageName) {
 					for _, v := range f.AvailableVersions {
 						if compareResult, err = updateutil.VersionCompare(v.Version, version); err != nil {
 							return version, err
@@ -121,7 +277,7 @@ func (m *Manifest) LatestVersion(log log.T, context *updateutil.InstanceContext,
 		}
 	}
 	if version == minimumVersion {
-		log.Debugf("Filename: %v", context.FileName(packageName))
+		log.Debugf("Filename: %v", m.fileName(context, packageName))
 		log.Debugf("Package Name: %v", packageName)
 		log.Debugf("Manifest: %v", m)
 		return version, fmt.Errorf("cannot find the latest version for package %v", packageName)
@@ -130,12 +286,102 @@ func (m *Manifest) LatestVersion(log log.T, context *updateutil.InstanceContext,
 	return version, nil
 }
 
+// AvailableVersionsFor returns the versions of the package that publish an artifact for the instance platform and arch,
+// sorted from the lowest to the highest version
+func (m *Manifest) AvailableVersionsFor(context *updateutil.InstanceContext, packageName string) []string {
+	fileName := m.fileName(context, packageName)
+	found := make(map[string]bool)
+	versions := []string{}
+	for _, p := range m.Packages {
+		if p.Name == packageName {
+			for _, f := range p.Files {
+				if f.Name == fileName {
+					for _, v := range f.AvailableVersions {
+						if found[v.Version] {
+							continue
+						}
+						// skip the versions that cannot be compared
+						if _, err := updateutil.VersionCompare(v.Version, minimumVersion); err != nil {
+							continue
+						}
+						found[v.Version] = true
+						versions = append(versions, v.Version)
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareManifestVersions(versions[i], versions[j]) < 0
+	})
+	return versions
+}
+
+// LatestVersionFor returns the highest version of the package that publishes an artifact for the instance platform
+// and arch, pre-release versions are ignored unless includePrerelease is set
+func (m *Manifest) LatestVersionFor(
+	context *updateutil.InstanceContext,
+	packageName string,
+	includePrerelease bool) (result string, err error) {
+	for _, v := range m.AvailableVersionsFor(context, packageName) {
+		if !includePrerelease && isPrereleaseVersion(v) {
+			continue
+		}
+		if result == "" || compareManifestVersions(v, result) > 0 {
+			result = v
+		}
+	}
+
+	if result == "" {
+		return "", fmt.Errorf("cannot find a compatible version of package %v for %v", packageName, m.fileName(context, packageName))
+	}
+	return result, nil
+}
+
+// isPrereleaseVersion returns true if the version carries a pre-release suffix, e.g. 3.0.0.0-beta
+func isPrereleaseVersion(version string) bool {
+	return strings.Contains(version, prereleaseSeparator)
+}
+
+// compareManifestVersions compares two versions of the manifest, a release version is higher than
+// the pre-release versions with the same version number
+func compareManifestVersions(versionl string, versionr string) int {
+	corel, prereleasel := splitPrereleaseVersion(versionl)
+	corer, prereleaser := splitPrereleaseVersion(versionr)
+	if compareResult, _ := updateutil.VersionCompare(corel, corer); compareResult != 0 {
+		return compareResult
+	}
+
+	switch {
+	case prereleasel == prereleaser:
+		return 0
+	case prereleasel == "":
+		return 1
+	case prereleaser == "":
+		return -1
+	}
+	compareResult, _ := updateutil.VersionCompare(prereleasel, prereleaser)
+	return compareResult
+}
+
+// splitPrereleaseVersion splits the version into the version number and the pre-release suffix
+func splitPrereleaseVersion(version string) (core string, prerelease string) {
+	parts := strings.SplitN(version, prereleaseSeparator, 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
 // DownloadURLAndHash returns download source url and hash value
 func (m *Manifest) DownloadURLAndHash(
 	context *updateutil.InstanceContext,
 	packageName string,
 	version string) (result string, hash string, err error) {
-	fileName := context.FileName(packageName)
+	// the {Arch} of the url is the arch of the package file, which is universal for some packages
+	fileContext := m.fileContext(context, packageName)
+	fileName := m.fileName(context, packageName)
 
 	for _, p := range m.Packages {
 		if p.Name == packageName {
@@ -143,11 +389,9 @@ func (m *Manifest) DownloadURLAndHash(
 				if f.Name == fileName {
 					for _, v := range f.AvailableVersions {
 						if version == v.Version || version == updateutil.PipelineTestVersion {
-							result = m.URIFormat
-							result = strings.Replace(result, updateutil.RegionHolder, context.Region, -1)
-							result = strings.Replace(result, updateutil.PackageNameHolder, packageName, -1)
-							result = strings.Replace(result, updateutil.PackageVersionHolder, version, -1)
-							result = strings.Replace(result, updateutil.FileNameHolder, f.Name, -1)
+							// the {FileName} of the url is the custom name of the package file
+							uriFormat := strings.Replace(m.URIFormat, updateutil.FileNameHolder, fileName, -1)
+							result = updateutil.BuildDownloadURL(uriFormat, fileContext, packageName, version)
 							if version == updateutil.PipelineTestVersion {
 								return result, "", nil
 							}
@@ -162,12 +406,64 @@ func (m *Manifest) DownloadURLAndHash(
 	return "", "", fmt.Errorf("incorrect package name or version, %v, %v", packageName, version)
 }
 
+// DownloadSize returns the declared size in bytes of the package version for the instance, 0 is returned
+// when the manifest does not declare the size or does not contain the package version
+func (m *Manifest) DownloadSize(
+	context *updateutil.InstanceContext,
+	packageName string,
+	version string) int64 {
+	fileName := m.fileName(context, packageName)
+
+	for _, p := range m.Packages {
+		if p.Name == packageName {
+			for _, f := range p.Files {
+				if f.Name == fileName {
+					for _, v := range f.AvailableVersions {
+						if version == v.Version {
+							return v.Size
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+// IsCompatibleWith returns false with the reason when the platform version of the instance is below the
+// minimum platform version declared in the manifest, platforms without a declared minimum are compatible
+func (m *Manifest) IsCompatibleWith(context *updateutil.InstanceContext) (compatible bool, reason string) {
+	minimumPlatformVersion, declared := m.MinimumPlatformVersions[context.Platform]
+	if !declared {
+		return true, ""
+	}
+
+	compareResult, err := updateutil.VersionCompare(context.PlatformVersion, minimumPlatformVersion)
+	if err != nil {
+		return false, fmt.Sprintf("failed to compare %v version %v with the minimum version %v, %v",
+			context.Platform, context.PlatformVersion, minimumPlatformVersion, err)
+	}
+	if compareResult < 0 {
+		return false, fmt.Sprintf("%v version %v is below the minimum version %v",
+			context.Platform, context.PlatformVersion, minimumPlatformVersion)
+	}
+	return true, ""
+}
+
 // validateManifest makes sure all the fields are provided.
 func validateManifest(log log.T, parsedManifest *Manifest, context *updateutil.InstanceContext, packageName string) error {
 	if len(parsedManifest.URIFormat) == 0 {
 		return fmt.Errorf("folder format cannot be null in the Manifest file")
 	}
-	fileName := context.FileName(packageName)
+	for _, p := range parsedManifest.Packages {
+		if p.Name == packageName && p.FileNameTemplate != "" {
+			if err := updateutil.ValidateFileNameTemplate(p.FileNameTemplate); err != nil {
+				return fmt.Errorf("invalid file name template of package %v, %v", packageName, err)
+			}
+		}
+	}
+	fileName := parsedManifest.fileName(context, packageName)
 	foundPackage := false
 	foundFile := false
 	for _, p := range parsedManifest.Packages {
@@ -97,6 +97,120 @@ func TestParseManifestWithError(t *testing.T) {
 	}
 }
 
+func TestAvailableVersionsFor(t *testing.T) {
+	agentName := "amazon-ssm-agent"
+	context := mockInstanceContext()
+	manifest := &Manifest{
+		URIFormat: "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}",
+		Packages: []*PackageContent{
+			{
+				Name: agentName,
+				Files: []*FileContent{
+					{
+						Name: "amazon-ssm-agent-linux-amd64.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "2.3.100.0"},
+							{Version: "2.3.13.0"},
+							{Version: "1.1.43.0"},
+						},
+					},
+					{
+						Name: "amazon-ssm-agent-linux-386.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "2.3.100.0"},
+							{Version: "2.3.200.0"},
+							{Version: "3.0.0.0"},
+						},
+					},
+				},
+			},
+			{
+				Name: agentName + updateutil.UpdaterPackageNamePrefix,
+				Files: []*FileContent{
+					{
+						Name: "amazon-ssm-agent-updater-linux-amd64.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "4.0.0.0"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	versions := manifest.AvailableVersionsFor(context, agentName)
+	assert.Equal(t, []string{"1.1.43.0", "2.3.13.0", "2.3.100.0"}, versions)
+
+	context.Arch = "arm64"
+	assert.Equal(t, []string{}, manifest.AvailableVersionsFor(context, agentName))
+}
+
+func TestLatestVersionFor(t *testing.T) {
+	agentName := "amazon-ssm-agent"
+	context := mockInstanceContext()
+	manifest := &Manifest{
+		URIFormat: "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}",
+		Packages: []*PackageContent{
+			{
+				Name: agentName,
+				Files: []*FileContent{
+					{
+						Name: "amazon-ssm-agent-linux-amd64.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "2.3.13.0"},
+							{Version: "2.3.100.0"},
+							{Version: "2.3.200.0-beta"},
+							{Version: "2.3.100.0-rc1"},
+						},
+					},
+					{
+						Name: "amazon-ssm-agent-linux-386.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "3.0.0.0"},
+						},
+					},
+					{
+						Name: "amazon-ssm-agent-linux-arm.tar.gz",
+						AvailableVersions: []*PackageVersion{
+							{Version: "3.0.0.0-beta"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	latest, err := manifest.LatestVersionFor(context, agentName, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.100.0", latest)
+
+	latest, err = manifest.LatestVersionFor(context, agentName, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.200.0-beta", latest)
+
+	// only pre-release versions are published for arm
+	context.Arch = "arm"
+	_, err = manifest.LatestVersionFor(context, agentName, false)
+	assert.Error(t, err)
+	latest, err = manifest.LatestVersionFor(context, agentName, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.0.0.0-beta", latest)
+
+	// no version is published for arm64
+	context.Arch = "arm64"
+	_, err = manifest.LatestVersionFor(context, agentName, true)
+	assert.Error(t, err)
+}
+
+func TestCompareManifestVersions(t *testing.T) {
+	assert.Equal(t, 0, compareManifestVersions("2.3.100.0", "2.3.100.0"))
+	assert.Equal(t, 1, compareManifestVersions("2.3.100.0", "2.3.13.0"))
+	assert.Equal(t, 1, compareManifestVersions("2.3.100.0", "2.3.100.0-rc1"))
+	assert.Equal(t, -1, compareManifestVersions("2.3.100.0-rc1", "2.3.100.0"))
+	assert.Equal(t, -1, compareManifestVersions("2.3.100.0-rc1", "2.3.100.0-rc2"))
+	assert.Equal(t, 1, compareManifestVersions("2.3.101.0-rc1", "2.3.100.0"))
+}
+
 //Load specified file from file system
 func loadFile(t *testing.T, fileName string) (result []byte) {
 	var err error
@@ -125,3 +239,208 @@ func mockInstanceContext() *updateutil.InstanceContext {
 		CompressFormat: "tar.gz",
 	}
 }
+
+func TestSampleManifestHasNoProblems(t *testing.T) {
+	for _, manifestFile := range sampleManifests {
+		manifest, err := LoadManifest(manifestFile)
+		assert.NoError(t, err)
+		assert.Empty(t, manifest.Problems(), manifestFile)
+	}
+}
+
+func TestDownloadSize(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := &Manifest{
+		Packages: []*PackageContent{
+			{
+				Name: "amazon-ssm-agent",
+				Files: []*FileContent{
+					{
+						Name: context.FileName("amazon-ssm-agent"),
+						AvailableVersions: []*PackageVersion{
+							{Version: "2.3.100.0", Checksum: "checksum", Size: 52428800},
+							{Version: "2.3.101.0", Checksum: "checksum"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, int64(52428800), manifest.DownloadSize(context, "amazon-ssm-agent", "2.3.100.0"))
+	// size is not declared
+	assert.Equal(t, int64(0), manifest.DownloadSize(context, "amazon-ssm-agent", "2.3.101.0"))
+	// version is not in the manifest
+	assert.Equal(t, int64(0), manifest.DownloadSize(context, "amazon-ssm-agent", "2.3.102.0"))
+}
+
+func TestCustomFileNameTemplate(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := &Manifest{
+		URIFormat: "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}",
+		Packages: []*PackageContent{
+			{
+				Name:             "amazon-ssm-agent",
+				FileNameTemplate: "{PackageName}_{Arch}_{Platform}.{Compressed}",
+				Files: []*FileContent{
+					{
+						Name:              "amazon-ssm-agent_amd64_linux.tar.gz",
+						AvailableVersions: []*PackageVersion{{Version: "2.3.100.0", Checksum: "checksum"}},
+					},
+				},
+			},
+		},
+	}
+
+	assert.NoError(t, validateManifest(log.NewMockLog(), manifest, context, "amazon-ssm-agent"))
+	assert.Empty(t, manifest.Problems())
+	assert.True(t, manifest.HasVersion(context, "amazon-ssm-agent", "2.3.100.0"))
+	source, hash, err := manifest.DownloadURLAndHash(context, "amazon-ssm-agent", "2.3.100.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/amazon-ssm-agent/2.3.100.0/amazon-ssm-agent_amd64_linux.tar.gz", source)
+	assert.Equal(t, "checksum", hash)
+
+	// the packages without a template are looked up by the default file name
+	manifest.Packages[0].FileNameTemplate = ""
+	assert.False(t, manifest.HasVersion(context, "amazon-ssm-agent", "2.3.100.0"))
+}
+
+func TestCustomFileNameTemplateWithUnknownPlaceholder(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := &Manifest{
+		URIFormat: "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}",
+		Packages: []*PackageContent{
+			{
+				Name:             "amazon-ssm-agent",
+				FileNameTemplate: "{PackageName}-{Version}-{Arch}.{Compressed}",
+				Files: []*FileContent{
+					{
+						Name:              "amazon-ssm-agent-{Version}-amd64.tar.gz",
+						AvailableVersions: []*PackageVersion{{Version: "2.3.100.0", Checksum: "checksum"}},
+					},
+				},
+			},
+		},
+	}
+
+	err := validateManifest(log.NewMockLog(), manifest, context, "amazon-ssm-agent")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "{Version}")
+	assert.Len(t, manifest.Problems(), 1)
+}
+
+func TestManifestFileNamesOfAllCompressFormatsHaveNoProblems(t *testing.T) {
+	manifest := universalManifest(
+		"amazon-ssm-agent-linux-amd64.tar.gz",
+		"amazon-ssm-agent-linux-arm64.tar.xz",
+		"amazon-ssm-agent-windows-amd64.zip")
+
+	assert.Empty(t, manifest.Problems())
+}
+
+func universalManifest(fileNames ...string) *Manifest {
+	manifest := &Manifest{
+		URIFormat: "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{Platform}_{Arch}/{FileName}",
+		Packages:  []*PackageContent{{Name: "amazon-ssm-agent"}},
+	}
+	for _, fileName := range fileNames {
+		manifest.Packages[0].Files = append(manifest.Packages[0].Files, &FileContent{
+			Name:              fileName,
+			AvailableVersions: []*PackageVersion{{Version: "2.3.100.0", Checksum: fileName + "-checksum", Size: 1024}},
+		})
+	}
+	return manifest
+}
+
+func TestUniversalPackageFile(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := universalManifest("amazon-ssm-agent-linux-any.tar.gz")
+
+	assert.NoError(t, validateManifest(log.NewMockLog(), manifest, context, "amazon-ssm-agent"))
+	assert.Empty(t, manifest.Problems())
+	assert.True(t, manifest.HasVersion(context, "amazon-ssm-agent", "2.3.100.0"))
+	assert.Equal(t, []string{"2.3.100.0"}, manifest.AvailableVersionsFor(context, "amazon-ssm-agent"))
+	assert.Equal(t, int64(1024), manifest.DownloadSize(context, "amazon-ssm-agent", "2.3.100.0"))
+	source, hash, err := manifest.DownloadURLAndHash(context, "amazon-ssm-agent", "2.3.100.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/amazon-ssm-agent/2.3.100.0/linux_any/amazon-ssm-agent-linux-any.tar.gz", source)
+	assert.Equal(t, "amazon-ssm-agent-linux-any.tar.gz-checksum", hash)
+
+	// the universal file matches every arch
+	context.Arch = updateutil.ArchArmHF
+	assert.True(t, manifest.HasVersion(context, "amazon-ssm-agent", "2.3.100.0"))
+}
+
+func TestArchSpecificPackageFileIsPreferred(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := universalManifest("amazon-ssm-agent-linux-any.tar.gz", "amazon-ssm-agent-linux-amd64.tar.gz")
+
+	assert.NoError(t, validateManifest(log.NewMockLog(), manifest, context, "amazon-ssm-agent"))
+	source, hash, err := manifest.DownloadURLAndHash(context, "amazon-ssm-agent", "2.3.100.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/amazon-ssm-agent/2.3.100.0/linux_amd64/amazon-ssm-agent-linux-amd64.tar.gz", source)
+	assert.Equal(t, "amazon-ssm-agent-linux-amd64.tar.gz-checksum", hash)
+
+	// the other arches fall back to the universal file
+	context.Arch = "arm64"
+	_, hash, err = manifest.DownloadURLAndHash(context, "amazon-ssm-agent", "2.3.100.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "amazon-ssm-agent-linux-any.tar.gz-checksum", hash)
+}
+
+func TestUniversalPackageFileOfOtherPlatform(t *testing.T) {
+	context := mockInstanceContext()
+	manifest := universalManifest("amazon-ssm-agent-windows-any.zip")
+
+	err := validateManifest(log.NewMockLog(), manifest, context, "amazon-ssm-agent")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "amazon-ssm-agent-linux-amd64.tar.gz")
+	assert.False(t, manifest.HasVersion(context, "amazon-ssm-agent", "2.3.100.0"))
+}
+
+func TestIsCompatibleWith(t *testing.T) {
+	manifest := &Manifest{
+		MinimumPlatformVersions: map[string]string{
+			updateutil.PlatformCentOS: "7",
+			updateutil.PlatformUbuntu: "16.04",
+		},
+	}
+
+	testCases := []struct {
+		platform        string
+		platformVersion string
+		compatible      bool
+	}{
+		// below the declared minimum
+		{updateutil.PlatformCentOS, "6.10", false},
+		{updateutil.PlatformUbuntu, "14.04", false},
+		// at the declared minimum
+		{updateutil.PlatformCentOS, "7", true},
+		{updateutil.PlatformUbuntu, "16.04", true},
+		// above the declared minimum
+		{updateutil.PlatformCentOS, "8.2", true},
+		{updateutil.PlatformUbuntu, "20.04", true},
+		// no declared minimum
+		{updateutil.PlatformRedHat, "6.5", true},
+	}
+
+	for _, test := range testCases {
+		context := &updateutil.InstanceContext{Platform: test.platform, PlatformVersion: test.platformVersion}
+		compatible, reason := manifest.IsCompatibleWith(context)
+		assert.Equal(t, test.compatible, compatible, "%v %v", test.platform, test.platformVersion)
+		if test.compatible {
+			assert.Empty(t, reason)
+		} else {
+			assert.Contains(t, reason, "is below the minimum version")
+		}
+	}
+}
+
+func TestIsCompatibleWithInvalidPlatformVersion(t *testing.T) {
+	manifest := &Manifest{MinimumPlatformVersions: map[string]string{updateutil.PlatformCentOS: "7"}}
+
+	compatible, reason := manifest.IsCompatibleWith(&updateutil.InstanceContext{Platform: updateutil.PlatformCentOS, PlatformVersion: "unknown"})
+
+	assert.False(t, compatible)
+	assert.Contains(t, reason, "failed to compare")
+}
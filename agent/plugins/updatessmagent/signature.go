@@ -0,0 +1,116 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updatessmagent implements the UpdateSsmAgent plugin.
+package updatessmagent
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+)
+
+// VerifyManifestAndArtifact verifies the detached RSA SHA256 signature over the manifest file with the trusted keys,
+// looks up the checksum the manifest declares for the package version and verifies the artifact against it. The
+// signature is accepted when any of the keys verifies it, so the old and the new key are both trusted while the
+// signing key is rotated. The UpdateError of the first failing stage is returned, ErrorInvalidManifestSignature,
+// ErrorInvalidManifest, ErrorPackageNotAccessible or ErrorInvalidPackage.
+func VerifyManifestAndArtifact(
+	log log.T,
+	manifestPath string,
+	signaturePath string,
+	pubKeys []*rsa.PublicKey,
+	artifactPath string,
+	context *updateutil.InstanceContext,
+	packageName string,
+	version string) (err error) {
+
+	// verify the manifest signature
+	var manifestContent, signature []byte
+	if manifestContent, err = ioutil.ReadFile(manifestPath); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifest, err, "failed to read manifest %v", manifestPath)
+	}
+	if signature, err = ioutil.ReadFile(signaturePath); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifestSignature, err, "failed to read manifest signature %v", signaturePath)
+	}
+	var keyIndex int
+	if keyIndex, err = verifySignature(manifestContent, signature, pubKeys); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifestSignature, err, "manifest %v does not match signature %v", manifestPath, signaturePath)
+	}
+	log.Infof("Verified signature of manifest %v with trusted key %v (%v)", manifestPath, keyIndex, keyFingerprint(pubKeys[keyIndex]))
+
+	// look up the checksum of the artifact
+	var manifest *Manifest
+	if manifest, err = ParseManifest(log, manifestPath, context, packageName); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifest, err, "failed to parse manifest %v", manifestPath)
+	}
+	var expectedHash string
+	if _, expectedHash, err = manifest.DownloadURLAndHash(context, packageName, version); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifest, err, "manifest %v has no checksum for %v %v", manifestPath, packageName, version)
+	}
+	if expectedHash == "" {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidManifest, nil, "manifest %v has an empty checksum for %v %v", manifestPath, packageName, version)
+	}
+
+	// verify the artifact
+	if _, err = os.Stat(artifactPath); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorPackageNotAccessible, err, "failed to access package %v", artifactPath)
+	}
+	var actualHash string
+	if actualHash, err = artifact.Sha256HashValue(log, artifactPath); err != nil {
+		return updateutil.NewUpdateError(updateutil.ErrorPackageNotAccessible, err, "failed to compute checksum of package %v", artifactPath)
+	}
+	if !strings.EqualFold(actualHash, expectedHash) {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidPackage, nil,
+			"checksum of package %v is %v, manifest declares %v", artifactPath, actualHash, expectedHash)
+	}
+
+	log.Infof("Verified package %v against manifest %v", artifactPath, manifestPath)
+	return nil
+}
+
+// verifySignature returns the index of the first key verifying the RSA SHA256 signature over the content, an error
+// is returned when none of the keys verifies it
+func verifySignature(content []byte, signature []byte, pubKeys []*rsa.PublicKey) (int, error) {
+	digest := sha256.Sum256(content)
+	configured := false
+	for index, pubKey := range pubKeys {
+		if pubKey == nil {
+			continue
+		}
+		configured = true
+		if rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, digest[:], signature) == nil {
+			return index, nil
+		}
+	}
+	if !configured {
+		return -1, fmt.Errorf("no trusted public key is configured")
+	}
+	return -1, fmt.Errorf("signature is not verified by any of the %v trusted public keys", len(pubKeys))
+}
+
+// keyFingerprint returns the hex encoded SHA256 of the PKCS1 encoding of the public key
+func keyFingerprint(pubKey *rsa.PublicKey) string {
+	fingerprint := sha256.Sum256(x509.MarshalPKCS1PublicKey(pubKey))
+	return hex.EncodeToString(fingerprint[:])
+}
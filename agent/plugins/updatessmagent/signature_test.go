@@ -0,0 +1,205 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updatessmagent implements the UpdateSsmAgent plugin.
+package updatessmagent
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	signedPackageName    = "amazon-ssm-agent"
+	signedPackageVersion = "3.0.0.0"
+	signedPackageContent = "package content"
+)
+
+type signedManifestFiles struct {
+	root          string
+	manifestPath  string
+	signaturePath string
+	artifactPath  string
+	key           *rsa.PrivateKey
+}
+
+// prepareSignedManifest writes a manifest declaring the checksum of the artifact and signs it
+func prepareSignedManifest(t *testing.T) *signedManifestFiles {
+	root, err := ioutil.TempDir("", "signedmanifest")
+	assert.NoError(t, err)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	files := &signedManifestFiles{
+		root:          root,
+		manifestPath:  filepath.Join(root, "manifest.json"),
+		signaturePath: filepath.Join(root, "manifest.json.sig"),
+		artifactPath:  filepath.Join(root, mockInstanceContext().FileName(signedPackageName)),
+		key:           key,
+	}
+
+	checksum := sha256.Sum256([]byte(signedPackageContent))
+	manifest := &Manifest{
+		SchemaVersion: "1.0",
+		URIFormat:     "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/ssm-agent/{PackageVersion}/{FileName}",
+		Packages: []*PackageContent{{
+			Name: signedPackageName,
+			Files: []*FileContent{{
+				Name:              mockInstanceContext().FileName(signedPackageName),
+				AvailableVersions: []*PackageVersion{{Version: signedPackageVersion, Checksum: hex.EncodeToString(checksum[:])}},
+			}},
+		}},
+	}
+	content, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(files.manifestPath, content, 0600))
+	files.sign(t, key)
+	assert.NoError(t, ioutil.WriteFile(files.artifactPath, []byte(signedPackageContent), 0600))
+	return files
+}
+
+// sign writes the signature of the current manifest content with the key
+func (f *signedManifestFiles) sign(t *testing.T, key *rsa.PrivateKey) {
+	content, err := ioutil.ReadFile(f.manifestPath)
+	assert.NoError(t, err)
+	digest := sha256.Sum256(content)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(f.signaturePath, signature, 0600))
+}
+
+func (f *signedManifestFiles) verify(version string) error {
+	return f.verifyWithKeys(version, &f.key.PublicKey)
+}
+
+func (f *signedManifestFiles) verifyWithKeys(version string, pubKeys ...*rsa.PublicKey) error {
+	return VerifyManifestAndArtifact(log.NewMockLog(), f.manifestPath, f.signaturePath, pubKeys,
+		f.artifactPath, mockInstanceContext(), signedPackageName, version)
+}
+
+func TestVerifyManifestAndArtifact(t *testing.T) {
+	files := prepareSignedManifest(t)
+	defer os.RemoveAll(files.root)
+
+	assert.NoError(t, files.verify(signedPackageVersion))
+}
+
+func TestVerifyManifestAndArtifactInvalidSignature(t *testing.T) {
+	files := prepareSignedManifest(t)
+	defer os.RemoveAll(files.root)
+
+	// signed by another key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	files.sign(t, otherKey)
+	err = files.verify(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifestSignature, updateutil.GetErrorCode(err))
+
+	// manifest modified after signing
+	files.sign(t, files.key)
+	content, err := ioutil.ReadFile(files.manifestPath)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(files.manifestPath, append(content, ' '), 0600))
+	err = files.verify(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifestSignature, updateutil.GetErrorCode(err))
+
+	// missing signature
+	assert.NoError(t, os.Remove(files.signaturePath))
+	err = files.verify(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifestSignature, updateutil.GetErrorCode(err))
+}
+
+func TestVerifyManifestAndArtifactTrustedKeys(t *testing.T) {
+	files := prepareSignedManifest(t)
+	defer os.RemoveAll(files.root)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	// signed by the first key
+	assert.NoError(t, files.verifyWithKeys(signedPackageVersion, &files.key.PublicKey, &otherKey.PublicKey))
+
+	// signed by the second key
+	assert.NoError(t, files.verifyWithKeys(signedPackageVersion, &otherKey.PublicKey, &files.key.PublicKey))
+
+	// signed by none of the keys
+	untrustedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	files.sign(t, untrustedKey)
+	err = files.verifyWithKeys(signedPackageVersion, &files.key.PublicKey, &otherKey.PublicKey)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifestSignature, updateutil.GetErrorCode(err))
+
+	// no trusted keys
+	err = files.verifyWithKeys(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifestSignature, updateutil.GetErrorCode(err))
+}
+
+func TestVerifySignatureReturnsMatchingKey(t *testing.T) {
+	firstKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	secondKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	content := []byte("manifest content")
+	digest := sha256.Sum256(content)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, secondKey, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+
+	index, err := verifySignature(content, signature, []*rsa.PublicKey{nil, &firstKey.PublicKey, &secondKey.PublicKey})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, index)
+
+	_, err = verifySignature(content, signature, []*rsa.PublicKey{&firstKey.PublicKey})
+	assert.Error(t, err)
+}
+
+func TestVerifyManifestAndArtifactMissingChecksum(t *testing.T) {
+	files := prepareSignedManifest(t)
+	defer os.RemoveAll(files.root)
+
+	err := files.verify("3.0.0.1")
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidManifest, updateutil.GetErrorCode(err))
+}
+
+func TestVerifyManifestAndArtifactInvalidArtifact(t *testing.T) {
+	files := prepareSignedManifest(t)
+	defer os.RemoveAll(files.root)
+
+	assert.NoError(t, ioutil.WriteFile(files.artifactPath, []byte("tampered content"), 0600))
+	err := files.verify(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
+
+	assert.NoError(t, os.Remove(files.artifactPath))
+	err = files.verify(signedPackageVersion)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorPackageNotAccessible, updateutil.GetErrorCode(err))
+}
@@ -17,6 +17,7 @@ package updatessmagent
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -45,11 +46,13 @@ type Plugin struct {
 // UpdatePluginInput represents one set of commands executed by the UpdateAgent plugin.
 type UpdatePluginInput struct {
 	contracts.PluginInput
-	AgentName      string `json:"agentName"`
-	AllowDowngrade string `json:"allowDowngrade"`
-	TargetVersion  string `json:"targetVersion"`
-	Source         string `json:"source"`
-	UpdaterName    string `json:"-"`
+	AgentName        string `json:"agentName"`
+	AllowDowngrade   string `json:"allowDowngrade"`
+	TargetVersion    string `json:"targetVersion"`
+	Source           string `json:"source"`
+	InstallTimeout   string `json:"installTimeout"`
+	UninstallTimeout string `json:"uninstallTimeout"`
+	UpdaterName      string `json:"-"`
 }
 
 // UpdatePluginConfig is used for initializing update agent plugin with default values
@@ -93,8 +96,13 @@ type pluginHelper interface {
 
 // Assign method to global variables to allow unittest to override
 var getAppConfig = appconfig.Config
-var fileDownload = artifact.Download
-var fileUncompress = fileutil.Uncompress
+var fileDownload = artifact.DownloadWithRetry
+var isUpdateNeeded = updateutil.IsUpdateNeeded
+var getInstalledAgentVersion = updateutil.GetInstalledAgentVersion
+var verifyApprovedVersion = updateutil.VerifyApprovedVersion
+var verifyPackageForContext = updateutil.VerifyPackageForContext
+var fileUncompress = updateutil.ExtractPackage
+var ensureExecutable = updateutil.EnsureExecutable
 var updateAgent = runUpdateAgent
 
 // NewPlugin returns a new instance of the plugin.
@@ -149,16 +157,46 @@ func runUpdateAgent(
 		version.Version,
 		targetVersion)
 
+	//Skip the downloads when the requested version is already installed
+	if len(pluginInput.TargetVersion) > 0 {
+		if needed, neededErr := isUpdateNeeded(log, context, pluginInput.TargetVersion); neededErr != nil {
+			log.Debugf("failed to check if the update is needed, %v", neededErr)
+		} else if !needed {
+			output.AppendInfof("%v %v has already been installed, update skipped\n",
+				pluginInput.AgentName,
+				pluginInput.TargetVersion)
+			output.MarkAsSucceeded()
+			return
+		}
+	}
+
+	// Fail fast when the instance does not have the memory to extract and install the packages
+	// If loading the available memory fails, continue to update like the disk space check
+	if isMemorySufficient, err := util.IsMemorySufficientForUpdate(log, 0); err != nil {
+		log.Warnf("Continuing update without memory check, %v", err)
+	} else if !isMemorySufficient {
+		output.MarkAsFailed(errors.New("Insufficient available memory"))
+		return
+	}
+
+	//Time the phases of the update for the update result
+	recorder := updateutil.NewMetricRecorder(nil)
+
 	//Download manifest file
+	recorder.StartPhase(updateutil.PhaseDownload)
 	manifest, downloadErr := manager.downloadManifest(log, util, &pluginInput, context, output)
+	recorder.StopPhase(updateutil.PhaseDownload, downloadErr)
 	if downloadErr != nil {
 		output.MarkAsFailed(downloadErr)
 		return
 	}
 
 	//Validate update details
+	recorder.StartPhase(updateutil.PhaseVerify)
 	noNeedToUpdate := false
-	if noNeedToUpdate, err = manager.validateUpdate(log, &pluginInput, context, manifest, output); noNeedToUpdate {
+	noNeedToUpdate, err = manager.validateUpdate(log, &pluginInput, context, manifest, output)
+	recorder.StopPhase(updateutil.PhaseVerify, err)
+	if noNeedToUpdate {
 		if err != nil {
 			output.MarkAsFailed(err)
 		}
@@ -166,9 +204,11 @@ func runUpdateAgent(
 	}
 
 	//Download updater and retrieve the version number
+	recorder.StartPhase(updateutil.PhaseDownload)
 	updaterVersion := ""
-	if updaterVersion, err = manager.downloadUpdater(
-		log, util, pluginInput.UpdaterName, manifest, output, context); err != nil {
+	updaterVersion, err = manager.downloadUpdater(log, util, pluginInput.UpdaterName, manifest, output, context)
+	recorder.StopPhase(updateutil.PhaseDownload, err)
+	if err != nil {
 		output.MarkAsFailed(err)
 		return
 	}
@@ -194,6 +234,7 @@ func runUpdateAgent(
 	updatePluginResult := &updateutil.UpdatePluginResult{
 		StandOut:      output.GetStdout(),
 		StartDateTime: startTime,
+		Durations:     recorder.Summary(),
 	}
 	if err = util.SaveUpdatePluginResult(log, appconfig.UpdaterArtifactsRoot, updatePluginResult); err != nil {
 		output.MarkAsFailed(err)
@@ -202,8 +243,14 @@ func runUpdateAgent(
 
 	// If disk space is not sufficient, fail the update to prevent installation and notify user in output
 	// If loading disk space fails, continue to update (agent update is backed by rollback handler)
+	// The space is checked against the size of the target package declared in the manifest when it is available,
+	// on the volume the updater downloads the packages to
 	log.Infof("Checking available disk space ...")
-	if isDiskSpaceSufficient, err := util.IsDiskSpaceSufficientForUpdate(log); err == nil && !isDiskSpaceSufficient {
+	artifactSize := manifest.DownloadSize(context, pluginInput.AgentName, pluginInput.TargetVersion)
+	if isDiskSpaceSufficient, err := util.IsDiskSpaceSufficientForUpdateInFolder(
+		log, appconfig.UpdaterArtifactsRoot, artifactSize); err != nil {
+		log.Warnf("Continuing update without disk space check, %v", err)
+	} else if !isDiskSpaceSufficient {
 		output.MarkAsFailed(errors.New("Insufficient available disk space"))
 		return
 	}
@@ -214,6 +261,13 @@ func runUpdateAgent(
 	workDir := updateutil.UpdateArtifactFolder(
 		appconfig.UpdaterArtifactsRoot, pluginInput.UpdaterName, updaterVersion)
 
+	// a freshly extracted updater may lack the execute bit
+	updaterPath := updateutil.UpdaterFilePath(appconfig.UpdaterArtifactsRoot, pluginInput.UpdaterName, updaterVersion)
+	if err = ensureExecutable(log, updaterPath, true); err != nil {
+		output.MarkAsFailed(err)
+		return
+	}
+
 	if err = util.ExeCommand(
 		log,
 		cmd,
@@ -272,15 +326,45 @@ func (m *updateManager) generateUpdateCmd(log log.T,
 	cmd = updateutil.BuildUpdateCommand(cmd, updateutil.OutputKeyPrefixCmd, keyPrefix)
 	cmd = updateutil.BuildUpdateCommand(cmd, updateutil.OutputBucketNameCmd, bucketName)
 
+	// the updater uses the update execution timeout for the install and uninstall scripts when the timeouts are not set
+	if pluginInput.InstallTimeout != "" {
+		if err = validateScriptTimeout(pluginInput.InstallTimeout); err != nil {
+			return "", fmt.Errorf("invalid install timeout, %v", err)
+		}
+		cmd = updateutil.BuildUpdateCommand(cmd, updateutil.InstallTimeoutCmd, pluginInput.InstallTimeout)
+	}
+	if pluginInput.UninstallTimeout != "" {
+		if err = validateScriptTimeout(pluginInput.UninstallTimeout); err != nil {
+			return "", fmt.Errorf("invalid uninstall timeout, %v", err)
+		}
+		cmd = updateutil.BuildUpdateCommand(cmd, updateutil.UninstallTimeoutCmd, pluginInput.UninstallTimeout)
+	}
+
 	return
 }
 
+// validateScriptTimeout returns an error when the timeout is not a positive number of seconds
+func validateScriptTimeout(timeout string) error {
+	seconds, err := strconv.Atoi(timeout)
+	if err != nil {
+		return err
+	}
+	if seconds <= 0 {
+		return fmt.Errorf("%v is not a positive number of seconds", timeout)
+	}
+	return nil
+}
+
 //downloadManifest downloads manifest file from s3 bucket
 func (m *updateManager) downloadManifest(log log.T,
 	util updateutil.T,
 	pluginInput *UpdatePluginInput,
 	context *updateutil.InstanceContext,
 	out iohandler.IOHandler) (manifest *Manifest, err error) {
+	if err = updateutil.ValidateManifestLocation(pluginInput.Source); err != nil {
+		return nil, err
+	}
+
 	//Download source
 	var updateDownload = ""
 	updateDownload, err = util.CreateUpdateDownloadFolder()
@@ -336,6 +420,9 @@ func (m *updateManager) downloadUpdater(log log.T,
 		downloadOutput.IsHashMatched == false ||
 		downloadOutput.LocalFilePath == "" {
 
+		if statusCode := artifact.DownloadStatusCode(downloadErr); statusCode == http.StatusNotFound || statusCode == http.StatusForbidden {
+			return version, updateutil.NewDownloadError(statusCode, updateutil.ErrorPackageNotAccessible, downloadErr, downloadInput.SourceURL)
+		}
 		errMessage := fmt.Sprintf("failed to download file reliably, %v\n", downloadInput.SourceURL)
 		if downloadErr != nil {
 			errMessage = fmt.Sprintf("%v, %v", errMessage, downloadErr.Error())
@@ -345,12 +432,20 @@ func (m *updateManager) downloadUpdater(log log.T,
 	out.AppendInfof("Successfully downloaded %v\n", downloadInput.SourceURL)
 	if uncompressErr := fileUncompress(
 		log,
+		context,
 		downloadOutput.LocalFilePath,
 		updateutil.UpdateArtifactFolder(appconfig.UpdaterArtifactsRoot, updaterPackageName, version)); uncompressErr != nil {
 		return version, fmt.Errorf("failed to uncompress updater package, %v, %v\n",
 			downloadOutput.LocalFilePath,
 			uncompressErr.Error())
 	}
+	// the updater is run next, fail when the package is built for another arch
+	if err = verifyPackageForContext(
+		log,
+		updateutil.UpdaterFilePath(appconfig.UpdaterArtifactsRoot, updaterPackageName, version),
+		context); err != nil {
+		return version, err
+	}
 
 	return version, nil
 }
@@ -386,12 +481,18 @@ func (m *updateManager) validateUpdate(log log.T,
 		return true, nil
 	}
 
-	if res == -1 && !allowDowngrade {
-		return true,
-			fmt.Errorf(
-				"updating %v to an older version, please enable allow downgrade to proceed\n",
-				pluginInput.AgentName)
-
+	// The downgrade is checked against the version the updater last installed successfully,
+	// the version of the running agent is used when it cannot be loaded
+	installedVersion, loadErr := getInstalledAgentVersion(log, appconfig.UpdaterArtifactsRoot)
+	if loadErr != nil {
+		log.Warnf("failed to load the installed agent version, checking downgrade against %v, %v", currentVersion, loadErr)
+		installedVersion = currentVersion
+	}
+	if err = updateutil.CheckDowngrade(log, installedVersion, pluginInput.TargetVersion, allowDowngrade); err != nil {
+		return true, err
+	}
+	if err = verifyApprovedVersion(log, pluginInput.TargetVersion); err != nil {
+		return true, err
 	}
 	if !manifest.HasVersion(context, pluginInput.AgentName, pluginInput.TargetVersion) {
 		return true,
@@ -407,6 +508,9 @@ func (m *updateManager) validateUpdate(log log.T,
 				pluginInput.AgentName,
 				currentVersion)
 	}
+	if compatible, reason := manifest.IsCompatibleWith(context); !compatible {
+		return true, fmt.Errorf("%v version %v is unsupported, %v\n", pluginInput.AgentName, pluginInput.TargetVersion, reason)
+	}
 
 	return false, nil
 }
@@ -414,7 +518,8 @@ func (m *updateManager) validateUpdate(log log.T,
 func (p *Plugin) Execute(context context.T, config contracts.Configuration, cancelFlag task.CancelFlag, output iohandler.IOHandler) {
 	log := context.Log()
 	log.Info("RunCommand started with configuration ", config)
-	util := new(updateutil.Utility)
+	util := &updateutil.Utility{OperationID: updateutil.NewOperationID()}
+	log.Infof("Update operation %v started", util.OperationID)
 	manager := new(updateManager)
 
 	if cancelFlag.ShutDown() {
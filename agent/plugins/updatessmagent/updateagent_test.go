@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/context"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
@@ -50,6 +51,49 @@ func TestGenerateUpdateCmd(t *testing.T) {
 	assert.Contains(t, result, "bucket")
 }
 
+func TestGenerateUpdateCmdWithScriptTimeouts(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.InstallTimeout = "600"
+	plugin.UninstallTimeout = "120"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+	manager := updateManager{}
+
+	result, err := manager.generateUpdateCmd(logger, manifest, plugin, context,
+		"path", "messageID", "stdout", "stderr", "prefix", "bucket")
+
+	assert.NoError(t, err)
+	assert.Contains(t, result, updateutil.BuildUpdateCommand("", updateutil.InstallTimeoutCmd, "600"))
+	assert.Contains(t, result, updateutil.BuildUpdateCommand("", updateutil.UninstallTimeoutCmd, "120"))
+}
+
+func TestGenerateUpdateCmdWithoutScriptTimeouts(t *testing.T) {
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+	manager := updateManager{}
+
+	result, err := manager.generateUpdateCmd(logger, manifest, plugin, context,
+		"path", "messageID", "stdout", "stderr", "prefix", "bucket")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, result, updateutil.InstallTimeoutCmd)
+	assert.NotContains(t, result, updateutil.UninstallTimeoutCmd)
+}
+
+func TestGenerateUpdateCmdWithInvalidScriptTimeout(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.UninstallTimeout = "-1"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+	manager := updateManager{}
+
+	_, err := manager.generateUpdateCmd(logger, manifest, plugin, context,
+		"path", "messageID", "stdout", "stderr", "prefix", "bucket")
+
+	assert.Error(t, err)
+}
+
 func TestDownloadManifest(t *testing.T) {
 	plugin := createStubPluginInput()
 	context := createStubInstanceContext()
@@ -71,6 +115,29 @@ func TestDownloadManifest(t *testing.T) {
 	assert.NotNil(t, manifest)
 }
 
+func TestDownloadManifestWithInvalidLocation(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.Source = "htps://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/ssm-agent-manifest.json"
+	context := createStubInstanceContext()
+
+	manager := updateManager{}
+	util := fakeUtility{}
+	out := iohandler.DefaultIOHandler{}
+
+	downloadCalled := false
+	fileDownload = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		downloadCalled = true
+		return artifact.DownloadOutput{}, nil
+	}
+
+	manifest, err := manager.downloadManifest(logger, &util, plugin, context, &out)
+
+	assert.Error(t, err)
+	assert.Nil(t, manifest)
+	assert.Equal(t, updateutil.ErrorInvalidManifestLocation, updateutil.GetErrorCode(err))
+	assert.False(t, downloadCalled)
+}
+
 func TestDownloadUpdater(t *testing.T) {
 	plugin := createStubPluginInput()
 	context := createStubInstanceContext()
@@ -87,13 +154,49 @@ func TestDownloadUpdater(t *testing.T) {
 		return result, nil
 	}
 
-	fileUncompress = func(log log.T, src, dest string) error {
+	fileUncompress = func(log log.T, context *updateutil.InstanceContext, src, dest string) error {
+		return nil
+	}
+	defer func() { verifyPackageForContext = updateutil.VerifyPackageForContext }()
+	var verifiedPath string
+	verifyPackageForContext = func(log log.T, filePath string, context *updateutil.InstanceContext) error {
+		verifiedPath = filePath
 		return nil
 	}
 
-	_, err := manager.downloadUpdater(logger, &util, plugin.AgentName, manifest, &out, context)
+	version, err := manager.downloadUpdater(logger, &util, plugin.AgentName, manifest, &out, context)
 
 	assert.NoError(t, err)
+	assert.Equal(t, updateutil.UpdaterFilePath(appconfig.UpdaterArtifactsRoot, plugin.AgentName, version), verifiedPath)
+}
+
+func TestDownloadUpdater_BuiltForAnotherArch(t *testing.T) {
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	manager := updateManager{}
+	util := fakeUtility{}
+	out := iohandler.DefaultIOHandler{}
+
+	fileDownload = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		result := artifact.DownloadOutput{}
+		result.IsHashMatched = true
+		result.LocalFilePath = "updater/location"
+		return result, nil
+	}
+	fileUncompress = func(log log.T, context *updateutil.InstanceContext, src, dest string) error {
+		return nil
+	}
+	defer func() { verifyPackageForContext = updateutil.VerifyPackageForContext }()
+	verifyPackageForContext = func(log log.T, filePath string, context *updateutil.InstanceContext) error {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidPackage, nil, "%v is built for arm64, expected amd64", filePath)
+	}
+
+	_, err := manager.downloadUpdater(logger, &util, plugin.AgentName, manifest, &out, context)
+
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
 }
 
 func TestDownloadUpdater_HashDoesNotMatch(t *testing.T) {
@@ -120,6 +223,26 @@ func TestDownloadUpdater_HashDoesNotMatch(t *testing.T) {
 	assert.Contains(t, err.Error(), "404")
 }
 
+func TestDownloadUpdater_AccessDenied(t *testing.T) {
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	manager := updateManager{}
+	util := fakeUtility{}
+	out := iohandler.DefaultIOHandler{}
+
+	fileDownload = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		return artifact.DownloadOutput{}, &artifact.HTTPStatusError{StatusCode: 403, Status: "403 Forbidden"}
+	}
+
+	_, err := manager.downloadUpdater(logger, &util, plugin.AgentName, manifest, &out, context)
+
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorPackageAccessDenied, updateutil.GetErrorCode(err))
+	assert.Contains(t, err.Error(), "verify the permissions of the instance role")
+}
+
 func TestDownloadUpdater_FailedDuringUnCompress(t *testing.T) {
 	plugin := createStubPluginInput()
 	context := createStubInstanceContext()
@@ -136,7 +259,7 @@ func TestDownloadUpdater_FailedDuringUnCompress(t *testing.T) {
 		return result, nil
 	}
 
-	fileUncompress = func(log log.T, src, dest string) error {
+	fileUncompress = func(log log.T, context *updateutil.InstanceContext, src, dest string) error {
 		return fmt.Errorf("Failed with uncompress")
 	}
 
@@ -208,6 +331,68 @@ func TestValidateUpdate_DowngradeVersion(t *testing.T) {
 	assert.Contains(t, err.Error(), "please enable allow downgrade to proceed")
 }
 
+func TestValidateUpdate_DowngradeFromInstalledVersion(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.AllowDowngrade = "false"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	getInstalledAgentVersion = func(log log.T, updateRoot string) (string, error) {
+		assert.Equal(t, appconfig.UpdaterArtifactsRoot, updateRoot)
+		return "9001.0.0.0", nil
+	}
+	defer func() { getInstalledAgentVersion = updateutil.GetInstalledAgentVersion }()
+
+	manager := updateManager{}
+	out := iohandler.DefaultIOHandler{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.True(t, noNeedToUpdate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "please enable allow downgrade to proceed")
+}
+
+func TestValidateUpdate_InstalledVersionCannotBeLoaded(t *testing.T) {
+	plugin := createStubPluginInput()
+	plugin.AllowDowngrade = "false"
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	getInstalledAgentVersion = func(log log.T, updateRoot string) (string, error) {
+		return "", updateutil.NewUpdateError(updateutil.ErrorLoadingAgentVersion, nil, "invalid installed agent version")
+	}
+	defer func() { getInstalledAgentVersion = updateutil.GetInstalledAgentVersion }()
+
+	manager := updateManager{}
+	out := iohandler.DefaultIOHandler{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.False(t, noNeedToUpdate)
+	assert.NoError(t, err)
+}
+
+func TestValidateUpdate_TargetVersionNotApproved(t *testing.T) {
+	plugin := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(plugin, context, true, true)
+
+	verifyApprovedVersion = func(log log.T, targetVersion string) error {
+		return fmt.Errorf("target version %v is not approved", targetVersion)
+	}
+	defer func() { verifyApprovedVersion = updateutil.VerifyApprovedVersion }()
+
+	manager := updateManager{}
+	out := iohandler.DefaultIOHandler{}
+
+	noNeedToUpdate, err := manager.validateUpdate(logger, plugin, context, manifest, &out)
+
+	assert.True(t, noNeedToUpdate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not approved")
+}
+
 func TestValidateUpdate_TargetVersionNotSupport(t *testing.T) {
 	plugin := createStubPluginInput()
 	plugin.TargetVersion = "1.1.1.999"
@@ -276,6 +461,9 @@ func TestUpdateAgent(t *testing.T) {
 		},
 	}
 
+	defer func() { ensureExecutable = updateutil.EnsureExecutable }()
+	ensureExecutable = func(log log.T, path string, fix bool) error { return nil }
+
 	pluginInput.TargetVersion = ""
 	mockCancelFlag := new(task.MockCancelFlag)
 	util := fakeUtility{}
@@ -287,6 +475,28 @@ func TestUpdateAgent(t *testing.T) {
 	}
 }
 
+func TestUpdateAgentFailsWhenUpdaterIsNotExecutable(t *testing.T) {
+	defer func() { ensureExecutable = updateutil.EnsureExecutable }()
+	pluginInput := createStubPluginInput()
+	context := createStubInstanceContext()
+	manager := fakeUpdateManager{
+		generateUpdateCmdResult: "-updater -message id value",
+		downloadManifestResult:  createStubManifest(pluginInput, context, true, true),
+		downloadUpdaterResult:   "updater",
+	}
+	checkedPath := ""
+	ensureExecutable = func(log log.T, path string, fix bool) error {
+		checkedPath = path
+		return fmt.Errorf("%v is not executable", path)
+	}
+	out := iohandler.DefaultIOHandler{}
+
+	updateAgent(&Plugin{}, contracts.Configuration{}, logger, &manager, &fakeUtility{}, pluginInput, new(task.MockCancelFlag), &out, time.Now())
+
+	assert.Equal(t, updateutil.UpdaterFilePath(appconfig.UpdaterArtifactsRoot, pluginInput.AgentName+updateutil.UpdaterPackageNamePrefix, "updater"), checkedPath)
+	assert.Contains(t, out.GetStderr(), "is not executable")
+}
+
 func TestUpdateAgent_NegativeTestCases(t *testing.T) {
 	pluginInput := createStubPluginInput()
 	pluginInput.TargetVersion = ""
@@ -337,6 +547,74 @@ func TestUpdateAgent_NegativeTestCases(t *testing.T) {
 	}
 }
 
+func TestUpdateAgentChecksDiskSpaceWithManifestSize(t *testing.T) {
+	pluginInput := createStubPluginInput()
+	context := createStubInstanceContext()
+	manifest := createStubManifest(pluginInput, context, true, true)
+	for _, p := range manifest.Packages {
+		for _, f := range p.Files {
+			for _, v := range f.AvailableVersions {
+				if p.Name == pluginInput.AgentName && v.Version == pluginInput.TargetVersion {
+					v.Size = 52428800
+				}
+			}
+		}
+	}
+	manager := fakeUpdateManager{
+		generateUpdateCmdResult: "-updater -message id value",
+		downloadManifestResult:  manifest,
+		downloadUpdaterResult:   "updater",
+	}
+	util := fakeUtility{}
+	out := iohandler.DefaultIOHandler{}
+	defer func() { ensureExecutable = updateutil.EnsureExecutable }()
+	ensureExecutable = func(log log.T, path string, fix bool) error { return nil }
+
+	updateAgent(&Plugin{}, contracts.Configuration{}, logger, &manager, &util, pluginInput, new(task.MockCancelFlag), &out, time.Now())
+
+	assert.Empty(t, out.GetStderr())
+	assert.Equal(t, int64(52428800), util.diskSpaceArtifactSize)
+	assert.Equal(t, appconfig.UpdaterArtifactsRoot, util.diskSpaceFolder)
+}
+
+func TestUpdateAgentFailsWithInsufficientMemory(t *testing.T) {
+	pluginInput := createStubPluginInput()
+	// the memory is checked before the manifest is downloaded
+	manager := fakeUpdateManager{
+		downloadManifestError: fmt.Errorf("manifest should not be downloaded"),
+	}
+	util := fakeUtility{insufficientMemory: true}
+	out := iohandler.DefaultIOHandler{}
+
+	updateAgent(&Plugin{}, contracts.Configuration{}, logger, &manager, &util, pluginInput, new(task.MockCancelFlag), &out, time.Now())
+
+	assert.Contains(t, out.GetStderr(), "Insufficient available memory")
+	assert.NotContains(t, out.GetStderr(), "manifest should not be downloaded")
+}
+
+func TestUpdateAgentSkipsDownloadsWhenTargetIsInstalled(t *testing.T) {
+	defer func() { isUpdateNeeded = updateutil.IsUpdateNeeded }()
+	pluginInput := createStubPluginInput()
+	var checkedVersion string
+	isUpdateNeeded = func(log log.T, context *updateutil.InstanceContext, targetVersion string) (bool, error) {
+		checkedVersion = targetVersion
+		return false, nil
+	}
+	// the update fails if the manifest is downloaded
+	manager := fakeUpdateManager{
+		downloadManifestError: fmt.Errorf("manifest should not be downloaded"),
+	}
+	util := fakeUtility{}
+	out := iohandler.DefaultIOHandler{}
+
+	updateAgent(&Plugin{}, contracts.Configuration{}, logger, &manager, &util, pluginInput, new(task.MockCancelFlag), &out, time.Now())
+
+	assert.Empty(t, out.GetStderr())
+	assert.Equal(t, pluginInput.TargetVersion, checkedVersion)
+	assert.Contains(t, out.GetStdout(), "already been installed, update skipped")
+	assert.Equal(t, contracts.ResultStatusSuccess, out.GetStatus())
+}
+
 func TestExecute(t *testing.T) {
 	pluginInput := createStubPluginInput()
 	pluginInput.TargetVersion = ""
@@ -380,6 +658,7 @@ func createStubPluginInput() *UpdatePluginInput {
 	input.TargetVersion = "9000.0.0.0"
 	input.AgentName = "amazon-ssm-agent"
 	input.AllowDowngrade = "true"
+	input.Source = "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/ssm-agent-manifest.json"
 	return &input
 }
 
@@ -419,7 +698,11 @@ func createStubInstanceContext() *updateutil.InstanceContext {
 	return &context
 }
 
-type fakeUtility struct{}
+type fakeUtility struct {
+	diskSpaceArtifactSize int64
+	diskSpaceFolder       string
+	insufficientMemory    bool
+}
 
 func (u *fakeUtility) CreateInstanceContext(log log.T) (context *updateutil.InstanceContext, err error) {
 	return createStubInstanceContext(), nil
@@ -433,6 +716,10 @@ func (u *fakeUtility) WaitForServiceToStart(log log.T, i *updateutil.InstanceCon
 	return true, nil
 }
 
+func (u *fakeUtility) WaitForServiceRunning(log log.T, i *updateutil.InstanceContext, timeout time.Duration, interval time.Duration) (result bool, err error) {
+	return true, nil
+}
+
 func (u *fakeUtility) CreateUpdateDownloadFolder() (folder string, err error) {
 	return "", nil
 }
@@ -448,6 +735,17 @@ func (u *fakeUtility) ExeCommand(
 	return nil
 }
 
+func (u *fakeUtility) ExeCommandWithTimeout(
+	log log.T,
+	cmd string,
+	workingDir string,
+	updaterRoot string,
+	stdOut string,
+	stdErr string,
+	timeout time.Duration) (err error) {
+	return nil
+}
+
 func (u *fakeUtility) SaveUpdatePluginResult(
 	log log.T,
 	updateRoot string,
@@ -455,10 +753,25 @@ func (u *fakeUtility) SaveUpdatePluginResult(
 	return nil
 }
 
-func (u *fakeUtility) IsDiskSpaceSufficientForUpdate(log log.T) (bool, error) {
+func (u *fakeUtility) IsMemorySufficientForUpdate(log log.T, requiredBytes int64) (bool, error) {
+	return !u.insufficientMemory, nil
+}
+
+func (u *fakeUtility) IsDiskSpaceSufficientForUpdate(log log.T, artifactSize int64) (bool, error) {
+	u.diskSpaceArtifactSize = artifactSize
 	return true, nil
 }
 
+func (u *fakeUtility) IsDiskSpaceSufficientForUpdateInFolder(log log.T, folder string, artifactSize int64) (bool, error) {
+	u.diskSpaceFolder = folder
+	u.diskSpaceArtifactSize = artifactSize
+	return true, nil
+}
+
+func (u *fakeUtility) VerifyInstalledVersion(log log.T, context *updateutil.InstanceContext, expectedVersion string) (err error) {
+	return nil
+}
+
 type fakeUpdateManager struct {
 	generateUpdateCmdResult string
 	generateUpdateCmdError  error
@@ -29,6 +29,7 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/framework/processor/executer/outofproc/proc"
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
 	"github.com/aws/amazon-ssm-agent/agent/s3util"
@@ -64,8 +65,15 @@ const (
 const (
 	// maxAllowedUpdateDuration represents the maximum allowed agent update time in seconds
 	maxAllowedUpdateDuration = 180
+
+	// staleUpdateContextDuration represents the time in seconds after which an unchanged update context of a dead updater is cleared
+	staleUpdateContextDuration = 1800
 )
 
+var isUpdaterProcessAlive = func(log log.T, pid int) bool {
+	return proc.IsProcessExists(log, pid, time.Time{})
+}
+
 // ContextMgr reprents context management logics
 type ContextMgr interface {
 	uploadOutput(log log.T, context *UpdateContext, orchestrationDir string) error
@@ -96,6 +104,11 @@ type UpdateDetail struct {
 	MessageID          string                 `json:"MessageId"`
 	UpdateRoot         string                 `json:"UpdateRoot"`
 	RequiresUninstall  bool                   `json:"RequiresUninstall"`
+	DryRun             bool                   `json:"DryRun"`
+	UpdaterPid         int                    `json:"UpdaterPid"`
+	OperationID        string                 `json:"OperationID,omitempty"`
+	InstallTimeout     int                    `json:"InstallTimeout,omitempty"`
+	UninstallTimeout   int                    `json:"UninstallTimeout,omitempty"`
 }
 
 // UpdateContext holds the book keeping details for Update context
@@ -211,6 +224,48 @@ func getOrchestrationDir(log log.T, update *UpdateDetail) string {
 	return orchestrationDirectory
 }
 
+// ClearStaleUpdateContext clears the current update of the update context when the context file has not changed for
+// staleThreshold and the updater that owns it is no longer running, it returns whether the current update was cleared
+func ClearStaleUpdateContext(log log.T, updateRoot string, staleThreshold time.Duration) (cleared bool, err error) {
+	contextLocation := updateutil.UpdateContextFilePath(updateRoot)
+	fileInfo, err := os.Stat(contextLocation)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	age := time.Since(fileInfo.ModTime())
+	if age < staleThreshold {
+		log.Debugf("UpdateContext was modified %v ago, keeping it", age)
+		return false, nil
+	}
+
+	var context *UpdateContext
+	if context, err = parseContext(log, contextLocation); err != nil {
+		return false, err
+	}
+	if context.Current == nil || context.Current.State == "" {
+		return false, nil
+	}
+
+	if pid := context.Current.UpdaterPid; pid > 0 && pid != os.Getpid() && isUpdaterProcessAlive(log, pid) {
+		log.Infof("UpdateContext was modified %v ago but updater %v is still running, keeping it", age, pid)
+		return false, nil
+	}
+
+	log.Warnf("Clearing stale update to %v in state %v, UpdateContext was modified %v ago",
+		context.Current.TargetVersion,
+		context.Current.State,
+		age)
+	context.cleanUpdate()
+	c := contextManager{}
+	if err = c.saveUpdateContext(log, context, contextLocation); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (context *UpdateContext) cleanUpdate() {
 	context.Histories = append(context.Histories, context.Current)
 	context.Current = &UpdateDetail{}
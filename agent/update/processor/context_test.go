@@ -0,0 +1,94 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor contains the methods for update ssm agent.
+// It also provides methods for sendReply and updateInstanceInfo
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveContextWithAge saves an update context owned by the updater pid and sets its modification time to age ago
+func saveContextWithAge(t *testing.T, updateRoot string, pid int, age time.Duration) {
+	context := &UpdateContext{
+		Current: &UpdateDetail{
+			State:         Staged,
+			TargetVersion: "5.1.0.0",
+			UpdateRoot:    updateRoot,
+			UpdaterPid:    pid,
+		},
+	}
+	contextLocation := updateutil.UpdateContextFilePath(updateRoot)
+	c := contextManager{}
+	assert.NoError(t, c.saveUpdateContext(logger, context, contextLocation))
+	modTime := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(contextLocation, modTime, modTime))
+}
+
+func TestClearStaleUpdateContext(t *testing.T) {
+	processAlive := isUpdaterProcessAlive
+	defer func() { isUpdaterProcessAlive = processAlive }()
+
+	testCases := []struct {
+		name          string
+		age           time.Duration
+		updaterAlive  bool
+		expectCleared bool
+	}{
+		{"fresh", time.Minute, false, false},
+		{"stale", 2 * time.Hour, false, true},
+		{"active", 2 * time.Hour, true, false},
+	}
+
+	for _, testCase := range testCases {
+		updateRoot, err := ioutil.TempDir("", "updatecontext")
+		assert.NoError(t, err)
+		defer os.RemoveAll(updateRoot)
+
+		saveContextWithAge(t, updateRoot, 4321, testCase.age)
+		updaterAlive := testCase.updaterAlive
+		isUpdaterProcessAlive = func(log log.T, pid int) bool { return pid == 4321 && updaterAlive }
+
+		cleared, err := ClearStaleUpdateContext(logger, updateRoot, 30*time.Minute)
+		assert.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.expectCleared, cleared, testCase.name)
+
+		context, err := LoadUpdateContext(logger, updateutil.UpdateContextFilePath(updateRoot))
+		assert.NoError(t, err, testCase.name)
+		if testCase.expectCleared {
+			assert.Equal(t, UpdateState(""), context.Current.State, testCase.name)
+			assert.Equal(t, 1, len(context.Histories), testCase.name)
+			assert.Equal(t, Staged, context.Histories[0].State, testCase.name)
+		} else {
+			assert.Equal(t, Staged, context.Current.State, testCase.name)
+		}
+	}
+}
+
+func TestClearStaleUpdateContextWithoutContextFile(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatecontext")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	cleared, err := ClearStaleUpdateContext(logger, updateRoot, 30*time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, cleared)
+}
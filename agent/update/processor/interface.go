@@ -52,6 +52,12 @@ type updateManager struct {
 	uninstall uninstall
 	install   install
 	download  download
+	// metrics records the duration and the outcome of the update phases, phase is the running phase
+	metrics *updateutil.MetricRecorder
+	phase   updateutil.UpdatePhase
+	// downloads are the paths of the downloaded installation packages by version, the package of the target
+	// version is kept once it installed successfully when the update artifacts are kept
+	downloads map[string]string
 }
 
 // Updater contains logic for performing agent update
@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor contains the methods for update ssm agent.
+// It also provides methods for sendReply and updateInstanceInfo
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil/filelock"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+)
+
+// UpdateLockFileName represents the name of the lock file held by the running updater
+const UpdateLockFileName = "update.lock"
+
+var fileLocker = filelock.NewFileLocker()
+
+// updateLockTimeoutSeconds represents the time in seconds after which the lock of an updater is expired
+var updateLockTimeoutSeconds = staleUpdateContextDuration
+
+// UpdateLockFilePath returns the update lock file path
+func UpdateLockFilePath(updateRoot string) string {
+	return filepath.Join(updateRoot, UpdateLockFileName)
+}
+
+// AcquireUpdateLock locks the update root for the current updater, an UpdateError with ErrorEnvironmentIssue is
+// returned when another updater holds the lock. The lock of a dead updater or an expired lock is taken over.
+// The release func returned must be deferred so the lock is released on every return of the updater.
+func AcquireUpdateLock(log log.T, updateRoot string) (release func(), err error) {
+	lockPath := UpdateLockFilePath(updateRoot)
+	ownerId := filelock.GetOwnerIdForProcess()
+
+	if err = fileutil.MakeDirs(updateRoot); err != nil {
+		return nil, updateutil.NewUpdateError(updateutil.ErrorEnvironmentIssue, err, "failed to create update root %v", updateRoot)
+	}
+	removeLockOfDeadUpdater(log, lockPath)
+
+	var locked bool
+	if locked, err = fileLocker.Lock(lockPath, ownerId, updateLockTimeoutSeconds); err != nil {
+		return nil, updateutil.NewUpdateError(updateutil.ErrorEnvironmentIssue, err, "failed to lock %v", lockPath)
+	}
+	if !locked {
+		return nil, updateutil.NewUpdateError(updateutil.ErrorEnvironmentIssue, nil, "another update is in progress, %v is locked", lockPath)
+	}
+
+	log.Debugf("Acquired update lock %v", lockPath)
+	return func() {
+		if hadLock, unlockErr := fileLocker.Unlock(lockPath, ownerId); unlockErr != nil {
+			log.Warnf("failed to release update lock %v, %v", lockPath, unlockErr)
+		} else if !hadLock {
+			log.Warnf("update lock %v was not held by %v", lockPath, ownerId)
+		}
+	}, nil
+}
+
+// removeLockOfDeadUpdater removes the lock file when the updater process that owns it is no longer running
+func removeLockOfDeadUpdater(log log.T, lockPath string) {
+	content, err := fileutil.ReadAllText(lockPath)
+	if err != nil {
+		return
+	}
+	var pid, gid int
+	if _, err = fmt.Sscanf(content, "pid-%d-gid-%d", &pid, &gid); err != nil || pid == os.Getpid() {
+		return
+	}
+	if !isUpdaterProcessAlive(log, pid) {
+		log.Infof("Removing update lock %v of updater %v that is no longer running", lockPath, pid)
+		os.Remove(lockPath)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package processor contains the methods for update ssm agent.
+// It also provides methods for sendReply and updateInstanceInfo
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/updateutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLockWithAge writes a lock file owned by another updater and sets its modification time to age ago
+func writeLockWithAge(t *testing.T, updateRoot string, age time.Duration) {
+	lockPath := UpdateLockFilePath(updateRoot)
+	assert.NoError(t, ioutil.WriteFile(lockPath, []byte("pid-12345-gid-0"), 0600))
+	modTime := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(lockPath, modTime, modTime))
+}
+
+func TestAcquireUpdateLock(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatelock")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	release, err := AcquireUpdateLock(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.True(t, fileExists(UpdateLockFilePath(updateRoot)))
+
+	_, err = AcquireUpdateLock(logger, updateRoot)
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorEnvironmentIssue, updateutil.GetErrorCode(err))
+
+	release()
+	assert.False(t, fileExists(UpdateLockFilePath(updateRoot)))
+
+	release, err = AcquireUpdateLock(logger, updateRoot)
+	assert.NoError(t, err)
+	release()
+}
+
+func TestAcquireUpdateLockHeldByAnotherUpdater(t *testing.T) {
+	processAlive := isUpdaterProcessAlive
+	defer func() { isUpdaterProcessAlive = processAlive }()
+
+	testCases := []struct {
+		name         string
+		age          time.Duration
+		updaterAlive bool
+		expectLocked bool
+	}{
+		{"active", time.Minute, true, false},
+		{"dead updater", time.Minute, false, true},
+		{"expired", 2 * time.Hour, true, true},
+	}
+
+	for _, test := range testCases {
+		updateRoot, err := ioutil.TempDir("", "updatelock")
+		assert.NoError(t, err)
+		writeLockWithAge(t, updateRoot, test.age)
+		updaterAlive := test.updaterAlive
+		isUpdaterProcessAlive = func(log log.T, pid int) bool {
+			return updaterAlive
+		}
+
+		release, err := AcquireUpdateLock(logger, updateRoot)
+
+		if test.expectLocked {
+			assert.NoError(t, err, test.name)
+			release()
+		} else {
+			assert.Error(t, err, test.name)
+			assert.Equal(t, updateutil.ErrorEnvironmentIssue, updateutil.GetErrorCode(err), test.name)
+			content, _ := ioutil.ReadFile(UpdateLockFilePath(updateRoot))
+			assert.Equal(t, "pid-12345-gid-0", string(content), test.name)
+		}
+		os.RemoveAll(updateRoot)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -17,6 +17,7 @@ package processor
 
 import (
 	"fmt"
+	"os"
 	"sync"
 
 	"time"
@@ -31,8 +32,18 @@ var minimumSupportedVersions map[string]string
 var once sync.Once
 
 var (
-	downloadArtifact = artifact.Download
-	uncompress       = fileutil.Uncompress
+	downloadArtifact         = artifact.DownloadWithRetry
+	uncompress               = updateutil.ExtractDownloadedArchive
+	keepUpdateArtifacts      = updateutil.IsKeepUpdateArtifactsEnabled
+	backupConfig             = updateutil.BackupConfig
+	restoreConfig            = updateutil.RestoreConfig
+	verifyExtractedArtifacts = updateutil.VerifyExtractedArtifacts
+	ensureExecutable         = updateutil.EnsureExecutable
+	detectConflictingInstall = updateutil.DetectConflictingInstalls
+	checkSecurityModules     = updateutil.CheckSecurityModules
+	classifyInstallerError   = updateutil.ClassifySecurityPolicyError
+	validationScriptPath     = updateutil.GetValidationScriptPath
+	runValidationScript      = updateutil.RunValidationScript
 )
 
 // NewUpdater creates an instance of Updater and other services it requires
@@ -49,6 +60,8 @@ func NewUpdater() *Updater {
 			uninstall: uninstallAgent,
 			install:   installAgent,
 			download:  downloadAndUnzipArtifact,
+			metrics:   updateutil.NewMetricRecorder(nil),
+			downloads: make(map[string]string),
 		},
 	}
 
@@ -83,11 +96,21 @@ func (u *Updater) InitializeUpdate(log log.T, detail *UpdateDetail) (context *Up
 		return nil, fmt.Errorf("update failed, no rollback needed %v", err.Error())
 	}
 	detail.StandardOut = pluginResult.StandOut
+	// tag the log messages of the updater with the operation started by the update plugin
+	detail.OperationID = pluginResult.OperationID
+	if util, ok := u.mgr.util.(*updateutil.Utility); ok {
+		util.OperationID = pluginResult.OperationID
+	}
 	// if failed to read time from updateplugin file
 	if !pluginResult.StartDateTime.Equal(time.Time{}) {
 		detail.StartDateTime = pluginResult.StartDateTime
 	}
 
+	// Clear the update left behind by an updater that did not complete
+	if _, err = ClearStaleUpdateContext(log, detail.UpdateRoot, staleUpdateContextDuration*time.Second); err != nil {
+		log.Warnf("failed to clear stale update context, %v", err)
+	}
+
 	// Load UpdateContext from local storage, set current update with the new UpdateDetail
 	if context, err = LoadUpdateContext(log, updateutil.UpdateContextFilePath(detail.UpdateRoot)); err != nil {
 		return context, fmt.Errorf("update failed, no rollback needed %v", err.Error())
@@ -98,6 +121,7 @@ func (u *Updater) InitializeUpdate(log log.T, detail *UpdateDetail) (context *Up
 	}
 
 	context.Current = detail
+	context.Current.UpdaterPid = os.Getpid()
 	if err = u.mgr.inProgress(context, log, Initialized); err != nil {
 		return
 	}
@@ -151,6 +175,7 @@ func getMinimumVSupportedVersions() (versions *map[string]string) {
 
 // prepareInstallationPackages downloads artifacts from public s3 storage
 func prepareInstallationPackages(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+	mgr.startPhase(updateutil.PhaseDownload)
 	log.Infof("Initiating download %v", context.Current.PackageName)
 	var instanceContext *updateutil.InstanceContext
 	updateDownload := ""
@@ -164,6 +189,10 @@ func prepareInstallationPackages(mgr *updateManager, log log.T, context *UpdateC
 	if err = validateInactiveVersion(log, context.Current, instanceContext); err != nil {
 		return mgr.inactive(context, log)
 	}
+	if err = detectConflictingInstall(log, instanceContext); err != nil {
+		return mgr.failed(context, log, updateutil.ErrorEnvironmentIssue, err.Error(), true)
+	}
+	checkSecurityModules(log)
 
 	if updateDownload, err = mgr.util.CreateUpdateDownloadFolder(); err != nil {
 		message := updateutil.BuildMessage(
@@ -181,10 +210,12 @@ func prepareInstallationPackages(mgr *updateManager, log log.T, context *UpdateC
 			updateutil.HashType: context.Current.SourceHash,
 		},
 		DestinationDirectory: updateDownload,
+		AdaptiveTimeout:      true,
+		UseChecksumCache:     true,
 	}
 
 	if err = mgr.download(mgr, log, downloadInput, context, context.Current.SourceVersion); err != nil {
-		return mgr.failed(context, log, updateutil.ErrorInvalidPackage, err.Error(), true)
+		return mgr.failed(context, log, downloadFailureCode(err), err.Error(), true)
 	}
 
 	// Download target
@@ -194,10 +225,12 @@ func prepareInstallationPackages(mgr *updateManager, log log.T, context *UpdateC
 			updateutil.HashType: context.Current.TargetHash,
 		},
 		DestinationDirectory: updateDownload,
+		AdaptiveTimeout:      true,
+		UseChecksumCache:     true,
 	}
 
 	if err = mgr.download(mgr, log, downloadInput, context, context.Current.TargetVersion); err != nil {
-		return mgr.failed(context, log, updateutil.ErrorInvalidPackage, err.Error(), true)
+		return mgr.failed(context, log, downloadFailureCode(err), err.Error(), true)
 	}
 
 	// Update stdout
@@ -218,11 +251,18 @@ func prepareInstallationPackages(mgr *updateManager, log log.T, context *UpdateC
 
 // proceedUpdate starts update process
 func proceedUpdate(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+	mgr.startPhase(updateutil.PhaseInstall)
 	log.Infof(
 		"Attemping to upgrade from %v to %v",
 		context.Current.SourceVersion,
 		context.Current.TargetVersion)
 
+	// Back up the configuration so the rollback can restore the settings the uninstall removed or
+	// the target version overwrote
+	if err = backupConfig(log, updateutil.ConfigBackupFolder(context.Current.UpdateRoot)); err != nil {
+		log.Warnf("failed to back up the agent configuration, it cannot be restored on rollback, %v", err)
+	}
+
 	// Uninstall only when the target version is lower than the source version
 	if context.Current.RequiresUninstall {
 		if err = mgr.uninstall(mgr, log, context.Current.SourceVersion, context); err != nil {
@@ -231,7 +271,7 @@ func proceedUpdate(mgr *updateManager, log log.T, context *UpdateContext) (err e
 				"failed to uninstall %v %v",
 				context.Current.PackageName,
 				context.Current.SourceVersion)
-			return mgr.failed(context, log, updateutil.ErrorUninstallFailed, message, true)
+			return mgr.failed(context, log, installerFailureCode(err, updateutil.ErrorUninstallFailed), message, true)
 		}
 	}
 
@@ -243,6 +283,7 @@ func proceedUpdate(mgr *updateManager, log log.T, context *UpdateContext) (err e
 			context.Current.PackageName,
 			context.Current.TargetVersion)
 		context.Current.AppendError(log, message)
+		mgr.stopPhase(updateutil.NewUpdateError(installerFailureCode(err, updateutil.ErrorInstallFailed), nil, "%v", message))
 
 		context.Current.AppendInfo(
 			log,
@@ -269,6 +310,7 @@ func proceedUpdate(mgr *updateManager, log log.T, context *UpdateContext) (err e
 
 // verifyInstallation checks installation result, verifies if agent is running
 func verifyInstallation(mgr *updateManager, log log.T, context *UpdateContext, isRollback bool) (err error) {
+	mgr.startPhase(updateutil.PhaseVerify)
 	// Check if agent is running
 	var isRunning = false
 	var instanceContext *updateutil.InstanceContext
@@ -287,6 +329,7 @@ func verifyInstallation(mgr *updateManager, log log.T, context *UpdateContext, i
 				"failed to start the agent")
 
 			context.Current.AppendError(log, message)
+			mgr.stopPhase(updateutil.NewUpdateError(updateutil.ErrorCannotStartService, nil, "%v", message))
 			context.Current.AppendInfo(
 				log,
 				"Initiating rollback %v to %v",
@@ -310,6 +353,31 @@ func verifyInstallation(mgr *updateManager, log log.T, context *UpdateContext, i
 
 	log.Infof("%v is running", context.Current.PackageName)
 	if !isRollback {
+		// the update is marked succeeded once the installed version and the validation script of the operator pass
+		err = mgr.util.VerifyInstalledVersion(log, instanceContext, context.Current.TargetVersion)
+		if err == nil {
+			err = runValidationScript(log, validationScriptPath(log), instanceContext, 0)
+		}
+		if err != nil {
+			message := updateutil.BuildMessage(err,
+				"failed to update %v to %v",
+				context.Current.PackageName,
+				context.Current.TargetVersion)
+
+			context.Current.AppendError(log, "%v", message)
+			mgr.stopPhase(updateutil.NewUpdateError(updateutil.GetErrorCode(err), nil, "%v", message))
+			context.Current.AppendInfo(
+				log,
+				"Initiating rollback %v to %v",
+				context.Current.PackageName,
+				context.Current.SourceVersion)
+			// Update state to rollback
+			if err = mgr.inProgress(context, log, Rollback); err != nil {
+				return err
+			}
+			return mgr.rollback(mgr, log, context)
+		}
+		keepInstalledArtifact(mgr, log, context)
 		return mgr.succeeded(context, log)
 	}
 
@@ -318,8 +386,28 @@ func verifyInstallation(mgr *updateManager, log log.T, context *UpdateContext, i
 	return mgr.failed(context, log, updateutil.ErrorCannotStartService, message, false)
 }
 
+// keepInstalledArtifact keeps the downloaded installation package of the target version once it installed
+// successfully, a failure to keep the package does not fail the update
+func keepInstalledArtifact(mgr *updateManager, log log.T, context *UpdateContext) {
+	version := context.Current.TargetVersion
+	filePath, found := mgr.downloads[version]
+	if !found {
+		return
+	}
+	if err := updateutil.CacheArtifact(
+		log,
+		context.Current.UpdateRoot,
+		context.Current.PackageName,
+		version,
+		filePath,
+		context.Current.TargetHash); err != nil {
+		log.Warnf("Failed to keep installation package of version %v, %v", version, err)
+	}
+}
+
 // rollbackInstallation rollback installation to the source version
 func rollbackInstallation(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+	mgr.startPhase(updateutil.PhaseInstall)
 	if err = mgr.uninstall(mgr, log, context.Current.TargetVersion, context); err != nil {
 		// Fail the rollback process as a result of target version cannot be uninstalled
 		message := updateutil.BuildMessage(
@@ -327,7 +415,7 @@ func rollbackInstallation(mgr *updateManager, log log.T, context *UpdateContext)
 			"failed to uninstall %v %v",
 			context.Current.PackageName,
 			context.Current.TargetVersion)
-		return mgr.failed(context, log, updateutil.ErrorUninstallFailed, message, false)
+		return mgr.failed(context, log, installerFailureCode(err, updateutil.ErrorUninstallFailed), message, false)
 	}
 
 	if err = mgr.install(mgr, log, context.Current.SourceVersion, context); err != nil {
@@ -337,7 +425,11 @@ func rollbackInstallation(mgr *updateManager, log log.T, context *UpdateContext)
 			"failed to install %v %v",
 			context.Current.PackageName,
 			context.Current.SourceVersion)
-		return mgr.failed(context, log, updateutil.ErrorInstallFailed, message, false)
+		return mgr.failed(context, log, installerFailureCode(err, updateutil.ErrorInstallFailed), message, false)
+	}
+
+	if err = restoreConfig(log, updateutil.ConfigBackupFolder(context.Current.UpdateRoot)); err != nil {
+		context.Current.AppendInfo(log, "failed to restore the agent configuration, %v", err.Error())
 	}
 
 	if err = mgr.inProgress(context, log, RolledBack); err != nil {
@@ -362,16 +454,22 @@ func uninstallAgent(mgr *updateManager, log log.T, version string, context *Upda
 		context.Current.PackageName,
 		version)
 
+	// Dry run exercises the update without uninstalling
+	if context.Current.DryRun {
+		context.Current.AppendInfo(log, "Dry run, would run %v in %v", uninstallPath, workDir)
+		return nil
+	}
+
 	// Uninstall version
-	if err = mgr.util.ExeCommand(
+	if err = mgr.util.ExeCommandWithTimeout(
 		log,
 		uninstallPath,
 		workDir,
 		context.Current.UpdateRoot,
 		context.Current.StdoutFileName,
 		context.Current.StderrFileName,
-		false); err != nil {
-		return err
+		uninstallTimeout(context.Current)); err != nil {
+		return classifyInstallerError(log, err)
 	}
 	log.Infof("%v %v uninstalled successfully", context.Current.PackageName, version)
 	return nil
@@ -392,23 +490,57 @@ func installAgent(mgr *updateManager, log log.T, version string, context *Update
 		context.Current.PackageName,
 		version)
 
+	// Dry run exercises the update without installing
+	if context.Current.DryRun {
+		context.Current.AppendInfo(log, "Dry run, would run %v in %v", installerPath, workDir)
+		return nil
+	}
+
 	// Install version
-	if err = mgr.util.ExeCommand(
+	if err = mgr.util.ExeCommandWithTimeout(
 		log,
 		installerPath,
 		workDir,
 		context.Current.UpdateRoot,
 		context.Current.StdoutFileName,
 		context.Current.StderrFileName,
-		false); err != nil {
+		installTimeout(context.Current)); err != nil {
 
-		return err
+		return classifyInstallerError(log, err)
 	}
 
 	log.Infof("%v %v installed successfully", context.Current.PackageName, version)
 	return nil
 }
 
+// installTimeout returns the timeout of the install script, zero lets the utility use the update execution timeout
+func installTimeout(update *UpdateDetail) time.Duration {
+	return time.Duration(update.InstallTimeout) * time.Second
+}
+
+// uninstallTimeout returns the timeout of the uninstall script, zero lets the utility use the update execution timeout
+func uninstallTimeout(update *UpdateDetail) time.Duration {
+	return time.Duration(update.UninstallTimeout) * time.Second
+}
+
+// downloadFailureCode returns the ErrorCode of the failed download, the download failures that are not classified
+// are reported as ErrorInvalidPackage
+func downloadFailureCode(err error) updateutil.ErrorCode {
+	if updateErr, ok := err.(*updateutil.UpdateError); ok {
+		return updateErr.Code
+	}
+	return updateutil.ErrorInvalidPackage
+}
+
+// installerFailureCode returns ErrorSecurityPolicyDenied when SELinux or AppArmor blocked the install or uninstall
+// script, defaultCode is returned for the other failures
+func installerFailureCode(err error, defaultCode updateutil.ErrorCode) updateutil.ErrorCode {
+	if updateutil.GetErrorCode(err) == updateutil.ErrorSecurityPolicyDenied {
+		return updateutil.ErrorSecurityPolicyDenied
+	}
+	return defaultCode
+}
+
 // downloadAndUnzipArtifact downloads installation package and unzips it
 func downloadAndUnzipArtifact(
 	mgr *updateManager,
@@ -418,27 +550,65 @@ func downloadAndUnzipArtifact(
 	version string) (err error) {
 
 	log.Infof("Preparing source for version %v", version)
-	// download installation zip files
-	downloadOutput, err := downloadArtifact(log, downloadInput)
-	if err != nil ||
-		downloadOutput.IsHashMatched == false ||
-		downloadOutput.LocalFilePath == "" {
-		if err != nil {
-			return fmt.Errorf("failed to download file reliably, %v, %v", downloadInput.SourceURL, err.Error())
+	updateRoot := context.Current.UpdateRoot
+	packageName := context.Current.PackageName
+	checksum := downloadInput.SourceChecksums[updateutil.HashType]
+	keepArtifacts := keepUpdateArtifacts(log)
+
+	// reuse the kept installation package when it verifies against the expected checksum
+	localFilePath := ""
+	if keepArtifacts {
+		if cachedFilePath, found := updateutil.CachedArtifact(log, updateRoot, packageName, version, checksum); found {
+			context.Current.AppendInfo(log, "Reusing kept installation package %v", cachedFilePath)
+			localFilePath = cachedFilePath
 		}
-		return fmt.Errorf("failed to download file reliably, %v", downloadInput.SourceURL)
 	}
 
-	// downloaded successfully, append message
-	context.Current.AppendInfo(log, "Successfully downloaded %v", downloadInput.SourceURL)
+	if localFilePath == "" {
+		// download installation zip files
+		downloadOutput, err := downloadArtifact(log, downloadInput)
+		if err != nil ||
+			downloadOutput.IsHashMatched == false ||
+			downloadOutput.LocalFilePath == "" {
+			if err != nil {
+				return updateutil.NewDownloadError(artifact.DownloadStatusCode(err), updateutil.ErrorInvalidPackage, err, downloadInput.SourceURL)
+			}
+			return fmt.Errorf("failed to download file reliably, %v", downloadInput.SourceURL)
+		}
+
+		// downloaded successfully, append message
+		context.Current.AppendInfo(log, "Successfully downloaded %v", downloadInput.SourceURL)
+		localFilePath = downloadOutput.LocalFilePath
 
-	// uncompress installation package
+		if keepArtifacts {
+			// the package is kept after the install succeeded so a package that fails to install is not reused
+			mgr.downloads[version] = localFilePath
+		}
+	}
+
+	// uncompress installation package, the entries are validated before anything is extracted
 	if err = uncompress(
 		log,
-		downloadOutput.LocalFilePath,
-		updateutil.UpdateArtifactFolder(context.Current.UpdateRoot, context.Current.PackageName, version)); err != nil {
-		return fmt.Errorf("failed to uncompress installation package, %v", err.Error())
+		localFilePath,
+		downloadInput.SourceURL,
+		updateutil.UpdateArtifactFolder(updateRoot, packageName, version)); err != nil {
+		return updateutil.NewUpdateError(
+			downloadFailureCode(err), nil, "failed to uncompress installation package, %v", err.Error())
 	}
 
-	return nil
+	// a freshly extracted script may lack the execute bit, the missing scripts are reported below
+	for _, scriptPath := range []string{
+		updateutil.InstallerFilePath(updateRoot, packageName, version),
+		updateutil.UnInstallerFilePath(updateRoot, packageName, version),
+	} {
+		if !fileutil.Exists(scriptPath) {
+			continue
+		}
+		if err = ensureExecutable(log, scriptPath, true); err != nil {
+			return err
+		}
+	}
+
+	// fail before the install scripts are run when the extraction is incomplete
+	return verifyExtractedArtifacts(updateRoot, packageName, version)
 }
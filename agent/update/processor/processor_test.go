@@ -16,8 +16,20 @@
 package processor
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	"github.com/aws/amazon-ssm-agent/agent/fileutil/artifact"
@@ -30,6 +42,7 @@ var logger = log.NewMockLog()
 
 type serviceStub struct {
 	Service
+	errorCode string
 }
 
 func (s *serviceStub) SendReply(log log.T, update *UpdateDetail) error {
@@ -41,6 +54,7 @@ func (s *serviceStub) DeleteMessage(log log.T, update *UpdateDetail) error {
 }
 
 func (s *serviceStub) UpdateHealthCheck(log log.T, update *UpdateDetail, errorCode string) error {
+	s.errorCode = errorCode
 	return nil
 }
 
@@ -116,6 +130,21 @@ func TestInitializeUpdate(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestInitializeUpdateWithOperationID(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext("")
+	context.Current.UpdateRoot = filepath.Join("testdata", "operationid")
+
+	// action
+	context, err := updater.InitializeUpdate(logger, context.Current)
+
+	// assert
+	assert.NoError(t, err)
+	assert.NotEmpty(t, context.Current.StandardOut)
+	assert.Equal(t, "9f1c6a0e-4b7d-4c2e-8a51-0d3e2f6b7c91", context.Current.OperationID)
+}
+
 func TestPrepareInstallationPackages(t *testing.T) {
 	// setup
 	updater := createDefaultUpdaterStub()
@@ -158,6 +187,27 @@ func TestPreparePackagesFailCreateInstanceContext(t *testing.T) {
 	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusFailed)
 }
 
+func TestPreparePackagesFailConflictingInstalls(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Initialized)
+	detectConflictingInstall = func(log log.T, context *updateutil.InstanceContext) error {
+		return updateutil.NewUpdateError(updateutil.ErrorEnvironmentIssue, nil, "found conflicting agent installs")
+	}
+	updater.mgr.download = func(mgr *updateManager, log log.T, downloadInput artifact.DownloadInput, context *UpdateContext, version string) (err error) {
+		assert.Fail(t, "artifacts must not be downloaded when conflicting installs are found")
+		return nil
+	}
+
+	// action
+	err := prepareInstallationPackages(updater.mgr, logger, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, context.Histories[0].State, Completed)
+	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusFailed)
+}
+
 func TestPreparePackagesFailCreateUpdateDownloadFolder(t *testing.T) {
 	// setup
 	updater := createDefaultUpdaterStub()
@@ -414,6 +464,125 @@ func TestVerifyInstallationCannotStartAgent(t *testing.T) {
 	assert.Equal(t, context.Current.State, Rollback)
 }
 
+func TestVerifyInstallationWithWrongInstalledVersion(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: true, wrongInstalledVersion: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+	isRollbackCalled := false
+
+	updater.mgr.rollback = func(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+		isRollbackCalled = true
+		return nil
+	}
+
+	// action
+	err := verifyInstallation(updater.mgr, logger, context, false)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, isRollbackCalled)
+	assert.Equal(t, context.Current.State, Rollback)
+	assert.Contains(t, context.Current.StandardError, "reports version 1.0.0.0")
+}
+
+func TestVerifyInstallationRunsValidationScript(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+	validatedScriptPath := ""
+	validationScriptPath = func(log log.T) string { return "/opt/validate.sh" }
+	runValidationScript = func(log log.T, scriptPath string, context *updateutil.InstanceContext, timeout time.Duration) error {
+		validatedScriptPath = scriptPath
+		return nil
+	}
+
+	// action
+	err := verifyInstallation(updater.mgr, logger, context, false)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/validate.sh", validatedScriptPath)
+	assert.Equal(t, context.Histories[0].State, Completed)
+	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusSuccess)
+}
+
+func TestVerifyInstallationFailedValidationScript(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+	isRollbackCalled := false
+	validationScriptPath = func(log log.T) string { return "/opt/validate.sh" }
+	runValidationScript = func(log log.T, scriptPath string, context *updateutil.InstanceContext, timeout time.Duration) error {
+		return updateutil.NewUpdateError(updateutil.ErrorInstallFailed, fmt.Errorf("exit status 1"), "validation script %v failed", scriptPath)
+	}
+
+	updater.mgr.rollback = func(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+		isRollbackCalled = true
+		return nil
+	}
+
+	// action
+	err := verifyInstallation(updater.mgr, logger, context, false)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, isRollbackCalled)
+	assert.Equal(t, context.Current.State, Rollback)
+	assert.Empty(t, context.Histories)
+	assert.Contains(t, context.Current.StandardError, "validation script /opt/validate.sh failed")
+}
+
+func TestVerifyRollbackSkipsValidationScript(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Rollback)
+	runValidationScript = func(log log.T, scriptPath string, context *updateutil.InstanceContext, timeout time.Duration) error {
+		assert.Fail(t, "the validation script should not be run on rollback")
+		return nil
+	}
+
+	// action
+	err := verifyInstallation(updater.mgr, logger, context, true)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusFailed)
+}
+
+func TestVerifyInstallationRecordsPhaseMetrics(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: false}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Installed)
+	var savedMetrics []*updateutil.UpdateMetric
+	saveUpdateMetrics = func(log log.T, updateRoot string, recorder *updateutil.MetricRecorder) error {
+		savedMetrics = recorder.Metrics
+		return nil
+	}
+
+	updater.mgr.rollback = func(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+		mgr.startPhase(updateutil.PhaseInstall)
+		return mgr.failed(context, log, updateutil.ErrorInstallFailed, "failed to install", false)
+	}
+
+	// action
+	err := verifyInstallation(updater.mgr, logger, context, false)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Len(t, savedMetrics, 2)
+	assert.Equal(t, updateutil.PhaseVerify, savedMetrics[0].Phase)
+	assert.Equal(t, updateutil.OutcomeFailed, savedMetrics[0].Outcome)
+	assert.Equal(t, updateutil.ErrorCannotStartService, savedMetrics[0].ErrorCode)
+	assert.Equal(t, updateutil.PhaseInstall, savedMetrics[1].Phase)
+	assert.Equal(t, updateutil.OutcomeFailed, savedMetrics[1].Outcome)
+	assert.Equal(t, updateutil.ErrorInstallFailed, savedMetrics[1].ErrorCode)
+}
+
 func TestVerifyRollback(t *testing.T) {
 	// setup
 	control := &stubControl{serviceIsRunning: true}
@@ -476,6 +645,73 @@ func TestRollbackInstallation(t *testing.T) {
 	assert.Equal(t, context.Current.State, RolledBack)
 }
 
+func TestProceedUpdateBacksUpAndRollbackRestoresConfig(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Staged)
+	context.Current.UpdateRoot = "updateroot"
+	var backupDir, restoreDir string
+	backupConfig = func(log log.T, destDir string) error {
+		backupDir = destDir
+		return nil
+	}
+	restoreConfig = func(log log.T, srcDir string) error {
+		restoreDir = srcDir
+		return nil
+	}
+	updater.mgr.install = func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error) {
+		if version == context.Current.TargetVersion {
+			return fmt.Errorf("install failed")
+		}
+		return nil
+	}
+	updater.mgr.uninstall = func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error) {
+		return nil
+	}
+	updater.mgr.verify = func(mgr *updateManager, log log.T, context *UpdateContext, isRollback bool) (err error) {
+		return nil
+	}
+
+	// action
+	err := proceedUpdate(updater.mgr, logger, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, RolledBack, context.Current.State)
+	assert.Equal(t, updateutil.ConfigBackupFolder("updateroot"), backupDir)
+	assert.Equal(t, backupDir, restoreDir)
+}
+
+func TestProceedUpdateWithDowngradeBacksUpConfigBeforeUninstall(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Staged)
+	context.Current.RequiresUninstall = true
+	var calls []string
+	backupConfig = func(log log.T, destDir string) error {
+		calls = append(calls, "backup")
+		return nil
+	}
+	updater.mgr.uninstall = func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error) {
+		calls = append(calls, "uninstall")
+		return nil
+	}
+	updater.mgr.install = func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error) {
+		calls = append(calls, "install")
+		return nil
+	}
+	updater.mgr.verify = func(mgr *updateManager, log log.T, context *UpdateContext, isRollback bool) (err error) {
+		return nil
+	}
+
+	// action
+	err := proceedUpdate(updater.mgr, logger, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backup", "uninstall", "install"}, calls)
+}
+
 func TestRollbackInstallationFailUninstall(t *testing.T) {
 	// setup
 	control := &stubControl{serviceIsRunning: false}
@@ -592,6 +828,148 @@ func TestInstallAgentFailExeCommand(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestInstallAgentBlockedBySecurityPolicy(t *testing.T) {
+	// setup
+	control := &stubControl{failExeCommand: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+	classifyInstallerError = func(log log.T, err error) error {
+		return updateutil.NewUpdateError(updateutil.ErrorSecurityPolicyDenied, err, "the command was likely blocked by SELinux")
+	}
+
+	// action
+	err := installAgent(updater.mgr, logger, context.Current.TargetVersion, context)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorSecurityPolicyDenied, updateutil.GetErrorCode(err))
+	assert.Equal(t, updateutil.ErrorSecurityPolicyDenied, installerFailureCode(err, updateutil.ErrorInstallFailed))
+	assert.Equal(t, updateutil.ErrorInstallFailed, installerFailureCode(fmt.Errorf("exit status 1"), updateutil.ErrorInstallFailed))
+}
+
+func TestProceedUpdateWithDowngradeBlockedBySecurityPolicy(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Staged)
+	context.Current.RequiresUninstall = true
+	updater.mgr.uninstall = func(mgr *updateManager, log log.T, version string, context *UpdateContext) (err error) {
+		return updateutil.NewUpdateError(updateutil.ErrorSecurityPolicyDenied, nil, "the command was likely blocked by AppArmor")
+	}
+
+	// action
+	err := proceedUpdate(updater.mgr, logger, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusFailed)
+	assert.Equal(t, string(updateutil.ErrorSecurityPolicyDenied), updater.mgr.svc.(*serviceStub).errorCode)
+}
+
+func TestInstallAndUninstallTimeouts(t *testing.T) {
+	// setup
+	control := &stubControl{failExeCommand: false}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+	context.Current.InstallTimeout = 300
+	context.Current.UninstallTimeout = 45
+
+	// action
+	assert.NoError(t, uninstallAgent(updater.mgr, logger, context.Current.SourceVersion, context))
+	assert.NoError(t, installAgent(updater.mgr, logger, context.Current.TargetVersion, context))
+
+	// assert
+	assert.Equal(t, []time.Duration{45 * time.Second, 300 * time.Second}, control.exeCommandTimeouts)
+}
+
+func TestInstallAndUninstallDefaultTimeouts(t *testing.T) {
+	// setup
+	control := &stubControl{failExeCommand: false}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+
+	// action
+	assert.NoError(t, uninstallAgent(updater.mgr, logger, context.Current.SourceVersion, context))
+	assert.NoError(t, installAgent(updater.mgr, logger, context.Current.TargetVersion, context))
+
+	// assert the scripts get the update execution timeout of the utility
+	assert.Equal(t, []time.Duration{0, 0}, control.exeCommandTimeouts)
+}
+
+func TestDownloadAndUnzipArtifactFailsWhenScriptCannotBeMadeExecutable(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Initialized)
+	updateRoot, err := ioutil.TempDir("", "extractedscripts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	context.Current.UpdateRoot = updateRoot
+	context.Current.PackageName = "amazon-ssm-agent"
+	installerPath := updateutil.InstallerFilePath(updateRoot, context.Current.PackageName, context.Current.TargetVersion)
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: "filepath"}, nil
+	}
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
+		os.MkdirAll(filepath.Dir(installerPath), 0755)
+		return ioutil.WriteFile(installerPath, []byte("#!/bin/sh"), 0666)
+	}
+	checkedPaths := []string{}
+	ensureExecutable = func(log log.T, path string, fix bool) error {
+		checkedPaths = append(checkedPaths, path)
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidPackage, nil, "%v is not executable", path)
+	}
+
+	// action
+	err = downloadAndUnzipArtifact(updater.mgr, logger, artifact.DownloadInput{}, context, context.Current.TargetVersion)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
+	assert.Equal(t, []string{installerPath}, checkedPaths)
+}
+
+func TestInstallSucceedsWithExtractedScriptsWithoutExecuteBit(t *testing.T) {
+	// setup
+	control := &stubControl{}
+	updater := createUpdaterStubs(control)
+	verifyExtractedArtifacts = updateutil.VerifyExtractedArtifacts
+	ensureExecutable = updateutil.EnsureExecutable
+	installer, uninstaller := updateutil.Installer, updateutil.UnInstaller
+	updateutil.Installer, updateutil.UnInstaller = updateutil.InstallScript, updateutil.UninstallScript
+	defer func() { updateutil.Installer, updateutil.UnInstaller = installer, uninstaller }()
+	context := createUpdateContext(Initialized)
+	updateRoot, err := ioutil.TempDir("", "extractedscripts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	context.Current.UpdateRoot = updateRoot
+	context.Current.PackageName = "amazon-ssm-agent"
+	version := context.Current.TargetVersion
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: "filepath"}, nil
+	}
+	// the package is extracted without the execute bits of the scripts
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
+		for _, scriptPath := range []string{
+			updateutil.InstallerFilePath(updateRoot, context.Current.PackageName, version),
+			updateutil.UnInstallerFilePath(updateRoot, context.Current.PackageName, version),
+		} {
+			if err := ioutil.WriteFile(scriptPath, []byte("#!/bin/sh"), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	assert.NoError(t, os.MkdirAll(updateutil.UpdateArtifactFolder(updateRoot, context.Current.PackageName, version), 0755))
+
+	// action
+	err = downloadAndUnzipArtifact(updater.mgr, logger, artifact.DownloadInput{}, context, version)
+	assert.NoError(t, err)
+	err = installAgent(updater.mgr, logger, version, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, control.exeCommandCalls)
+}
+
 func TestDownloadAndUnzipArtifact(t *testing.T) {
 	// setup
 	control := &stubControl{failExeCommand: true}
@@ -605,7 +983,7 @@ func TestDownloadAndUnzipArtifact(t *testing.T) {
 	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
 		return downloadOutput, nil
 	}
-	uncompress = func(log log.T, src, dest string) error {
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
 		return nil
 	}
 
@@ -616,6 +994,128 @@ func TestDownloadAndUnzipArtifact(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// writeTarPackage writes a tar archive of the files, compressed with gzip or with xz when xz is set
+func writeTarPackage(t *testing.T, path string, files map[string]string, xz bool) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+	if !xz {
+		return
+	}
+
+	// recompress the tar stream with xz
+	gzipped, err := os.Open(path)
+	assert.NoError(t, err)
+	defer gzipped.Close()
+	gr, err := gzip.NewReader(gzipped)
+	assert.NoError(t, err)
+	command := exec.Command("xz", "--compress", "--stdout")
+	command.Stdin = gr
+	output, err := command.Output()
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, output, 0644))
+}
+
+func TestDownloadAndUnzipArtifactExtractsPackageByFormatOfSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tar packages are not used on windows")
+	}
+	testCases := map[string]bool{"amazon-ssm-agent-linux-amd64.tar.gz": false}
+	if _, err := exec.LookPath("xz"); err == nil {
+		testCases["amazon-ssm-agent-linux-amd64.tar.xz"] = true
+	}
+
+	for fileName, xz := range testCases {
+		// setup
+		updater := createDefaultUpdaterStub()
+		uncompress = updateutil.ExtractDownloadedArchive
+		context := createUpdateContext(Initialized)
+		updateRoot, err := ioutil.TempDir("", "extractpackage")
+		assert.NoError(t, err)
+		context.Current.UpdateRoot = updateRoot
+		context.Current.PackageName = "amazon-ssm-agent"
+		// the local copy of the download is not named after the source
+		downloadedPath := filepath.Join(updateRoot, "download")
+		writeTarPackage(t, downloadedPath, map[string]string{"install.sh": "install", "uninstall.sh": "uninstall"}, xz)
+		downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+			return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: downloadedPath}, nil
+		}
+		downloadInput := artifact.DownloadInput{SourceURL: "https://example.com/amazon-ssm-agent/6.0.0.0/" + fileName}
+
+		// action
+		err = downloadAndUnzipArtifact(updater.mgr, logger, downloadInput, context, context.Current.TargetVersion)
+
+		// assert
+		assert.NoError(t, err, fileName)
+		content, err := ioutil.ReadFile(filepath.Join(
+			updateutil.UpdateArtifactFolder(updateRoot, "amazon-ssm-agent", context.Current.TargetVersion), "install.sh"))
+		assert.NoError(t, err, fileName)
+		assert.Equal(t, "install", string(content), fileName)
+		os.RemoveAll(updateRoot)
+	}
+}
+
+func TestDownloadAndUnzipArtifactRejectsPackageEscapingVersionFolder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tar packages are not used on windows")
+	}
+	// setup
+	updater := createDefaultUpdaterStub()
+	uncompress = updateutil.ExtractDownloadedArchive
+	context := createUpdateContext(Initialized)
+	updateRoot, err := ioutil.TempDir("", "extractpackage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	context.Current.UpdateRoot = updateRoot
+	context.Current.PackageName = "amazon-ssm-agent"
+	downloadedPath := filepath.Join(updateRoot, "download")
+	writeTarPackage(t, downloadedPath, map[string]string{"install.sh": "install", "../../evil.sh": "evil"}, false)
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: downloadedPath}, nil
+	}
+	downloadInput := artifact.DownloadInput{SourceURL: "https://example.com/amazon-ssm-agent-linux-amd64.tar.gz"}
+
+	// action
+	err = downloadAndUnzipArtifact(updater.mgr, logger, downloadInput, context, context.Current.TargetVersion)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
+	assert.False(t, fileExists(filepath.Join(updateRoot, "evil.sh")))
+}
+
+func TestDownloadWithIncompleteExtraction(t *testing.T) {
+	// setup
+	control := &stubControl{}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: "filepath"}, nil
+	}
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
+		return nil
+	}
+	verifyExtractedArtifacts = func(updateRoot string, packageName string, version string) error {
+		return updateutil.NewUpdateError(updateutil.ErrorInvalidPackage, nil, "missing install.sh")
+	}
+
+	// action
+	err := downloadAndUnzipArtifact(updater.mgr, logger, artifact.DownloadInput{}, context, context.Current.TargetVersion)
+
+	// assert
+	assert.Error(t, err)
+	assert.Equal(t, updateutil.ErrorInvalidPackage, updateutil.GetErrorCode(err))
+}
+
 func TestDownloadWithError(t *testing.T) {
 	// setup
 	control := &stubControl{failExeCommand: true}
@@ -637,12 +1137,236 @@ func TestDownloadWithError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDownloadWithErrorResponse(t *testing.T) {
+	// setup
+	control := &stubControl{}
+	updater := createUpdaterStubs(control)
+	downloadArtifact = artifact.DownloadWithRetry
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		statusCode int
+		code       updateutil.ErrorCode
+		message    string
+	}{
+		{http.StatusNotFound, updateutil.ErrorPackageNotFound, "verify the version and the package name"},
+		{http.StatusForbidden, updateutil.ErrorPackageAccessDenied, "verify the permissions of the instance role"},
+		{http.StatusBadRequest, updateutil.ErrorInvalidPackage, "failed to download file reliably"},
+	}
+	for _, test := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.statusCode)
+		}))
+		context := createUpdateContext(Initialized)
+		downloadInput := artifact.DownloadInput{SourceURL: server.URL + "/amazon-ssm-agent.tar.gz", DestinationDirectory: dir}
+
+		// action
+		err = downloadAndUnzipArtifact(updater.mgr, logger, downloadInput, context, context.Current.TargetVersion)
+		server.Close()
+
+		// assert
+		assert.Error(t, err, test.message)
+		assert.Equal(t, test.code, downloadFailureCode(err), test.message)
+		assert.Contains(t, err.Error(), test.message)
+	}
+}
+
+func TestDryRunSkipsInstaller(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: true}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+	context.Current.PackageName = "amazon-ssm-agent"
+	context.Current.RequiresUninstall = true
+	context.Current.DryRun = true
+	downloadedVersions := []string{}
+	updater.mgr.download = func(mgr *updateManager, log log.T, downloadInput artifact.DownloadInput, context *UpdateContext, version string) (err error) {
+		downloadedVersions = append(downloadedVersions, version)
+		return nil
+	}
+
+	mockLog := log.NewMockLog()
+
+	// action
+	err := updater.StartOrResumeUpdate(mockLog, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0, control.exeCommandCalls)
+	assert.Equal(t, []string{context.Histories[0].SourceVersion, context.Histories[0].TargetVersion}, downloadedVersions)
+	assert.Equal(t, Completed, context.Histories[0].State)
+	assert.Equal(t, contracts.ResultStatusSuccess, context.Histories[0].Result)
+	mockLog.AssertCalled(t, "Infof", "Dry run succeeded, would install amazon-ssm-agent 6.0.0.0", []interface{}(nil))
+}
+
+func TestDryRunRunsHealthCheck(t *testing.T) {
+	// setup
+	control := &stubControl{serviceIsRunning: false}
+	updater := createUpdaterStubs(control)
+	context := createUpdateContext(Initialized)
+	context.Current.DryRun = true
+	updater.mgr.download = func(mgr *updateManager, log log.T, downloadInput artifact.DownloadInput, context *UpdateContext, version string) (err error) {
+		return nil
+	}
+
+	mockLog := log.NewMockLog()
+
+	// action
+	err := updater.StartOrResumeUpdate(mockLog, context)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0, control.exeCommandCalls)
+	assert.Equal(t, contracts.ResultStatusFailed, context.Histories[0].Result)
+	mockLog.AssertNotCalled(t, "Infof", "Dry run succeeded, would install  6.0.0.0", []interface{}(nil))
+}
+
+func TestDownloadAndUnzipArtifactReusesKeptArtifact(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Initialized)
+	checksum := prepareKeptArtifact(t, context, "package content")
+	defer os.RemoveAll(context.Current.UpdateRoot)
+
+	keepUpdateArtifacts = func(log log.T) bool { return true }
+	downloaded := false
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		downloaded = true
+		return artifact.DownloadOutput{}, fmt.Errorf("download should be skipped")
+	}
+	uncompressedSrc := ""
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
+		uncompressedSrc = src
+		return nil
+	}
+	downloadInput := artifact.DownloadInput{
+		SourceChecksums: map[string]string{updateutil.HashType: checksum},
+	}
+
+	// action
+	err := downloadAndUnzipArtifact(updater.mgr, logger, downloadInput, context, context.Current.TargetVersion)
+
+	// assert
+	assert.NoError(t, err)
+	assert.False(t, downloaded)
+	assert.Equal(t, filepath.Join(
+		updateutil.UpdateArtifactFolder(context.Current.UpdateRoot, context.Current.PackageName, context.Current.TargetVersion),
+		updateutil.CachedArtifactFileName), uncompressedSrc)
+}
+
+func TestDownloadAndUnzipArtifactDownloadsInvalidKeptArtifact(t *testing.T) {
+	// setup
+	updater := createDefaultUpdaterStub()
+	context := createUpdateContext(Initialized)
+	checksum := prepareKeptArtifact(t, context, "package content")
+	defer os.RemoveAll(context.Current.UpdateRoot)
+
+	// corrupt the kept package after its checksum was recorded
+	cachedPath := filepath.Join(
+		updateutil.UpdateArtifactFolder(context.Current.UpdateRoot, context.Current.PackageName, context.Current.TargetVersion),
+		updateutil.CachedArtifactFileName)
+	assert.NoError(t, ioutil.WriteFile(cachedPath, []byte("corrupted"), 0600))
+
+	downloadedPath := filepath.Join(context.Current.UpdateRoot, "downloaded")
+	assert.NoError(t, ioutil.WriteFile(downloadedPath, []byte("package content"), 0600))
+
+	keepUpdateArtifacts = func(log log.T) bool { return true }
+	downloaded := false
+	downloadArtifact = func(log log.T, input artifact.DownloadInput) (output artifact.DownloadOutput, err error) {
+		downloaded = true
+		return artifact.DownloadOutput{IsHashMatched: true, LocalFilePath: downloadedPath}, nil
+	}
+	uncompressedSrc := ""
+	uncompress = func(log log.T, src, sourceURL, dest string) error {
+		uncompressedSrc = src
+		return nil
+	}
+	downloadInput := artifact.DownloadInput{
+		SourceChecksums: map[string]string{updateutil.HashType: checksum},
+	}
+
+	// action
+	err := downloadAndUnzipArtifact(updater.mgr, logger, downloadInput, context, context.Current.TargetVersion)
+
+	// assert
+	assert.NoError(t, err)
+	assert.True(t, downloaded)
+	assert.Equal(t, downloadedPath, uncompressedSrc)
+	// the kept package is replaced only after the downloaded one installed successfully
+	assert.Equal(t, downloadedPath, updater.mgr.downloads[context.Current.TargetVersion])
+	content, err := ioutil.ReadFile(cachedPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "corrupted", string(content))
+}
+
+func TestVerifyInstallationKeepsDownloadedArtifact(t *testing.T) {
+	for _, wrongInstalledVersion := range []bool{false, true} {
+		// setup
+		control := &stubControl{serviceIsRunning: true, wrongInstalledVersion: wrongInstalledVersion}
+		updater := createUpdaterStubs(control)
+		updater.mgr.rollback = func(mgr *updateManager, log log.T, context *UpdateContext) (err error) {
+			return nil
+		}
+		context := createUpdateContext(Installed)
+		updateRoot, err := ioutil.TempDir("", "keptartifact")
+		assert.NoError(t, err)
+		context.Current.UpdateRoot = updateRoot
+		downloadedPath := filepath.Join(updateRoot, "downloaded")
+		assert.NoError(t, ioutil.WriteFile(downloadedPath, []byte("package content"), 0600))
+		hash := sha256.Sum256([]byte("package content"))
+		checksum := hex.EncodeToString(hash[:])
+		packageName, version := context.Current.PackageName, context.Current.TargetVersion
+		context.Current.TargetHash = checksum
+		updater.mgr.downloads[version] = downloadedPath
+
+		// action
+		err = verifyInstallation(updater.mgr, logger, context, false)
+
+		// assert
+		assert.NoError(t, err)
+		_, found := updateutil.CachedArtifact(logger, updateRoot, packageName, version, checksum)
+		// the package of a failed install is not kept
+		assert.Equal(t, !wrongInstalledVersion, found)
+		os.RemoveAll(updateRoot)
+	}
+}
+
+// prepareKeptArtifact keeps a package with the given content for the target version and returns its checksum
+func prepareKeptArtifact(t *testing.T, context *UpdateContext, content string) string {
+	updateRoot, err := ioutil.TempDir("", "keptartifact")
+	assert.NoError(t, err)
+	context.Current.UpdateRoot = updateRoot
+
+	sourcePath := filepath.Join(updateRoot, "source")
+	assert.NoError(t, ioutil.WriteFile(sourcePath, []byte(content), 0600))
+	hash := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(hash[:])
+
+	assert.NoError(t, updateutil.CacheArtifact(
+		logger, updateRoot, context.Current.PackageName, context.Current.TargetVersion, sourcePath, checksum))
+	return checksum
+}
+
 // createUpdaterWithStubs creates stubs updater and it's manager, util and service
 func createDefaultUpdaterStub() *Updater {
 	return createUpdaterStubs(&stubControl{})
 }
 
 func createUpdaterStubs(control *stubControl) *Updater {
+	saveInstalledAgentVersion = func(log log.T, updateRoot string, installedVersion string) error { return nil }
+	keepUpdateArtifacts = func(log log.T) bool { return false }
+	backupConfig = func(log log.T, destDir string) error { return nil }
+	restoreConfig = func(log log.T, srcDir string) error { return nil }
+	verifyExtractedArtifacts = func(updateRoot string, packageName string, version string) error { return nil }
+	ensureExecutable = func(log log.T, path string, fix bool) error { return nil }
+	detectConflictingInstall = func(log log.T, context *updateutil.InstanceContext) error { return nil }
+	checkSecurityModules = func(log log.T) {}
+	classifyInstallerError = func(log log.T, err error) error { return err }
+	saveUpdateMetrics = func(log log.T, updateRoot string, recorder *updateutil.MetricRecorder) error { return nil }
+	validationScriptPath = func(log log.T) string { return "" }
+	runValidationScript = updateutil.RunValidationScript
 	updater := NewUpdater()
 	updater.mgr.svc = &serviceStub{}
 	updater.mgr.util = &utilityStub{controller: control}
@@ -656,6 +1380,9 @@ type stubControl struct {
 	failCreateUpdateDownloadFolder bool
 	serviceIsRunning               bool
 	failExeCommand                 bool
+	wrongInstalledVersion          bool
+	exeCommandCalls                int
+	exeCommandTimeouts             []time.Duration
 }
 
 type utilityStub struct {
@@ -685,12 +1412,18 @@ func (u *utilityStub) CreateUpdateDownloadFolder() (folder string, err error) {
 }
 
 func (u *utilityStub) ExeCommand(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, isAsync bool) (err error) {
+	u.controller.exeCommandCalls++
 	if u.controller.failExeCommand {
 		return fmt.Errorf("cannot run script")
 	}
 	return nil
 }
 
+func (u *utilityStub) ExeCommandWithTimeout(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, timeout time.Duration) (err error) {
+	u.controller.exeCommandTimeouts = append(u.controller.exeCommandTimeouts, timeout)
+	return u.ExeCommand(log, cmd, workingDir, updaterRoot, stdOut, stdErr, false)
+}
+
 func (u *utilityStub) SaveUpdatePluginResult(log log.T, updaterRoot string, updateResult *updateutil.UpdatePluginResult) (err error) {
 	return nil
 }
@@ -708,3 +1441,17 @@ func (u *utilityStub) WaitForServiceToStart(log log.T, i *updateutil.InstanceCon
 	}
 	return false, nil
 }
+
+func (u *utilityStub) WaitForServiceRunning(log log.T, i *updateutil.InstanceContext, timeout time.Duration, interval time.Duration) (result bool, err error) {
+	if u.controller.serviceIsRunning {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (u *utilityStub) VerifyInstalledVersion(log log.T, context *updateutil.InstanceContext, expectedVersion string) (err error) {
+	if u.controller.wrongInstalledVersion {
+		return updateutil.NewUpdateError(updateutil.ErrorInstallFailed, nil, "installed agent reports version 1.0.0.0, expected %v", expectedVersion)
+	}
+	return nil
+}
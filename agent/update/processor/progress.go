@@ -24,6 +24,28 @@ import (
 	"github.com/aws/amazon-ssm-agent/agent/updateutil"
 )
 
+var saveInstalledAgentVersion = updateutil.SaveInstalledAgentVersion
+var saveUpdateMetrics = updateutil.SaveUpdateMetrics
+
+// startPhase records the running update phase as succeeded and starts recording the phase
+func (u *updateManager) startPhase(phase updateutil.UpdatePhase) {
+	if u.metrics == nil {
+		return
+	}
+	u.stopPhase(nil)
+	u.metrics.StartPhase(phase)
+	u.phase = phase
+}
+
+// stopPhase records the running update phase with the outcome derived from err
+func (u *updateManager) stopPhase(err error) {
+	if u.metrics == nil || u.phase == "" {
+		return
+	}
+	u.metrics.StopPhase(u.phase, err)
+	u.phase = ""
+}
+
 // inProgress sets update to inProgressing with given new UpdateState
 func (u *updateManager) inProgress(context *UpdateContext, log log.T, state UpdateState) (err error) {
 	update := context.Current
@@ -55,12 +77,25 @@ func (u *updateManager) succeeded(context *UpdateContext, log log.T) (err error)
 	update := context.Current
 	update.State = Completed
 	update.Result = contracts.ResultStatusSuccess
+	if update.DryRun {
+		update.AppendInfo(
+			log,
+			"Dry run succeeded, would install %v %v",
+			update.PackageName,
+			update.TargetVersion)
+		return u.finalizeUpdateAndSendReply(log, context, "")
+	}
 	update.AppendInfo(
 		log,
 		"%v updated successfully to %v",
 		update.PackageName,
 		update.TargetVersion)
 
+	// record the installed version, failing to record it doesn't fail the update
+	if err = saveInstalledAgentVersion(log, update.UpdateRoot, update.TargetVersion); err != nil {
+		log.Warnf("failed to record installed version %v, %v", update.TargetVersion, err)
+	}
+
 	return u.finalizeUpdateAndSendReply(log, context, "")
 }
 
@@ -80,6 +115,7 @@ func (u *updateManager) failed(context *UpdateContext, log log.T, code updateuti
 	if noRollbackMessage {
 		update.AppendInfo(log, "No rollback needed")
 	}
+	u.stopPhase(updateutil.NewUpdateError(code, nil, "%v", errMessage))
 
 	return u.finalizeUpdateAndSendReply(log, context, string(code))
 }
@@ -101,6 +137,13 @@ func (u *updateManager) inactive(context *UpdateContext, log log.T) (err error)
 func (u *updateManager) finalizeUpdateAndSendReply(log log.T, context *UpdateContext, errorCode string) (err error) {
 	update := context.Current
 	update.EndDateTime = time.Now().UTC()
+	// the metrics of the update phases are saved next to the update plugin result
+	if u.metrics != nil {
+		u.stopPhase(nil)
+		if metricsErr := saveUpdateMetrics(log, update.UpdateRoot, u.metrics); metricsErr != nil {
+			log.Warnf("failed to save the update metrics, %v", metricsErr)
+		}
+	}
 	// resolve context location base on the UpdateRoot
 	contextLocation := updateutil.UpdateContextFilePath(update.UpdateRoot)
 	if err = u.ctxMgr.saveUpdateContext(log, context, contextLocation); err != nil {
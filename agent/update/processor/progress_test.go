@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
+	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/updateutil"
 	"github.com/stretchr/testify/assert"
 )
@@ -50,6 +51,21 @@ func TestUpdateSucceed(t *testing.T) {
 	assert.Equal(t, context.Histories[0].Result, contracts.ResultStatusSuccess)
 }
 
+func TestUpdateSucceedRecordsInstalledVersion(t *testing.T) {
+	updater := createDefaultUpdaterStub()
+	recordedVersion := ""
+	saveInstalledAgentVersion = func(log log.T, updateRoot string, installedVersion string) error {
+		recordedVersion = installedVersion
+		return nil
+	}
+	context := generateTestCase().Context
+	context.Current.TargetVersion = "2.3.900.0"
+	err := updater.mgr.succeeded(context, logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.900.0", recordedVersion)
+}
+
 func TestUpdateFailed(t *testing.T) {
 	updater := createDefaultUpdaterStub()
 	context := generateTestCase().Context
@@ -17,8 +17,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
 	"github.com/aws/amazon-ssm-agent/agent/contracts"
 	logger "github.com/aws/amazon-ssm-agent/agent/log"
 	ssmlog "github.com/aws/amazon-ssm-agent/agent/log/ssmlog"
@@ -36,22 +38,28 @@ var (
 	log     logger.T
 	updater processor.T
 	region  = platform.Region
+
+	// offlineUpdateRoot is the folder install-offline-package saves the offline update trigger in
+	offlineUpdateRoot = appconfig.UpdaterArtifactsRoot
 )
 
 var (
-	update          *bool
-	sourceVersion   *string
-	sourceLocation  *string
-	sourceHash      *string
-	targetVersion   *string
-	targetLocation  *string
-	targetHash      *string
-	packageName     *string
-	messageID       *string
-	stdout          *string
-	stderr          *string
-	outputKeyPrefix *string
-	outputBucket    *string
+	update           *bool
+	sourceVersion    *string
+	sourceLocation   *string
+	sourceHash       *string
+	targetVersion    *string
+	targetLocation   *string
+	targetHash       *string
+	packageName      *string
+	messageID        *string
+	stdout           *string
+	stderr           *string
+	outputKeyPrefix  *string
+	outputBucket     *string
+	dryRun           *bool
+	installTimeout   *int
+	uninstallTimeout *int
 )
 
 func init() {
@@ -76,6 +84,9 @@ func init() {
 	stderr = flag.String(updateutil.StderrFileName, "", "standard error file path")
 	outputKeyPrefix = flag.String(updateutil.OutputKeyPrefixCmd, "", "output key prefix")
 	outputBucket = flag.String(updateutil.OutputBucketNameCmd, "", "output bucket name")
+	dryRun = flag.Bool(updateutil.DryRunCmd, false, "run the update without installing")
+	installTimeout = flag.Int(updateutil.InstallTimeoutCmd, 0, "timeout of the install script in seconds")
+	uninstallTimeout = flag.Int(updateutil.UninstallTimeoutCmd, 0, "timeout of the uninstall script in seconds")
 }
 
 // Config holds Runtime info of plugins.
@@ -98,6 +109,11 @@ func main() {
 		return
 	}
 
+	// Install the package staged by install-offline-package when no target is given
+	if len(*targetLocation) == 0 {
+		applyOfflineUpdateTrigger(offlineUpdateRoot)
+	}
+
 	// Basic Validation
 	if len(*sourceVersion) == 0 || len(*sourceLocation) == 0 {
 		log.Error("no current version or package source.")
@@ -126,6 +142,9 @@ func main() {
 		MessageID:          *messageID,
 		StartDateTime:      time.Now().UTC(),
 		RequiresUninstall:  false,
+		DryRun:             *dryRun,
+		InstallTimeout:     *installTimeout,
+		UninstallTimeout:   *uninstallTimeout,
 	}
 
 	if err := resolveUpdateDetail(detail); err != nil {
@@ -135,6 +154,14 @@ func main() {
 
 	log.Infof("Update root is: %v", detail.UpdateRoot)
 
+	// Lock the update root so another updater cannot run the update at the same time
+	releaseLock, err := processor.AcquireUpdateLock(log, detail.UpdateRoot)
+	if err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	defer releaseLock()
+
 	// Load UpdateContext from local storage, set current update with the new UpdateDetail
 	context, err := updater.InitializeUpdate(log, detail)
 	if err != nil {
@@ -172,6 +199,29 @@ func resolveUpdateDetail(detail *processor.UpdateDetail) error {
 	return nil
 }
 
+// applyOfflineUpdateTrigger sets the target from the offline update trigger saved in updateRoot, the trigger is
+// removed once it is applied so the staged package is installed only once
+func applyOfflineUpdateTrigger(updateRoot string) {
+	trigger, err := updateutil.LoadOfflineUpdateTrigger(updateRoot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Ignoring the offline update trigger, %v", err)
+		}
+		return
+	}
+
+	log.Infof("Installing offline package %v staged at %v", trigger.TargetLocation, trigger.StagedDateTime)
+	*targetVersion = trigger.TargetVersion
+	*targetLocation = trigger.TargetLocation
+	*targetHash = trigger.TargetHash
+	if len(*packageName) == 0 {
+		*packageName = trigger.PackageName
+	}
+	if err = updateutil.RemoveOfflineUpdateTrigger(updateRoot); err != nil {
+		log.Warnf("Failed to remove the offline update trigger, %v", err)
+	}
+}
+
 // recoverUpdaterFromPanic recovers updater if panic occurs and fails the updater
 func recoverUpdaterFromPanic(context *processor.UpdateContext) {
 	// recover in case the updater panics
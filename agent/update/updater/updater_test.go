@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -134,3 +135,44 @@ func TestUpdaterFailedWithoutSourceTargetCmd(t *testing.T) {
 	assert.Empty(t, *sourceVersion)
 	assert.Empty(t, *targetVersion)
 }
+
+func TestApplyOfflineUpdateTrigger(t *testing.T) {
+	// setup
+	log = logger.NewMockLog()
+	updateRoot, _ := ioutil.TempDir("", "offlineupdate")
+	defer os.RemoveAll(updateRoot)
+	*targetVersion, *targetLocation, *targetHash, *packageName = "", "", "", ""
+	trigger := &updateutil.OfflineUpdateTrigger{
+		PackageName:    "amazon-ssm-agent",
+		TargetVersion:  "5.0.0.0",
+		TargetLocation: "/var/lib/amazon/ssm/update/amazon-ssm-agent/5.0.0.0/amazon-ssm-agent-linux-amd64.tar.gz",
+		TargetHash:     "abc",
+	}
+	assert.NoError(t, updateutil.SaveOfflineUpdateTrigger(updateRoot, trigger))
+
+	// action
+	applyOfflineUpdateTrigger(updateRoot)
+
+	// assert
+	assert.Equal(t, "5.0.0.0", *targetVersion)
+	assert.Equal(t, trigger.TargetLocation, *targetLocation)
+	assert.Equal(t, "abc", *targetHash)
+	assert.Equal(t, "amazon-ssm-agent", *packageName)
+	_, err := updateutil.LoadOfflineUpdateTrigger(updateRoot)
+	assert.True(t, os.IsNotExist(err), "the trigger is removed once applied")
+}
+
+func TestApplyOfflineUpdateTriggerWithoutTrigger(t *testing.T) {
+	// setup
+	log = logger.NewMockLog()
+	updateRoot, _ := ioutil.TempDir("", "offlineupdate")
+	defer os.RemoveAll(updateRoot)
+	*targetVersion, *targetLocation = "", ""
+
+	// action
+	applyOfflineUpdateTrigger(updateRoot)
+
+	// assert
+	assert.Empty(t, *targetVersion)
+	assert.Empty(t, *targetLocation)
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/version"
+)
+
+// InstalledVersionFileName represents the file name which records the installed agent version
+const InstalledVersionFileName = "installedversion"
+
+const (
+	// AgentVersionFlag represents the flag the agent binary prints its version with
+	AgentVersionFlag = "-version"
+
+	// undefinedFlagMessage is printed by the agent binaries that predate AgentVersionFlag when they are run with it
+	undefinedFlagMessage = "flag provided but not defined"
+)
+
+// errVersionFlagUnsupported is returned by reportedAgentVersion when the agent binary predates AgentVersionFlag
+var errVersionFlagUnsupported = errors.New("the agent does not support the " + AgentVersionFlag + " flag")
+
+var readFile = ioutil.ReadFile
+var writeFile = writeFileAtomically
+
+// runningAgentVersion is the version of the agent running the update plugin
+var runningAgentVersion = version.Version
+
+// reportedVersionPattern matches the version the agent binary reports, e.g. SSM Agent version: 2.3.100.0
+var reportedVersionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// InstalledVersionFilePath returns installed agent version file path
+func InstalledVersionFilePath(updateRoot string) (filePath string) {
+	return filepath.Join(updateRoot, InstalledVersionFileName)
+}
+
+// GetInstalledAgentVersion returns the agent version recorded by the updater in the update root,
+// the version of the running agent binary is returned when no version has been recorded yet
+func GetInstalledAgentVersion(log log.T, updateRoot string) (installedVersion string, err error) {
+	filePath := InstalledVersionFilePath(updateRoot)
+
+	var content []byte
+	if content, err = readFile(filePath); err != nil {
+		if os.IsNotExist(err) {
+			log.Debugf("%v does not exist, using the agent binary version %v", filePath, version.Version)
+			return version.Version, nil
+		}
+		return "", NewUpdateError(ErrorLoadingAgentVersion, err, "failed to read installed agent version from %v", filePath)
+	}
+
+	installedVersion = strings.TrimSpace(string(content))
+	if _, _, _, _, err = parseVersion(installedVersion); err != nil {
+		return "", NewUpdateError(ErrorLoadingAgentVersion, err, "invalid installed agent version %v in %v", installedVersion, filePath)
+	}
+
+	return installedVersion, nil
+}
+
+// SaveInstalledAgentVersion records the installed agent version in the update root, the version file is replaced
+// atomically so a failed write keeps the previously recorded version
+func SaveInstalledAgentVersion(log log.T, updateRoot string, installedVersion string) (err error) {
+	if _, _, _, _, err = parseVersion(installedVersion); err != nil {
+		return NewUpdateError(ErrorLoadingAgentVersion, err, "invalid installed agent version %v", installedVersion)
+	}
+
+	filePath := InstalledVersionFilePath(updateRoot)
+	if err = writeFile(filePath, []byte(installedVersion), appconfig.ReadWriteAccess); err != nil {
+		log.Errorf("failed to save installed agent version to %v, %v", filePath, err)
+		return err
+	}
+
+	return nil
+}
+
+// IsUpdateNeeded returns false when the version of the running agent already equals the target version,
+// the versions are compared with VersionCompare so downgrades are reported as needed as well. The version file
+// recorded by the updater is not used as it can be stale when the agent was installed by other means.
+func IsUpdateNeeded(log log.T, context *InstanceContext, targetVersion string) (needed bool, err error) {
+	installedVersion := runningAgentVersion
+	compareResult, err := VersionCompare(installedVersion, targetVersion)
+	if err != nil {
+		return false, NewUpdateError(ErrorInvalidTargetVersion, err, "failed to compare installed agent version %v with target version %v", installedVersion, targetVersion)
+	}
+	if compareResult == 0 {
+		if context != nil {
+			log.Infof("Agent %v is already installed on %v %v, no update is needed", installedVersion, context.Platform, context.PlatformVersion)
+		} else {
+			log.Infof("Agent %v is already installed, no update is needed", installedVersion)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// VerifyInstalledVersion runs the installed agent binary with AgentVersionFlag and returns an UpdateError with
+// ErrorInstallFailed when the binary cannot be run or reports a version other than the expected version. The check
+// is skipped when the installed agent predates AgentVersionFlag, e.g. after a downgrade or a rollback.
+func (util *Utility) VerifyInstalledVersion(log log.T, context *InstanceContext, expectedVersion string) (err error) {
+	binaryPath := agentBinaryPath(context)
+	reportedVersion, err := util.reportedAgentVersion(log, binaryPath, "installed")
+	if err == errVersionFlagUnsupported {
+		log.Infof("Skipping the installed agent version check, %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	compareResult, err := VersionCompare(reportedVersion, expectedVersion)
+	if err != nil {
+		return NewUpdateError(ErrorInstallFailed, err, "failed to compare installed agent version %v with %v", reportedVersion, expectedVersion)
+	}
+	if compareResult != 0 {
+		return NewUpdateError(ErrorInstallFailed, nil, "installed agent %v reports version %v, expected %v", binaryPath, reportedVersion, expectedVersion)
+	}
+
+	log.Infof("Installed agent %v reports the expected version %v", binaryPath, expectedVersion)
+	return nil
+}
+
+// reportedAgentVersion runs the agent binary with AgentVersionFlag and returns the version it reports, the binary
+// is run directly rather than through the platform shell so a path with spaces is passed to it unchanged.
+// errVersionFlagUnsupported is returned when the binary rejects the flag, the other errors are UpdateErrors
+// with ErrorInstallFailed which name the binary by its role, e.g. installed or running
+func (util *Utility) reportedAgentVersion(log log.T, binaryPath string, role string) (reportedVersion string, err error) {
+	log.Debugf("Running %v %v", binaryPath, AgentVersionFlag)
+	command := execCommand(binaryPath, AgentVersionFlag)
+	command.Dir = filepath.Dir(binaryPath)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+
+	output, err := statusCommandOutput(command)
+	if err != nil {
+		// the output of a timed out command may still be written to, it is only read after the command exited
+		if GetErrorCode(err) != ErrorTimeout && strings.Contains(stderr.String(), undefinedFlagMessage) {
+			return "", errVersionFlagUnsupported
+		}
+		return "", NewUpdateError(ErrorInstallFailed, err, "failed to run the %v agent %v", role, binaryPath)
+	}
+	if reportedVersion = reportedVersionPattern.FindString(string(output)); reportedVersion == "" {
+		return "", NewUpdateError(ErrorInstallFailed, nil, "%v agent %v did not report a version", role, binaryPath)
+	}
+	return reportedVersion, nil
+}
+
+// ListInstalledVersions returns the versions staged in the UpdateArtifactFolder of the package in ascending order,
+// the folders that are not named after a version are ignored
+func ListInstalledVersions(updateRoot string, packageName string) (versions []string, err error) {
+	versions = []string{}
+	var entries []os.FileInfo
+	if entries, err = ioutil.ReadDir(filepath.Join(updateRoot, packageName)); err != nil {
+		if os.IsNotExist(err) {
+			return versions, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, _, _, _, parseErr := parseVersion(entry.Name()); parseErr != nil {
+			continue
+		}
+		versions = append(versions, entry.Name())
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		compareResult, _ := VersionCompare(versions[i], versions[j])
+		return compareResult < 0
+	})
+	return versions, nil
+}
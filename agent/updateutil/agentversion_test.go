@@ -0,0 +1,196 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/version"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetInstalledAgentVersionWithVersionFile(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	assert.NoError(t, ioutil.WriteFile(InstalledVersionFilePath(updateRoot), []byte("2.3.842.0\n"), appconfig.ReadWriteAccess))
+
+	installedVersion, err := GetInstalledAgentVersion(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.842.0", installedVersion)
+}
+
+func TestGetInstalledAgentVersionWithMissingVersionFile(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	installedVersion, err := GetInstalledAgentVersion(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, version.Version, installedVersion)
+}
+
+func TestGetInstalledAgentVersionWithMalformedVersionFile(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	for _, content := range []string{"", "not a version", "2.3.a.0", "2.3.842"} {
+		assert.NoError(t, ioutil.WriteFile(InstalledVersionFilePath(updateRoot), []byte(content), appconfig.ReadWriteAccess))
+
+		_, err = GetInstalledAgentVersion(logger, updateRoot)
+		assert.Error(t, err)
+		assert.Equal(t, ErrorLoadingAgentVersion, GetErrorCode(err))
+	}
+}
+
+func TestGetInstalledAgentVersionWithUnreadableVersionFile(t *testing.T) {
+	readFile = func(filename string) ([]byte, error) {
+		return nil, fmt.Errorf("permission denied")
+	}
+	defer func() { readFile = ioutil.ReadFile }()
+
+	_, err := GetInstalledAgentVersion(logger, appconfig.UpdaterArtifactsRoot)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorLoadingAgentVersion, GetErrorCode(err))
+}
+
+func TestSaveInstalledAgentVersion(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	assert.NoError(t, SaveInstalledAgentVersion(logger, updateRoot, "2.3.900.0"))
+	assert.NoError(t, SaveInstalledAgentVersion(logger, updateRoot, "2.3.950.0"))
+	installedVersion, err := GetInstalledAgentVersion(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.950.0", installedVersion)
+
+	// the version file is renamed into place, no temp files are left behind
+	files, err := ioutil.ReadDir(updateRoot)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	err = SaveInstalledAgentVersion(logger, updateRoot, "invalid")
+	assert.Equal(t, ErrorLoadingAgentVersion, GetErrorCode(err))
+	installedVersion, err = GetInstalledAgentVersion(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.3.950.0", installedVersion)
+}
+
+func TestVerifyInstalledVersion(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	execCommand = fakeExecCommand
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	// the binary reports the expected version
+	assert.NoError(t, util.VerifyInstalledVersion(logger, context, "2.3.100.0"))
+
+	// the binary reports another version
+	err := util.VerifyInstalledVersion(logger, context, "3.0.0.0")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "reports version 2.3.100.0, expected 3.0.0.0")
+}
+
+func TestVerifyInstalledVersionBinaryCannotRun(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	execCommand = missingExecCommand
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	err := util.VerifyInstalledVersion(logger, context, "2.3.100.0")
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "failed to run the installed agent")
+}
+
+func TestVerifyInstalledVersionWithoutVersionFlag(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	// the agent binaries that predate the version flag reject it
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		return fakeExecCommand("oldagent", args...)
+	}
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	assert.NoError(t, util.VerifyInstalledVersion(logger, context, "2.3.100.0"))
+}
+
+func TestListInstalledVersions(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	for _, name := range []string{"2.3.842.0", "2.3.1000.0", "10.0.0.1", "2.3.99.0", "latest", "2.3", "2.3.x.0", "cachedartifact"} {
+		assert.NoError(t, os.MkdirAll(UpdateArtifactFolder(updateRoot, "amazon-ssm-agent", name), appconfig.ReadWriteExecuteAccess))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(updateRoot, "amazon-ssm-agent", "3.0.0.0"), []byte{}, appconfig.ReadWriteAccess))
+
+	versions, err := ListInstalledVersions(updateRoot, "amazon-ssm-agent")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2.3.99.0", "2.3.842.0", "2.3.1000.0", "10.0.0.1"}, versions)
+}
+
+func TestListInstalledVersionsWithoutPackageFolder(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "installedversions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	versions, err := ListInstalledVersions(updateRoot, "amazon-ssm-agent")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestIsUpdateNeeded(t *testing.T) {
+	runningAgentVersion = "2.3.842.0"
+	defer func() { runningAgentVersion = version.Version }()
+	context := &InstanceContext{Region: "us-east-1", Platform: PlatformLinux, PlatformVersion: "2", Arch: "amd64"}
+
+	testCases := []struct {
+		name          string
+		targetVersion string
+		needed        bool
+	}{
+		{"equal", "2.3.842.0", false},
+		{"upgrade", "2.3.1000.0", true},
+		{"downgrade", "2.3.50.0", true},
+	}
+
+	for _, test := range testCases {
+		needed, err := IsUpdateNeeded(logger, context, test.targetVersion)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.needed, needed, test.name)
+	}
+
+	_, err := IsUpdateNeeded(logger, context, "latest")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidTargetVersion, GetErrorCode(err))
+}
+
+func TestIsUpdateNeededWithRunningVersion(t *testing.T) {
+	needed, err := IsUpdateNeeded(logger, nil, version.Version)
+	assert.NoError(t, err)
+	assert.False(t, needed)
+}
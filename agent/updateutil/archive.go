@@ -0,0 +1,338 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/fileutil"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// ExtractPackage extracts the update package to dest, the decompressor is selected based on the CompressFormat
+// of the instance context, or detected from the package file name when the context does not specify one
+func ExtractPackage(log log.T, context *InstanceContext, src, dest string) error {
+	compressFormat := ""
+	if context != nil {
+		compressFormat = context.CompressFormat
+	}
+	if compressFormat == "" {
+		compressFormat = detectCompressFormat(src)
+	}
+
+	return extractArchive(log, compressFormat, src, dest)
+}
+
+// ExtractArchive extracts the tar.gz, tar.xz or zip archive to destDir based on the archive extension,
+// an UpdateError with ErrorInvalidPackage is returned if any entry of the archive escapes destDir and one
+// with ErrorEnvironmentIssue if xz is not installed to decompress a tar.xz archive
+func ExtractArchive(log log.T, archivePath string, destDir string) error {
+	return extractArchive(log, detectCompressFormat(archivePath), archivePath, destDir)
+}
+
+// ExtractDownloadedArchive extracts the archive downloaded from sourceURL to destDir, the local copy of a download
+// is not named after the source so the decompressor is selected based on the extension of sourceURL
+func ExtractDownloadedArchive(log log.T, archivePath string, sourceURL string, destDir string) error {
+	sourcePath := sourceURL
+	if index := strings.IndexAny(sourcePath, "?#"); index >= 0 {
+		sourcePath = sourcePath[:index]
+	}
+	return extractArchive(log, detectCompressFormat(sourcePath), archivePath, destDir)
+}
+
+// SelectiveExtract extracts only the wantedNames entries of the tar.gz or zip archive to destDir, the other entries
+// are skipped without being written. An UpdateError with ErrorInvalidPackage is returned if a wanted name escapes
+// destDir, is not a regular file, or is missing from the archive, the files extracted so far are removed in that case
+func SelectiveExtract(log log.T, archivePath string, destDir string, wantedNames []string) (err error) {
+	wanted := make(map[string]bool)
+	for _, name := range wantedNames {
+		if err = validateArchiveEntry(archivePath, destDir, name); err != nil {
+			return err
+		}
+		wanted[archiveEntryName(name)] = false
+	}
+
+	extracted := []string{}
+	defer func() {
+		if err != nil {
+			for _, filePath := range extracted {
+				os.Remove(filePath)
+			}
+		}
+	}()
+	extract := func(entryName string, isRegular bool, mode os.FileMode, r io.Reader) error {
+		name := archiveEntryName(entryName)
+		if done, found := wanted[name]; !found || done {
+			return nil
+		}
+		if !isRegular {
+			return NewUpdateError(ErrorInvalidPackage, nil, "%v entry %v is not a regular file", archivePath, entryName)
+		}
+		filePath := filepath.Join(destDir, filepath.FromSlash(name))
+		if err := writeArchiveEntry(filePath, mode, r); err != nil {
+			return NewUpdateError(ErrorInvalidPackage, err, "failed to extract %v from %v", entryName, archivePath)
+		}
+		log.Debugf("Extracted %v from %v", entryName, archivePath)
+		extracted = append(extracted, filePath)
+		wanted[name] = true
+		return nil
+	}
+
+	switch detectCompressFormat(archivePath) {
+	case CompressFormatZip:
+		err = walkZipEntries(archivePath, extract)
+	case CompressFormatTarGz:
+		err = walkTarGzEntries(archivePath, extract)
+	default:
+		return NewUpdateError(ErrorInvalidPackage, nil, "selective extraction of %v is not supported", archivePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for name, done := range wanted {
+		if !done {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		err = NewUpdateError(ErrorInvalidPackage, nil, "%v does not contain %v", archivePath, strings.Join(missing, ", "))
+		return err
+	}
+	return nil
+}
+
+// archiveEntryName returns the entry name in the slash separated form the archives use
+func archiveEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "./")
+}
+
+// writeArchiveEntry writes the content of an archive entry to filePath, creating its parent folders
+func writeArchiveEntry(filePath string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), appconfig.ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = appconfig.ReadWriteAccess
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// walkTarGzEntries calls visit for every entry of the tar.gz archive
+func walkTarGzEntries(src string, visit func(name string, isRegular bool, mode os.FileMode, r io.Reader) error) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to open %v", src)
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", src)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", src)
+		}
+		if hdr.FileInfo().IsDir() {
+			continue
+		}
+		if err = visit(hdr.Name, hdr.FileInfo().Mode().IsRegular(), hdr.FileInfo().Mode(), tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZipEntries calls visit for every entry of the zip archive
+func walkZipEntries(src string, visit func(name string, isRegular bool, mode os.FileMode, r io.Reader) error) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to open %v", src)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err = visitZipEntry(f, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visitZipEntry opens the zip entry and calls visit with its content
+func visitZipEntry(f *zip.File, visit func(name string, isRegular bool, mode os.FileMode, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", f.Name)
+	}
+	defer rc.Close()
+	return visit(f.Name, f.Mode().IsRegular(), f.Mode(), rc)
+}
+
+// extractArchive validates the archive entries before extracting the archive with the compress format
+func extractArchive(log log.T, compressFormat string, src, dest string) (err error) {
+	switch compressFormat {
+	case CompressFormatTarXz:
+		if err = validateTarXzEntries(src, dest); err != nil {
+			return err
+		}
+		err = fileutil.UncompressTarXz(log, src, dest)
+	case CompressFormatZip:
+		if err = validateZipEntries(src, dest); err != nil {
+			return err
+		}
+		err = fileutil.Unzip(src, dest)
+	default:
+		if err = validateTarGzEntries(src, dest); err != nil {
+			return err
+		}
+		err = fileutil.Uncompress(log, src, dest)
+	}
+
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to extract %v", src)
+	}
+	return nil
+}
+
+// detectCompressFormat returns the compress format based on the package file name, tar.gz is the default
+func detectCompressFormat(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, "."+CompressFormatTarXz):
+		return CompressFormatTarXz
+	case strings.HasSuffix(fileName, "."+CompressFormatZip):
+		return CompressFormatZip
+	default:
+		return CompressFormatTarGz
+	}
+}
+
+// validateTarGzEntries checks that every entry of the tar.gz archive stays within dest
+func validateTarGzEntries(src, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to open %v", src)
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", src)
+	}
+	defer gr.Close()
+
+	return validateTarEntries(src, dest, gr)
+}
+
+// validateTarXzEntries checks that every entry of the tar.xz archive stays within dest, an UpdateError with
+// ErrorEnvironmentIssue is returned when xz is not installed
+func validateTarXzEntries(src, dest string) error {
+	xr, err := fileutil.OpenXz(src)
+	if err == fileutil.ErrXzNotFound {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "failed to decompress %v", src)
+	} else if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to open %v", src)
+	}
+
+	err = validateTarEntries(src, dest, xr)
+	if closeErr := xr.Close(); err == nil && closeErr != nil {
+		err = NewUpdateError(ErrorInvalidPackage, closeErr, "failed to read %v", src)
+	}
+	return err
+}
+
+// validateTarEntries checks that every entry of the tar stream read from src stays within dest
+func validateTarEntries(src, dest string, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", src)
+		}
+		if err = validateArchiveEntry(src, dest, hdr.Name); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			target := hdr.Linkname
+			if hdr.Typeflag == tar.TypeSymlink && !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(hdr.Name), target)
+			}
+			if err = validateArchiveEntry(src, dest, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// validateZipEntries checks that every entry of the zip archive stays within dest
+func validateZipEntries(src, dest string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to open %v", src)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err = validateArchiveEntry(src, dest, f.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArchiveEntry returns an UpdateError with ErrorInvalidPackage if the entry path escapes dest
+func validateArchiveEntry(src, dest, entryName string) error {
+	if filepath.IsAbs(entryName) || strings.HasPrefix(entryName, "/") {
+		return NewUpdateError(ErrorInvalidPackage, nil, "%v contains entry %v with an absolute path", src, entryName)
+	}
+
+	cleanDest := filepath.Clean(dest)
+	entryPath := filepath.Join(cleanDest, entryName)
+	if entryPath != cleanDest && !strings.HasPrefix(entryPath, cleanDest+string(filepath.Separator)) {
+		return NewUpdateError(ErrorInvalidPackage, nil, "%v contains entry %v that escapes %v", src, entryName, dest)
+	}
+	return nil
+}
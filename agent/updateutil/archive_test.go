@@ -0,0 +1,324 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type archiveEntry struct {
+	name     string
+	linkname string
+	content  string
+}
+
+func writeTarGz(t *testing.T, path string, entries []archiveEntry) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	gw := gzip.NewWriter(file)
+	defer gw.Close()
+	writeTar(t, gw, entries)
+}
+
+func writeTarXz(t *testing.T, path string, entries []archiveEntry) {
+	var buf bytes.Buffer
+	writeTar(t, &buf, entries)
+	cmd := exec.Command("xz", "--compress", "--stdout")
+	cmd.Stdin = &buf
+	output, err := cmd.Output()
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, output, 0644))
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []archiveEntry) {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.linkname != "" {
+			hdr = &tar.Header{Name: entry.name, Mode: 0777, Linkname: entry.linkname, Typeflag: tar.TypeSymlink}
+		}
+		assert.NoError(t, tw.WriteHeader(hdr))
+		if entry.linkname == "" {
+			_, err := tw.Write([]byte(entry.content))
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, path string, entries []archiveEntry) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	zw := zip.NewWriter(file)
+	defer zw.Close()
+
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(entry.content))
+		assert.NoError(t, err)
+	}
+}
+
+func TestExtractArchiveRejectsPathTraversal(t *testing.T) {
+	testCases := map[string][]archiveEntry{
+		"parent.tar.gz":   {{name: "install.sh", content: "install"}, {name: "../evil.sh", content: "evil"}},
+		"nested.tar.gz":   {{name: "bin/../../evil.sh", content: "evil"}},
+		"absolute.tar.gz": {{name: "/tmp/evil.sh", content: "evil"}},
+		"symlink.tar.gz":  {{name: "bin/link", linkname: "../../evil"}},
+		"parent.zip":      {{name: "install.sh", content: "install"}, {name: "../evil.sh", content: "evil"}},
+		"nested.zip":      {{name: "bin/../../evil.sh", content: "evil"}},
+	}
+
+	for archiveName, entries := range testCases {
+		root, err := ioutil.TempDir("", "extractarchive")
+		assert.NoError(t, err)
+		archivePath := filepath.Join(root, archiveName)
+		if filepath.Ext(archiveName) == ".zip" {
+			writeZip(t, archivePath, entries)
+		} else {
+			writeTarGz(t, archivePath, entries)
+		}
+		dest := filepath.Join(root, "dest")
+
+		err = ExtractArchive(logger, archivePath, dest)
+
+		assert.Error(t, err, archiveName)
+		assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err), archiveName)
+		_, statErr := os.Stat(filepath.Join(root, "evil.sh"))
+		assert.True(t, os.IsNotExist(statErr), archiveName)
+		// nothing is extracted from a rejected archive
+		_, statErr = os.Stat(filepath.Join(dest, "install.sh"))
+		assert.True(t, os.IsNotExist(statErr), archiveName)
+		os.RemoveAll(root)
+	}
+}
+
+func TestExtractArchiveRejectsPathTraversalInTarXz(t *testing.T) {
+	if _, err := exec.LookPath("xz"); err != nil || runtime.GOOS == "windows" {
+		t.Skip("xz is not available")
+	}
+	testCases := map[string][]archiveEntry{
+		"parent.tar.xz":   {{name: "install.sh", content: "install"}, {name: "../evil.sh", content: "evil"}},
+		"absolute.tar.xz": {{name: "/tmp/evil.sh", content: "evil"}},
+		"symlink.tar.xz":  {{name: "install.sh", content: "install"}, {name: "bin/link", linkname: "../../evil.sh"}},
+	}
+
+	for archiveName, entries := range testCases {
+		root, err := ioutil.TempDir("", "extractarchive")
+		assert.NoError(t, err)
+		archivePath := filepath.Join(root, archiveName)
+		writeTarXz(t, archivePath, entries)
+		dest := filepath.Join(root, "dest")
+
+		err = ExtractArchive(logger, archivePath, dest)
+
+		assert.Error(t, err, archiveName)
+		assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err), archiveName)
+		_, statErr := os.Stat(filepath.Join(root, "evil.sh"))
+		assert.True(t, os.IsNotExist(statErr), archiveName)
+		// the entries are validated before anything is extracted
+		_, statErr = os.Stat(filepath.Join(dest, "install.sh"))
+		assert.True(t, os.IsNotExist(statErr), archiveName)
+		os.RemoveAll(root)
+	}
+}
+
+func TestExtractDownloadedArchive(t *testing.T) {
+	if _, err := exec.LookPath("xz"); err != nil || runtime.GOOS == "windows" {
+		t.Skip("xz is not available")
+	}
+	root, err := ioutil.TempDir("", "extractarchive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	// the local copy of a download is not named after the source
+	archivePath := filepath.Join(root, "download")
+	writeTarXz(t, archivePath, []archiveEntry{{name: "install.sh", content: "install"}})
+	dest := filepath.Join(root, "dest")
+
+	err = ExtractDownloadedArchive(logger, archivePath, "https://example.com/amazon-ssm-agent-linux-amd64.tar.xz?versionId=1", dest)
+
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(filepath.Join(dest, "install.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "install", string(content))
+}
+
+func TestExtractArchiveWithoutXz(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("tar.xz packages are not supported on windows")
+	}
+	root, err := ioutil.TempDir("", "extractarchive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	archivePath := filepath.Join(root, "package.tar.xz")
+	assert.NoError(t, ioutil.WriteFile(archivePath, []byte("xz"), 0644))
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", root)
+
+	err = ExtractArchive(logger, archivePath, filepath.Join(root, "dest"))
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "install.sh", content: "install"},
+		{name: "bin/amazon-ssm-agent", content: "agent binary"},
+		{name: "bin/../version", content: "2.3.842.0"},
+	}
+	archiveNames := []string{"package.zip"}
+	if runtime.GOOS != "windows" {
+		archiveNames = append(archiveNames, "package.tar.gz")
+		if _, err := exec.LookPath("xz"); err == nil {
+			archiveNames = append(archiveNames, "package.tar.xz")
+		}
+	}
+
+	for _, archiveName := range archiveNames {
+		root, err := ioutil.TempDir("", "extractarchive")
+		assert.NoError(t, err)
+		archivePath := filepath.Join(root, archiveName)
+		switch detectCompressFormat(archiveName) {
+		case CompressFormatZip:
+			writeZip(t, archivePath, entries)
+		case CompressFormatTarXz:
+			writeTarXz(t, archivePath, entries)
+		default:
+			writeTarGz(t, archivePath, entries)
+		}
+		dest := filepath.Join(root, "dest")
+
+		assert.NoError(t, ExtractArchive(logger, archivePath, dest), archiveName)
+
+		for _, expected := range []archiveEntry{
+			{name: "install.sh", content: "install"},
+			{name: filepath.Join("bin", "amazon-ssm-agent"), content: "agent binary"},
+			{name: "version", content: "2.3.842.0"},
+		} {
+			content, err := ioutil.ReadFile(filepath.Join(dest, expected.name))
+			assert.NoError(t, err, archiveName)
+			assert.Equal(t, expected.content, string(content), archiveName)
+		}
+		os.RemoveAll(root)
+	}
+}
+
+func TestSelectiveExtract(t *testing.T) {
+	archiveNames := []string{"package.zip", "package.tar.gz"}
+	entries := []archiveEntry{
+		{name: "install.sh", content: "install"},
+		{name: "uninstall.sh", content: "uninstall"},
+		{name: "bin/amazon-ssm-agent", content: "agent binary"},
+		{name: "bin/ssm-cli", content: "cli binary"},
+	}
+
+	for _, archiveName := range archiveNames {
+		root, err := ioutil.TempDir("", "selectiveextract")
+		assert.NoError(t, err)
+		archivePath := filepath.Join(root, archiveName)
+		switch detectCompressFormat(archiveName) {
+		case CompressFormatZip:
+			writeZip(t, archivePath, entries)
+		case CompressFormatTarXz:
+			writeTarXz(t, archivePath, entries)
+		default:
+			writeTarGz(t, archivePath, entries)
+		}
+		dest := filepath.Join(root, "dest")
+
+		assert.NoError(t, SelectiveExtract(logger, archivePath, dest, []string{"install.sh", filepath.Join("bin", "amazon-ssm-agent")}), archiveName)
+
+		content, err := ioutil.ReadFile(filepath.Join(dest, "install.sh"))
+		assert.NoError(t, err, archiveName)
+		assert.Equal(t, "install", string(content), archiveName)
+		content, err = ioutil.ReadFile(filepath.Join(dest, "bin", "amazon-ssm-agent"))
+		assert.NoError(t, err, archiveName)
+		assert.Equal(t, "agent binary", string(content), archiveName)
+		for _, skipped := range []string{"uninstall.sh", filepath.Join("bin", "ssm-cli")} {
+			_, statErr := os.Stat(filepath.Join(dest, skipped))
+			assert.True(t, os.IsNotExist(statErr), archiveName)
+		}
+		os.RemoveAll(root)
+	}
+}
+
+func TestSelectiveExtractFromFixture(t *testing.T) {
+	dest, err := ioutil.TempDir("", "selectiveextract")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dest)
+
+	assert.NoError(t, SelectiveExtract(logger, filepath.Join("testdata", "package.tar.gz"), dest, []string{"install.sh"}))
+
+	_, err = os.Stat(filepath.Join(dest, "install.sh"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dest, "bin"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSelectiveExtractWithMissingWantedFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "selectiveextract")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	archivePath := filepath.Join(root, "package.tar.gz")
+	writeTarGz(t, archivePath, []archiveEntry{{name: "install.sh", content: "install"}})
+	dest := filepath.Join(root, "dest")
+
+	err = SelectiveExtract(logger, archivePath, dest, []string{"install.sh", "uninstall.sh"})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "uninstall.sh")
+	// the wanted files extracted before the missing file was detected are removed
+	_, statErr := os.Stat(filepath.Join(dest, "install.sh"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestSelectiveExtractRejectsPathTraversal(t *testing.T) {
+	root, err := ioutil.TempDir("", "selectiveextract")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	archivePath := filepath.Join(root, "package.tar.gz")
+	writeTarGz(t, archivePath, []archiveEntry{{name: "../evil.sh", content: "evil"}, {name: "bin/link", linkname: "../../evil"}})
+	dest := filepath.Join(root, "dest")
+
+	for _, wantedName := range []string{"../evil.sh", "/tmp/evil.sh", "bin/link"} {
+		err = SelectiveExtract(logger, archivePath, dest, []string{wantedName})
+
+		assert.Error(t, err, wantedName)
+		assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err), wantedName)
+	}
+	_, statErr := os.Stat(filepath.Join(root, "evil.sh"))
+	assert.True(t, os.IsNotExist(statErr))
+	_, statErr = os.Stat(filepath.Join(dest, "bin", "link"))
+	assert.True(t, os.IsNotExist(statErr))
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// CachedArtifactFileName represents the file name of the package kept in the version folder
+	CachedArtifactFileName = "cachedartifact"
+
+	// CachedArtifactChecksumFileName represents the file name of the recorded sha256 checksum of the kept package
+	CachedArtifactChecksumFileName = "cachedartifact.sha256"
+)
+
+// IsKeepUpdateArtifactsEnabled returns if the downloaded update packages are kept for reuse
+func IsKeepUpdateArtifactsEnabled(log log.T) bool {
+	config, err := loadAppConfig(false)
+	if err != nil {
+		log.Debugf("failed to load appconfig, update artifacts are not kept, %v", err)
+		return false
+	}
+	return config.Agent.KeepUpdateArtifacts
+}
+
+// CacheArtifact copies the downloaded package into the version folder and records its checksum
+func CacheArtifact(log log.T, updateRoot string, packageName string, version string, filePath string, checksum string) (err error) {
+	if checksum == "" {
+		log.Debugf("%v %v has no checksum, the package is not kept", packageName, version)
+		return nil
+	}
+	folder := UpdateArtifactFolder(updateRoot, packageName, version)
+	if err = mkDirAll(folder, appconfig.ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+
+	cachedPath := filepath.Join(folder, CachedArtifactFileName)
+	if err = copyFile(filePath, cachedPath); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(folder, CachedArtifactChecksumFileName), []byte(checksum), appconfig.ReadWriteAccess); err != nil {
+		return err
+	}
+
+	log.Infof("Kept %v %v in %v", packageName, version, cachedPath)
+	return nil
+}
+
+// CachedArtifact returns the kept package of the version when both the recorded and the computed checksum
+// of the package match the expected checksum
+func CachedArtifact(log log.T, updateRoot string, packageName string, version string, checksum string) (filePath string, found bool) {
+	if checksum == "" {
+		return "", false
+	}
+	folder := UpdateArtifactFolder(updateRoot, packageName, version)
+	filePath = filepath.Join(folder, CachedArtifactFileName)
+
+	recorded, err := ioutil.ReadFile(filepath.Join(folder, CachedArtifactChecksumFileName))
+	if err != nil {
+		log.Debugf("no kept package for %v %v, %v", packageName, version, err)
+		return "", false
+	}
+	if !strings.EqualFold(strings.TrimSpace(string(recorded)), checksum) {
+		log.Infof("Kept package of %v %v was recorded with a different checksum", packageName, version)
+		return "", false
+	}
+
+	computed, err := sha256File(filePath)
+	if err != nil || !strings.EqualFold(computed, checksum) {
+		log.Infof("Kept package of %v %v does not verify, it will be downloaded again", packageName, version)
+		return "", false
+	}
+
+	return filePath, true
+}
+
+func sha256File(filePath string) (checksum string, err error) {
+	var file *os.File
+	if file, err = os.Open(filePath); err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(src string, dest string) (err error) {
+	var in, out *os.File
+	if in, err = os.Open(src); err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if out, err = os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, appconfig.ReadWriteAccess); err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
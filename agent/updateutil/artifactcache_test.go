@@ -0,0 +1,89 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareArtifactCache(t *testing.T, content string) (updateRoot string, sourcePath string, checksum string) {
+	updateRoot, err := ioutil.TempDir("", "artifactcache")
+	assert.NoError(t, err)
+	sourcePath = filepath.Join(updateRoot, "source")
+	assert.NoError(t, ioutil.WriteFile(sourcePath, []byte(content), 0600))
+	hash := sha256.Sum256([]byte(content))
+	return updateRoot, sourcePath, hex.EncodeToString(hash[:])
+}
+
+func TestCachedArtifactVerifiesChecksum(t *testing.T) {
+	updateRoot, sourcePath, checksum := prepareArtifactCache(t, "package content")
+	defer os.RemoveAll(updateRoot)
+
+	assert.NoError(t, CacheArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", sourcePath, checksum))
+
+	filePath, found := CachedArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", checksum)
+	assert.True(t, found)
+	assert.Equal(t, filepath.Join(UpdateArtifactFolder(updateRoot, "amazon-ssm-agent", "3.0.0.0"), CachedArtifactFileName), filePath)
+
+	_, found = CachedArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", "0123abcd")
+	assert.False(t, found)
+
+	_, found = CachedArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.1", checksum)
+	assert.False(t, found)
+}
+
+func TestCachedArtifactRejectsCorruptedFile(t *testing.T) {
+	updateRoot, sourcePath, checksum := prepareArtifactCache(t, "package content")
+	defer os.RemoveAll(updateRoot)
+
+	assert.NoError(t, CacheArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", sourcePath, checksum))
+	cachedPath := filepath.Join(UpdateArtifactFolder(updateRoot, "amazon-ssm-agent", "3.0.0.0"), CachedArtifactFileName)
+	assert.NoError(t, ioutil.WriteFile(cachedPath, []byte("corrupted"), 0600))
+
+	_, found := CachedArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", checksum)
+	assert.False(t, found)
+}
+
+func TestCacheArtifactWithoutChecksum(t *testing.T) {
+	updateRoot, sourcePath, _ := prepareArtifactCache(t, "package content")
+	defer os.RemoveAll(updateRoot)
+
+	assert.NoError(t, CacheArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", sourcePath, ""))
+	_, err := os.Stat(filepath.Join(UpdateArtifactFolder(updateRoot, "amazon-ssm-agent", "3.0.0.0"), CachedArtifactFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	_, found := CachedArtifact(logger, updateRoot, "amazon-ssm-agent", "3.0.0.0", "")
+	assert.False(t, found)
+}
+
+func TestIsKeepUpdateArtifactsEnabled(t *testing.T) {
+	defer func() { loadAppConfig = appconfig.Config }()
+
+	config := appconfig.DefaultConfig()
+	config.Agent.KeepUpdateArtifacts = true
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return config, nil }
+	assert.True(t, IsKeepUpdateArtifactsEnabled(logger))
+
+	config.Agent.KeepUpdateArtifacts = false
+	assert.False(t, IsKeepUpdateArtifactsEnabled(logger))
+}
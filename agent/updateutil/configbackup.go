@@ -0,0 +1,96 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// ConfigBackupFolderName represents the folder in the update root the agent configuration is backed up to
+const ConfigBackupFolderName = "configbackup"
+
+var configFilePaths = defaultConfigFilePaths
+
+// defaultConfigFilePaths returns the agent configuration files kept across a failed update
+func defaultConfigFilePaths() []string {
+	return []string{
+		appconfig.AppConfigPath,
+		filepath.Join(appconfig.DefaultProgramFolder, appconfig.SeelogConfigFileName),
+	}
+}
+
+// ConfigBackupFolder returns the folder the agent configuration is backed up to before the update
+func ConfigBackupFolder(updateRoot string) string {
+	return filepath.Join(updateRoot, ConfigBackupFolderName)
+}
+
+// BackupConfig copies the agent configuration files to destDir, the files that do not exist are skipped
+// and the backups of a previous update are removed so they cannot be restored by mistake
+func BackupConfig(log log.T, destDir string) (err error) {
+	if err = os.RemoveAll(destDir); err != nil {
+		return err
+	}
+	if err = mkDirAll(destDir, appconfig.ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+
+	for _, configPath := range configFilePaths() {
+		var info os.FileInfo
+		if info, err = os.Stat(configPath); err != nil {
+			if os.IsNotExist(err) {
+				log.Debugf("%v does not exist, it is not backed up", configPath)
+				continue
+			}
+			return err
+		}
+		backupPath := filepath.Join(destDir, filepath.Base(configPath))
+		if err = copyFile(configPath, backupPath); err != nil {
+			return err
+		}
+		if err = os.Chmod(backupPath, info.Mode()); err != nil {
+			return err
+		}
+		log.Infof("Backed up %v to %v", configPath, backupPath)
+	}
+	return nil
+}
+
+// RestoreConfig copies the agent configuration files backed up by BackupConfig from srcDir to their location,
+// the files that were not backed up are left untouched
+func RestoreConfig(log log.T, srcDir string) (err error) {
+	for _, configPath := range configFilePaths() {
+		backupPath := filepath.Join(srcDir, filepath.Base(configPath))
+		var info os.FileInfo
+		if info, err = os.Stat(backupPath); err != nil {
+			if os.IsNotExist(err) {
+				log.Debugf("%v was not backed up, it is not restored", configPath)
+				continue
+			}
+			return err
+		}
+		if err = copyFile(backupPath, configPath); err != nil {
+			return err
+		}
+		if err = os.Chmod(configPath, info.Mode()); err != nil {
+			return err
+		}
+		log.Infof("Restored %v from %v", configPath, backupPath)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestConfigFiles points the configuration files to a temp folder and returns their paths
+func useTestConfigFiles(t *testing.T, dir string) (appConfigPath string, seelogPath string) {
+	appConfigPath = filepath.Join(dir, appconfig.AppConfigFileName)
+	seelogPath = filepath.Join(dir, appconfig.SeelogConfigFileName)
+	configFilePaths = func() []string { return []string{appConfigPath, seelogPath} }
+	return appConfigPath, seelogPath
+}
+
+func TestBackupAndRestoreConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configbackup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { configFilePaths = defaultConfigFilePaths }()
+	appConfigPath, seelogPath := useTestConfigFiles(t, dir)
+	assert.NoError(t, ioutil.WriteFile(appConfigPath, []byte(`{"Agent":{"Region":"us-east-1"}}`), 0640))
+	assert.NoError(t, ioutil.WriteFile(seelogPath, []byte("<seelog/>"), appconfig.ReadWriteAccess))
+	backupDir := ConfigBackupFolder(filepath.Join(dir, "update"))
+
+	assert.NoError(t, BackupConfig(logger, backupDir))
+
+	// the new version overwrites the configuration
+	assert.NoError(t, ioutil.WriteFile(appConfigPath, []byte(`{}`), appconfig.ReadWriteAccess))
+	assert.NoError(t, os.Remove(seelogPath))
+
+	assert.NoError(t, RestoreConfig(logger, backupDir))
+
+	content, err := ioutil.ReadFile(appConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Agent":{"Region":"us-east-1"}}`, string(content))
+	info, err := os.Stat(appConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	content, err = ioutil.ReadFile(seelogPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "<seelog/>", string(content))
+}
+
+func TestBackupConfigWithMissingConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configbackup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { configFilePaths = defaultConfigFilePaths }()
+	appConfigPath, seelogPath := useTestConfigFiles(t, dir)
+	assert.NoError(t, ioutil.WriteFile(seelogPath, []byte("<seelog/>"), appconfig.ReadWriteAccess))
+	backupDir := ConfigBackupFolder(filepath.Join(dir, "update"))
+	// a backup of a previous update is not restored
+	assert.NoError(t, os.MkdirAll(backupDir, appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(backupDir, appconfig.AppConfigFileName), []byte(`{}`), appconfig.ReadWriteAccess))
+
+	assert.NoError(t, BackupConfig(logger, backupDir))
+	// the new version creates the configuration
+	assert.NoError(t, ioutil.WriteFile(appConfigPath, []byte(`{"Agent":{}}`), appconfig.ReadWriteAccess))
+	assert.NoError(t, RestoreConfig(logger, backupDir))
+
+	content, err := ioutil.ReadFile(appConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Agent":{}}`, string(content))
+	content, err = ioutil.ReadFile(seelogPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "<seelog/>", string(content))
+}
+
+func TestRestoreConfigWithoutBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configbackup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { configFilePaths = defaultConfigFilePaths }()
+	appConfigPath, _ := useTestConfigFiles(t, dir)
+	assert.NoError(t, ioutil.WriteFile(appConfigPath, []byte(`{}`), appconfig.ReadWriteAccess))
+
+	assert.NoError(t, RestoreConfig(logger, filepath.Join(dir, "missing")))
+
+	content, err := ioutil.ReadFile(appConfigPath)
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(content))
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// agentUnitNames are the systemd units the agent is installed as by its packages
+var agentUnitNames = []string{AgentSystemdUnit, AgentSnapSystemdUnit}
+
+var (
+	findAgentBinaries = installedAgentBinaries
+	findAgentUnits    = installedAgentUnits
+)
+
+// DetectConflictingInstalls returns an UpdateError with ErrorEnvironmentIssue when more than one agent binary or
+// service is installed, updating one of the installs corrupts the others so the update must not proceed
+func DetectConflictingInstalls(log log.T, context *InstanceContext) error {
+	binaries, err := findAgentBinaries()
+	if err != nil {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "failed to look for installed agent binaries")
+	}
+	units := findAgentUnits(log, context)
+
+	if len(binaries) <= 1 && len(units) <= 1 {
+		log.Debugf("found a single agent install, binaries %v, services %v", binaries, units)
+		return nil
+	}
+	return NewUpdateError(
+		ErrorEnvironmentIssue,
+		nil,
+		"found conflicting agent installs, binaries [%v], services [%v], remove all but one of them before updating",
+		strings.Join(binaries, ", "),
+		strings.Join(units, ", "))
+}
+
+// installedAgentBinaries returns the agent binaries present on the instance
+func installedAgentBinaries() (binaries []string, err error) {
+	for _, binaryPath := range agentBinaryPaths {
+		if _, statErr := statFile(binaryPath); statErr == nil {
+			binaries = append(binaries, binaryPath)
+		} else if !os.IsNotExist(statErr) {
+			return nil, statErr
+		}
+	}
+	return binaries, nil
+}
+
+// installedAgentUnits returns the agent units loaded by systemd, none are returned when the platform does not use
+// systemd or systemctl cannot be probed
+func installedAgentUnits(log log.T, context *InstanceContext) (units []string) {
+	if runtimeGOOS != PlatformLinux {
+		return nil
+	}
+	if isSystemD, err := context.IsPlatformUsingSystemD(log); err != nil || !isSystemD {
+		return nil
+	}
+	for _, unitName := range agentUnitNames {
+		output, err := statusCommandOutput(execCommand("systemctl", "show", unitName, "--property=LoadState"))
+		if err != nil {
+			log.Debugf("failed to probe the systemd unit %v, %v", unitName, err)
+			return nil
+		}
+		if strings.TrimPrefix(strings.TrimSpace(string(output)), systemdLoadStateProperty) == systemdUnitLoaded {
+			units = append(units, unitName)
+		}
+	}
+	return units
+}
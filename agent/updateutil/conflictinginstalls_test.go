@@ -0,0 +1,100 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubInstallProbes replaces the install probes with ones reporting the given binaries and units
+func stubInstallProbes(binaries []string, binariesErr error, units []string) func() {
+	originalBinaries, originalUnits := findAgentBinaries, findAgentUnits
+	findAgentBinaries = func() ([]string, error) { return binaries, binariesErr }
+	findAgentUnits = func(log log.T, context *InstanceContext) []string { return units }
+	return func() {
+		findAgentBinaries, findAgentUnits = originalBinaries, originalUnits
+	}
+}
+
+func TestDetectConflictingInstalls(t *testing.T) {
+	context := &InstanceContext{"us-east-1", PlatformUbuntu, "18.04", "linux", "amd64", "tar.gz"}
+	testCases := []struct {
+		name     string
+		binaries []string
+		units    []string
+		conflict bool
+	}{
+		{"none", nil, nil, false},
+		{"package", []string{"/usr/bin/amazon-ssm-agent"}, []string{"amazon-ssm-agent.service"}, false},
+		{"snap", []string{"/snap/bin/amazon-ssm-agent"}, []string{"snap.amazon-ssm-agent.amazon-ssm-agent.service"}, false},
+		{
+			"package and snap",
+			[]string{"/usr/bin/amazon-ssm-agent", "/snap/bin/amazon-ssm-agent"},
+			[]string{"amazon-ssm-agent.service", "snap.amazon-ssm-agent.amazon-ssm-agent.service"},
+			true,
+		},
+		{"two binaries", []string{"/usr/bin/amazon-ssm-agent", "/snap/bin/amazon-ssm-agent"}, nil, true},
+		{"two services", []string{"/usr/bin/amazon-ssm-agent"}, []string{"amazon-ssm-agent.service", "snap.amazon-ssm-agent.amazon-ssm-agent.service"}, true},
+	}
+
+	for _, test := range testCases {
+		restore := stubInstallProbes(test.binaries, nil, test.units)
+		err := DetectConflictingInstalls(logger, context)
+		restore()
+
+		if !test.conflict {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		assert.Error(t, err, test.name)
+		assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err), test.name)
+		for _, install := range append(test.binaries, test.units...) {
+			assert.Contains(t, err.Error(), install, test.name)
+		}
+	}
+}
+
+func TestDetectConflictingInstallsProbeFails(t *testing.T) {
+	defer stubInstallProbes(nil, fmt.Errorf("permission denied"), nil)()
+
+	err := DetectConflictingInstalls(logger, &InstanceContext{"us-east-1", PlatformUbuntu, "18.04", "linux", "amd64", "tar.gz"})
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "permission denied")
+}
+
+func TestInstalledAgentBinaries(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "conflictinginstalls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	installed := filepath.Join(tempDir, "installed")
+	assert.NoError(t, ioutil.WriteFile(installed, []byte{}, 0755))
+
+	originalPaths := agentBinaryPaths
+	defer func() { agentBinaryPaths = originalPaths }()
+	agentBinaryPaths = []string{installed, filepath.Join(tempDir, "missing")}
+
+	binaries, err := installedAgentBinaries()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{installed}, binaries)
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"os"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// EnsureExecutable returns an UpdateError with ErrorInvalidPackage when the file at path cannot be executed, fix sets
+// the execute bits of the readers when they are missing instead of failing. The bits are only set on a regular file
+// which is not writable by the group or the others, a file others can modify is never made executable.
+func EnsureExecutable(log log.T, path string, fix bool) (err error) {
+	var info os.FileInfo
+	if info, err = os.Lstat(path); err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to check if %v is executable", path)
+	}
+	if !info.Mode().IsRegular() {
+		return NewUpdateError(ErrorInvalidPackage, nil, "%v is not a regular file", path)
+	}
+	if isExecutable(info) {
+		return nil
+	}
+	if !fix {
+		return NewUpdateError(ErrorInvalidPackage, nil, "%v is not executable", path)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return NewUpdateError(ErrorInvalidPackage, nil,
+			"%v is not executable and is writable by other users, refusing to make it executable", path)
+	}
+
+	// readers of the file get the matching execute bit, 0644 becomes 0755 and 0600 becomes 0700
+	mode := info.Mode().Perm()
+	mode |= (mode & 0444) >> 2
+	if err = os.Chmod(path, mode); err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to make %v executable", path)
+	}
+	log.Infof("%v was not executable, its mode was changed to %v", path, mode)
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeInstaller(t *testing.T, mode os.FileMode) (dir string, path string) {
+	dir, err := ioutil.TempDir("", "executable")
+	assert.NoError(t, err)
+	path = filepath.Join(dir, "install.sh")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode))
+	// the umask may have cleared some of the bits
+	assert.NoError(t, os.Chmod(path, mode))
+	return dir, path
+}
+
+func TestEnsureExecutableWithExecutableFile(t *testing.T) {
+	dir, path := writeInstaller(t, 0750)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, EnsureExecutable(logger, path, false))
+	assert.NoError(t, EnsureExecutable(logger, path, true))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+}
+
+func TestEnsureExecutableFixesNonExecutableFile(t *testing.T) {
+	dir, path := writeInstaller(t, 0644)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, EnsureExecutable(logger, path, true))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func TestEnsureExecutableWithFixDisabled(t *testing.T) {
+	dir, path := writeInstaller(t, 0644)
+	defer os.RemoveAll(dir)
+
+	err := EnsureExecutable(logger, path, false)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "is not executable")
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestEnsureExecutableRefusesFileWritableByOthers(t *testing.T) {
+	dir, path := writeInstaller(t, 0666)
+	defer os.RemoveAll(dir)
+
+	err := EnsureExecutable(logger, path, true)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+}
+
+func TestEnsureExecutableWithMissingFile(t *testing.T) {
+	err := EnsureExecutable(logger, filepath.Join(os.TempDir(), "doesnotexist", "install.sh"), true)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+}
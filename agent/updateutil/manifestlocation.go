@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateManifestLocation validates the manifest location is a well formed http, https, s3 or file location,
+// an UpdateError with ErrorInvalidManifestLocation is returned otherwise
+func ValidateManifestLocation(location string) (err error) {
+	if strings.TrimSpace(location) == "" {
+		return NewUpdateError(ErrorInvalidManifestLocation, nil, "manifest location cannot be empty")
+	}
+
+	// local manifest file
+	if filepath.IsAbs(location) {
+		return nil
+	}
+
+	var locationURL *url.URL
+	if locationURL, err = url.Parse(location); err != nil {
+		return NewUpdateError(ErrorInvalidManifestLocation, err, "invalid manifest location %v", location)
+	}
+
+	switch strings.ToLower(locationURL.Scheme) {
+	case "http", "https":
+		if locationURL.Hostname() == "" {
+			err = fmt.Errorf("host is missing")
+		}
+	case "s3":
+		if locationURL.Host == "" {
+			err = fmt.Errorf("bucket is missing")
+		} else if strings.Trim(locationURL.Path, "/") == "" {
+			err = fmt.Errorf("object key is missing")
+		}
+	case "file":
+		if locationURL.Path == "" {
+			err = fmt.Errorf("file path is missing")
+		}
+	case "":
+		err = fmt.Errorf("scheme is missing")
+	default:
+		err = fmt.Errorf("scheme %v is not supported", locationURL.Scheme)
+	}
+
+	if err != nil {
+		return NewUpdateError(ErrorInvalidManifestLocation, err, "invalid manifest location %v", location)
+	}
+	return nil
+}
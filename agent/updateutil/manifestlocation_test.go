@@ -0,0 +1,54 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateManifestLocation(t *testing.T) {
+	validLocations := []string{
+		"https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/ssm-agent-manifest.json",
+		"https://amazon-ssm-us-east-1.s3.amazonaws.com/ssm-agent-manifest.json",
+		"http://localhost:8080/ssm-agent-manifest.json",
+		"s3://amazon-ssm-us-east-1/ssm-agent-manifest.json",
+		"file:///var/lib/amazon/ssm/ssm-agent-manifest.json",
+		"/var/lib/amazon/ssm/ssm-agent-manifest.json",
+	}
+	for _, location := range validLocations {
+		assert.NoError(t, ValidateManifestLocation(location), location)
+	}
+
+	invalidLocations := []string{
+		"",
+		"   ",
+		"htps://s3.amazonaws.com/ssm-agent-manifest.json",
+		"ftp://s3.amazonaws.com/ssm-agent-manifest.json",
+		"https:///ssm-agent-manifest.json",
+		"https://:443/ssm-agent-manifest.json",
+		"s3://amazon-ssm-us-east-1",
+		"s3:///ssm-agent-manifest.json",
+		"file://",
+		"s3.amazonaws.com/ssm-agent-manifest.json",
+		"https://s3.amazonaws.com/%zz",
+	}
+	for _, location := range invalidLocations {
+		err := ValidateManifestLocation(location)
+		assert.Error(t, err, location)
+		assert.Equal(t, ErrorInvalidManifestLocation, GetErrorCode(err), location)
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd netbsd openbsd
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// availableMemory is not supported, callers continue the update without the memory check
+func availableMemory() (int64, error) {
+	return 0, fmt.Errorf("loading the available memory is not supported on %v", runtime.GOOS)
+}
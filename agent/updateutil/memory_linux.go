@@ -0,0 +1,73 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procMeminfoPath is the file the kernel reports the memory usage in
+var procMeminfoPath = "/proc/meminfo"
+
+// availableMemory returns the bytes of memory available for starting new processes
+func availableMemory() (int64, error) {
+	file, err := os.Open(procMeminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return parseAvailableMemory(file)
+}
+
+// parseAvailableMemory returns the MemAvailable of the meminfo, it is estimated from the free memory and the page
+// cache on kernels older than 3.14 which do not report it
+func parseAvailableMemory(meminfo io.Reader) (int64, error) {
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(meminfo)
+	for scanner.Scan() {
+		// e.g. "MemAvailable:    1024000 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			value *= 1024
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if available, ok := values["MemAvailable"]; ok {
+		return available, nil
+	}
+	free, ok := values["MemFree"]
+	if !ok {
+		return 0, fmt.Errorf("meminfo reports neither MemAvailable nor MemFree")
+	}
+	return free + values["Buffers"] + values["Cached"], nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// memoryStatusEx is the MEMORYSTATUSEX structure GlobalMemoryStatusEx fills
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// availableMemory returns the bytes of physical memory available
+func availableMemory() (int64, error) {
+	// Load kernel32.dll and find GlobalMemoryStatusEx function
+	globalMemoryStatusEx := syscall.MustLoadDLL("kernel32.dll").MustFindProc("GlobalMemoryStatusEx")
+
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	// GlobalMemoryStatusEx returns 0 when it fails, the error of Call is only meaningful then
+	if ret, _, callErr := globalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ret == 0 {
+		return 0, callErr
+	}
+	return int64(status.availPhys), nil
+}
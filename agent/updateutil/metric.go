@@ -0,0 +1,182 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+// UpdatePhase represents a phase of the update process
+type UpdatePhase string
+
+const (
+	// PhaseDownload represents the download phase of the update
+	PhaseDownload UpdatePhase = "Download"
+
+	// PhaseInstall represents the install phase of the update
+	PhaseInstall UpdatePhase = "Install"
+
+	// PhaseVerify represents the verify phase of the update
+	PhaseVerify UpdatePhase = "Verify"
+)
+
+const (
+	// OutcomeSucceeded represents a phase that completed without error
+	OutcomeSucceeded = "Succeeded"
+
+	// OutcomeFailed represents a phase that completed with error
+	OutcomeFailed = "Failed"
+)
+
+// UpdateMetricFileName represents Update metric file name
+const UpdateMetricFileName = "updatemetrics.json"
+
+// UpdateMetric represents the telemetry of a single update phase
+type UpdateMetric struct {
+	Phase      UpdatePhase `json:"Phase"`
+	StartTime  time.Time   `json:"StartTime"`
+	EndTime    time.Time   `json:"EndTime"`
+	DurationMs int64       `json:"DurationMs"`
+	Outcome    string      `json:"Outcome"`
+	ErrorCode  ErrorCode   `json:"ErrorCode,omitempty"`
+	Message    string      `json:"Message,omitempty"`
+}
+
+// PhaseDuration represents the time spent in a phase of the update
+type PhaseDuration struct {
+	Phase      UpdatePhase `json:"Phase"`
+	DurationMs int64       `json:"DurationMs"`
+}
+
+// DurationSummary represents the total time of the update and the time spent in each of its phases
+type DurationSummary struct {
+	TotalMs int64           `json:"TotalMs"`
+	Phases  []PhaseDuration `json:"Phases"`
+}
+
+// MetricRecorder records the UpdateMetric of each update phase
+type MetricRecorder struct {
+	Metrics []*UpdateMetric
+	clock   times.Clock
+	started map[UpdatePhase]time.Time
+}
+
+// NewMetricRecorder creates a MetricRecorder using the given clock, times.DefaultClock is used when clock is nil
+func NewMetricRecorder(clock times.Clock) *MetricRecorder {
+	if clock == nil {
+		clock = times.DefaultClock
+	}
+	return &MetricRecorder{
+		Metrics: []*UpdateMetric{},
+		clock:   clock,
+		started: make(map[UpdatePhase]time.Time),
+	}
+}
+
+// StartPhase records the start time of the phase
+func (r *MetricRecorder) StartPhase(phase UpdatePhase) {
+	r.started[phase] = r.clock.Now()
+}
+
+// StopPhase records the end of the phase with the outcome derived from err
+func (r *MetricRecorder) StopPhase(phase UpdatePhase, err error) (metric *UpdateMetric, stopErr error) {
+	startTime, ok := r.started[phase]
+	if !ok {
+		return nil, fmt.Errorf("phase %v was not started", phase)
+	}
+	delete(r.started, phase)
+
+	endTime := r.clock.Now()
+	metric = &UpdateMetric{
+		Phase:      phase,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		DurationMs: int64(endTime.Sub(startTime) / time.Millisecond),
+		Outcome:    OutcomeSucceeded,
+	}
+	if err != nil {
+		metric.Outcome = OutcomeFailed
+		metric.ErrorCode = GetErrorCode(err)
+		metric.Message = err.Error()
+	}
+	r.Metrics = append(r.Metrics, metric)
+	return metric, nil
+}
+
+// Summary returns the time from the start of the first recorded phase to the end of the last one and the time spent
+// in each phase in the order the phases were first recorded, the time of a phase recorded several times is added up
+func (r *MetricRecorder) Summary() *DurationSummary {
+	summary := &DurationSummary{Phases: []PhaseDuration{}}
+	if len(r.Metrics) == 0 {
+		return summary
+	}
+
+	startTime, endTime := r.Metrics[0].StartTime, r.Metrics[0].EndTime
+	for _, metric := range r.Metrics {
+		if metric.StartTime.Before(startTime) {
+			startTime = metric.StartTime
+		}
+		if metric.EndTime.After(endTime) {
+			endTime = metric.EndTime
+		}
+		summary.Phases = addPhaseDuration(summary.Phases, metric.Phase, metric.DurationMs)
+	}
+	summary.TotalMs = int64(endTime.Sub(startTime) / time.Millisecond)
+	return summary
+}
+
+// addPhaseDuration adds the duration to the phase, the phase is appended when it is not in the list yet
+func addPhaseDuration(phases []PhaseDuration, phase UpdatePhase, durationMs int64) []PhaseDuration {
+	for i := range phases {
+		if phases[i].Phase == phase {
+			phases[i].DurationMs += durationMs
+			return phases
+		}
+	}
+	return append(phases, PhaseDuration{Phase: phase, DurationMs: durationMs})
+}
+
+// MarshalMetrics returns the recorded metrics in json format
+func (r *MetricRecorder) MarshalMetrics() ([]byte, error) {
+	return json.Marshal(r.Metrics)
+}
+
+// UpdateMetricFilePath returns update metric file path
+func UpdateMetricFilePath(updateRoot string) (filePath string) {
+	return filepath.Join(updateRoot, UpdateMetricFileName)
+}
+
+// SaveUpdateMetrics saves the recorded metrics next to the UpdatePluginResult in the local storage, the file is
+// replaced atomically so a failed write never leaves corrupt metrics behind
+func SaveUpdateMetrics(log log.T, updateRoot string, recorder *MetricRecorder) (err error) {
+	var jsonData = []byte{}
+	if jsonData, err = recorder.MarshalMetrics(); err != nil {
+		return err
+	}
+
+	if err = writeFileAtomically(UpdateMetricFilePath(updateRoot), jsonData, appconfig.ReadWriteAccess); err != nil {
+		log.Errorf("failed to save update metrics, %v", err)
+		return err
+	}
+
+	return nil
+}
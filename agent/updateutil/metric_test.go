@@ -0,0 +1,158 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/times"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricRecorderPhaseSequence(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := times.NewMockedClock()
+	clock.On("Now").Return(start).Once()
+	clock.On("Now").Return(start.Add(2 * time.Second)).Once()
+	clock.On("Now").Return(start.Add(3 * time.Second)).Once()
+	clock.On("Now").Return(start.Add(3*time.Second + 500*time.Millisecond)).Once()
+
+	recorder := NewMetricRecorder(clock)
+
+	recorder.StartPhase(PhaseDownload)
+	_, err := recorder.StopPhase(PhaseDownload, nil)
+	assert.NoError(t, err)
+
+	recorder.StartPhase(PhaseInstall)
+	_, err = recorder.StopPhase(PhaseInstall, NewUpdateError(ErrorInstallFailed, fmt.Errorf("exit status 1"), "failed to install"))
+	assert.NoError(t, err)
+
+	data, err := recorder.MarshalMetrics()
+	assert.NoError(t, err)
+
+	var metrics []UpdateMetric
+	assert.NoError(t, json.Unmarshal(data, &metrics))
+	assert.Equal(t, 2, len(metrics))
+
+	assert.Equal(t, PhaseDownload, metrics[0].Phase)
+	assert.Equal(t, int64(2000), metrics[0].DurationMs)
+	assert.Equal(t, OutcomeSucceeded, metrics[0].Outcome)
+	assert.Equal(t, ErrorCode(""), metrics[0].ErrorCode)
+
+	assert.Equal(t, PhaseInstall, metrics[1].Phase)
+	assert.Equal(t, int64(500), metrics[1].DurationMs)
+	assert.Equal(t, OutcomeFailed, metrics[1].Outcome)
+	assert.Equal(t, ErrorInstallFailed, metrics[1].ErrorCode)
+	assert.Contains(t, metrics[1].Message, "exit status 1")
+	clock.AssertExpectations(t)
+}
+
+func TestMetricRecorderStopPhaseNotStarted(t *testing.T) {
+	recorder := NewMetricRecorder(nil)
+	_, err := recorder.StopPhase(PhaseVerify, nil)
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(recorder.Metrics))
+}
+
+func TestMetricRecorderUnexpectedErrorCode(t *testing.T) {
+	recorder := NewMetricRecorder(nil)
+	recorder.StartPhase(PhaseVerify)
+	metric, err := recorder.StopPhase(PhaseVerify, fmt.Errorf("generic error"))
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorUnexpected, metric.ErrorCode)
+}
+
+func TestMetricRecorderSummary(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := times.NewMockedClock()
+	for _, offset := range []time.Duration{
+		100 * time.Millisecond,  // download started
+		2100 * time.Millisecond, // download stopped
+		2100 * time.Millisecond, // verify started
+		2600 * time.Millisecond, // verify stopped
+		2600 * time.Millisecond, // download started again
+		3600 * time.Millisecond, // download stopped
+	} {
+		clock.On("Now").Return(start.Add(offset)).Once()
+	}
+
+	recorder := NewMetricRecorder(clock)
+	recorder.StartPhase(PhaseDownload)
+	recorder.StopPhase(PhaseDownload, nil)
+	recorder.StartPhase(PhaseVerify)
+	recorder.StopPhase(PhaseVerify, fmt.Errorf("invalid manifest"))
+	recorder.StartPhase(PhaseDownload)
+	recorder.StopPhase(PhaseDownload, nil)
+	summary := recorder.Summary()
+
+	assert.Equal(t, int64(3500), summary.TotalMs)
+	assert.Equal(t, []PhaseDuration{
+		{Phase: PhaseDownload, DurationMs: 3000},
+		{Phase: PhaseVerify, DurationMs: 500},
+	}, summary.Phases)
+	clock.AssertExpectations(t)
+}
+
+func TestMetricRecorderSummaryWithoutPhases(t *testing.T) {
+	summary := NewMetricRecorder(nil).Summary()
+
+	assert.Equal(t, int64(0), summary.TotalMs)
+	assert.Empty(t, summary.Phases)
+}
+
+func TestDurationSummaryInUpdatePluginResult(t *testing.T) {
+	result := &UpdatePluginResult{
+		StandOut: "output",
+		Durations: &DurationSummary{
+			TotalMs: 3500,
+			Phases:  []PhaseDuration{{Phase: PhaseDownload, DurationMs: 3000}, {Phase: PhaseVerify, DurationMs: 500}},
+		},
+	}
+	data, err := json.Marshal(result)
+	assert.NoError(t, err)
+
+	var loaded UpdatePluginResult
+	assert.NoError(t, json.Unmarshal(data, &loaded))
+	assert.Equal(t, result.Durations, loaded.Durations)
+}
+
+func TestSaveUpdateMetrics(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatemetrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	recorder := NewMetricRecorder(nil)
+	recorder.StartPhase(PhaseDownload)
+	recorder.StopPhase(PhaseDownload, nil)
+
+	assert.NoError(t, SaveUpdateMetrics(logger, updateRoot, recorder))
+
+	data, err := ioutil.ReadFile(UpdateMetricFilePath(updateRoot))
+	assert.NoError(t, err)
+	var metrics []UpdateMetric
+	assert.NoError(t, json.Unmarshal(data, &metrics))
+	assert.Equal(t, 1, len(metrics))
+	assert.Equal(t, PhaseDownload, metrics[0].Phase)
+
+	// the metrics are renamed into place, no temp files are left behind
+	files, err := ioutil.ReadDir(updateRoot)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -16,7 +16,11 @@ package updateutil
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/aws/amazon-ssm-agent/agent/appconfig"
@@ -25,41 +29,132 @@ import (
 
 //UpdatePluginResult represents Agent update plugin result
 type UpdatePluginResult struct {
-	StandOut      string    `json:"StandOut"`
-	StartDateTime time.Time `json:"StartDateTime"`
+	StandOut      string           `json:"StandOut"`
+	StartDateTime time.Time        `json:"StartDateTime"`
+	OperationID   string           `json:"OperationID,omitempty"`
+	Durations     *DurationSummary `json:"Durations,omitempty"`
 }
 
-//LoadUpdatePluginResult loads UpdatePluginResult from local storage
+//LoadUpdatePluginResult loads UpdatePluginResult from local storage, an error is returned when the file is corrupt
 func LoadUpdatePluginResult(
 	log log.T, updateRoot string) (updateResult *UpdatePluginResult, err error) {
 
 	//Load specified file from file system
-	result, err := ioutil.ReadFile(UpdatePluginResultFilePath(updateRoot))
+	filePath := UpdatePluginResultFilePath(updateRoot)
+	result, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return
 	}
 	// parse context file
-	err = json.Unmarshal([]byte(result), &updateResult)
-	if err != nil {
-		return
+	if err = json.Unmarshal([]byte(result), &updateResult); err != nil {
+		return nil, fmt.Errorf("update plugin result %v is corrupt, %v", filePath, err)
+	}
+	if updateResult == nil {
+		return nil, fmt.Errorf("update plugin result %v is empty", filePath)
 	}
 
 	return updateResult, nil
 }
 
-//SaveUpdatePluginResult saves UpdatePluginResult to the local storage
+// saveResultAttemptCount represents the number of attempts to save the UpdatePluginResult
+const saveResultAttemptCount = 3
+
+// saveResultRetryInterval represents the wait before the first retry, the wait doubles after each retry
+var saveResultRetryInterval = 200 * time.Millisecond
+
+var writeUpdatePluginResult = writeFileAtomically
+
+//SaveUpdatePluginResult saves UpdatePluginResult to the local storage, the write is retried on transient disk
+//errors and an UpdateError with ErrorEnvironmentIssue is returned on a permanent error or when all the attempts fail
 func (util *Utility) SaveUpdatePluginResult(
 	log log.T, updateRoot string, updateResult *UpdatePluginResult) (err error) {
+	log = util.operationLog(log)
+	if updateResult.OperationID == "" {
+		updateResult.OperationID = util.OperationID
+	}
 	var jsonData = []byte{}
 	jsonData, err = json.Marshal(updateResult)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(UpdatePluginResultFilePath(updateRoot), jsonData, appconfig.ReadWriteAccess)
+	filePath := UpdatePluginResultFilePath(updateRoot)
+	retryInterval := saveResultRetryInterval
+	for attempt := 1; attempt <= saveResultAttemptCount; attempt++ {
+		if err = writeUpdatePluginResult(filePath, jsonData, appconfig.ReadWriteAccess); err == nil {
+			return nil
+		}
+		if !isTransientWriteError(err) {
+			break
+		}
+		log.Warnf("Attempt %v out of %v to save update plugin result failed, %v", attempt, saveResultAttemptCount, err)
+		if attempt < saveResultAttemptCount {
+			time.Sleep(retryInterval)
+			retryInterval *= 2
+		}
+	}
+
+	log.Errorf("Failed to save update plugin result to %v, the update status cannot be reported, %v", filePath, err)
+	return NewUpdateError(ErrorEnvironmentIssue, err, "failed to save update plugin result to %v", filePath)
+}
+
+// isTransientWriteError returns if a retry of the write can succeed, the disk being full or busy and the file being
+// replaced by another process are transient while e.g. a missing folder, a denied access or a read-only file system
+// are permanent
+func isTransientWriteError(err error) bool {
+	isRename := false
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err, isRename = e.Err, true
+	case *os.SyscallError:
+		err = e.Err
+	}
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	if isRename {
+		for _, conflict := range renameConflictErrors {
+			if errno == conflict {
+				return true
+			}
+		}
+	}
+	switch errno {
+	case syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ENOSPC:
+		return true
+	}
+	return false
+}
+
+// writeFileAtomically writes the data to a temp file which is renamed over the file,
+// so a partial write never leaves a corrupt file behind
+func writeFileAtomically(filePath string, data []byte, perm os.FileMode) (err error) {
+	var tempFile *os.File
+	if tempFile, err = ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp"); err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tempPath)
+		}
+	}()
+
+	if _, err = tempFile.Write(data); err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return err
 	}
+	if err = os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
 
-	return nil
+	return os.Rename(tempPath, filePath)
 }
@@ -0,0 +1,167 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoadUpdatePluginResult(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatepluginresult")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	util := Utility{}
+	startTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	result := &UpdatePluginResult{StandOut: "Updating amazon-ssm-agent", StartDateTime: startTime}
+
+	assert.NoError(t, util.SaveUpdatePluginResult(logger, updateRoot, result))
+	// overwriting the result replaces the previous one
+	result.StandOut = "Updated amazon-ssm-agent"
+	assert.NoError(t, util.SaveUpdatePluginResult(logger, updateRoot, result))
+
+	loaded, err := LoadUpdatePluginResult(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated amazon-ssm-agent", loaded.StandOut)
+	assert.True(t, startTime.Equal(loaded.StartDateTime))
+
+	// no temp file is left behind
+	files, err := ioutil.ReadDir(updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, UpdatePluginResultFileName, files[0].Name())
+}
+
+func TestLoadUpdatePluginResultCorrupt(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatepluginresult")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	for _, content := range []string{`{"StandOut": "Updating amazon-ssm`, `null`} {
+		assert.NoError(t, ioutil.WriteFile(UpdatePluginResultFilePath(updateRoot), []byte(content), 0600))
+
+		result, err := LoadUpdatePluginResult(logger, updateRoot)
+		assert.Error(t, err)
+		assert.Nil(t, result)
+		assert.Contains(t, err.Error(), UpdatePluginResultFilePath(updateRoot))
+	}
+}
+
+func TestSaveUpdatePluginResultRetriesTransientErrors(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatepluginresult")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	defer func() {
+		writeUpdatePluginResult = writeFileAtomically
+		saveResultRetryInterval = 200 * time.Millisecond
+	}()
+	saveResultRetryInterval = time.Millisecond
+
+	attempts := 0
+	writeUpdatePluginResult = func(filePath string, data []byte, perm os.FileMode) error {
+		attempts++
+		if attempts < saveResultAttemptCount {
+			return syscall.ENOSPC
+		}
+		return writeFileAtomically(filePath, data, perm)
+	}
+
+	util := Utility{}
+	assert.NoError(t, util.SaveUpdatePluginResult(logger, updateRoot, &UpdatePluginResult{StandOut: "Updating"}))
+	assert.Equal(t, saveResultAttemptCount, attempts)
+
+	loaded, err := LoadUpdatePluginResult(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updating", loaded.StandOut)
+}
+
+func TestSaveUpdatePluginResultFailsAfterRetries(t *testing.T) {
+	defer func() {
+		writeUpdatePluginResult = writeFileAtomically
+		saveResultRetryInterval = 200 * time.Millisecond
+	}()
+	saveResultRetryInterval = time.Millisecond
+
+	attempts := 0
+	writeUpdatePluginResult = func(filePath string, data []byte, perm os.FileMode) error {
+		attempts++
+		return syscall.EAGAIN
+	}
+
+	util := Utility{}
+	err := util.SaveUpdatePluginResult(logger, "updateRoot", &UpdatePluginResult{StandOut: "Updating"})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Equal(t, saveResultAttemptCount, attempts)
+}
+
+func TestSaveUpdatePluginResultRetriesRenameConflict(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatepluginresult")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	defer func() {
+		writeUpdatePluginResult = writeFileAtomically
+		saveResultRetryInterval = 200 * time.Millisecond
+	}()
+	saveResultRetryInterval = time.Millisecond
+
+	attempts := 0
+	writeUpdatePluginResult = func(filePath string, data []byte, perm os.FileMode) error {
+		attempts++
+		if attempts == 1 {
+			return &os.LinkError{Op: "rename", Old: filePath + ".tmp", New: filePath, Err: renameConflictErrors[0]}
+		}
+		return writeFileAtomically(filePath, data, perm)
+	}
+
+	util := Utility{}
+	assert.NoError(t, util.SaveUpdatePluginResult(logger, updateRoot, &UpdatePluginResult{StandOut: "Updating"}))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestSaveUpdatePluginResultDoesNotRetryPermanentErrors(t *testing.T) {
+	defer func() {
+		writeUpdatePluginResult = writeFileAtomically
+		saveResultRetryInterval = 200 * time.Millisecond
+	}()
+	saveResultRetryInterval = time.Millisecond
+
+	for _, permanentErr := range []error{
+		&os.PathError{Op: "open", Path: "updateRoot", Err: syscall.ENOENT},
+		&os.PathError{Op: "open", Path: "updateRoot", Err: syscall.EACCES},
+		&os.PathError{Op: "open", Path: "updateRoot", Err: syscall.EROFS},
+		fmt.Errorf("unexpected error"),
+	} {
+		attempts := 0
+		writeUpdatePluginResult = func(filePath string, data []byte, perm os.FileMode) error {
+			attempts++
+			return permanentErr
+		}
+
+		util := Utility{}
+		err := util.SaveUpdatePluginResult(logger, "updateRoot", &UpdatePluginResult{StandOut: "Updating"})
+
+		assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+		assert.Equal(t, 1, attempts, "%v", permanentErr)
+	}
+}
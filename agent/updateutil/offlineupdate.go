@@ -0,0 +1,82 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+)
+
+// OfflineUpdateTriggerFileName represents the file name of the update staged from a local package
+const OfflineUpdateTriggerFileName = "offlineupdate.json"
+
+// OfflineUpdateTrigger represents an agent package staged for the updater from a local file, the updater installs
+// it when it is not passed a target location
+type OfflineUpdateTrigger struct {
+	PackageName    string    `json:"PackageName"`
+	TargetVersion  string    `json:"TargetVersion"`
+	TargetLocation string    `json:"TargetLocation"`
+	TargetHash     string    `json:"TargetHash"`
+	StagedDateTime time.Time `json:"StagedDateTime"`
+}
+
+// OfflineUpdateTriggerFilePath returns offline update trigger file path
+func OfflineUpdateTriggerFilePath(updateRoot string) (filePath string) {
+	return filepath.Join(updateRoot, OfflineUpdateTriggerFileName)
+}
+
+// SaveOfflineUpdateTrigger saves the OfflineUpdateTrigger to the update root, the file is replaced atomically so
+// the updater never reads a partial trigger
+func SaveOfflineUpdateTrigger(updateRoot string, trigger *OfflineUpdateTrigger) (err error) {
+	var jsonData []byte
+	if jsonData, err = json.Marshal(trigger); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(updateRoot, appconfig.ReadWriteExecuteAccess); err != nil {
+		return err
+	}
+	return writeFileAtomically(OfflineUpdateTriggerFilePath(updateRoot), jsonData, appconfig.ReadWriteAccess)
+}
+
+// LoadOfflineUpdateTrigger loads the OfflineUpdateTrigger from the update root, the error of ioutil.ReadFile is returned
+// as is when no update is staged
+func LoadOfflineUpdateTrigger(updateRoot string) (trigger *OfflineUpdateTrigger, err error) {
+	filePath := OfflineUpdateTriggerFilePath(updateRoot)
+	var content []byte
+	if content, err = ioutil.ReadFile(filePath); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &trigger); err != nil {
+		return nil, fmt.Errorf("offline update trigger %v is corrupt, %v", filePath, err)
+	}
+	if trigger == nil || trigger.TargetVersion == "" || trigger.TargetLocation == "" {
+		return nil, fmt.Errorf("offline update trigger %v has no target", filePath)
+	}
+	return trigger, nil
+}
+
+// RemoveOfflineUpdateTrigger removes the OfflineUpdateTrigger so the staged package is installed once
+func RemoveOfflineUpdateTrigger(updateRoot string) error {
+	if err := os.Remove(OfflineUpdateTriggerFilePath(updateRoot)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfflineUpdateTrigger(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "offlineupdate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	// no update is staged
+	_, err = LoadOfflineUpdateTrigger(updateRoot)
+	assert.True(t, os.IsNotExist(err))
+
+	trigger := &OfflineUpdateTrigger{
+		PackageName:    "amazon-ssm-agent",
+		TargetVersion:  "3.0.100.0",
+		TargetLocation: filepath.Join(updateRoot, "amazon-ssm-agent", "3.0.100.0", "amazon-ssm-agent-linux-amd64.tar.gz"),
+		TargetHash:     "3c95870b46ad5e35c35b008a98d169cea73d85c1f6f4b6602e9173905b67db93",
+		StagedDateTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	assert.NoError(t, SaveOfflineUpdateTrigger(updateRoot, trigger))
+
+	loaded, err := LoadOfflineUpdateTrigger(updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, trigger, loaded)
+
+	assert.NoError(t, RemoveOfflineUpdateTrigger(updateRoot))
+	_, err = LoadOfflineUpdateTrigger(updateRoot)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, RemoveOfflineUpdateTrigger(updateRoot))
+}
+
+func TestLoadOfflineUpdateTriggerInvalid(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "offlineupdate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	for _, content := range []string{`{"TargetVersion": `, `null`, `{"TargetVersion": "3.0.100.0"}`} {
+		assert.NoError(t, ioutil.WriteFile(OfflineUpdateTriggerFilePath(updateRoot), []byte(content), 0600))
+		_, err = LoadOfflineUpdateTrigger(updateRoot)
+		assert.Error(t, err, content)
+		assert.False(t, os.IsNotExist(err), content)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/twinj/uuid"
+)
+
+// NewOperationID generates the ID which identifies a single update operation in the log messages
+func NewOperationID() string {
+	return uuid.NewV4().String()
+}
+
+// OperationLogContext returns the context the log messages of the update operation are tagged with
+func OperationLogContext(operationID string) string {
+	return "[UpdateOperation " + operationID + "]"
+}
+
+// operationLog returns a logger which tags the messages with the OperationID of the utility,
+// the logger is returned as is when the utility has no OperationID
+func (util *Utility) operationLog(log log.T) log.T {
+	if util.OperationID == "" {
+		return log
+	}
+	return log.WithContext(OperationLogContext(util.OperationID))
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCapturingLog returns a logger which tags the messages like the agent logger and records them in the mock
+func newCapturingLog() (log.T, *log.Mock) {
+	captured := log.NewMockLog()
+	return &log.Wrapper{
+		Format:   &log.ContextFormatFilter{Context: []string{}},
+		M:        &sync.Mutex{},
+		Delegate: &log.DelegateLogger{BaseLoggerInstance: captured},
+	}, captured
+}
+
+func TestNewOperationID(t *testing.T) {
+	first := NewOperationID()
+	second := NewOperationID()
+
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, second)
+}
+
+func TestExeCommandTagsLogWithOperationID(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{OperationID: "op-1234"}
+	logger, captured := newCapturingLog()
+	assert.NoError(t, util.ExeCommand(logger, "echo", outputRoot, outputRoot, "stdout", "stderr", false))
+
+	commandLine := strings.Join(setPlatformSpecificCommand([]string{"echo"}), " ")
+	captured.AssertCalled(t, "Debugf", "[UpdateOperation op-1234] Running command %v", []interface{}{commandLine})
+}
+
+func TestExeCommandWithoutOperationID(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{}
+	logger, captured := newCapturingLog()
+	assert.NoError(t, util.ExeCommand(logger, "echo", outputRoot, outputRoot, "stdout", "stderr", false))
+
+	commandLine := strings.Join(setPlatformSpecificCommand([]string{"echo"}), " ")
+	captured.AssertCalled(t, "Debugf", "Running command %v", []interface{}{commandLine})
+}
+
+func TestSaveUpdatePluginResultRecordsOperationID(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updatepluginresult")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	util := Utility{OperationID: "op-1234"}
+	operationLog, _ := newCapturingLog()
+	assert.NoError(t, util.SaveUpdatePluginResult(operationLog, updateRoot, &UpdatePluginResult{StandOut: "Updating"}))
+
+	loaded, err := LoadUpdatePluginResult(logger, updateRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "op-1234", loaded.OperationID)
+}
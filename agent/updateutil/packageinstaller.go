@@ -0,0 +1,95 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// PackageManagerDpkg represents the debian package manager
+	PackageManagerDpkg = "dpkg"
+
+	// PackageManagerYum represents the yum package manager
+	PackageManagerYum = "yum"
+
+	// PackageManagerRpm represents the rpm package manager
+	PackageManagerRpm = "rpm"
+
+	// PackageManagerScript represents the install script shipped with the package
+	PackageManagerScript = "script"
+)
+
+// PackageInstallResult represents the result of installing a package
+type PackageInstallResult struct {
+	PackageManager string
+	Command        []string
+	ExitCode       int
+	Stdout         string
+	Stderr         string
+}
+
+// InstallPackage installs the package with the native package manager of the platform, dpkg for debian based
+// platforms and yum or rpm for rpm based platforms, other platforms run the install script next to the package
+func InstallPackage(log log.T, context *InstanceContext, packagePath string) (result *PackageInstallResult, err error) {
+	result = &PackageInstallResult{}
+	switch context.InstallerName {
+	case PlatformUbuntu:
+		// installing the debian package over a snap install corrupts the snap
+		if isSnapInstall(log) {
+			return result, NewUpdateError(ErrorInstallFailed, nil,
+				"agent is installed with snap, refusing to install %v with dpkg, use 'snap refresh amazon-ssm-agent' instead", packagePath)
+		}
+		result.PackageManager = PackageManagerDpkg
+		result.Command = []string{"dpkg", "-i", packagePath}
+	case PlatformLinux:
+		// suse does not ship yum, rpm is always available on rpm based platforms
+		if _, yumErr := execCommand("yum", "--version").Output(); context.Platform != PlatformSuseOS && yumErr == nil {
+			result.PackageManager = PackageManagerYum
+			result.Command = []string{"yum", "install", "-y", packagePath}
+		} else {
+			result.PackageManager = PackageManagerRpm
+			result.Command = []string{"rpm", "-U", "--replacepkgs", packagePath}
+		}
+	default:
+		result.PackageManager = PackageManagerScript
+		result.Command = setPlatformSpecificCommand([]string{filepath.Join(filepath.Dir(packagePath), Installer)})
+	}
+
+	log.Infof("Installing %v with %v", packagePath, strings.Join(result.Command, " "))
+	var stdout, stderr bytes.Buffer
+	command := execCommand(result.Command[0], result.Command[1:]...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err = command.Run()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	if err != nil {
+		result.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		return result, NewUpdateError(ErrorInstallFailed, err, "%v failed to install %v with exit code %v, %v",
+			result.PackageManager, packagePath, result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return result, nil
+}
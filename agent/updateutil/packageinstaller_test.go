@@ -0,0 +1,158 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingExecCommand records the commands and runs the fake command, the commands in missing fail to start
+type recordingExecCommand struct {
+	commands [][]string
+	missing  map[string]bool
+	failing  map[string]bool
+}
+
+func (r *recordingExecCommand) execCommand(command string, args ...string) *exec.Cmd {
+	r.commands = append(r.commands, append([]string{command}, args...))
+	if r.missing[command] {
+		return missingExecCommand(command, args...)
+	}
+	if r.failing[command] {
+		return fakeExecCommand("exitcode")
+	}
+	return fakeExecCommand(command, args...)
+}
+
+func TestInstallPackage(t *testing.T) {
+	defer func() {
+		execCommand = exec.Command
+		isSnapInstall = IsSnapInstall
+	}()
+	isSnapInstall = func(log log.T) bool { return false }
+
+	testCases := []struct {
+		context         InstanceContext
+		packagePath     string
+		missing         map[string]bool
+		packageManager  string
+		expectedCommand string
+	}{
+		{
+			InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntu, "amd64", "tar.gz"},
+			"/var/lib/amazon/ssm/update/amazon-ssm-agent.deb",
+			nil,
+			PackageManagerDpkg,
+			"dpkg -i /var/lib/amazon/ssm/update/amazon-ssm-agent.deb",
+		},
+		{
+			InstanceContext{"us-east-1", PlatformRedHat, "7.1", PlatformLinux, "amd64", "tar.gz"},
+			"/var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+			nil,
+			PackageManagerYum,
+			"yum install -y /var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+		},
+		{
+			InstanceContext{"us-east-1", PlatformRedHat, "7.1", PlatformLinux, "amd64", "tar.gz"},
+			"/var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+			map[string]bool{"yum": true},
+			PackageManagerRpm,
+			"rpm -U --replacepkgs /var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+		},
+		{
+			InstanceContext{"us-east-1", PlatformSuseOS, "12", PlatformLinux, "amd64", "tar.gz"},
+			"/var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+			nil,
+			PackageManagerRpm,
+			"rpm -U --replacepkgs /var/lib/amazon/ssm/update/amazon-ssm-agent.rpm",
+		},
+	}
+
+	for _, test := range testCases {
+		recorder := &recordingExecCommand{missing: test.missing}
+		execCommand = recorder.execCommand
+
+		result, err := InstallPackage(logger, &test.context, test.packagePath)
+
+		assert.NoError(t, err)
+		assert.Equal(t, test.packageManager, result.PackageManager)
+		assert.Equal(t, test.expectedCommand, strings.Join(result.Command, " "))
+		assert.Equal(t, test.expectedCommand, strings.Join(recorder.commands[len(recorder.commands)-1], " "))
+		assert.Equal(t, 0, result.ExitCode)
+	}
+}
+
+func TestInstallPackageFailed(t *testing.T) {
+	defer func() {
+		execCommand = exec.Command
+		isSnapInstall = IsSnapInstall
+	}()
+	isSnapInstall = func(log log.T) bool { return false }
+	recorder := &recordingExecCommand{failing: map[string]bool{"dpkg": true}}
+	execCommand = recorder.execCommand
+
+	context := InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntu, "amd64", "tar.gz"}
+	result, err := InstallPackage(logger, &context, "/var/lib/amazon/ssm/update/amazon-ssm-agent.deb")
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Equal(t, PackageManagerDpkg, result.PackageManager)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Contains(t, result.Stderr, "dependency problems")
+	assert.Contains(t, err.Error(), "dependency problems")
+}
+
+func TestInstallPackageRefusesSnapInstall(t *testing.T) {
+	defer func() {
+		execCommand = exec.Command
+		isSnapInstall = IsSnapInstall
+	}()
+	isSnapInstall = func(log log.T) bool { return true }
+	recorder := &recordingExecCommand{}
+	execCommand = recorder.execCommand
+
+	context := InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntu, "amd64", "tar.gz"}
+	_, err := InstallPackage(logger, &context, "/var/lib/amazon/ssm/update/amazon-ssm-agent.deb")
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "snap refresh")
+	assert.Empty(t, recorder.commands)
+}
+
+func TestInstallPackageFallsBackToScript(t *testing.T) {
+	originalInstaller := Installer
+	defer func() {
+		execCommand = exec.Command
+		Installer = originalInstaller
+	}()
+	recorder := &recordingExecCommand{}
+	execCommand = recorder.execCommand
+	Installer = InstallScript
+
+	context := InstanceContext{"us-east-1", PlatformWindows, "10", PlatformWindows, "amd64", "zip"}
+	packagePath := filepath.Join("update", "amazon-ssm-agent", "amazon-ssm-agent.zip")
+	result, err := InstallPackage(logger, &context, packagePath)
+
+	assert.NoError(t, err)
+	assert.Equal(t, PackageManagerScript, result.PackageManager)
+	assert.Equal(t, setPlatformSpecificCommand([]string{filepath.Join("update", "amazon-ssm-agent", InstallScript)}), result.Command)
+}
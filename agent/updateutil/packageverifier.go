@@ -0,0 +1,158 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// packageFileNamePattern matches the platform and arch of the package file names built by FileName
+var packageFileNamePattern = regexp.MustCompile(fmt.Sprintf(`-(%v|%v|%v|%v|%v|%v)-(amd64|386|armhf|arm|arm64)\.(%v|%v|%v)$`,
+	PlatformLinux, PlatformUbuntu, PlatformUbuntuSnap, PlatformWindows, PlatformWindowsNano, PlatformFreeBSD,
+	regexp.QuoteMeta(CompressFormatTarGz), regexp.QuoteMeta(CompressFormatTarXz), CompressFormatZip))
+
+// VerifyPackageForContext verifies the file is built for the platform and arch of the instance context. The arch of
+// an executable extracted from a package is read from its ELF, PE or Mach-O header, a package file is verified by
+// the FileName convention. An UpdateError with ErrorInvalidPackage is returned if the file is built for a different
+// platform or arch, or when it can be verified neither way.
+func VerifyPackageForContext(log log.T, filePath string, context *InstanceContext) error {
+	if context.Arch == ArchAny {
+		log.Debugf("%v is a universal package, skipping arch verification", filePath)
+		return nil
+	}
+
+	archs, err := executableArchs(filePath)
+	if err != nil {
+		return NewUpdateError(ErrorInvalidPackage, err, "failed to read %v", filePath)
+	}
+	if archs == nil {
+		return verifyPackageFileName(filePath, context)
+	}
+	for _, arch := range archs {
+		if arch == context.Arch {
+			return nil
+		}
+	}
+	return NewUpdateError(ErrorInvalidPackage, nil,
+		"%v is built for %v, expected %v", filePath, strings.Join(archs, " or "), context.Arch)
+}
+
+// verifyPackageFileName verifies the package file name follows the FileName convention of the instance context
+func verifyPackageFileName(filePath string, context *InstanceContext) error {
+	fileName := filepath.Base(filePath)
+	expectedSuffix := fmt.Sprintf("-%v-%v.%v", context.InstallerName, context.Arch, context.CompressFormat)
+	if strings.HasSuffix(fileName, expectedSuffix) {
+		return nil
+	}
+
+	match := packageFileNamePattern.FindStringSubmatch(fileName)
+	if match == nil {
+		return NewUpdateError(ErrorInvalidPackage, nil,
+			"cannot verify the platform and arch of %v, it is not an executable and its name does not end with %v",
+			fileName, expectedSuffix)
+	}
+	return NewUpdateError(ErrorInvalidPackage, nil,
+		"package %v is built for %v %v, expected %v %v",
+		fileName, match[1], match[2], context.InstallerName, context.Arch)
+}
+
+// executableArchs returns the artifact archs the executable can be installed on, a 32-bit arm executable is
+// installed on both ArchArm and ArchArmHF. Nil is returned when the file is not an ELF, PE or Mach-O executable.
+func executableArchs(filePath string) (archs []string, err error) {
+	if _, err = os.Stat(filePath); err != nil {
+		return nil, err
+	}
+
+	if file, elfErr := elf.Open(filePath); elfErr == nil {
+		defer file.Close()
+		switch file.Machine {
+		case elf.EM_X86_64:
+			return []string{"amd64"}, nil
+		case elf.EM_386:
+			return []string{"386"}, nil
+		case elf.EM_AARCH64:
+			return []string{"arm64"}, nil
+		case elf.EM_ARM:
+			return []string{ArchArm, ArchArmHF}, nil
+		}
+		return []string{file.Machine.String()}, nil
+	}
+
+	if file, peErr := pe.Open(filePath); peErr == nil {
+		defer file.Close()
+		switch file.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return []string{"amd64"}, nil
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return []string{"386"}, nil
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			return []string{"arm64"}, nil
+		case pe.IMAGE_FILE_MACHINE_ARMNT:
+			return []string{ArchArm, ArchArmHF}, nil
+		}
+		return []string{fmt.Sprintf("pe machine %#x", file.Machine)}, nil
+	}
+
+	if file, machoErr := macho.Open(filePath); machoErr == nil {
+		defer file.Close()
+		switch file.Cpu {
+		case macho.CpuAmd64:
+			return []string{"amd64"}, nil
+		case macho.Cpu386:
+			return []string{"386"}, nil
+		case macho.CpuArm64:
+			return []string{"arm64"}, nil
+		case macho.CpuArm:
+			return []string{ArchArm, ArchArmHF}, nil
+		}
+		return []string{file.Cpu.String()}, nil
+	}
+	return nil, nil
+}
+
+// VerifyExtractedArtifacts verifies the installer and uninstaller of the extracted package, or the updater of the
+// extracted updater package, exist and are executable. An UpdateError with ErrorInvalidPackage listing the missing
+// files is returned so an incomplete extraction fails before the files are run.
+func VerifyExtractedArtifacts(updateRoot string, packageName string, version string) error {
+	expectedFiles := []string{
+		InstallerFilePath(updateRoot, packageName, version),
+		UnInstallerFilePath(updateRoot, packageName, version),
+	}
+	if strings.HasSuffix(packageName, UpdaterPackageNamePrefix) {
+		expectedFiles = []string{UpdaterFilePath(updateRoot, packageName, version)}
+	}
+
+	var missingFiles []string
+	for _, expectedFile := range expectedFiles {
+		if info, err := os.Stat(expectedFile); err != nil || !info.Mode().IsRegular() || !isExecutable(info) {
+			missingFiles = append(missingFiles, expectedFile)
+		}
+	}
+	if len(missingFiles) > 0 {
+		return NewUpdateError(ErrorInvalidPackage, nil,
+			"extracted package %v %v is incomplete, missing or not executable: %v",
+			packageName, version, strings.Join(missingFiles, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeELFHeader writes an ELF header of a 32-bit little endian executable for the machine
+func writeELFHeader(t *testing.T, filePath string, machine elf.Machine) {
+	header := elf.Header32{
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  52,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	var buffer bytes.Buffer
+	assert.NoError(t, binary.Write(&buffer, binary.LittleEndian, header))
+	assert.NoError(t, ioutil.WriteFile(filePath, buffer.Bytes(), 0755))
+}
+
+func TestVerifyPackageForContext(t *testing.T) {
+	// the test binary is built for the arch of the instance
+	executable, err := os.Executable()
+	assert.NoError(t, err)
+	context := &InstanceContext{Region: "us-east-1", Platform: PlatformLinux, InstallerName: PlatformLinux, Arch: runtime.GOARCH}
+	assert.NoError(t, VerifyPackageForContext(logger, executable, context))
+
+	context.Arch = "arm64"
+	if runtime.GOARCH == "arm64" {
+		context.Arch = "amd64"
+	}
+	err = VerifyPackageForContext(logger, executable, context)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+
+	context.Arch = ArchAny
+	assert.NoError(t, VerifyPackageForContext(logger, executable, context))
+}
+
+func TestVerifyPackageForContextWith32BitArm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packageverifier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	updaterPath := filepath.Join(dir, "updater")
+	writeELFHeader(t, updaterPath, elf.EM_ARM)
+	context := &InstanceContext{Region: "us-east-1", Platform: PlatformLinux, InstallerName: PlatformLinux}
+
+	for _, arch := range []string{ArchArm, ArchArmHF} {
+		context.Arch = arch
+		assert.NoError(t, VerifyPackageForContext(logger, updaterPath, context), arch)
+	}
+
+	context.Arch = "arm64"
+	err = VerifyPackageForContext(logger, updaterPath, context)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+}
+
+func TestVerifyPackageForContextWithPackageFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packageverifier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	context := &InstanceContext{
+		Region:         "us-east-1",
+		Platform:       PlatformLinux,
+		InstallerName:  PlatformLinux,
+		Arch:           "arm64",
+		CompressFormat: CompressFormatTarGz,
+	}
+
+	matching := []string{
+		context.FileName("amazon-ssm-agent"),
+		context.FileName("amazon-ssm-agent-updater"),
+	}
+	for _, fileName := range matching {
+		filePath := filepath.Join(dir, fileName)
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte("package"), 0600))
+		assert.NoError(t, VerifyPackageForContext(logger, filePath, context), fileName)
+	}
+
+	mismatched := []string{
+		"amazon-ssm-agent-linux-amd64.tar.gz",
+		"amazon-ssm-agent-ubuntu-arm64.tar.gz",
+		"amazon-ssm-agent-windows-amd64.zip",
+		"amazon-ssm-agent-linux-arm64.tar.xz",
+		"amazon-ssm-agent-updater-linux-386.tar.gz",
+		// packages named otherwise cannot be verified
+		"0123456789abcdef0123456789abcdef01234567",
+		"updater",
+	}
+	for _, fileName := range mismatched {
+		filePath := filepath.Join(dir, fileName)
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte("#!/bin/sh"), 0755))
+		err := VerifyPackageForContext(logger, filePath, context)
+		assert.Error(t, err, fileName)
+		assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err), fileName)
+	}
+
+	err = VerifyPackageForContext(logger, filepath.Join(dir, "missing"), context)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+}
+
+// useTestInstallers sets the installer and uninstaller names and returns a func restoring them
+func useTestInstallers() (restore func()) {
+	installer, uninstaller := Installer, UnInstaller
+	Installer, UnInstaller = DebInstaller, DebUnInstaller
+	return func() { Installer, UnInstaller = installer, uninstaller }
+}
+
+// writeExecutable creates the file with its folder and the execute bits set
+func writeExecutable(t *testing.T, filePath string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+	assert.NoError(t, ioutil.WriteFile(filePath, []byte("#!/bin/sh"), 0755))
+}
+
+func TestVerifyExtractedArtifacts(t *testing.T) {
+	defer useTestInstallers()()
+	updateRoot, err := ioutil.TempDir("", "extracted")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	writeExecutable(t, InstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	writeExecutable(t, UnInstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	writeExecutable(t, UpdaterFilePath(updateRoot, "amazon-ssm-agent-updater", "3.0.0.0"))
+
+	assert.NoError(t, VerifyExtractedArtifacts(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	assert.NoError(t, VerifyExtractedArtifacts(updateRoot, "amazon-ssm-agent-updater", "3.0.0.0"))
+}
+
+func TestVerifyExtractedArtifactsWithIncompleteExtraction(t *testing.T) {
+	defer useTestInstallers()()
+	updateRoot, err := ioutil.TempDir("", "extracted")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	writeExecutable(t, InstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	// a folder named after the uninstaller is not the uninstaller
+	assert.NoError(t, os.MkdirAll(UnInstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"), 0755))
+
+	err = VerifyExtractedArtifacts(updateRoot, "amazon-ssm-agent", "3.0.0.0")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+	assert.Contains(t, err.Error(), UnInstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	assert.NotContains(t, err.Error(), InstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0")+",")
+
+	err = VerifyExtractedArtifacts(updateRoot, "amazon-ssm-agent-updater", "3.0.0.0")
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+	assert.Contains(t, err.Error(), UpdaterFilePath(updateRoot, "amazon-ssm-agent-updater", "3.0.0.0"))
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// PartitionAws represents the commercial partition
+	PartitionAws = "aws"
+
+	// PartitionAwsCn represents the China partition
+	PartitionAwsCn = "aws-cn"
+
+	// PartitionAwsUsGov represents the GovCloud partition
+	PartitionAwsUsGov = "aws-us-gov"
+
+	// PartitionAwsIso represents the iso partition
+	PartitionAwsIso = "aws-iso"
+
+	// PartitionAwsIsoB represents the iso-b partition
+	PartitionAwsIsoB = "aws-iso-b"
+
+	// DomainSuffixHolder represents Place holder for the endpoint domain suffix of the partition
+	DomainSuffixHolder = "{DomainSuffix}"
+
+	// defaultDomainSuffix represents the endpoint domain suffix of the commercial and GovCloud partitions
+	defaultDomainSuffix = "amazonaws.com"
+)
+
+// partitionRegionPrefixes maps the region prefixes to their partition, the longest prefixes come first
+var partitionRegionPrefixes = []struct {
+	prefix    string
+	partition string
+}{
+	{"us-isob-", PartitionAwsIsoB},
+	{"us-iso-", PartitionAwsIso},
+	{"us-gov-", PartitionAwsUsGov},
+	{"cn-", PartitionAwsCn},
+}
+
+// partitionDomainSuffixes maps the partitions to the domain suffix of their endpoints
+var partitionDomainSuffixes = map[string]string{
+	PartitionAws:      defaultDomainSuffix,
+	PartitionAwsUsGov: defaultDomainSuffix,
+	PartitionAwsCn:    "amazonaws.com.cn",
+	PartitionAwsIso:   "c2s.ic.gov",
+	PartitionAwsIsoB:  "sc2s.sgov.gov",
+}
+
+// RegionPartition returns the partition of the region, regions that are not part of another partition
+// belong to the commercial partition
+func RegionPartition(region string) string {
+	for _, p := range partitionRegionPrefixes {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return PartitionAws
+}
+
+// DomainSuffix returns the endpoint domain suffix of the partition of the region, e.g. amazonaws.com.cn for cn-north-1
+func DomainSuffix(region string) string {
+	return partitionDomainSuffixes[RegionPartition(region)]
+}
+
+// withPartitionDomainSuffix replaces the amazonaws.com domain of the url host with the domain suffix of the
+// partition of the region, urls of other hosts and of the commercial and GovCloud partitions are left untouched
+func withPartitionDomainSuffix(rawURL string, region string) string {
+	suffix := DomainSuffix(region)
+	if suffix == defaultDomainSuffix {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	host := parsed.Hostname()
+	if host != defaultDomainSuffix && !strings.HasSuffix(host, "."+defaultDomainSuffix) {
+		return rawURL
+	}
+	port := parsed.Port()
+	parsed.Host = strings.TrimSuffix(host, defaultDomainSuffix) + suffix
+	if port != "" {
+		parsed.Host += ":" + port
+	}
+	return parsed.String()
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionPartition(t *testing.T) {
+	testCases := []struct {
+		region       string
+		partition    string
+		domainSuffix string
+	}{
+		{"us-east-1", PartitionAws, "amazonaws.com"},
+		{"eu-west-3", PartitionAws, "amazonaws.com"},
+		{"us-gov-west-1", PartitionAwsUsGov, "amazonaws.com"},
+		{"cn-north-1", PartitionAwsCn, "amazonaws.com.cn"},
+		{"cn-northwest-1", PartitionAwsCn, "amazonaws.com.cn"},
+		{"us-iso-east-1", PartitionAwsIso, "c2s.ic.gov"},
+		{"us-isob-east-1", PartitionAwsIsoB, "sc2s.sgov.gov"},
+		{"", PartitionAws, "amazonaws.com"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.partition, RegionPartition(test.region), test.region)
+		assert.Equal(t, test.domainSuffix, DomainSuffix(test.region), test.region)
+	}
+}
+
+func TestWithPartitionDomainSuffix(t *testing.T) {
+	testCases := []struct {
+		url    string
+		region string
+		result string
+	}{
+		{"https://s3.cn-north-1.amazonaws.com/bucket/key", "cn-north-1", "https://s3.cn-north-1.amazonaws.com.cn/bucket/key"},
+		{"https://s3.amazonaws.com:443/bucket/key", "cn-north-1", "https://s3.amazonaws.com.cn:443/bucket/key"},
+		// hosts that already use the domain of the partition or another domain are left untouched
+		{"https://s3.cn-north-1.amazonaws.com.cn/bucket/key", "cn-north-1", "https://s3.cn-north-1.amazonaws.com.cn/bucket/key"},
+		{"https://example.com/amazonaws.com/key", "cn-north-1", "https://example.com/amazonaws.com/key"},
+		{"https://notamazonaws.com/key", "cn-north-1", "https://notamazonaws.com/key"},
+		{"https://s3.us-east-1.amazonaws.com/bucket/key", "us-east-1", "https://s3.us-east-1.amazonaws.com/bucket/key"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.result, withPartitionDomainSuffix(test.url, test.region), test.url)
+	}
+}
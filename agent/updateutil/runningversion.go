@@ -0,0 +1,73 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// deletedExecutableSuffix is appended by linux to the executable of a process whose binary was replaced on disk
+const deletedExecutableSuffix = " (deleted)"
+
+// errRunningAgentUnsupported is returned by runningAgentExecutable on the platforms the process cannot be found on
+var errRunningAgentUnsupported = errors.New("finding the running agent process is not supported")
+
+var (
+	findRunningAgentExecutable = runningAgentExecutable
+	reportAgentVersion         = (*Utility).reportedAgentVersion
+)
+
+// VerifyRunningVersion returns an UpdateError with ErrorInstallFailed when the running agent process is not the
+// expected version, e.g. the service was not restarted and still runs the previous binary. The check is skipped on
+// the platforms the running process cannot be found on.
+func (util *Utility) VerifyRunningVersion(log log.T, context *InstanceContext, expectedVersion string) (err error) {
+	executable, err := findRunningAgentExecutable(log, context)
+	if err == errRunningAgentUnsupported {
+		log.Infof("Skipping the running agent version check, %v", err)
+		return nil
+	}
+	if err != nil {
+		return NewUpdateError(ErrorInstallFailed, err, "failed to find the running agent process")
+	}
+	if strings.HasSuffix(executable, deletedExecutableSuffix) {
+		return NewUpdateError(
+			ErrorInstallFailed,
+			nil,
+			"running agent %v was replaced on disk, the process was not restarted",
+			strings.TrimSuffix(executable, deletedExecutableSuffix))
+	}
+
+	runningVersion, err := reportAgentVersion(util, log, executable, "running")
+	if err == errVersionFlagUnsupported {
+		log.Infof("Skipping the running agent version check, %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	compareResult, err := VersionCompare(runningVersion, expectedVersion)
+	if err != nil {
+		return NewUpdateError(ErrorInstallFailed, err, "failed to compare running agent version %v with %v", runningVersion, expectedVersion)
+	}
+	if compareResult != 0 {
+		return NewUpdateError(ErrorInstallFailed, nil, "running agent %v is version %v, expected %v", executable, runningVersion, expectedVersion)
+	}
+
+	log.Infof("Running agent %v is the expected version %v", executable, expectedVersion)
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// procRoot is the procfs mount the running agent process is looked up in
+var procRoot = "/proc"
+
+// runningAgentExecutable returns the executable of the running agent process from procfs, the processes whose
+// executable cannot be read are skipped
+func runningAgentExecutable(log log.T, context *InstanceContext) (executable string, err error) {
+	var entries []os.FileInfo
+	if entries, err = ioutil.ReadDir(procRoot); err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if _, convErr := strconv.Atoi(entry.Name()); convErr != nil || !entry.IsDir() {
+			continue
+		}
+		link, linkErr := os.Readlink(filepath.Join(procRoot, entry.Name(), "exe"))
+		if linkErr != nil {
+			continue
+		}
+		if filepath.Base(strings.TrimSuffix(link, deletedExecutableSuffix)) == AgentServiceName {
+			log.Debugf("Found the running agent process %v with executable %v", entry.Name(), link)
+			return link, nil
+		}
+	}
+	return "", fmt.Errorf("no %v process is running", AgentServiceName)
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRunningAgent replaces the running agent probes with ones reporting the given executable and version
+func stubRunningAgent(executable string, findErr error, runningVersion string) func() {
+	originalFind, originalReport := findRunningAgentExecutable, reportAgentVersion
+	findRunningAgentExecutable = func(log log.T, context *InstanceContext) (string, error) { return executable, findErr }
+	reportAgentVersion = func(util *Utility, log log.T, binaryPath string, role string) (string, error) {
+		return runningVersion, nil
+	}
+	return func() {
+		findRunningAgentExecutable, reportAgentVersion = originalFind, originalReport
+	}
+}
+
+func TestVerifyRunningVersionMatches(t *testing.T) {
+	defer stubRunningAgent("/usr/bin/amazon-ssm-agent", nil, "3.0.100.0")()
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	assert.NoError(t, util.VerifyRunningVersion(logger, context, "3.0.100.0"))
+}
+
+func TestVerifyRunningVersionMismatch(t *testing.T) {
+	defer stubRunningAgent("/usr/bin/amazon-ssm-agent", nil, "2.3.100.0")()
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	err := util.VerifyRunningVersion(logger, context, "3.0.100.0")
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "is version 2.3.100.0, expected 3.0.100.0")
+}
+
+func TestVerifyRunningVersionReplacedExecutable(t *testing.T) {
+	defer stubRunningAgent("/usr/bin/amazon-ssm-agent (deleted)", nil, "3.0.100.0")()
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	err := util.VerifyRunningVersion(logger, context, "3.0.100.0")
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "was not restarted")
+}
+
+func TestVerifyRunningVersionProcessNotFound(t *testing.T) {
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+	util := Utility{}
+
+	restore := stubRunningAgent("", fmt.Errorf("no amazon-ssm-agent process is running"), "")
+	err := util.VerifyRunningVersion(logger, context, "3.0.100.0")
+	restore()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+
+	// the check is skipped on the platforms the process cannot be found on
+	restore = stubRunningAgent("", errRunningAgentUnsupported, "")
+	err = util.VerifyRunningVersion(logger, context, "3.0.100.0")
+	restore()
+	assert.NoError(t, err)
+}
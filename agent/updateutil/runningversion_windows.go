@@ -0,0 +1,45 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// runningAgentExecutable returns the executable of the running agent process reported by Get-Process
+func runningAgentExecutable(log log.T, context *InstanceContext) (string, error) {
+	powershell := filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsPowerShell", "v1.0", "powershell.exe")
+	output, err := statusCommandOutput(execCommand(
+		powershell,
+		"-NoProfile",
+		"-Command",
+		fmt.Sprintf("(Get-Process -Name %v -ErrorAction Stop | Select-Object -First 1).Path", AgentServiceName)))
+	if err != nil {
+		return "", fmt.Errorf("no %v process is running, %v", AgentServiceName, err)
+	}
+
+	executable := strings.TrimSpace(string(output))
+	if executable == "" {
+		return "", fmt.Errorf("the path of the %v process is not available", AgentServiceName)
+	}
+	return executable, nil
+}
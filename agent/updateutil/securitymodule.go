@@ -0,0 +1,159 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// SecurityModuleMode is the mode a mandatory access control module runs in
+type SecurityModuleMode string
+
+const (
+	// SecurityModuleDisabled represents the module is not loaded
+	SecurityModuleDisabled SecurityModuleMode = "disabled"
+
+	// SecurityModulePermissive represents the module only logs the denials
+	SecurityModulePermissive SecurityModuleMode = "permissive"
+
+	// SecurityModuleEnforcing represents the module blocks the denied operations
+	SecurityModuleEnforcing SecurityModuleMode = "enforcing"
+)
+
+const (
+	seLinuxModuleName  = "SELinux"
+	appArmorModuleName = "AppArmor"
+
+	seLinuxEnforceFile        = "/sys/fs/selinux/enforce"
+	appArmorEnabledFile       = "/sys/module/apparmor/parameters/enabled"
+	appArmorCurrentFile       = "/proc/self/attr/apparmor/current"
+	legacyAppArmorCurrentFile = "/proc/self/attr/current"
+	appArmorUnconfined        = "unconfined"
+	appArmorEnforceSuffix     = "(enforce)"
+)
+
+// securityModuleRemediations are the steps logged for an enforcing module, they let the operator find and allow the
+// operations the installer needs
+var securityModuleRemediations = map[string]string{
+	seLinuxModuleName:  "check the denials with 'ausearch -m avc -ts recent' and allow the installer with a policy module",
+	appArmorModuleName: "check the denials with 'dmesg | grep apparmor' and switch the blocking profile to complain mode with 'aa-complain'",
+}
+
+// securityPolicyDenials are the messages of the exec failures an enforcing module causes, exit status 126 is
+// returned by the shell when it is not permitted to execute the installer
+var securityPolicyDenials = []string{"permission denied", "operation not permitted", "exit status: 126", "exit status 126"}
+
+var (
+	readSecurityModuleFile = ioutil.ReadFile
+	getSELinuxMode         = seLinuxMode
+	getAppArmorMode        = appArmorMode
+)
+
+// EnforcingSecurityModules returns the names of the mandatory access control modules which can block the installer
+func EnforcingSecurityModules() (modules []string) {
+	if getSELinuxMode() == SecurityModuleEnforcing {
+		modules = append(modules, seLinuxModuleName)
+	}
+	if getAppArmorMode() == SecurityModuleEnforcing {
+		modules = append(modules, appArmorModuleName)
+	}
+	return modules
+}
+
+// CheckSecurityModules logs a warning with the remediation for each enforcing SELinux or AppArmor module, the update
+// proceeds since the policy may allow the installer
+func CheckSecurityModules(log log.T) {
+	seLinux, appArmor := getSELinuxMode(), getAppArmorMode()
+	log.Debugf("SELinux is %v, AppArmor is %v", seLinux, appArmor)
+	for _, module := range EnforcingSecurityModules() {
+		log.Warnf("%v is enforcing and may block the installer, %v", module, securityModuleRemediations[module])
+	}
+}
+
+// ClassifySecurityPolicyError returns an UpdateError with ErrorSecurityPolicyDenied when err is a permission failure
+// and SELinux or AppArmor is enforcing, other errors are returned unchanged
+func ClassifySecurityPolicyError(log log.T, err error) error {
+	if err == nil || !isPermissionFailure(err) {
+		return err
+	}
+	modules := EnforcingSecurityModules()
+	if len(modules) == 0 {
+		return err
+	}
+
+	remediations := make([]string, len(modules))
+	for i, module := range modules {
+		remediations[i] = securityModuleRemediations[module]
+	}
+	log.Warnf("%v blocked the command, %v", strings.Join(modules, ", "), err)
+	return NewUpdateError(
+		ErrorSecurityPolicyDenied,
+		err,
+		"the command was likely blocked by %v, %v",
+		strings.Join(modules, " and "),
+		strings.Join(remediations, "; "))
+}
+
+// isPermissionFailure returns true when the error message matches one of the securityPolicyDenials
+func isPermissionFailure(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, denial := range securityPolicyDenials {
+		if strings.Contains(message, denial) {
+			return true
+		}
+	}
+	return false
+}
+
+// seLinuxMode returns the SELinux mode from selinuxfs, SELinux is disabled when selinuxfs is not mounted
+func seLinuxMode() SecurityModuleMode {
+	content, err := readSecurityModuleFile(seLinuxEnforceFile)
+	if err != nil {
+		return SecurityModuleDisabled
+	}
+	if strings.TrimSpace(string(content)) == "1" {
+		return SecurityModuleEnforcing
+	}
+	return SecurityModulePermissive
+}
+
+// appArmorMode returns enforcing when the updater is confined by an AppArmor profile in enforce mode. Distributions
+// such as Ubuntu load enforce mode profiles for other programs, AppArmor does not restrict an unconfined updater so
+// it is reported as permissive then, as it is for a profile in complain mode.
+func appArmorMode() SecurityModuleMode {
+	enabled, err := readSecurityModuleFile(appArmorEnabledFile)
+	if err != nil || strings.TrimSpace(string(enabled)) != "Y" {
+		return SecurityModuleDisabled
+	}
+	current, err := readSecurityModuleFile(appArmorCurrentFile)
+	if err != nil {
+		// kernels without the AppArmor specific attr folder report the label of the major security module
+		if current, err = readSecurityModuleFile(legacyAppArmorCurrentFile); err != nil {
+			return SecurityModulePermissive
+		}
+	}
+
+	label := strings.TrimSpace(strings.TrimRight(string(current), "\x00"))
+	if label == appArmorUnconfined {
+		return SecurityModulePermissive
+	}
+	if strings.HasSuffix(label, appArmorEnforceSuffix) {
+		return SecurityModuleEnforcing
+	}
+	return SecurityModulePermissive
+}
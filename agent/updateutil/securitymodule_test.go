@@ -0,0 +1,145 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubSecurityModuleFiles replaces the security module files with the given contents, missing files are not found
+func stubSecurityModuleFiles(files map[string]string) func() {
+	original := readSecurityModuleFile
+	readSecurityModuleFile = func(path string) ([]byte, error) {
+		if content, ok := files[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	return func() {
+		readSecurityModuleFile = original
+	}
+}
+
+// stubSecurityModuleModes replaces the SELinux and AppArmor probes with ones reporting the given modes
+func stubSecurityModuleModes(seLinux SecurityModuleMode, appArmor SecurityModuleMode) func() {
+	originalSELinux, originalAppArmor := getSELinuxMode, getAppArmorMode
+	getSELinuxMode = func() SecurityModuleMode { return seLinux }
+	getAppArmorMode = func() SecurityModuleMode { return appArmor }
+	return func() {
+		getSELinuxMode, getAppArmorMode = originalSELinux, originalAppArmor
+	}
+}
+
+func TestSELinuxMode(t *testing.T) {
+	testCases := []struct {
+		files    map[string]string
+		expected SecurityModuleMode
+	}{
+		{map[string]string{}, SecurityModuleDisabled},
+		{map[string]string{seLinuxEnforceFile: "1"}, SecurityModuleEnforcing},
+		{map[string]string{seLinuxEnforceFile: "0\n"}, SecurityModulePermissive},
+	}
+
+	for _, test := range testCases {
+		restore := stubSecurityModuleFiles(test.files)
+		assert.Equal(t, test.expected, seLinuxMode(), "%v", test.files)
+		restore()
+	}
+}
+
+func TestAppArmorMode(t *testing.T) {
+	testCases := []struct {
+		files    map[string]string
+		expected SecurityModuleMode
+	}{
+		{map[string]string{}, SecurityModuleDisabled},
+		{map[string]string{appArmorEnabledFile: "N\n"}, SecurityModuleDisabled},
+		// the profiles of other programs do not confine the updater
+		{map[string]string{appArmorEnabledFile: "Y\n"}, SecurityModulePermissive},
+		{map[string]string{
+			appArmorEnabledFile: "Y\n",
+			appArmorCurrentFile: "unconfined\n",
+		}, SecurityModulePermissive},
+		{map[string]string{
+			appArmorEnabledFile: "Y\n",
+			appArmorCurrentFile: "/usr/bin/amazon-ssm-agent (enforce)\n",
+		}, SecurityModuleEnforcing},
+		{map[string]string{
+			appArmorEnabledFile:       "Y\n",
+			legacyAppArmorCurrentFile: "/usr/bin/amazon-ssm-agent (enforce)\x00",
+		}, SecurityModuleEnforcing},
+		{map[string]string{
+			appArmorEnabledFile: "Y\n",
+			appArmorCurrentFile: "/usr/bin/amazon-ssm-agent (complain)\n",
+		}, SecurityModulePermissive},
+	}
+
+	for _, test := range testCases {
+		restore := stubSecurityModuleFiles(test.files)
+		assert.Equal(t, test.expected, appArmorMode(), "%v", test.files)
+		restore()
+	}
+}
+
+func TestEnforcingSecurityModules(t *testing.T) {
+	testCases := []struct {
+		seLinux  SecurityModuleMode
+		appArmor SecurityModuleMode
+		expected []string
+	}{
+		{SecurityModuleDisabled, SecurityModuleDisabled, nil},
+		{SecurityModulePermissive, SecurityModulePermissive, nil},
+		{SecurityModuleEnforcing, SecurityModuleDisabled, []string{seLinuxModuleName}},
+		{SecurityModuleDisabled, SecurityModuleEnforcing, []string{appArmorModuleName}},
+		{SecurityModuleEnforcing, SecurityModuleEnforcing, []string{seLinuxModuleName, appArmorModuleName}},
+	}
+
+	for _, test := range testCases {
+		restore := stubSecurityModuleModes(test.seLinux, test.appArmor)
+		assert.Equal(t, test.expected, EnforcingSecurityModules(), "%v %v", test.seLinux, test.appArmor)
+		CheckSecurityModules(logger)
+		restore()
+	}
+}
+
+func TestClassifySecurityPolicyErrorEnforcing(t *testing.T) {
+	defer stubSecurityModuleModes(SecurityModuleEnforcing, SecurityModuleDisabled)()
+
+	err := ClassifySecurityPolicyError(logger, fmt.Errorf("failed to start command install.sh, fork/exec install.sh: permission denied"))
+	assert.Error(t, err)
+	assert.Equal(t, ErrorSecurityPolicyDenied, GetErrorCode(err))
+	assert.Contains(t, err.Error(), seLinuxModuleName)
+	assert.Contains(t, err.Error(), "ausearch")
+	assert.NotContains(t, err.Error(), "setenforce")
+	assert.Contains(t, err.Error(), "permission denied")
+
+	err = ClassifySecurityPolicyError(logger, fmt.Errorf("The execution of command returned Exit Status: 126"))
+	assert.Equal(t, ErrorSecurityPolicyDenied, GetErrorCode(err))
+
+	other := fmt.Errorf("The execution of command returned Exit Status: 1")
+	assert.Equal(t, other, ClassifySecurityPolicyError(logger, other))
+	assert.NoError(t, ClassifySecurityPolicyError(logger, nil))
+}
+
+func TestClassifySecurityPolicyErrorPermissive(t *testing.T) {
+	defer stubSecurityModuleModes(SecurityModulePermissive, SecurityModulePermissive)()
+
+	denied := fmt.Errorf("fork/exec install.sh: permission denied")
+	assert.Equal(t, denied, ClassifySecurityPolicyError(logger, denied))
+}
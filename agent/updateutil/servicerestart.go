@@ -0,0 +1,79 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+)
+
+// DefaultRestartGracePeriod represents the wait between stopping and starting the agent service
+const DefaultRestartGracePeriod = 3 * time.Second
+
+// serviceStartAttempts is the number of times RestartAgentService starts the service before it fails
+const serviceStartAttempts = 2
+
+const (
+	serviceActionStop  = "stop"
+	serviceActionStart = "start"
+)
+
+var (
+	runServiceAction             = agentServiceAction
+	restartClock     times.Clock = times.DefaultClock
+)
+
+// RestartAgentService stops the agent service and starts it after the restart grace period, the grace period lets
+// the OS release the sockets and files of the stopped agent. A failed start is retried once after another grace
+// period, an UpdateError with ErrorCannotStopService or ErrorCannotStartService is returned when the restart fails.
+func (util *Utility) RestartAgentService(log log.T, context *InstanceContext) (err error) {
+	log = util.operationLog(log)
+	if err = runServiceAction(log, context, serviceActionStop); err != nil {
+		return NewUpdateError(ErrorCannotStopService, err, "failed to stop the agent service")
+	}
+
+	gracePeriod := util.restartGracePeriod()
+	for attempt := 1; attempt <= serviceStartAttempts; attempt++ {
+		if gracePeriod > 0 {
+			log.Debugf("Waiting %v before starting the agent service", gracePeriod)
+			<-restartClock.After(gracePeriod)
+		}
+		if err = runServiceAction(log, context, serviceActionStart); err == nil {
+			log.Infof("Restarted the agent service")
+			return nil
+		}
+		log.Warnf("Attempt %v of %v to start the agent service failed, %v", attempt, serviceStartAttempts, err)
+	}
+	return NewUpdateError(ErrorCannotStartService, err, "failed to start the agent service")
+}
+
+// restartGracePeriod returns the RestartGracePeriod of the utility, DefaultRestartGracePeriod is used when it is 0
+// and the service is started right away when it is negative
+func (util *Utility) restartGracePeriod() time.Duration {
+	if util.RestartGracePeriod == 0 {
+		return DefaultRestartGracePeriod
+	}
+	return util.RestartGracePeriod
+}
+
+// agentServiceAction runs the service manager command which stops or starts the agent service
+func agentServiceAction(log log.T, context *InstanceContext, action string) error {
+	parts := agentServiceCommand(log, context, action)
+	log.Debugf("Running %v", parts)
+	_, err := statusCommandOutput(execCommand(parts[0], parts[1:]...))
+	return err
+}
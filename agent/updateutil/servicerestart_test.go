@@ -0,0 +1,114 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/aws/amazon-ssm-agent/agent/times"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// stubServiceRestart replaces the service manager and the clock of the restart, the actions and the waits are
+// recorded in steps and the start fails startFailures times
+func stubServiceRestart(steps *[]string, gracePeriod time.Duration, startFailures int) (*times.MockedClock, func()) {
+	originalAction, originalClock := runServiceAction, restartClock
+	runServiceAction = func(log log.T, context *InstanceContext, action string) error {
+		*steps = append(*steps, action)
+		if action == serviceActionStart && startFailures > 0 {
+			startFailures--
+			return fmt.Errorf("address already in use")
+		}
+		return nil
+	}
+
+	elapsed := make(chan struct{}, serviceStartAttempts)
+	for i := 0; i < serviceStartAttempts; i++ {
+		elapsed <- struct{}{}
+	}
+	clock := times.NewMockedClock()
+	clock.On("After", gracePeriod).Run(func(args mock.Arguments) {
+		*steps = append(*steps, "wait")
+	}).Return(elapsed)
+	restartClock = clock
+
+	return clock, func() {
+		runServiceAction, restartClock = originalAction, originalClock
+	}
+}
+
+func TestRestartAgentServiceWaitsBetweenStopAndStart(t *testing.T) {
+	steps := []string{}
+	clock, restore := stubServiceRestart(&steps, 5*time.Second, 0)
+	defer restore()
+	util := Utility{RestartGracePeriod: 5 * time.Second}
+
+	err := util.RestartAgentService(logger, &InstanceContext{Platform: PlatformAmazonLinux, PlatformVersion: "2"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{serviceActionStop, "wait", serviceActionStart}, steps)
+	clock.AssertNumberOfCalls(t, "After", 1)
+}
+
+func TestRestartAgentServiceDefaultGracePeriod(t *testing.T) {
+	steps := []string{}
+	clock, restore := stubServiceRestart(&steps, DefaultRestartGracePeriod, 0)
+	defer restore()
+	util := Utility{}
+
+	assert.NoError(t, util.RestartAgentService(logger, &InstanceContext{Platform: PlatformAmazonLinux, PlatformVersion: "2"}))
+	clock.AssertCalled(t, "After", DefaultRestartGracePeriod)
+}
+
+func TestRestartAgentServiceRetriesStart(t *testing.T) {
+	steps := []string{}
+	clock, restore := stubServiceRestart(&steps, 5*time.Second, 1)
+	defer restore()
+	util := Utility{RestartGracePeriod: 5 * time.Second}
+
+	err := util.RestartAgentService(logger, &InstanceContext{Platform: PlatformAmazonLinux, PlatformVersion: "2"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{serviceActionStop, "wait", serviceActionStart, "wait", serviceActionStart}, steps)
+	clock.AssertNumberOfCalls(t, "After", 2)
+}
+
+func TestRestartAgentServiceStartFails(t *testing.T) {
+	steps := []string{}
+	_, restore := stubServiceRestart(&steps, 5*time.Second, serviceStartAttempts)
+	defer restore()
+	util := Utility{RestartGracePeriod: 5 * time.Second}
+
+	err := util.RestartAgentService(logger, &InstanceContext{Platform: PlatformAmazonLinux, PlatformVersion: "2"})
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorCannotStartService, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "address already in use")
+}
+
+func TestRestartAgentServiceWithoutGracePeriod(t *testing.T) {
+	steps := []string{}
+	clock, restore := stubServiceRestart(&steps, 0, 0)
+	defer restore()
+	util := Utility{RestartGracePeriod: -1}
+
+	assert.NoError(t, util.RestartAgentService(logger, &InstanceContext{Platform: PlatformAmazonLinux, PlatformVersion: "2"}))
+	assert.Equal(t, []string{serviceActionStop, serviceActionStart}, steps)
+	clock.AssertNotCalled(t, "After", mock.Anything)
+}
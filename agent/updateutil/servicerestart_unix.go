@@ -0,0 +1,45 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import "github.com/aws/amazon-ssm-agent/agent/log"
+
+// darwinAgentLaunchdLabel is the label of the launchd job of the agent
+const darwinAgentLaunchdLabel = "com.amazon.aws.ssm"
+
+// agentServiceCommand returns the command of the service manager of the platform which runs the action on the agent
+func agentServiceCommand(log log.T, context *InstanceContext, action string) []string {
+	if context.Platform == PlatformFreeBSD {
+		return []string{"service", AgentServiceName, action}
+	}
+	if runtimeGOOS == "darwin" {
+		return []string{"launchctl", action, darwinAgentLaunchdLabel}
+	}
+
+	// systemd is asked which unit it manages, the platform version is the fallback
+	serviceName, fallbackServiceName := AgentServiceUnit(context, true), AgentSnapSystemdUnit
+	if serviceName == AgentSnapSystemdUnit {
+		fallbackServiceName = AgentSystemdUnit
+	}
+	if unit, probed := systemdManagedUnit(log, serviceName, fallbackServiceName); probed && unit != "" {
+		return []string{"systemctl", action, unit}
+	}
+	if isSystemD, err := context.IsPlatformUsingSystemD(log); err == nil && isSystemD {
+		return []string{"systemctl", action, serviceName}
+	}
+	return []string{action, AgentServiceName}
+}
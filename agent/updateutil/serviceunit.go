@@ -0,0 +1,70 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+const (
+	// AgentSystemdUnit represents the systemd unit of the agent installed by the rpm and deb packages
+	AgentSystemdUnit = "amazon-ssm-agent.service"
+
+	// AgentSnapSystemdUnit represents the systemd unit of the agent installed by snap, snapd names it after the snap
+	AgentSnapSystemdUnit = "snap.amazon-ssm-agent.amazon-ssm-agent.service"
+
+	// AgentServiceName represents the upstart job and the rc script of the agent
+	AgentServiceName = "amazon-ssm-agent"
+
+	// AgentWindowsServiceName represents the windows service of the agent
+	AgentWindowsServiceName = "AmazonSSMAgent"
+)
+
+// AgentServiceUnit returns the identifier service commands use for the agent on the platform of the instance, the
+// systemd unit when the platform uses systemd, otherwise the upstart job, rc script or windows service name
+func AgentServiceUnit(context *InstanceContext, isSystemD bool) string {
+	switch context.InstallerName {
+	case PlatformWindows, PlatformWindowsNano:
+		return AgentWindowsServiceName
+	case PlatformFreeBSD:
+		return AgentServiceName
+	case PlatformUbuntuSnap:
+		// snap only runs on systemd
+		return AgentSnapSystemdUnit
+	}
+	if isSystemD {
+		return AgentSystemdUnit
+	}
+	return AgentServiceName
+}
+
+// AgentServiceUnitPath returns the path of the file the agent service is defined in on the platform of the instance,
+// the path is empty on windows where the service is registered with the service control manager
+func AgentServiceUnitPath(context *InstanceContext, isSystemD bool) string {
+	switch context.InstallerName {
+	case PlatformWindows, PlatformWindowsNano:
+		return ""
+	case PlatformFreeBSD:
+		return "/usr/local/etc/rc.d/" + AgentServiceName
+	case PlatformUbuntuSnap:
+		return "/etc/systemd/system/" + AgentSnapSystemdUnit
+	case PlatformUbuntu:
+		// the deb package ships its unit in the directory of the distribution packages
+		if isSystemD {
+			return "/lib/systemd/system/" + AgentSystemdUnit
+		}
+	default:
+		if isSystemD {
+			return "/etc/systemd/system/" + AgentSystemdUnit
+		}
+	}
+	return "/etc/init/" + AgentServiceName + ".conf"
+}
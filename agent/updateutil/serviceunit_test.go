@@ -0,0 +1,63 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentServiceUnit(t *testing.T) {
+	testCases := []struct {
+		context  InstanceContext
+		systemd  bool
+		unit     string
+		unitPath string
+	}{
+		// amazon linux 2 with systemd
+		{InstanceContext{"us-east-1", PlatformLinux, "2", PlatformLinux, "amd64", "tar.gz"}, true,
+			"amazon-ssm-agent.service", "/etc/systemd/system/amazon-ssm-agent.service"},
+		// amazon linux with upstart
+		{InstanceContext{"us-east-1", PlatformLinux, "2018.03", PlatformLinux, "amd64", "tar.gz"}, false,
+			"amazon-ssm-agent", "/etc/init/amazon-ssm-agent.conf"},
+		// red hat with systemd on arm
+		{InstanceContext{"us-east-1", PlatformRedHat, "8.2", PlatformLinux, "arm64", "tar.gz"}, true,
+			"amazon-ssm-agent.service", "/etc/systemd/system/amazon-ssm-agent.service"},
+		// ubuntu deb with systemd
+		{InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntu, "amd64", "tar.gz"}, true,
+			"amazon-ssm-agent.service", "/lib/systemd/system/amazon-ssm-agent.service"},
+		// ubuntu deb with upstart
+		{InstanceContext{"us-east-1", PlatformUbuntu, "14.04", PlatformUbuntu, "386", "tar.gz"}, false,
+			"amazon-ssm-agent", "/etc/init/amazon-ssm-agent.conf"},
+		// ubuntu snap
+		{InstanceContext{"us-east-1", PlatformUbuntu, "20.04", PlatformUbuntuSnap, "amd64", "tar.gz"}, true,
+			"snap.amazon-ssm-agent.amazon-ssm-agent.service", "/etc/systemd/system/snap.amazon-ssm-agent.amazon-ssm-agent.service"},
+		// freebsd rc
+		{InstanceContext{"us-east-1", PlatformFreeBSD, "12.1-RELEASE", PlatformFreeBSD, "amd64", "tar.gz"}, false,
+			"amazon-ssm-agent", "/usr/local/etc/rc.d/amazon-ssm-agent"},
+		// windows
+		{InstanceContext{"us-east-1", PlatformWindows, "10.0.17763", PlatformWindows, "amd64", "zip"}, false,
+			"AmazonSSMAgent", ""},
+		// windows nano server
+		{InstanceContext{"us-east-1", PlatformWindowsNano, "10.0.14393", PlatformWindowsNano, "amd64", "zip"}, false,
+			"AmazonSSMAgent", ""},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.unit, AgentServiceUnit(&test.context, test.systemd), test.context.Platform)
+		assert.Equal(t, test.unitPath, AgentServiceUnitPath(&test.context, test.systemd), test.context.Platform)
+	}
+}
@@ -15,6 +15,8 @@
 package updateutil
 
 import (
+	"time"
+
 	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/stretchr/testify/mock"
 )
@@ -50,6 +52,12 @@ func (m *Mock) ExeCommand(log log.T, cmd string, workingDir string, updaterRoot
 	return args.Error(0)
 }
 
+// ExeCommandWithTimeout mocks the ExeCommandWithTimeout function.
+func (m *Mock) ExeCommandWithTimeout(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, timeout time.Duration) (err error) {
+	args := m.Called(log, cmd, workingDir, updaterRoot, stdOut, stdErr, timeout)
+	return args.Error(0)
+}
+
 // SaveUpdatePluginResult mocks the SaveUpdatePluginResult function.
 func (m *Mock) SaveUpdatePluginResult(log log.T, updaterRoot string, updateResult *UpdatePluginResult) (err error) {
 	args := m.Called(log, updaterRoot, updateResult)
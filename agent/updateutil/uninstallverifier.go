@@ -0,0 +1,73 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"os"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+var statFile = os.Stat
+
+// VerifyUninstalled verifies the service and the binary of the uninstalled version are no longer present
+func VerifyUninstalled(log log.T, context *InstanceContext, packageName string, version string) (err error) {
+	var serviceInstalled bool
+	if serviceInstalled, err = isServiceInstalled(log, context); err != nil {
+		return NewUpdateError(ErrorUninstallFailed, err, "failed to check the service of %v %v", packageName, version)
+	}
+	if serviceInstalled {
+		return NewUpdateError(ErrorUninstallFailed, nil, "service of %v %v is still installed", packageName, version)
+	}
+
+	for _, binaryPath := range agentBinaryPaths {
+		if _, statErr := statFile(binaryPath); statErr == nil {
+			return NewUpdateError(ErrorUninstallFailed, nil, "binary %v of %v %v is still present", binaryPath, packageName, version)
+		} else if !os.IsNotExist(statErr) {
+			return NewUpdateError(ErrorUninstallFailed, statErr, "failed to check the binary %v of %v %v", binaryPath, packageName, version)
+		}
+	}
+
+	log.Infof("Verified %v %v is uninstalled", packageName, version)
+	return nil
+}
+
+// isServiceInstalled returns if the agent service is still registered with the init system of the platform
+func isServiceInstalled(log log.T, i *InstanceContext) (result bool, err error) {
+	isSystemD := false
+
+	// isSystemD will always be false for Windows
+	if isSystemD, err = i.IsPlatformUsingSystemD(log); err != nil {
+		return false, err
+	}
+
+	if isSystemD {
+		if _, err = execCommand("systemctl", "cat", AgentSystemdUnit).Output(); err == nil {
+			return true, nil
+		}
+		//test snap service
+		if _, err = execCommand("systemctl", "cat", AgentSnapSystemdUnit).Output(); err == nil {
+			return true, nil
+		}
+		log.Debugf("systemctl does not find the agent service, %v", err)
+		return false, nil
+	}
+
+	if _, err = agentStatusOutput(); err != nil {
+		log.Debugf("agent service status is not available, %v", err)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func missingExecCommand(command string, args ...string) *exec.Cmd {
+	return exec.Command(filepath.Join(os.TempDir(), "nonexistent", command), args...)
+}
+
+func TestVerifyUninstalled(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "uninstallverifier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	originalPaths := agentBinaryPaths
+	defer func() {
+		agentBinaryPaths = originalPaths
+		execCommand = exec.Command
+	}()
+	agentBinaryPaths = []string{filepath.Join(tempDir, "amazon-ssm-agent")}
+	execCommand = missingExecCommand
+
+	testCases := []InstanceContext{
+		// test system with upstart
+		{"us-east-1", PlatformRedHat, "6.5", "linux", "amd64", "tar.gz"},
+		// test system with systemD
+		{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"},
+	}
+	for _, context := range testCases {
+		assert.NoError(t, VerifyUninstalled(logger, &context, "amazon-ssm-agent", "2.3.0.0"))
+	}
+}
+
+func TestVerifyUninstalledServiceStillPresent(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	execCommand = fakeExecCommand
+
+	context := InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	err := VerifyUninstalled(logger, &context, "amazon-ssm-agent", "2.3.0.0")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorUninstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "service")
+}
+
+func TestVerifyUninstalledBinaryStillPresent(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "uninstallverifier")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	binaryPath := filepath.Join(tempDir, "amazon-ssm-agent")
+	assert.NoError(t, ioutil.WriteFile(binaryPath, []byte("agent binary"), 0755))
+
+	originalPaths := agentBinaryPaths
+	defer func() {
+		agentBinaryPaths = originalPaths
+		execCommand = exec.Command
+	}()
+	agentBinaryPaths = []string{binaryPath}
+	execCommand = missingExecCommand
+
+	context := InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	err = VerifyUninstalled(logger, &context, "amazon-ssm-agent", "2.3.0.0")
+	assert.Error(t, err)
+	assert.Equal(t, ErrorUninstallFailed, GetErrorCode(err))
+	assert.Contains(t, err.Error(), binaryPath)
+}
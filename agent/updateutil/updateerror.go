@@ -0,0 +1,61 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import "net/http"
+
+// UpdateError represents an update failure classified with an ErrorCode
+type UpdateError struct {
+	Code    ErrorCode
+	Message string
+}
+
+// NewUpdateError creates an UpdateError, the message is built the same way as BuildMessage
+func NewUpdateError(code ErrorCode, err error, format string, params ...interface{}) *UpdateError {
+	return &UpdateError{
+		Code:    code,
+		Message: BuildMessage(err, format, params...),
+	}
+}
+
+// Error returns the message of the update error
+func (e *UpdateError) Error() string {
+	return e.Message
+}
+
+// GetErrorCode returns the ErrorCode of the error, ErrorUnexpected is returned for errors that are not UpdateError
+func GetErrorCode(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	if updateErr, ok := err.(*UpdateError); ok {
+		return updateErr.Code
+	}
+	return ErrorUnexpected
+}
+
+// NewDownloadError creates the UpdateError of a failed download of source, the http status code of the response
+// tells whether the version or package name is wrong (404) or the instance role lacks permissions (403),
+// defaultCode is used for the other failures
+func NewDownloadError(statusCode int, defaultCode ErrorCode, err error, source string) *UpdateError {
+	switch statusCode {
+	case http.StatusNotFound:
+		return NewUpdateError(ErrorPackageNotFound, err, "failed to download file reliably, %v was not found, verify the version and the package name", source)
+	case http.StatusForbidden:
+		return NewUpdateError(ErrorPackageAccessDenied, err, "failed to download file reliably, access to %v was denied, verify the permissions of the instance role", source)
+	default:
+		return NewUpdateError(defaultCode, err, "failed to download file reliably, %v", source)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+// commandStateRoot represents the data store folder which holds the command state of each instance
+var commandStateRoot = appconfig.DefaultDataStorePath
+
+// IsSafeToUpdate returns false with the reason when the agent is executing commands, the documents of the update
+// command itself are passed as excludedDocumentIDs, force skips the check
+func IsSafeToUpdate(log log.T, force bool, excludedDocumentIDs ...string) (safe bool, reason string) {
+	if force {
+		log.Infof("Update is forced, skipping the in-progress command check")
+		return true, ""
+	}
+
+	// the in-progress documents are persisted under {DataStore}/{InstanceID}/document/state/current
+	pattern := filepath.Join(commandStateRoot,
+		"*",
+		appconfig.DefaultDocumentRootDirName,
+		appconfig.DefaultLocationOfState,
+		appconfig.DefaultLocationOfCurrent,
+		"*")
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return false, fmt.Sprintf("failed to check in-progress commands, %v", err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, documentID := range excludedDocumentIDs {
+		excluded[documentID] = true
+	}
+
+	inProgress := []string{}
+	for _, match := range matches {
+		if documentID := filepath.Base(match); !excluded[documentID] {
+			inProgress = append(inProgress, documentID)
+		}
+	}
+	if len(inProgress) > 0 {
+		sort.Strings(inProgress)
+		return false, fmt.Sprintf("%v command(s) in progress: %v", len(inProgress), strings.Join(inProgress, ", "))
+	}
+
+	return true, ""
+}
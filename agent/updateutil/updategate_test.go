@@ -0,0 +1,73 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCommandState(t *testing.T, dataStore string, location string, documentID string) {
+	stateDir := filepath.Join(dataStore, "i-1234567890", appconfig.DefaultDocumentRootDirName, appconfig.DefaultLocationOfState, location)
+	assert.NoError(t, os.MkdirAll(stateDir, appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(stateDir, documentID), []byte("{}"), appconfig.ReadWriteAccess))
+}
+
+func TestIsSafeToUpdate(t *testing.T) {
+	dataStore, err := ioutil.TempDir("", "updategate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataStore)
+	defer func() { commandStateRoot = appconfig.DefaultDataStorePath }()
+	commandStateRoot = dataStore
+
+	// idle agent
+	safe, reason := IsSafeToUpdate(logger, false)
+	assert.True(t, safe)
+	assert.Empty(t, reason)
+
+	// completed and pending commands don't block the update
+	writeCommandState(t, dataStore, appconfig.DefaultLocationOfCompleted, "completed-command")
+	writeCommandState(t, dataStore, appconfig.DefaultLocationOfPending, "pending-command")
+	// the update command itself is in progress
+	writeCommandState(t, dataStore, appconfig.DefaultLocationOfCurrent, "update-command")
+	safe, reason = IsSafeToUpdate(logger, false, "update-command")
+	assert.True(t, safe)
+	assert.Empty(t, reason)
+}
+
+func TestIsSafeToUpdateWithCommandInProgress(t *testing.T) {
+	dataStore, err := ioutil.TempDir("", "updategate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dataStore)
+	defer func() { commandStateRoot = appconfig.DefaultDataStorePath }()
+	commandStateRoot = dataStore
+
+	writeCommandState(t, dataStore, appconfig.DefaultLocationOfCurrent, "update-command")
+	writeCommandState(t, dataStore, appconfig.DefaultLocationOfCurrent, "long-running-command")
+
+	safe, reason := IsSafeToUpdate(logger, false, "update-command")
+	assert.False(t, safe)
+	assert.Contains(t, reason, "long-running-command")
+	assert.NotContains(t, reason, "update-command")
+
+	safe, reason = IsSafeToUpdate(logger, true, "update-command")
+	assert.True(t, safe)
+	assert.Empty(t, reason)
+}
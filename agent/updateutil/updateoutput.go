@@ -0,0 +1,118 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// updateOutputReadBlockSize represents the size of the blocks read from the end of the update output files
+const updateOutputReadBlockSize = 4096
+
+// ReadUpdateOutput returns the last maxLines lines of the update stdout or stderr file in the update root,
+// the file is read backwards from the end so only the requested lines are loaded
+func ReadUpdateOutput(updateRoot string, fileName string, maxLines int) (lines []string, err error) {
+	// UpdateStdOutPath and UpdateStdErrPath only differ in the default file name
+	filePath := UpdateStdOutPath(updateRoot, fileName)
+	if maxLines <= 0 {
+		return nil, fmt.Errorf("invalid max lines %v, it must be greater than 0", maxLines)
+	}
+
+	var file *os.File
+	if file, err = os.Open(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("update output file %v does not exist", filePath)
+		}
+		return nil, fmt.Errorf("failed to open update output file %v, %v", filePath, err)
+	}
+	defer file.Close()
+
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		return nil, fmt.Errorf("failed to stat update output file %v, %v", filePath, err)
+	}
+
+	var content []byte
+	offset := info.Size()
+	// a trailing newline terminates the last line, it does not start a new one
+	for offset > 0 && bytes.Count(bytes.TrimSuffix(content, []byte("\n")), []byte("\n")) < maxLines {
+		blockSize := int64(updateOutputReadBlockSize)
+		if offset < blockSize {
+			blockSize = offset
+		}
+		offset -= blockSize
+		block := make([]byte, blockSize)
+		if _, err = file.ReadAt(block, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read update output file %v, %v", filePath, err)
+		}
+		content = append(block, content...)
+	}
+
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return []string{}, nil
+	}
+	lines = strings.Split(text, "\n")
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, nil
+}
+
+// outputTruncatedMarker is written in place of the output which exceeds the limit of a limitedWriter
+const outputTruncatedMarker = "\n[output truncated, the limit of %v bytes is exceeded]\n"
+
+// limitedWriter writes up to limit bytes to the writer and drops the rest after writing outputTruncatedMarker, the
+// dropped writes succeed so the command keeps running instead of failing on a broken pipe
+type limitedWriter struct {
+	writer    io.Writer
+	limit     int64
+	written   int64
+	truncated bool
+}
+
+// newLimitedWriter creates a limitedWriter which writes up to limit bytes to the writer
+func newLimitedWriter(writer io.Writer, limit int64) *limitedWriter {
+	return &limitedWriter{writer: writer, limit: limit}
+}
+
+// Write writes the part of p within the limit, the length of p is returned unless the writer fails
+func (w *limitedWriter) Write(p []byte) (n int, err error) {
+	if w.truncated {
+		return len(p), nil
+	}
+	if remaining := w.limit - w.written; int64(len(p)) > remaining {
+		if _, err = w.writer.Write(p[:remaining]); err == nil {
+			_, err = fmt.Fprintf(w.writer, outputTruncatedMarker, w.limit)
+		}
+		w.written = w.limit
+		w.truncated = true
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	n, err = w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
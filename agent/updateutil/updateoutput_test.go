@@ -0,0 +1,98 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadUpdateOutput(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updateoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	content := "line 1\nline 2\nline 3\nline 4\nline 5\n"
+	assert.NoError(t, ioutil.WriteFile(UpdateStdOutPath(updateRoot, DefaultStandOut), []byte(content), 0644))
+	assert.NoError(t, ioutil.WriteFile(UpdateStdErrPath(updateRoot, DefaultStandErr), []byte("error 1\r\nerror 2"), 0644))
+
+	testCases := []struct {
+		fileName string
+		maxLines int
+		expected []string
+	}{
+		{DefaultStandOut, 2, []string{"line 4", "line 5"}},
+		{DefaultStandOut, 5, []string{"line 1", "line 2", "line 3", "line 4", "line 5"}},
+		{DefaultStandOut, 10, []string{"line 1", "line 2", "line 3", "line 4", "line 5"}},
+		{DefaultStandErr, 1, []string{"error 2"}},
+		{DefaultStandErr, 10, []string{"error 1", "error 2"}},
+	}
+	for _, test := range testCases {
+		lines, err := ReadUpdateOutput(updateRoot, test.fileName, test.maxLines)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, lines)
+	}
+}
+
+func TestReadUpdateOutputAcrossBlocks(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updateoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	var content []string
+	for i := 0; i < 1000; i++ {
+		content = append(content, fmt.Sprintf("update output line %v", i))
+	}
+	assert.NoError(t, ioutil.WriteFile(UpdateStdOutPath(updateRoot, DefaultStandOut), []byte(strings.Join(content, "\n")+"\n"), 0644))
+
+	lines, err := ReadUpdateOutput(updateRoot, DefaultStandOut, 300)
+	assert.NoError(t, err)
+	assert.Equal(t, content[700:], lines)
+}
+
+func TestReadUpdateOutputMissingFile(t *testing.T) {
+	updateRoot, err := ioutil.TempDir("", "updateoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+
+	_, err = ReadUpdateOutput(updateRoot, DefaultStandOut, 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestLimitedWriter(t *testing.T) {
+	var output bytes.Buffer
+	writer := newLimitedWriter(&output, 10)
+
+	n, err := writer.Write([]byte("12345"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	// the write crossing the limit is cut and followed by the marker
+	n, err = writer.Write([]byte("67890abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, n)
+	// the later writes are dropped
+	n, err = writer.Write([]byte("def"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Equal(t, "1234567890"+fmt.Sprintf(outputTruncatedMarker, 10), output.String())
+}
@@ -15,7 +15,9 @@
 package updateutil
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -26,6 +28,7 @@ import (
 	"time"
 
 	"errors"
+	"regexp"
 	"strconv"
 
 	"io"
@@ -82,12 +85,21 @@ const (
 	// CompressedHolder represents Place holder for compress format
 	CompressedHolder = "{Compressed}"
 
+	// DefaultFileNameTemplate represents the file name template of the package artifacts
+	DefaultFileNameTemplate = PackageNameHolder + "-" + PlatformHolder + "-" + ArchHolder + "." + CompressedHolder
+
 	// PlatformLinux represents linux
 	PlatformLinux = "linux"
 
 	// PlatformAmazonLinux represents amazon linux
 	PlatformAmazonLinux = "amazon"
 
+	// PlatformAmazonLinux2023 represents amazon linux 2023
+	PlatformAmazonLinux2023 = "amazon linux 2023"
+
+	// amazonLinux2023MajorVersion represents the major platform version of amazon linux 2023
+	amazonLinux2023MajorVersion = "2023"
+
 	// PlatformRedHat represents RedHat
 	PlatformRedHat = "red hat"
 
@@ -118,6 +130,18 @@ const (
 	//PlatformWindowsNano represents windows nano
 	PlatformWindowsNano = "windows-nano"
 
+	// PlatformFreeBSD represents FreeBSD
+	PlatformFreeBSD = "freebsd"
+
+	// ArchArm represents the artifact arch of 32-bit arm below armv7
+	ArchArm = "arm"
+
+	// ArchArmHF represents the artifact arch of 32-bit armv7 and later with hardware floating point
+	ArchArmHF = "armhf"
+
+	// ArchAny represents the arch of a universal artifact which is installed on every arch
+	ArchAny = "any"
+
 	// DefaultUpdateExecutionTimeoutInSeconds represents default timeout time for execution update related scripts in seconds
 	DefaultUpdateExecutionTimeoutInSeconds = 150
 
@@ -125,6 +149,17 @@ const (
 	PipelineTestVersion = "255.0.0.0"
 )
 
+const (
+	// CompressFormatTarGz represents the gzip compressed tar package format
+	CompressFormatTarGz = "tar.gz"
+
+	// CompressFormatTarXz represents the xz compressed tar package format
+	CompressFormatTarXz = "tar.xz"
+
+	// CompressFormatZip represents the zip package format
+	CompressFormatZip = "zip"
+)
+
 //ErrorCode is types of Error Codes
 type ErrorCode string
 
@@ -147,6 +182,12 @@ const (
 	// ErrorPackageNotAccessible represents Installation package file is not accessible
 	ErrorPackageNotAccessible ErrorCode = "ErrorPackageNotAccessible"
 
+	// ErrorPackageNotFound represents Installation package file does not exist at the download location
+	ErrorPackageNotFound ErrorCode = "ErrorPackageNotFound"
+
+	// ErrorPackageAccessDenied represents Installation package file download is not permitted for the instance
+	ErrorPackageAccessDenied ErrorCode = "ErrorPackageAccessDenied"
+
 	// ErrorInvalidCertificate represents Installation package file doesn't contain valid certificate
 	ErrorInvalidCertificate ErrorCode = "ErrorInvalidCertificate"
 
@@ -156,6 +197,9 @@ const (
 	// ErrorInvalidManifestLocation represents Invalid manifest file location
 	ErrorInvalidManifestLocation ErrorCode = "ErrorInvalidManifestLocation"
 
+	// ErrorInvalidManifestSignature represents Manifest file doesn't match its signature
+	ErrorInvalidManifestSignature ErrorCode = "ErrorInvalidManifestSignature"
+
 	// ErrorUninstallFailed represents Uninstall failed
 	ErrorUninstallFailed ErrorCode = "ErrorUninstallFailed"
 
@@ -179,11 +223,17 @@ const (
 
 	// ErrorLoadingAgentVersion represents failed for loading agent version
 	ErrorLoadingAgentVersion ErrorCode = "ErrorLoadingAgentVersion"
+
+	// ErrorSecurityPolicyDenied represents the installer was blocked by SELinux or AppArmor
+	ErrorSecurityPolicyDenied ErrorCode = "ErrorSecurityPolicyDenied"
 )
 
 // MinimumDiskSpaceForUpdate represents 100 Mb in bytes
 const MinimumDiskSpaceForUpdate int64 = 104857600
 
+// DefaultMinimumMemoryForUpdate represents 128 Mb in bytes
+const DefaultMinimumMemoryForUpdate int64 = 134217728
+
 const (
 	verifyAttemptCount              = 36
 	verifyRetryIntervalMilliseconds = 5000
@@ -204,29 +254,123 @@ type T interface {
 	CreateInstanceContext(log log.T) (context *InstanceContext, err error)
 	CreateUpdateDownloadFolder() (folder string, err error)
 	ExeCommand(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, isAsync bool) (err error)
+	ExeCommandWithTimeout(log log.T, cmd string, workingDir string, updaterRoot string, stdOut string, stdErr string, timeout time.Duration) (err error)
 	IsServiceRunning(log log.T, i *InstanceContext) (result bool, err error)
 	WaitForServiceToStart(log log.T, i *InstanceContext) (result bool, err error)
+	WaitForServiceRunning(log log.T, i *InstanceContext, timeout time.Duration, interval time.Duration) (result bool, err error)
 	SaveUpdatePluginResult(log log.T, updaterRoot string, updateResult *UpdatePluginResult) (err error)
-	IsDiskSpaceSufficientForUpdate(log log.T) (bool, error)
+	IsDiskSpaceSufficientForUpdate(log log.T, artifactSize int64) (bool, error)
+	IsDiskSpaceSufficientForUpdateInFolder(log log.T, folder string, artifactSize int64) (bool, error)
+	IsMemorySufficientForUpdate(log log.T, requiredBytes int64) (bool, error)
+	VerifyInstalledVersion(log log.T, context *InstanceContext, expectedVersion string) (err error)
 }
 
 // Utility implements interface T
 type Utility struct {
 	CustomUpdateExecutionTimeoutInSeconds int
+	// RunAsUser is the user ExeCommand runs the commands as on unix, the agent user is used when it is empty
+	RunAsUser string
+	// UseSanitizedPath makes ExeCommand run the commands with a minimal system PATH instead of the agent PATH
+	UseSanitizedPath bool
+	// Region overrides the region of the instance context, the appconfig region is used when it is empty
+	Region string
+	// MetadataRetryCount is the number of retries of the failed instance metadata lookups,
+	// DefaultMetadataRetryCount is used when it is 0 and the lookups are not retried when it is negative
+	MetadataRetryCount int
+	// MetadataRetryInterval is the wait before the first retry, it doubles after each retry,
+	// DefaultMetadataRetryInterval is used when it is 0
+	MetadataRetryInterval time.Duration
+	// OperationID identifies the update operation, the log messages of the helpers are tagged with it when it is set
+	OperationID string
+	// MaxOutputSize is the number of bytes ExeCommand writes to each of the stdout and stderr files of a command,
+	// the rest of the output is dropped, DefaultMaxOutputSize is used when it is not positive
+	MaxOutputSize int64
+	// MinimumMemoryForUpdate is the available memory IsMemorySufficientForUpdate requires when no amount is passed,
+	// DefaultMinimumMemoryForUpdate is used when it is not positive
+	MinimumMemoryForUpdate int64
+	// RestartGracePeriod is the wait between stopping and starting the agent service in RestartAgentService,
+	// DefaultRestartGracePeriod is used when it is 0 and the service is started right away when it is negative
+	RestartGracePeriod time.Duration
 }
 
+const (
+	// DefaultMetadataRetryCount represents the default number of retries of the instance metadata lookups
+	DefaultMetadataRetryCount = 3
+
+	// DefaultMetadataRetryInterval represents the default wait before the first retry of the instance metadata lookups
+	DefaultMetadataRetryInterval = time.Second
+
+	// DefaultMaxOutputSize represents the default number of bytes of each output stream of a command written to its file
+	DefaultMaxOutputSize int64 = 10 * 1024 * 1024
+)
+
+var metadataRetrySleep = time.Sleep
+
+// metadataReadyPollInterval is the wait between the region lookups of WaitForMetadataReady
+var metadataReadyPollInterval = time.Second
+
 var getDiskSpaceInfo = fileutil.GetDiskSpaceInfo
+var getDiskSpaceInfoForPath = fileutil.GetDiskSpaceInfoForPath
+var getAvailableMemory = availableMemory
 var getRegion = platform.Region
 var getPlatformName = platform.PlatformName
 var getPlatformVersion = platform.PlatformVersion
 var mkDirAll = os.MkdirAll
+var downloadRoot = appconfig.DownloadRoot
 var openFile = os.OpenFile
 var execCommand = exec.Command
+var loadAppConfig = appconfig.Config
 var cmdStart = (*exec.Cmd).Start
 var cmdOutput = (*exec.Cmd).Output
+var runtimeGOOS = runtime.GOOS
+var runtimeGOARCH = runtime.GOARCH
+
+// goarm is the GOARM of 32-bit arm builds, it can be set at build time with
+// -ldflags "-X github.com/aws/amazon-ssm-agent/agent/updateutil.goarm=7"
+var goarm = ""
+
+// machineHardwareName returns the machine hardware name reported by uname, e.g. armv7l
+var machineHardwareName = func() (string, error) {
+	output, err := execCommand("uname", "-m").Output()
+	return strings.TrimSpace(string(output)), err
+}
 var isUsingSystemD map[string]string
 var once sync.Once
 
+// serviceRunningPollJitter is the fraction of the poll interval randomly added to or removed from each wait
+// so that instances updating at the same time do not poll the service manager in lockstep
+const serviceRunningPollJitter = 0.2
+
+// pollJitterRand is the random source of the poll jitter, guarded by pollJitterLock
+var pollJitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var pollJitterLock sync.Mutex
+
+// serviceStatusTimeout is the time the service status commands are given to complete before they are killed
+var serviceStatusTimeout = 30 * time.Second
+
+// systemctlUnitNotActiveExitCode is the exit code of systemctl status when the unit is not running
+const systemctlUnitNotActiveExitCode = 3
+
+const (
+	// systemdLoadStateProperty prefixes the load state reported by systemctl show
+	systemdLoadStateProperty = "LoadState="
+
+	// systemdUnitLoaded is the load state of a unit systemd manages
+	systemdUnitLoaded = "loaded"
+
+	// systemdUnitNotFound is the load state of a unit that does not exist
+	systemdUnitNotFound = "not-found"
+)
+
+// redactedValue replaces the value of a sensitive flag when a command is logged
+const redactedValue = "****"
+
+// sensitiveCommandFlags lists the flags, without leading dashes, whose values are redacted when a command is logged
+var sensitiveCommandFlags = []string{"password", "token", "secret", "code", "accesskey", "secretkey", "sessiontoken"}
+
+// redactCommand is the hook that renders a resolved command for logs and errors
+var redactCommand = redactSensitiveFlags
+
 // Installer represents Install shell script for linux
 var Installer string
 
@@ -252,114 +396,322 @@ var possiblyUsingSystemD = map[string]bool{
 
 // CreateInstanceContext create instance related information such as region, platform and arch
 func (util *Utility) CreateInstanceContext(log log.T) (context *InstanceContext, err error) {
+	log = util.operationLog(log)
 	region := ""
-	if region, err = getRegion(); region == "" {
+	if err = util.retryMetadataCall(log, "region", func() (lookupErr error) {
+		if region, lookupErr = util.instanceRegion(log); region == "" {
+			return fmt.Errorf("region is empty, %v", lookupErr)
+		}
+		return nil
+	}); err != nil {
 		return context, fmt.Errorf("Failed to get region, %v", err)
 	}
+	if err = ValidateRegion(region); err != nil {
+		return context, err
+	}
 	platformName := ""
 	platformVersion := ""
-	installerName := ""
-	if platformName, err = getPlatformName(log); err != nil {
+	if err = util.retryMetadataCall(log, "platform name", func() (lookupErr error) {
+		platformName, lookupErr = getPlatformName(log)
+		return lookupErr
+	}); err != nil {
 		return
 	}
-	// TODO: Change this structure to a switch and inject the platform name from another method.
 	platformName = strings.ToLower(platformName)
-	if strings.Contains(platformName, PlatformAmazonLinux) {
-		platformName = PlatformLinux
-		installerName = PlatformLinux
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformRedHat) {
-		platformName = PlatformRedHat
-		installerName = PlatformLinux
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformOracleLinux) {
-		platformName = PlatformOracleLinux
-		installerName = PlatformLinux
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformUbuntu) {
-		platformName = PlatformUbuntu
-		if isSnap, err := isAgentInstalledUsingSnap(log); err == nil && isSnap {
-			installerName = PlatformUbuntuSnap
-			Installer = SnapInstaller
-			UnInstaller = SnapUnInstaller
-		} else {
-			installerName = PlatformUbuntu
-			Installer = DebInstaller
-			UnInstaller = DebUnInstaller
+
+	// freebsd is identified by the operating system the agent is built for
+	if runtimeGOOS == PlatformFreeBSD {
+		platformName = PlatformFreeBSD
+	}
+
+	// snap and nano server cannot be identified by the platform name
+	if strings.Contains(platformName, PlatformUbuntu) {
+		if isSnapInstall(log) {
+			platformName = PlatformUbuntuSnap
+		}
+	} else if mappedName, _, _, _ := mapPlatform(platformName); mappedName == PlatformWindows {
+		if isNano, _ := platform.IsPlatformNanoServer(log); isNano {
+			//TODO move this logic to instance context
+			platformName = PlatformWindowsNano
 		}
-	} else if strings.Contains(platformName, PlatformCentOS) {
-		platformName = PlatformCentOS
-		installerName = PlatformLinux
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformSuseOS) {
-		platformName = PlatformSuseOS
-		installerName = PlatformLinux
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformRaspbian) {
-		platformName = PlatformRaspbian
-		installerName = PlatformUbuntu
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if strings.Contains(platformName, PlatformDebian) {
-		platformName = PlatformDebian
-		installerName = PlatformUbuntu
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else if isNano, _ := platform.IsPlatformNanoServer(log); isNano {
-		//TODO move this logic to instance context
-		platformName = PlatformWindowsNano
-		installerName = PlatformWindowsNano
-		Installer = InstallScript
-		UnInstaller = UninstallScript
-	} else {
-		platformName = PlatformWindows
-		installerName = PlatformWindows
-		Installer = InstallScript
-		UnInstaller = UninstallScript
 	}
 
-	if platformVersion, err = getPlatformVersion(log); err != nil {
+	if err = util.retryMetadataCall(log, "platform version", func() (lookupErr error) {
+		platformVersion, lookupErr = getPlatformVersion(log)
+		return lookupErr
+	}); err != nil {
 		return
 	}
-	context = &InstanceContext{
+
+	return NewInstanceContext(region, platformName, platformVersion, instanceArch(log))
+}
+
+// retryMetadataCall calls the instance metadata lookup until it succeeds or the retries are exhausted, the wait
+// doubles after each failed attempt and the errors of all the attempts are returned when the lookup does not succeed
+func (util *Utility) retryMetadataCall(log log.T, name string, lookup func() error) error {
+	retryCount := util.MetadataRetryCount
+	if retryCount == 0 {
+		retryCount = DefaultMetadataRetryCount
+	}
+	interval := util.MetadataRetryInterval
+	if interval == 0 {
+		interval = DefaultMetadataRetryInterval
+	}
+
+	var attemptErrors []string
+	for attempt := 0; ; attempt++ {
+		err := lookup()
+		if err == nil {
+			return nil
+		}
+		attemptErrors = append(attemptErrors, err.Error())
+		if attempt >= retryCount {
+			break
+		}
+		log.Debugf("Failed to get %v, retrying in %v, %v", name, interval, err)
+		metadataRetrySleep(interval)
+		interval *= 2
+	}
+	return fmt.Errorf("failed to get %v after %v attempts, %v", name, len(attemptErrors), strings.Join(attemptErrors, "; "))
+}
+
+// instanceArch returns the artifact arch of the instance, 32-bit arm is mapped to ArchArm or ArchArmHF
+func instanceArch(log log.T) string {
+	if runtimeGOARCH != ArchArm {
+		return runtimeGOARCH
+	}
+	machine, err := machineHardwareName()
+	if err != nil {
+		log.Debugf("failed to get the machine hardware name, using GOARM %v, %v", goarm, err)
+		machine = ""
+	}
+	return normalizeArmArch(machine, goarm)
+}
+
+// normalizeArmArch maps the machine hardware name, or the GOARM of the build when the machine is unknown,
+// to ArchArmHF for armv7 and later and to ArchArm otherwise
+func normalizeArmArch(machine string, goarm string) string {
+	machine = strings.ToLower(machine)
+	switch {
+	case strings.HasPrefix(machine, "armv7"), strings.HasPrefix(machine, "armv8"), machine == "aarch64":
+		// aarch64 hardware running a 32-bit agent is armv8 in aarch32 mode
+		return ArchArmHF
+	case strings.HasPrefix(machine, "arm"):
+		return ArchArm
+	}
+	if version, err := strconv.Atoi(goarm); err == nil && version >= 7 {
+		return ArchArmHF
+	}
+	return ArchArm
+}
+
+// NewInstanceContext creates the InstanceContext for the given platform without querying the instance,
+// the platform name is mapped to the platform and installer the same way as CreateInstanceContext
+func NewInstanceContext(region, platformName, platformVersion, arch string) (context *InstanceContext, err error) {
+	if region == "" {
+		return nil, fmt.Errorf("region cannot be empty")
+	}
+	if arch == "" {
+		return nil, fmt.Errorf("arch cannot be empty")
+	}
+
+	installerName := ""
+	platformName, installerName, Installer, UnInstaller = mapPlatform(strings.ToLower(platformName))
+	// amazon linux 2023 keeps the linux installer but is distinguished by its platform version
+	if platformName == PlatformLinux && isAmazonLinux2023(platformVersion) {
+		platformName = PlatformAmazonLinux2023
+	}
+	// windows reports edition and build strings that do not compare cleanly
+	if platformName == PlatformWindows || platformName == PlatformWindowsNano {
+		platformVersion = normalizeWindowsVersion(platformVersion)
+	}
+
+	return &InstanceContext{
 		Region:          region,
 		Platform:        platformName,
 		PlatformVersion: platformVersion,
 		InstallerName:   installerName,
-		Arch:            runtime.GOARCH,
+		Arch:            arch,
 		CompressFormat:  CompressFormat,
+	}, nil
+}
+
+// mapPlatform maps the platform name to the platform, installer name, install and uninstall scripts
+func mapPlatform(platformName string) (mappedName, installerName, installer, uninstaller string) {
+	// TODO: Change this structure to a switch and inject the platform name from another method.
+	if strings.Contains(platformName, PlatformAmazonLinux) {
+		return PlatformLinux, PlatformLinux, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformRedHat) {
+		return PlatformRedHat, PlatformLinux, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformOracleLinux) {
+		return PlatformOracleLinux, PlatformLinux, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformUbuntuSnap) {
+		return PlatformUbuntu, PlatformUbuntuSnap, SnapInstaller, SnapUnInstaller
+	} else if strings.Contains(platformName, PlatformUbuntu) {
+		return PlatformUbuntu, PlatformUbuntu, DebInstaller, DebUnInstaller
+	} else if strings.Contains(platformName, PlatformCentOS) {
+		return PlatformCentOS, PlatformLinux, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformSuseOS) {
+		return PlatformSuseOS, PlatformLinux, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformRaspbian) {
+		return PlatformRaspbian, PlatformUbuntu, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformDebian) {
+		return PlatformDebian, PlatformUbuntu, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformWindowsNano) {
+		return PlatformWindowsNano, PlatformWindowsNano, InstallScript, UninstallScript
+	} else if strings.Contains(platformName, PlatformFreeBSD) {
+		return PlatformFreeBSD, PlatformFreeBSD, InstallScript, UninstallScript
 	}
+	return PlatformWindows, PlatformWindows, InstallScript, UninstallScript
+}
+
+// isAmazonLinux2023 returns if the amazon linux platform version is a 2023 version, e.g. 2023 or 2023.0.20230315,
+// amazon linux 1 versions such as 2018.03 and amazon linux 2 versions such as 2 are not
+func isAmazonLinux2023(platformVersion string) bool {
+	majorVersion := strings.SplitN(strings.TrimSpace(platformVersion), ".", 2)[0]
+	return majorVersion == amazonLinux2023MajorVersion
+}
+
+// windowsVersionPattern matches the major.minor.build version of windows, e.g. 10.0.17763
+var windowsVersionPattern = regexp.MustCompile(`\d+\.\d+\.\d+`)
 
-	return context, nil
+// windowsBuildPattern matches the build number of windows, e.g. OS Build 17763.1039
+var windowsBuildPattern = regexp.MustCompile(`(?i)build\s+(\d+)`)
+
+// windowsServerEditionPattern matches the windows server editions, e.g. Windows Server 2012 R2 Datacenter
+var windowsServerEditionPattern = regexp.MustCompile(`(?i)server\s+(\d{4})(\s+r2)?`)
+
+// windowsServerEditionVersions maps the windows server editions to their major.minor.build version
+var windowsServerEditionVersions = map[string]string{
+	"2008":    "6.0.6003",
+	"2008 r2": "6.1.7601",
+	"2012":    "6.2.9200",
+	"2012 r2": "6.3.9600",
+	"2016":    "10.0.14393",
+	"2019":    "10.0.17763",
+	"2022":    "10.0.20348",
 }
 
-// isAgentInstalledUsingSnap returns if snap is used to install the snap
-func isAgentInstalledUsingSnap(log log.T) (result bool, err error) {
+// windowsBuildVersions maps the first build number of each windows release to its major.minor version,
+// in descending order of the builds
+var windowsBuildVersions = []struct {
+	build   int
+	version string
+}{
+	{10240, "10.0"},
+	{9600, "6.3"},
+	{9200, "6.2"},
+	{7600, "6.1"},
+	{6000, "6.0"},
+}
 
-	if _, commandErr := execCommand("snap", "services", "amazon-ssm-agent").Output(); commandErr != nil {
-		log.Debugf("Error checking 'snap services amazon-ssm-agent' - %v", commandErr)
-		return false, commandErr
+// normalizeWindowsVersion maps the windows version, build or edition string to the major.minor.build form that
+// VersionCompare orders correctly, e.g. 10.0.17763.1039, OS Build 17763.1039 and Windows Server 2019 Datacenter
+// all map to 10.0.17763. The version is returned unchanged when the string is not recognized.
+func normalizeWindowsVersion(platformVersion string) string {
+	platformVersion = strings.TrimSpace(platformVersion)
+	if version := windowsVersionPattern.FindString(platformVersion); version != "" {
+		return version
 	}
-	log.Debug("Agent is installed using snap")
-	return true, nil
+	if match := windowsBuildPattern.FindStringSubmatch(platformVersion); match != nil {
+		if build, err := strconv.Atoi(match[1]); err == nil {
+			for _, release := range windowsBuildVersions {
+				if build >= release.build {
+					return fmt.Sprintf("%v.%v", release.version, build)
+				}
+			}
+		}
+	}
+	if match := windowsServerEditionPattern.FindStringSubmatch(platformVersion); match != nil {
+		edition := match[1]
+		if match[2] != "" {
+			edition += " r2"
+		}
+		if version, ok := windowsServerEditionVersions[edition]; ok {
+			return version
+		}
+	}
+	return platformVersion
+}
+
+// snapAgentPath is the directory snapd mounts the revisions of the agent snap in
+var snapAgentPath = "/snap/amazon-ssm-agent"
+
+var isSnapInstall = IsSnapInstall
 
+// IsSnapInstall returns if the agent is managed by snap, the current revision under /snap is checked before
+// asking snap for the installed snaps
+func IsSnapInstall(log log.T) bool {
+	if _, err := statFile(filepath.Join(snapAgentPath, "current")); err == nil {
+		log.Debug("Agent is installed using snap")
+		return true
+	}
+	if _, commandErr := execCommand("snap", "list", "amazon-ssm-agent").Output(); commandErr != nil {
+		log.Debugf("Error checking 'snap list amazon-ssm-agent' - %v", commandErr)
+		return false
+	}
+	log.Debug("Agent is installed using snap")
+	return true
 }
 
 // CreateUpdateDownloadFolder creates folder for storing update downloads
 func (util *Utility) CreateUpdateDownloadFolder() (folder string, err error) {
-	root := filepath.Join(appconfig.DownloadRoot, "update")
-	if err = mkDirAll(root, os.ModePerm|os.ModeDir); err != nil {
+	root := filepath.Join(downloadRoot, "update")
+	if err = makeWritableDir(root, os.ModePerm|os.ModeDir); err != nil {
+		return "", err
+	}
+	// an existing folder is not created again, make sure the agent can write to it
+	if err = verifyWritableDir(root); err != nil {
 		return "", err
 	}
 
 	return root, nil
 }
 
+// CleanupDownloadFolder removes the folder of the update downloads, the folder must be the update download folder
+// created by CreateUpdateDownloadFolder or a folder under it, any other path is refused so a wrong path never
+// deletes an unrelated directory
+func CleanupDownloadFolder(log log.T, folder string) (err error) {
+	root := filepath.Join(downloadRoot, "update")
+	if !isUnderFolder(root, folder) {
+		return NewUpdateError(ErrorUnexpected, nil, "refusing to delete %v, it is not under the update download folder %v", folder, root)
+	}
+	// the folder may not exist, e.g. when the update failed before downloading
+	if _, err = os.Lstat(folder); os.IsNotExist(err) {
+		return nil
+	}
+	if err = os.RemoveAll(folder); err != nil {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "failed to delete update download folder %v", folder)
+	}
+	log.Debugf("Deleted update download folder %v", folder)
+	return nil
+}
+
+// isUnderFolder returns true if the path is the root folder or a path under it, the symbolic links of the
+// existing paths are resolved first so a link cannot point the path outside the root folder
+func isUnderFolder(root string, path string) bool {
+	var err error
+	if root, err = filepath.Abs(root); err != nil {
+		return false
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return false
+	}
+	if resolved, resolveErr := filepath.EvalSymlinks(root); resolveErr == nil {
+		root = resolved
+	}
+	// the last element is not resolved, RemoveAll deletes a link instead of its target
+	if resolved, resolveErr := filepath.EvalSymlinks(filepath.Dir(path)); resolveErr == nil {
+		path = filepath.Join(resolved, filepath.Base(path))
+	}
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return relative == "." || (relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)))
+}
+
 // ExeCommand executes shell command
 func (util *Utility) ExeCommand(
 	log log.T,
@@ -369,63 +721,253 @@ func (util *Utility) ExeCommand(
 	stdOut string,
 	stdErr string,
 	isAsync bool) (err error) {
+	log = util.operationLog(log)
 
-	parts := strings.Fields(cmd)
+	parts, parseErr := splitCommand(cmd)
+	if parseErr != nil {
+		return NewUpdateError(ErrorUnexpected, parseErr, "failed to parse command %v", cmd)
+	}
+	if len(parts) == 0 {
+		return NewUpdateError(ErrorUnexpected, nil, "command cannot be empty")
+	}
 
 	if isAsync {
+		commandLine := redactCommand(parts)
+		log.Debugf("Starting command %v", commandLine)
 		command := execCommand(parts[0], parts[1:]...)
 		command.Dir = workingDir
 		prepareProcess(command)
+		if err = setCommandUser(log, command, util.RunAsUser); err != nil {
+			return err
+		}
+		util.setCommandPath(log, command)
 		// Start command asynchronously
 		err = cmdStart(command)
 		if err != nil {
-			return
+			return errors.New(BuildMessage(err, "failed to start command %v", commandLine))
 		}
 	} else {
-		tempCmd := setPlatformSpecificCommand(parts)
-		command := execCommand(tempCmd[0], tempCmd[1:]...)
-		command.Dir = workingDir
-		stdoutWriter, stderrWriter, exeErr := setExeOutErr(outputRoot, stdOut, stdErr)
-		if exeErr != nil {
-			return exeErr
+		return util.runCommandWithOutputFiles(log, parts, workingDir, outputRoot, stdOut, stdErr, 0)
+	}
+	return nil
+}
+
+// ExeCommandWithTimeout runs the shell command like the synchronous ExeCommand, the command is killed when it
+// exceeds the timeout instead of the update execution timeout. The update execution timeout is used when timeout
+// is not positive.
+func (util *Utility) ExeCommandWithTimeout(
+	log log.T,
+	cmd string,
+	workingDir string,
+	outputRoot string,
+	stdOut string,
+	stdErr string,
+	timeout time.Duration) (err error) {
+	log = util.operationLog(log)
+
+	parts, parseErr := splitCommand(cmd)
+	if parseErr != nil {
+		return NewUpdateError(ErrorUnexpected, parseErr, "failed to parse command %v", cmd)
+	}
+	if len(parts) == 0 {
+		return NewUpdateError(ErrorUnexpected, nil, "command cannot be empty")
+	}
+	return util.runCommandWithOutputFiles(log, parts, workingDir, outputRoot, stdOut, stdErr, timeout)
+}
+
+// runCommandWithOutputFiles runs the command with runCommand and writes its output to the stdout and stderr files
+func (util *Utility) runCommandWithOutputFiles(
+	log log.T,
+	parts []string,
+	workingDir string,
+	outputRoot string,
+	stdOut string,
+	stdErr string,
+	timeout time.Duration) (err error) {
+	stdoutWriter, stderrWriter, exeErr := setExeOutErr(outputRoot, stdOut, stdErr)
+	if exeErr != nil {
+		return exeErr
+	}
+	defer stdoutWriter.Close()
+	defer stderrWriter.Close()
+
+	// a misbehaving command cannot fill the disk with its output
+	maxOutputSize := util.maxOutputSize()
+	return util.runCommand(log,
+		parts,
+		workingDir,
+		newLimitedWriter(stdoutWriter, maxOutputSize),
+		newLimitedWriter(stderrWriter, maxOutputSize),
+		timeout)
+}
+
+// ExeCommandWithWriters runs the shell command like the synchronous ExeCommand and streams its standard output and
+// standard error to the writers as the command runs, a nil writer discards the stream. Use io.MultiWriter to tee
+// the output to a file and the logger.
+func (util *Utility) ExeCommandWithWriters(
+	log log.T,
+	cmd string,
+	workingDir string,
+	stdout io.Writer,
+	stderr io.Writer) (err error) {
+	log = util.operationLog(log)
+
+	parts, parseErr := splitCommand(cmd)
+	if parseErr != nil {
+		return NewUpdateError(ErrorUnexpected, parseErr, "failed to parse command %v", cmd)
+	}
+	if len(parts) == 0 {
+		return NewUpdateError(ErrorUnexpected, nil, "command cannot be empty")
+	}
+	return util.runCommand(log, parts, workingDir, stdout, stderr, 0)
+}
+
+// runCommand runs the command with the platform specific shell and waits for it to exit, the command and its child
+// processes are killed when it exceeds the timeout, the update execution timeout is used when timeout is not positive
+func (util *Utility) runCommand(
+	log log.T,
+	parts []string,
+	workingDir string,
+	stdout io.Writer,
+	stderr io.Writer,
+	timeout time.Duration) (err error) {
+	tempCmd := setPlatformSpecificCommand(parts)
+	commandLine := redactCommand(tempCmd)
+	log.Debugf("Running command %v", commandLine)
+	command := execCommand(tempCmd[0], tempCmd[1:]...)
+	command.Dir = workingDir
+	if err = setCommandUser(log, command, util.RunAsUser); err != nil {
+		return err
+	}
+	util.setCommandPath(log, command)
+	if stdout != nil {
+		command.Stdout = stdout
+	}
+	if stderr != nil {
+		command.Stderr = stderr
+	}
+
+	prepareProcessTree(command)
+	err = cmdStart(command)
+	if err != nil {
+		return errors.New(BuildMessage(err, "failed to start command %v", commandLine))
+	}
+	tree := trackProcessTree(log, command)
+	defer tree.close(log)
+
+	if timeout <= 0 {
+		timeout = time.Duration(util.updateExecutionTimeout(log)) * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	go killProcessOnTimeout(log, command, tree, timer)
+	err = command.Wait()
+	timedOut := !timer.Stop()
+	if err != nil {
+		log.Debugf("command returned error %v", err)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			// The program has exited with an exit code != 0
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				exitCode := status.ExitStatus()
+				if exitCode == -1 && timedOut {
+					// set appropriate exit code based on cancel or timeout
+					exitCode = appconfig.CommandStoppedPreemptivelyExitCode
+					log.Infof("The execution of command was timedout.")
+				}
+				err = fmt.Errorf("The execution of command returned Exit Status: %d \n %v", exitCode, err.Error())
+			}
 		}
-		defer stdoutWriter.Close()
-		defer stderrWriter.Close()
+		return errors.New(BuildMessage(err, "command %v failed", commandLine))
+	}
+	return nil
+}
 
-		command.Stdout = stdoutWriter
-		command.Stderr = stderrWriter
+// redactSensitiveFlags joins the command arguments, the values of sensitiveCommandFlags are replaced with redactedValue
+// whether they are passed as "-flag value" or "-flag=value"
+func redactSensitiveFlags(parts []string) string {
+	redacted := make([]string, len(parts))
+	for i := 0; i < len(parts); i++ {
+		part := parts[i]
+		if !strings.HasPrefix(part, "-") {
+			redacted[i] = part
+			continue
+		}
 
-		err = cmdStart(command)
-		if err != nil {
-			return
+		name := strings.TrimLeft(part, "-")
+		if index := strings.Index(name, "="); index >= 0 {
+			if isSensitiveCommandFlag(name[:index]) {
+				part = part[:len(part)-len(name)+index+1] + redactedValue
+			}
+			redacted[i] = part
+			continue
 		}
 
-		var timeout = DefaultUpdateExecutionTimeoutInSeconds
-		if util.CustomUpdateExecutionTimeoutInSeconds != 0 {
-			timeout = util.CustomUpdateExecutionTimeoutInSeconds
+		redacted[i] = part
+		if isSensitiveCommandFlag(name) && i+1 < len(parts) {
+			i++
+			redacted[i] = redactedValue
 		}
-		timer := time.NewTimer(time.Duration(timeout) * time.Second)
-		go killProcessOnTimeout(log, command, timer)
-		err = command.Wait()
-		timedOut := !timer.Stop()
-		if err != nil {
-			log.Debugf("command returned error %v", err)
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				// The program has exited with an exit code != 0
-				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-					exitCode := status.ExitStatus()
-					if exitCode == -1 && timedOut {
-						// set appropriate exit code based on cancel or timeout
-						exitCode = appconfig.CommandStoppedPreemptivelyExitCode
-						log.Infof("The execution of command was timedout.")
-					}
-					err = fmt.Errorf("The execution of command returned Exit Status: %d \n %v", exitCode, err.Error())
-				}
+	}
+	return strings.Join(redacted, " ")
+}
+
+func isSensitiveCommandFlag(name string) bool {
+	for _, flag := range sensitiveCommandFlags {
+		if strings.EqualFold(name, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommand splits the command into arguments, arguments wrapped in single or double quotes are kept intact.
+// Backslash only escapes a double quote inside double quotes so windows paths are preserved.
+func splitCommand(cmd string) (parts []string, err error) {
+	parts = []string{}
+	var current strings.Builder
+	var quote rune
+	inArgument := false
+
+	runes := []rune(cmd)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
 			}
-			return err
+		case quote == '"':
+			if r == '\\' && i+1 < len(runes) && runes[i+1] == '"' {
+				current.WriteRune('"')
+				i++
+			} else if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArgument = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArgument {
+				parts = append(parts, current.String())
+				current.Reset()
+				inArgument = false
+			}
+		default:
+			current.WriteRune(r)
+			inArgument = true
 		}
 	}
-	return nil
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command %v", cmd)
+	}
+	if inArgument {
+		parts = append(parts, current.String())
+	}
+	return parts, nil
 }
 
 // TODO move to commandUtil
@@ -510,22 +1052,148 @@ func (util *Utility) NewExeCommandOutput(
 	return string(out), err
 }
 
+// setCommandPath replaces the PATH of the command environment with the sanitized PATH when UseSanitizedPath is set,
+// the command keeps the inherited environment otherwise
+func (util *Utility) setCommandPath(log log.T, command *exec.Cmd) {
+	if !util.UseSanitizedPath {
+		return
+	}
+
+	environment := command.Env
+	if environment == nil {
+		environment = os.Environ()
+	}
+	path := sanitizedPath()
+	sanitized := make([]string, 0, len(environment)+1)
+	for _, variable := range environment {
+		// environment variable names are case insensitive on windows
+		if !strings.HasPrefix(strings.ToUpper(variable), "PATH=") {
+			sanitized = append(sanitized, variable)
+		}
+	}
+	command.Env = append(sanitized, "PATH="+path)
+	log.Debugf("Running command with PATH %v", path)
+}
+
+// maxOutputSize returns the number of bytes written of each output stream of a command
+func (util *Utility) maxOutputSize() int64 {
+	if util.MaxOutputSize > 0 {
+		return util.MaxOutputSize
+	}
+	return DefaultMaxOutputSize
+}
+
+// updateExecutionTimeout returns the timeout of the update scripts in seconds, the custom timeout of the utility
+// takes precedence over the timeout of the appconfig, DefaultUpdateExecutionTimeoutInSeconds is used when neither is set
+func (util *Utility) updateExecutionTimeout(log log.T) int {
+	if util.CustomUpdateExecutionTimeoutInSeconds != 0 {
+		return util.CustomUpdateExecutionTimeoutInSeconds
+	}
+	if config, err := loadAppConfig(false); err != nil {
+		log.Debugf("failed to load appconfig, using the default update execution timeout, %v", err)
+	} else if config.Agent.UpdateExecutionTimeoutSeconds > 0 {
+		return config.Agent.UpdateExecutionTimeoutSeconds
+	}
+	return DefaultUpdateExecutionTimeoutInSeconds
+}
+
+// regionPattern matches the aws region names of all the partitions, e.g. us-east-1, us-gov-west-1 or cn-north-1
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// ValidateRegion returns an error when the region is not an aws region name, so a malformed region is reported
+// before it is used to build the download urls
+func ValidateRegion(region string) error {
+	if !regionPattern.MatchString(region) {
+		return fmt.Errorf("invalid region %q, a region such as us-east-1, us-gov-west-1 or cn-north-1 is expected", region)
+	}
+	return nil
+}
+
+// WaitForMetadataReady polls the region until the instance metadata returns one or the timeout elapses, updates
+// started right after boot can run before the network and the instance metadata service are up, so callers can
+// wait for it before CreateInstanceContext. An UpdateError with ErrorTimeout is returned when no region is returned in time
+func WaitForMetadataReady(log log.T, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		region, err := getRegion()
+		if strings.TrimSpace(region) != "" {
+			log.Debugf("Instance metadata is ready after %v attempts, region %v", attempt, region)
+			return nil
+		}
+		if time.Now().Add(metadataReadyPollInterval).After(deadline) {
+			return NewUpdateError(ErrorTimeout, err, "instance metadata is not ready after %v", timeout)
+		}
+		log.Debugf("Instance metadata is not ready on attempt %v, retrying in %v, %v", attempt, metadataReadyPollInterval, err)
+		metadataRetrySleep(metadataReadyPollInterval)
+	}
+}
+
+// instanceRegion returns the region of the instance, the region of the utility takes precedence over the region
+// of the appconfig, the region is looked up from the platform metadata when neither is set
+func (util *Utility) instanceRegion(log log.T) (string, error) {
+	if region := strings.TrimSpace(util.Region); region != "" {
+		log.Debugf("Using the region override %v", region)
+		return region, nil
+	}
+	if config, err := loadAppConfig(false); err != nil {
+		log.Debugf("failed to load appconfig, looking up the region from the platform, %v", err)
+	} else if region := strings.TrimSpace(config.Agent.Region); region != "" {
+		log.Debugf("Using the appconfig region %v", region)
+		return region, nil
+	}
+	return getRegion()
+}
+
 // IsServiceRunning returns is service running
 func (util *Utility) IsServiceRunning(log log.T, i *InstanceContext) (result bool, err error) {
+	return util.isServiceRunning(util.operationLog(log), i)
+}
+
+func (util *Utility) isServiceRunning(log log.T, i *InstanceContext) (result bool, err error) {
 	commandOutput := []byte{}
 	expectedOutput := ""
 	isSystemD := false
 
-	// isSystemD will always be false for Windows
-	if isSystemD, err = i.IsPlatformUsingSystemD(log); err != nil {
+	// freebsd uses the rc system which is queried through service
+	if i.Platform == PlatformFreeBSD {
+		return freeBSDServiceRunning()
+	}
+
+	// windows containers run the agent without the service control manager
+	if running, handled := platformServiceRunning(log, i); handled {
+		return running, nil
+	}
+
+	// the unit of the install is probed first, the unit of the other kind of install is the fallback
+	serviceName, fallbackServiceName := AgentServiceUnit(i, true), AgentSnapSystemdUnit
+	if serviceName == AgentSnapSystemdUnit {
+		fallbackServiceName = AgentSystemdUnit
+	}
+
+	// systemd is asked whether it manages the agent unit, the platform version is only a guess since the unit
+	// can be disabled and the agent run standalone. isSystemD will always be false for Windows
+	if unit, probed := systemdManagedUnit(log, serviceName, fallbackServiceName); probed {
+		isSystemD = unit != ""
+		serviceName, fallbackServiceName = unit, ""
+	} else if isSystemD, err = i.IsPlatformUsingSystemD(log); err != nil {
 		return false, err
 	}
 
 	if isSystemD {
 		expectedOutput = "Active: active (running)"
-		if commandOutput, err = execCommand("systemctl", "status", "amazon-ssm-agent.service").Output(); err != nil {
-			//test snap service enabled
-			if commandOutput, err = execCommand("systemctl", "status", "snap.amazon-ssm-agent.amazon-ssm-agent.service").Output(); err != nil {
+		if commandOutput, err = statusCommandOutput(execCommand("systemctl", "status", serviceName)); err != nil {
+			if stopped, statusErr := systemctlStatusError(log, serviceName, err); stopped || statusErr != nil {
+				return false, statusErr
+			}
+			// the probed unit has no other name
+			if fallbackServiceName == "" {
+				return false, err
+			}
+			//test the other service name
+			if commandOutput, err = statusCommandOutput(execCommand("systemctl", "status", fallbackServiceName)); err != nil {
+				if stopped, statusErr := systemctlStatusError(log, fallbackServiceName, err); stopped || statusErr != nil {
+					return false, statusErr
+				}
 				return false, err
 			}
 		}
@@ -544,43 +1212,262 @@ func (util *Utility) IsServiceRunning(log log.T, i *InstanceContext) (result boo
 	return false, nil
 }
 
+// statusCommandOutput runs the status command and returns its output, the command is killed when it does not complete
+// within serviceStatusTimeout and an UpdateError with ErrorTimeout is returned so a hung service manager cannot
+// block the updater
+func statusCommandOutput(command *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	command.Stdout = &stdout
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- command.Wait() }()
+	select {
+	case err := <-done:
+		return stdout.Bytes(), err
+	case <-time.After(serviceStatusTimeout):
+		// the output is not returned since Wait may still be copying it
+		command.Process.Kill()
+		return nil, NewUpdateError(ErrorTimeout, nil,
+			"%v did not complete within %v", strings.Join(command.Args, " "), serviceStatusTimeout)
+	}
+}
+
+// systemdManagedUnit returns the first of the units that is loaded by systemd, unit is empty when systemd manages
+// none of them. probed is false when systemctl cannot be run or its output is not understood, the caller falls
+// back to the platform version then
+func systemdManagedUnit(log log.T, serviceNames ...string) (unit string, probed bool) {
+	if runtimeGOOS != PlatformLinux {
+		return "", false
+	}
+	for _, serviceName := range serviceNames {
+		output, err := statusCommandOutput(execCommand("systemctl", "show", serviceName, "--property=LoadState"))
+		if err != nil {
+			log.Debugf("failed to probe the systemd unit %v, %v", serviceName, err)
+			return "", false
+		}
+		loadState := strings.TrimSpace(string(output))
+		if !strings.HasPrefix(loadState, systemdLoadStateProperty) {
+			log.Debugf("unexpected systemd load state of %v, %v", serviceName, loadState)
+			return "", false
+		}
+		if strings.TrimPrefix(loadState, systemdLoadStateProperty) == systemdUnitLoaded {
+			log.Debugf("%v is managed by systemd", serviceName)
+			return serviceName, true
+		}
+	}
+	log.Debugf("the agent is not managed by systemd")
+	return "", true
+}
+
+// systemctlStatusError classifies the error of systemctl status, stopped is true when systemctl reports the unit
+// is not running and an UpdateError with ErrorEnvironmentIssue is returned when systemctl is not installed so
+// callers can fall back to another init system, a timed out status is returned as it is. Before systemd v231 the
+// status of a missing unit exits with the code of a stopped one, the load state tells them apart.
+func systemctlStatusError(log log.T, serviceName string, err error) (stopped bool, statusErr error) {
+	if GetErrorCode(err) == ErrorTimeout {
+		return false, err
+	}
+	if isExecutableNotFound(err) {
+		return false, NewUpdateError(ErrorEnvironmentIssue, err, "systemctl cannot be found")
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == systemctlUnitNotActiveExitCode {
+		output, showErr := statusCommandOutput(execCommand("systemctl", "show", serviceName, "--property=LoadState"))
+		if showErr == nil && strings.TrimPrefix(strings.TrimSpace(string(output)), systemdLoadStateProperty) == systemdUnitNotFound {
+			log.Debugf("%v does not exist", serviceName)
+			return false, nil
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// isExecutableNotFound returns if the command failed because its executable does not exist
+func isExecutableNotFound(err error) bool {
+	switch typedErr := err.(type) {
+	case *exec.Error:
+		return typedErr.Err == exec.ErrNotFound || os.IsNotExist(typedErr.Err)
+	case *os.PathError:
+		return os.IsNotExist(typedErr.Err)
+	}
+	return strings.Contains(err.Error(), "executable file not found")
+}
+
+// freeBSDServiceRunning returns if the amazon-ssm-agent rc service is running, the service status command
+// exits with a non-zero code when the service is not running
+func freeBSDServiceRunning() (result bool, err error) {
+	commandOutput, err := statusCommandOutput(execCommand("service", AgentServiceName, "status"))
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return false, err
+		}
+	}
+	return isRcServiceRunning(string(commandOutput)), nil
+}
+
+// isRcServiceRunning parses the rc service status output, e.g. "amazon_ssm_agent is running as pid 1234."
+// or "amazon_ssm_agent is not running."
+func isRcServiceRunning(statusOutput string) bool {
+	return strings.Contains(statusOutput, " is running")
+}
+
 // WaitForServiceToStart wait for service to start and returns is service started
 func (util *Utility) WaitForServiceToStart(log log.T, i *InstanceContext) (result bool, err error) {
+	log = util.operationLog(log)
 	isRunning := false
 	for attempt := 0; attempt < verifyAttemptCount; attempt++ {
 		if attempt > 0 {
 			log.Infof("Retrying update health check %v out of %v", attempt+1, verifyAttemptCount)
 			time.Sleep(time.Duration(verifyRetryIntervalMilliseconds) * time.Millisecond)
 		}
-		if isRunning, err = util.IsServiceRunning(log, i); err == nil && isRunning {
+		if isRunning, err = util.isServiceRunning(log, i); err == nil && isRunning {
 			return true, nil
 		}
 	}
 	return false, err
 }
 
+// WaitForServiceRunning polls IsServiceRunning every interval until the service is running or the timeout elapses
+func (util *Utility) WaitForServiceRunning(log log.T, i *InstanceContext, timeout time.Duration, interval time.Duration) (result bool, err error) {
+	log = util.operationLog(log)
+	return waitForServiceRunning(log, util.isServiceRunning, i, timeout, interval)
+}
+
+func waitForServiceRunning(log log.T,
+	isServiceRunning func(log log.T, i *InstanceContext) (bool, error),
+	i *InstanceContext,
+	timeout time.Duration,
+	interval time.Duration) (result bool, err error) {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		if result, err = isServiceRunning(log, i); err == nil && result {
+			return true, nil
+		}
+		if err != nil {
+			log.Debugf("Service status check attempt %v failed, %v", attempt, err)
+		}
+		wait := jitteredInterval(interval)
+		if time.Now().Add(wait).After(deadline) {
+			break
+		}
+		time.Sleep(wait)
+	}
+
+	if err != nil {
+		return false, NewUpdateError(ErrorCannotStartService, err, "service is not running after %v", timeout)
+	}
+	return false, NewUpdateError(ErrorTimeout, nil, "service is not running after %v", timeout)
+}
+
+// jitteredInterval returns the interval randomly adjusted by up to serviceRunningPollJitter in either direction
+func jitteredInterval(interval time.Duration) time.Duration {
+	pollJitterLock.Lock()
+	factor := pollJitterRand.Float64()*2 - 1
+	pollJitterLock.Unlock()
+	return interval + time.Duration(factor*serviceRunningPollJitter*float64(interval))
+}
+
 // IsDiskSpaceSufficientForUpdate loads disk space info and checks the available bytes
-// Returns true if the system has at least 100 Mb for available disk space or false if it is less than 100 Mb
-func (util *Utility) IsDiskSpaceSufficientForUpdate(log log.T) (bool, error) {
+// Returns true if the system has at least the artifact size plus 100 Mb for available disk space, the artifact size
+// is 0 when it is not known before the download
+// Returns an UpdateError with ErrorEnvironmentIssue if the disk space info cannot be loaded
+func (util *Utility) IsDiskSpaceSufficientForUpdate(log log.T, artifactSize int64) (bool, error) {
+	log = util.operationLog(log)
 	var diskSpaceInfo fileutil.DiskSpaceInfo
 	var err error
 
 	// Get the available disk space
 	if diskSpaceInfo, err = getDiskSpaceInfo(); err != nil {
 		log.Infof("Failed to load disk space info - %v", err)
-		return false, err
+		return false, NewUpdateError(ErrorEnvironmentIssue, err, "failed to load disk space info")
 	}
 
-	// Return false if available disk space is less than 100 Mb
-	if diskSpaceInfo.AvailBytes < MinimumDiskSpaceForUpdate {
-		log.Infof("Insufficient available disk space - %d Mb", diskSpaceInfo.AvailBytes/int64(1024*1024))
+	return isDiskSpaceSufficient(log, diskSpaceInfo, artifactSize), nil
+}
+
+// IsDiskSpaceSufficientForUpdateInFolder checks the available bytes of the filesystem the folder is on like
+// IsDiskSpaceSufficientForUpdate, so a full root volume does not fail the update when the folder lives on another
+// mount. The closest existing parent is checked when the folder is not created yet.
+// Returns an UpdateError with ErrorEnvironmentIssue if the disk space info cannot be loaded
+func (util *Utility) IsDiskSpaceSufficientForUpdateInFolder(log log.T, folder string, artifactSize int64) (bool, error) {
+	log = util.operationLog(log)
+	var diskSpaceInfo fileutil.DiskSpaceInfo
+	var err error
+
+	path := closestExistingPath(folder)
+	if diskSpaceInfo, err = getDiskSpaceInfoForPath(path); err != nil {
+		log.Infof("Failed to load disk space info of %v - %v", path, err)
+		return false, NewUpdateError(ErrorEnvironmentIssue, err, "failed to load disk space info of %v", path)
+	}
+
+	return isDiskSpaceSufficient(log, diskSpaceInfo, artifactSize), nil
+}
+
+// isDiskSpaceSufficient returns false if available disk space is less than the artifact size plus 100 Mb
+func isDiskSpaceSufficient(log log.T, diskSpaceInfo fileutil.DiskSpaceInfo, artifactSize int64) bool {
+	requiredBytes := MinimumDiskSpaceForUpdate
+	if artifactSize > 0 {
+		requiredBytes += artifactSize
+	}
+	if diskSpaceInfo.AvailBytes < requiredBytes {
+		log.Infof("Insufficient available disk space - %d Mb, %d Mb is required",
+			diskSpaceInfo.AvailBytes/int64(1024*1024),
+			requiredBytes/int64(1024*1024))
+		return false
+	}
+
+	return true
+}
+
+// IsMemorySufficientForUpdate loads the available memory of the instance and checks it against requiredBytes, so an
+// update on a tiny instance fails before the extraction and the install run out of memory. The minimum memory of the
+// utility is required when requiredBytes is not positive.
+// Returns an UpdateError with ErrorEnvironmentIssue if the available memory cannot be loaded
+func (util *Utility) IsMemorySufficientForUpdate(log log.T, requiredBytes int64) (bool, error) {
+	log = util.operationLog(log)
+	if requiredBytes <= 0 {
+		requiredBytes = util.minimumMemoryForUpdate()
+	}
+
+	availableBytes, err := getAvailableMemory()
+	if err != nil {
+		log.Infof("Failed to load available memory - %v", err)
+		return false, NewUpdateError(ErrorEnvironmentIssue, err, "failed to load available memory")
+	}
+	if availableBytes < requiredBytes {
+		log.Infof("Insufficient available memory - %d Mb, %d Mb is required",
+			availableBytes/int64(1024*1024),
+			requiredBytes/int64(1024*1024))
 		return false, nil
 	}
 
-	// Return true otherwise
 	return true, nil
 }
 
+func (util *Utility) minimumMemoryForUpdate() int64 {
+	if util.MinimumMemoryForUpdate > 0 {
+		return util.MinimumMemoryForUpdate
+	}
+	return DefaultMinimumMemoryForUpdate
+}
+
+// closestExistingPath returns the path or its closest parent which exists
+func closestExistingPath(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
 // IsPlatformUsingSystemD returns if SystemD is the default Init for the Linux platform
 func (i *InstanceContext) IsPlatformUsingSystemD(log log.T) (result bool, err error) {
 	compareResult := 0
@@ -597,7 +1484,7 @@ func (i *InstanceContext) IsPlatformUsingSystemD(log log.T) (result bool, err er
 		}
 	} else if _, ok := possiblyUsingSystemD[i.Platform]; ok {
 		// attempt to execute 'systemctl --version' to verify systemd
-		if _, commandErr := execCommand("systemctl", "--version").Output(); commandErr != nil {
+		if _, commandErr := statusCommandOutput(execCommand("systemctl", "--version")); commandErr != nil {
 			return false, nil
 		}
 
@@ -616,19 +1503,90 @@ func getMinimumVersionForSystemD() (systemDMap *map[string]string) {
 		isUsingSystemD[PlatformUbuntu] = "15"
 		isUsingSystemD[PlatformSuseOS] = "12"
 		isUsingSystemD[PlatformDebian] = "8"
+		isUsingSystemD[PlatformAmazonLinux2023] = amazonLinux2023MajorVersion
 	})
 	return &isUsingSystemD
 }
 
 // FileName generates downloadable file name base on agreed convension
 func (i *InstanceContext) FileName(packageName string) string {
-	fileName := "{PackageName}-{Platform}-{Arch}.{Compressed}"
-	fileName = strings.Replace(fileName, PackageNameHolder, packageName, -1)
-	fileName = strings.Replace(fileName, PlatformHolder, i.InstallerName, -1)
-	fileName = strings.Replace(fileName, ArchHolder, i.Arch, -1)
-	fileName = strings.Replace(fileName, CompressedHolder, i.CompressFormat, -1)
+	return i.FileNameWithTemplate(DefaultFileNameTemplate, packageName)
+}
+
+// FileNameWithTemplate generates the downloadable file name of the package with the file name template of the
+// package, DefaultFileNameTemplate is used when the template is empty
+func (i *InstanceContext) FileNameWithTemplate(template string, packageName string) string {
+	if template == "" {
+		template = DefaultFileNameTemplate
+	}
+	return FileNameFromTemplate(template, i.InstallerName, i.Arch, i.CompressFormat, packageName)
+}
+
+// FileNameFor generates the downloadable file name of the package for the installer, arch and compress format,
+// so the artifacts of other platforms can be named without an instance context
+func FileNameFor(installerName string, arch string, compressFormat string, packageName string) string {
+	return FileNameFromTemplate(DefaultFileNameTemplate, installerName, arch, compressFormat, packageName)
+}
+
+// FileNameFromTemplate replaces the placeholders of the file name template with the package name, installer name,
+// arch and compress format, the template is expected to be validated with ValidateFileNameTemplate
+func FileNameFromTemplate(template string, installerName string, arch string, compressFormat string, packageName string) string {
+	return strings.NewReplacer(
+		PackageNameHolder, packageName,
+		PlatformHolder, installerName,
+		ArchHolder, arch,
+		CompressedHolder, compressFormat,
+	).Replace(template)
+}
+
+// fileNamePlaceholderPattern matches the placeholders of a file name template, e.g. {Arch}
+var fileNamePlaceholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// fileNamePlaceholders are the placeholders FileNameFromTemplate replaces
+var fileNamePlaceholders = map[string]bool{
+	PackageNameHolder: true,
+	PlatformHolder:    true,
+	ArchHolder:        true,
+	CompressedHolder:  true,
+}
+
+// ValidateFileNameTemplate returns an error when the file name template is empty, contains placeholders other than
+// {PackageName}, {Platform}, {Arch} and {Compressed} or contains unbalanced braces
+func ValidateFileNameTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("file name template cannot be empty")
+	}
+	unknown := []string{}
+	for _, placeholder := range fileNamePlaceholderPattern.FindAllString(template, -1) {
+		if !fileNamePlaceholders[placeholder] {
+			unknown = append(unknown, placeholder)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("file name template %v contains unknown placeholders %v", template, strings.Join(unknown, ", "))
+	}
+	if strings.ContainsAny(fileNamePlaceholderPattern.ReplaceAllString(template, ""), "{}") {
+		return fmt.Errorf("file name template %v contains unbalanced braces", template)
+	}
+	return nil
+}
 
-	return fileName
+// BuildDownloadURL replaces the placeholders of the url template with the values of the instance context, package
+// name and version. {FileName} is the FileName of the package and {Platform} is the installer name the same way
+// as in FileName, placeholders missing from the template are ignored. {DomainSuffix} and the amazonaws.com domain
+// of the url host are replaced with the endpoint domain suffix of the partition of the region.
+func BuildDownloadURL(template string, context *InstanceContext, packageName string, version string) string {
+	downloadURL := strings.NewReplacer(
+		RegionHolder, context.Region,
+		DomainSuffixHolder, DomainSuffix(context.Region),
+		PackageNameHolder, packageName,
+		PackageVersionHolder, version,
+		FileNameHolder, context.FileName(packageName),
+		PlatformHolder, context.InstallerName,
+		ArchHolder, context.Arch,
+		CompressedHolder, context.CompressFormat,
+	).Replace(template)
+	return withPartitionDomainSuffix(downloadURL, context.Region)
 }
 
 // BuildMessage builds the messages with provided format, error and arguments
@@ -717,12 +1675,12 @@ func UnInstallerFilePath(updateRoot string, packageName string, version string)
 	return filepath.Join(UpdateArtifactFolder(updateRoot, packageName, version), UnInstaller)
 }
 
-func killProcessOnTimeout(log log.T, command *exec.Cmd, timer *time.Timer) {
+func killProcessOnTimeout(log log.T, command *exec.Cmd, tree *processTree, timer *time.Timer) {
 	<-timer.C
 	log.Debug("Process exceeded timeout. Attempting to kill process!")
 
-	// task has been exceeded the allowed execution timeout, kill process
-	if err := command.Process.Kill(); err != nil {
+	// task has been exceeded the allowed execution timeout, kill process and its children
+	if err := tree.kill(log, command); err != nil {
 		log.Error(err)
 		return
 	}
@@ -736,7 +1694,7 @@ func setExeOutErr(
 	stdOutFileName string,
 	stdErrFileName string) (stdoutWriter *os.File, stderrWriter *os.File, err error) {
 
-	if err = mkDirAll(UpdateOutputDirectory(updaterRoot), appconfig.ReadWriteExecuteAccess); err != nil {
+	if err = makeWritableDir(UpdateOutputDirectory(updaterRoot), appconfig.ReadWriteExecuteAccess); err != nil {
 		return
 	}
 
@@ -758,6 +1716,77 @@ func setExeOutErr(
 	return stdoutWriter, stderrWriter, nil
 }
 
+// makeWritableDir creates the directory with mkDirAll, a read-only file system, a symlink loop or dangling symlink
+// and a denied permission are reported as an UpdateError with ErrorEnvironmentIssue since the update cannot proceed
+// until the environment is fixed
+func makeWritableDir(dir string, perm os.FileMode) (err error) {
+	if err = mkDirAll(dir, perm); err == nil {
+		return nil
+	}
+	switch {
+	case isReadOnlyFileSystem(err):
+		return NewUpdateError(ErrorEnvironmentIssue, err,
+			"cannot create %v, the file system is read-only, mount a writable file system at %v to use it as the download root",
+			dir, dir)
+	case isSymlinkLoop(dir):
+		// mkdir reports a symlink loop as an existing file
+		return NewUpdateError(ErrorEnvironmentIssue, err,
+			"cannot create %v, the path contains a symlink loop, fix the symlinks of %v", dir, dir)
+	case isDanglingSymlink(dir):
+		return NewUpdateError(ErrorEnvironmentIssue, err,
+			"cannot create %v, it is a symlink to a location that does not exist", dir)
+	case os.IsPermission(err):
+		return NewUpdateError(ErrorEnvironmentIssue, err,
+			"cannot create %v, permission denied, %v or one of its parents is not writable by the agent user", dir, dir)
+	}
+	return err
+}
+
+// verifyWritableDir creates and removes a file in dir, an UpdateError with ErrorEnvironmentIssue is returned when
+// the folder is owned by another user or its permissions do not allow the agent to write to it
+func verifyWritableDir(dir string) error {
+	probePath := filepath.Join(dir, ".writable")
+	probe, err := openFile(probePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, appconfig.ReadWriteAccess)
+	if err != nil {
+		if os.IsPermission(err) || isReadOnlyFileSystem(err) {
+			return NewUpdateError(ErrorEnvironmentIssue, err,
+				"%v is not writable, make sure it is owned by the user the agent runs as", dir)
+		}
+		return err
+	}
+	probe.Close()
+	return os.Remove(probePath)
+}
+
+// isSymlinkLoop returns if resolving the path runs into a symlink loop
+func isSymlinkLoop(path string) bool {
+	_, err := os.Stat(path)
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	return err == syscall.ELOOP
+}
+
+// isDanglingSymlink returns if the path is a symlink to a location that does not exist
+func isDanglingSymlink(path string) bool {
+	if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// isReadOnlyFileSystem returns if the file system error was caused by a read-only file system
+func isReadOnlyFileSystem(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	return err == syscall.EROFS
+}
+
 func CompareVersion(versionOne string, versionTwo string) (int, error) {
 	majorOne, minorOne, buildOne, patchOne, err := parseVersion(versionOne)
 	if err != nil {
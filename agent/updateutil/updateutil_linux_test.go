@@ -0,0 +1,144 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build linux
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExeCommandRunsAsUser(t *testing.T) {
+	defer func() {
+		lookupUser = user.Lookup
+		execCommand = exec.Command
+		cmdStart = (*exec.Cmd).Start
+	}()
+	lookupUser = func(name string) (*user.User, error) {
+		return &user.User{Username: name, Uid: "1001", Gid: "1002"}, nil
+	}
+	execCommand = fakeExecCommand
+	var started *exec.Cmd
+	cmdStart = func(command *exec.Cmd) error {
+		started = command
+		return nil
+	}
+
+	util := Utility{RunAsUser: "ssm-user"}
+	err := util.ExeCommand(logger, "update", "temp", appconfig.UpdaterArtifactsRoot, "stdout", "stderr", true)
+	assert.NoError(t, err)
+
+	assert.NotNil(t, started)
+	assert.NotNil(t, started.SysProcAttr.Credential)
+	assert.Equal(t, uint32(1001), started.SysProcAttr.Credential.Uid)
+	assert.Equal(t, uint32(1002), started.SysProcAttr.Credential.Gid)
+	// the process group setting of async commands is kept
+	assert.True(t, started.SysProcAttr.Setpgid)
+}
+
+func TestExeCommandWithInvalidUser(t *testing.T) {
+	defer func() {
+		lookupUser = user.Lookup
+		execCommand = exec.Command
+		cmdStart = (*exec.Cmd).Start
+	}()
+	lookupUser = func(name string) (*user.User, error) {
+		return nil, user.UnknownUserError(name)
+	}
+	execCommand = fakeExecCommand
+	cmdStart = func(command *exec.Cmd) error {
+		return fmt.Errorf("command should not be started")
+	}
+
+	util := Utility{RunAsUser: "missing-user"}
+	for _, isAsync := range []bool{true, false} {
+		err := util.ExeCommand(logger, "update", "temp", appconfig.UpdaterArtifactsRoot, "stdout", "stderr", isAsync)
+		assert.Error(t, err)
+		assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+		assert.Contains(t, err.Error(), "missing-user")
+	}
+}
+
+func TestExeCommandWithoutUser(t *testing.T) {
+	defer func() {
+		execCommand = exec.Command
+		cmdStart = (*exec.Cmd).Start
+	}()
+	execCommand = fakeExecCommand
+	var started *exec.Cmd
+	cmdStart = func(command *exec.Cmd) error {
+		started = command
+		return nil
+	}
+
+	util := Utility{}
+	assert.NoError(t, util.ExeCommand(logger, "update", "temp", appconfig.UpdaterArtifactsRoot, "stdout", "stderr", true))
+	assert.Nil(t, started.SysProcAttr.Credential)
+}
+
+func TestParseAvailableMemory(t *testing.T) {
+	available, err := parseAvailableMemory(strings.NewReader(
+		"MemTotal:        1009180 kB\nMemFree:          110880 kB\nMemAvailable:     625472 kB\nBuffers:           31860 kB\nCached:           521304 kB\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(625472*1024), available)
+
+	// kernels older than 3.14 do not report MemAvailable
+	available, err = parseAvailableMemory(strings.NewReader(
+		"MemTotal:        1009180 kB\nMemFree:          110880 kB\nBuffers:           31860 kB\nCached:           521304 kB\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64((110880+31860+521304)*1024), available)
+
+	_, err = parseAvailableMemory(strings.NewReader("MemTotal:        1009180 kB\n"))
+	assert.Error(t, err)
+}
+
+func TestAvailableMemory(t *testing.T) {
+	available, err := availableMemory()
+	assert.NoError(t, err)
+	assert.True(t, available > 0)
+}
+
+func TestRunningAgentExecutable(t *testing.T) {
+	root, err := ioutil.TempDir("", "proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	procRoot = root
+	defer func() { procRoot = "/proc" }()
+	context := &InstanceContext{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "amd64", "tar.gz"}
+
+	// no agent process is running
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "1"), appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, os.Symlink("/usr/lib/systemd/systemd", filepath.Join(root, "1", "exe")))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "self"), appconfig.ReadWriteExecuteAccess))
+	_, err = runningAgentExecutable(logger, context)
+	assert.Error(t, err)
+
+	// the agent process runs a binary replaced on disk
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "42"), appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, os.Symlink("/usr/bin/amazon-ssm-agent (deleted)", filepath.Join(root, "42", "exe")))
+	executable, err := runningAgentExecutable(logger, context)
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin/amazon-ssm-agent (deleted)", executable)
+}
@@ -15,10 +15,17 @@
 package updateutil
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -106,6 +113,8 @@ func TestCreateInstanceContext(t *testing.T) {
 	getRegion = RegionStub
 	getPlatformName = PlatformNameStub
 	getPlatformVersion = PlatformVersionStub
+	metadataRetrySleep = func(time.Duration) {}
+	defer func() { metadataRetrySleep = time.Sleep }()
 	util := Utility{}
 
 	for _, test := range testCases {
@@ -124,6 +133,242 @@ func TestCreateInstanceContext(t *testing.T) {
 	}
 }
 
+func TestNewInstanceContextMatchesCreateInstanceContext(t *testing.T) {
+	platformNames := []string{
+		"Amazon Linux AMI",
+		"CentOS Linux",
+		"SLES",
+		"Red Hat Enterprise Linux Server",
+		"Oracle Linux Server",
+		"Ubuntu",
+		"Raspbian GNU/Linux",
+		"Debian GNU/Linux",
+		"Microsoft Windows Server 2016 Datacenter",
+	}
+
+	getRegion = RegionStub
+	getPlatformName = PlatformNameStub
+	getPlatformVersion = PlatformVersionStub
+	// agent is not installed using snap
+	execCommand = missingExecCommand
+	defer func() { execCommand = exec.Command }()
+	util := Utility{}
+
+	for _, platformName := range platformNames {
+		context = testInstanceContext{region: "us-west-2", platformName: platformName, platformVersion: "1.0"}
+
+		created, err := util.CreateInstanceContext(logger)
+		assert.NoError(t, err)
+		createdInstaller, createdUnInstaller := Installer, UnInstaller
+
+		constructed, err := NewInstanceContext("us-west-2", platformName, "1.0", runtime.GOARCH)
+		assert.NoError(t, err)
+		assert.Equal(t, created, constructed, platformName)
+		assert.Equal(t, createdInstaller, Installer, platformName)
+		assert.Equal(t, createdUnInstaller, UnInstaller, platformName)
+	}
+}
+
+func TestCreateInstanceContextForFreeBSD(t *testing.T) {
+	getRegion = func() (string, error) { return "us-east-1", nil }
+	getPlatformName = func(log log.T) (string, error) { return "FreeBSD", nil }
+	getPlatformVersion = func(log log.T) (string, error) { return "12.1-RELEASE", nil }
+	runtimeGOOS = PlatformFreeBSD
+	defer func() {
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+		getPlatformVersion = PlatformVersionStub
+		runtimeGOOS = runtime.GOOS
+	}()
+
+	util := Utility{}
+	context, err := util.CreateInstanceContext(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, PlatformFreeBSD, context.Platform)
+	assert.Equal(t, PlatformFreeBSD, context.InstallerName)
+	assert.Equal(t, "12.1-RELEASE", context.PlatformVersion)
+	assert.Equal(t, InstallScript, Installer)
+	assert.Equal(t, UninstallScript, UnInstaller)
+
+	isSystemD, err := context.IsPlatformUsingSystemD(logger)
+	assert.NoError(t, err)
+	assert.False(t, isSystemD)
+
+	// the operating system wins over an unrecognized platform name
+	getPlatformName = func(log log.T) (string, error) { return "unknown", nil }
+	context, err = util.CreateInstanceContext(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, PlatformFreeBSD, context.Platform)
+}
+
+func TestNormalizeArmArch(t *testing.T) {
+	testCases := []struct {
+		machine  string
+		goarm    string
+		expected string
+	}{
+		{"armv7l", "", ArchArmHF},
+		{"armv7l", "6", ArchArmHF},
+		{"armv8l", "", ArchArmHF},
+		{"aarch64", "", ArchArmHF},
+		{"armv6l", "", ArchArm},
+		{"armv6l", "7", ArchArm},
+		{"armv5tel", "", ArchArm},
+		// the machine is unknown, GOARM of the build decides
+		{"", "7", ArchArmHF},
+		{"", "6", ArchArm},
+		{"", "", ArchArm},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, normalizeArmArch(test.machine, test.goarm), "%v GOARM=%v", test.machine, test.goarm)
+	}
+}
+
+func TestCreateInstanceContextForArm(t *testing.T) {
+	getRegion = func() (string, error) { return "us-east-1", nil }
+	getPlatformName = func(log log.T) (string, error) { return "Raspbian GNU/Linux", nil }
+	getPlatformVersion = func(log log.T) (string, error) { return "10", nil }
+	defer func() {
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+		getPlatformVersion = PlatformVersionStub
+		runtimeGOARCH = runtime.GOARCH
+		machineHardwareName = func() (string, error) {
+			output, err := execCommand("uname", "-m").Output()
+			return strings.TrimSpace(string(output)), err
+		}
+	}()
+
+	testCases := []struct {
+		goarch       string
+		machine      string
+		machineErr   error
+		expectedFile string
+	}{
+		{"arm", "armv7l", nil, "amazon-ssm-agent-ubuntu-armhf." + CompressFormat},
+		{"arm", "armv6l", nil, "amazon-ssm-agent-ubuntu-arm." + CompressFormat},
+		{"arm", "", fmt.Errorf("uname failed"), "amazon-ssm-agent-ubuntu-arm." + CompressFormat},
+		// other archs are passed through without querying the machine
+		{"arm64", "", fmt.Errorf("uname should not be called"), "amazon-ssm-agent-ubuntu-arm64." + CompressFormat},
+		{"amd64", "", fmt.Errorf("uname should not be called"), "amazon-ssm-agent-ubuntu-amd64." + CompressFormat},
+	}
+
+	util := Utility{}
+	for _, test := range testCases {
+		runtimeGOARCH = test.goarch
+		machine, machineErr := test.machine, test.machineErr
+		machineHardwareName = func() (string, error) { return machine, machineErr }
+
+		context, err := util.CreateInstanceContext(logger)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedFile, context.FileName("amazon-ssm-agent"), test.machine)
+	}
+}
+
+func TestNewInstanceContextForAmazonLinux(t *testing.T) {
+	testCases := []struct {
+		platformName     string
+		platformVersion  string
+		expectedPlatform string
+		isUsingSystemD   bool
+	}{
+		// amazon linux 1
+		{"Amazon Linux AMI", "2018.03", PlatformLinux, false},
+		// amazon linux 2
+		{"Amazon Linux", "2", PlatformLinux, false},
+		// amazon linux 2023
+		{"Amazon Linux", "2023", PlatformAmazonLinux2023, true},
+		{"Amazon Linux", "2023.0.20230315", PlatformAmazonLinux2023, true},
+	}
+
+	// systemctl is not available, only the registered systemd platforms use systemd
+	execCommand = missingExecCommand
+	defer func() { execCommand = exec.Command }()
+
+	for _, test := range testCases {
+		context, err := NewInstanceContext("us-east-1", test.platformName, test.platformVersion, "amd64")
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedPlatform, context.Platform, test.platformVersion)
+		assert.Equal(t, PlatformLinux, context.InstallerName, test.platformVersion)
+		assert.Equal(t, InstallScript, Installer)
+		assert.Equal(t, "amazon-ssm-agent-linux-amd64."+CompressFormat, context.FileName("amazon-ssm-agent"))
+
+		isSystemD, err := context.IsPlatformUsingSystemD(logger)
+		assert.NoError(t, err)
+		assert.Equal(t, test.isUsingSystemD, isSystemD, test.platformVersion)
+	}
+}
+
+func TestNewInstanceContextForWindows(t *testing.T) {
+	testCases := []struct {
+		platformName     string
+		platformVersion  string
+		expectedPlatform string
+		expectedVersion  string
+	}{
+		{"Microsoft Windows Server 2019 Datacenter", "10.0.17763", PlatformWindows, "10.0.17763"},
+		{"Microsoft Windows Server 2019 Datacenter", "10.0.17763.1039", PlatformWindows, "10.0.17763"},
+		{"Microsoft Windows Server 2016 Datacenter", "Microsoft Windows Server 2016 Datacenter 10.0.14393 Build 14393", PlatformWindows, "10.0.14393"},
+		{"Microsoft Windows Server 2019 Datacenter", "Version 1809 (OS Build 17763.1039)", PlatformWindows, "10.0.17763"},
+		{"Microsoft Windows Server 2012 R2 Standard", "Build 9600", PlatformWindows, "6.3.9600"},
+		{"Microsoft Windows Server 2008 R2 Datacenter", "Build 7601", PlatformWindows, "6.1.7601"},
+		{"Microsoft Windows Server 2012 R2 Standard", "Windows Server 2012 R2 Standard", PlatformWindows, "6.3.9600"},
+		{"Microsoft Windows Server 2012 Standard", "Windows Server 2012 Standard", PlatformWindows, "6.2.9200"},
+		{"windows-nano", " 10.0.14393 ", PlatformWindowsNano, "10.0.14393"},
+		{"Microsoft Windows Server 2022 Datacenter", "N/A", PlatformWindows, "N/A"},
+	}
+
+	for _, test := range testCases {
+		context, err := NewInstanceContext("us-east-1", test.platformName, test.platformVersion, "amd64")
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedPlatform, context.Platform, test.platformVersion)
+		assert.Equal(t, test.expectedVersion, context.PlatformVersion, test.platformVersion)
+
+		isSystemD, err := context.IsPlatformUsingSystemD(logger)
+		assert.NoError(t, err)
+		assert.False(t, isSystemD, test.platformVersion)
+	}
+
+	// the normalized versions compare in release order
+	compareResult, err := VersionCompare(normalizeWindowsVersion("Build 9600"), normalizeWindowsVersion("10.0.14393.3384"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, compareResult)
+	compareResult, err = VersionCompare(normalizeWindowsVersion("Windows Server 2019 Datacenter"), normalizeWindowsVersion("OS Build 17763.1039"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, compareResult)
+}
+
+func TestNewInstanceContextWithForcedPlatform(t *testing.T) {
+	testCases := []struct {
+		platformName          string
+		expectedPlatformName  string
+		expectedInstallerName string
+		expectedInstaller     string
+	}{
+		{PlatformUbuntuSnap, PlatformUbuntu, PlatformUbuntuSnap, SnapInstaller},
+		{PlatformUbuntu, PlatformUbuntu, PlatformUbuntu, DebInstaller},
+		{PlatformWindowsNano, PlatformWindowsNano, PlatformWindowsNano, InstallScript},
+		{"Amazon Linux", PlatformLinux, PlatformLinux, InstallScript},
+	}
+
+	for _, test := range testCases {
+		context, err := NewInstanceContext("us-east-1", test.platformName, "1.0", "arm64")
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedPlatformName, context.Platform)
+		assert.Equal(t, test.expectedInstallerName, context.InstallerName)
+		assert.Equal(t, test.expectedInstaller, Installer)
+		assert.Equal(t, "arm64", context.Arch)
+		assert.Equal(t, "us-east-1", context.Region)
+		assert.Equal(t, CompressFormat, context.CompressFormat)
+	}
+
+	_, err := NewInstanceContext("", PlatformUbuntu, "1.0", "amd64")
+	assert.Error(t, err)
+	_, err = NewInstanceContext("us-east-1", PlatformUbuntu, "1.0", "")
+	assert.Error(t, err)
+}
+
 var context testInstanceContext
 
 func PlatformVersionStub(log log.T) (version string, err error) {
@@ -156,6 +401,90 @@ func TestFileNameConstruction(t *testing.T) {
 	}
 }
 
+func TestFileNameFor(t *testing.T) {
+	contexts := []InstanceContext{
+		{"us-east-1", PlatformAmazonLinux, "2", PlatformLinux, "arm64", CompressFormatTarGz},
+		{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntuSnap, "amd64", CompressFormatTarGz},
+		{"us-east-1", PlatformWindows, "10.0.17763", PlatformWindows, "amd64", CompressFormatZip},
+		{"us-east-1", PlatformWindowsNano, "10.0.14393", PlatformWindowsNano, "amd64", CompressFormatZip},
+		{"us-east-1", PlatformFreeBSD, "12.1-RELEASE", PlatformFreeBSD, "amd64", CompressFormatTarGz},
+		{"us-east-1", PlatformRedHat, "8", PlatformLinux, "amd64", CompressFormatTarXz},
+	}
+
+	for _, context := range contexts {
+		for _, packageName := range []string{"amazon-ssm-agent", "amazon-ssm-agent-updater"} {
+			assert.Equal(t, context.FileName(packageName),
+				FileNameFor(context.InstallerName, context.Arch, context.CompressFormat, packageName))
+		}
+	}
+	assert.Equal(t, "amazon-ssm-agent-windows-386.zip", FileNameFor(PlatformWindows, "386", CompressFormatZip, "amazon-ssm-agent"))
+}
+
+func TestValidateFileNameTemplate(t *testing.T) {
+	for _, template := range []string{
+		DefaultFileNameTemplate,
+		"{PackageName}_{Arch}_{Platform}.{Compressed}",
+		"ssm-agent-{Platform}.zip",
+	} {
+		assert.NoError(t, ValidateFileNameTemplate(template), template)
+	}
+	for _, template := range []string{"", "  ", "{PackageName}-{Version}.{Compressed}", "{PackageName}-{Arch", "{PackageName}}"} {
+		assert.Error(t, ValidateFileNameTemplate(template), template)
+	}
+}
+
+func TestFileNameWithTemplate(t *testing.T) {
+	context := &InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntu, "arm64", CompressFormatTarGz}
+
+	assert.Equal(t, "amazon-ssm-agent_arm64_ubuntu.tar.gz", context.FileNameWithTemplate("{PackageName}_{Arch}_{Platform}.{Compressed}", "amazon-ssm-agent"))
+	assert.Equal(t, context.FileName("amazon-ssm-agent"), context.FileNameWithTemplate("", "amazon-ssm-agent"))
+}
+
+func TestBuildDownloadURL(t *testing.T) {
+	context := &InstanceContext{"us-east-1", "amazon linux 2023", "2023", "linux", "amd64", "tar.gz"}
+	testCases := []struct {
+		template string
+		result   string
+	}{
+		{
+			"https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}",
+			"https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/amazon-ssm-agent/3.0.0.0/amazon-ssm-agent-linux-amd64.tar.gz",
+		},
+		{
+			"https://example.com/{PackageName}/{PackageVersion}/{Platform}_{Arch}/agent.{Compressed}",
+			"https://example.com/amazon-ssm-agent/3.0.0.0/linux_amd64/agent.tar.gz",
+		},
+		// placeholders missing from the template are ignored
+		{"https://example.com/{FileName}", "https://example.com/amazon-ssm-agent-linux-amd64.tar.gz"},
+		{"https://example.com/latest/agent", "https://example.com/latest/agent"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.result, BuildDownloadURL(test.template, context, "amazon-ssm-agent", "3.0.0.0"))
+	}
+}
+
+func TestBuildDownloadURLForPartitions(t *testing.T) {
+	template := "https://s3.{Region}.amazonaws.com/amazon-ssm-{Region}/{PackageName}/{PackageVersion}/{FileName}"
+	testCases := []struct {
+		region string
+		result string
+	}{
+		{"us-east-1", "https://s3.us-east-1.amazonaws.com/amazon-ssm-us-east-1/amazon-ssm-agent/3.0.0.0/amazon-ssm-agent-linux-amd64.tar.gz"},
+		{"us-gov-west-1", "https://s3.us-gov-west-1.amazonaws.com/amazon-ssm-us-gov-west-1/amazon-ssm-agent/3.0.0.0/amazon-ssm-agent-linux-amd64.tar.gz"},
+		{"cn-north-1", "https://s3.cn-north-1.amazonaws.com.cn/amazon-ssm-cn-north-1/amazon-ssm-agent/3.0.0.0/amazon-ssm-agent-linux-amd64.tar.gz"},
+	}
+
+	for _, test := range testCases {
+		context := &InstanceContext{test.region, "amazon linux 2023", "2023", "linux", "amd64", "tar.gz"}
+		assert.Equal(t, test.result, BuildDownloadURL(template, context, "amazon-ssm-agent", "3.0.0.0"), test.region)
+	}
+
+	context := &InstanceContext{"cn-northwest-1", "amazon linux 2023", "2023", "linux", "amd64", "tar.gz"}
+	assert.Equal(t, "https://s3.cn-northwest-1.amazonaws.com.cn/agent",
+		BuildDownloadURL("https://s3.{Region}.{DomainSuffix}/agent", context, "amazon-ssm-agent", "3.0.0.0"))
+}
+
 func TestBuildMessage(t *testing.T) {
 	err := fmt.Errorf("first error message")
 	var result = BuildMessage(err, "another message")
@@ -174,12 +503,20 @@ func TestBuildMessages(t *testing.T) {
 }
 
 func TestCreateUpdateDownloadFolderSucceeded(t *testing.T) {
-	mkDirAll = func(path string, perm os.FileMode) error {
-		return nil
-	}
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadRoot = dir
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+	mkDirAll = os.MkdirAll
 	util := Utility{}
-	result, _ := util.CreateUpdateDownloadFolder()
+	result, err := util.CreateUpdateDownloadFolder()
+	assert.NoError(t, err)
 	assert.Contains(t, result, "update")
+	// the writability probe is removed
+	files, err := ioutil.ReadDir(result)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
 }
 
 func TestCreateUpdateDownloadFolderFailed(t *testing.T) {
@@ -191,6 +528,107 @@ func TestCreateUpdateDownloadFolderFailed(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCreateUpdateDownloadFolderOnReadOnlyFileSystem(t *testing.T) {
+	mkDirAll = func(path string, perm os.FileMode) error {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EROFS}
+	}
+	defer func() { mkDirAll = os.MkdirAll }()
+
+	util := Utility{}
+	_, err := util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "read-only")
+
+	err = util.ExeCommand(logger, "update", "", "updateroot", "stdout", "stderr", false)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+
+	// a denied permission is an environment issue as well
+	mkDirAll = func(path string, perm os.FileMode) error {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EACCES}
+	}
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "permission denied")
+
+	// other failures are returned as they are
+	mkDirAll = func(path string, perm os.FileMode) error {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOSPC}
+	}
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorUnexpected, GetErrorCode(err))
+}
+
+func TestCreateUpdateDownloadFolderWithUnwritableFolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadRoot = dir
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+	mkDirAll = os.MkdirAll
+	// the folder exists but is owned by another user
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+	}
+	defer func() { openFile = os.OpenFile }()
+
+	util := Utility{}
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "not writable")
+}
+
+func TestCleanupDownloadFolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadRoot = dir
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+
+	folder := filepath.Join(dir, "update", "amazon-ssm-agent", "3.0.0.0")
+	assert.NoError(t, os.MkdirAll(folder, appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(folder, "package.tar.gz"), []byte("package"), appconfig.ReadWriteAccess))
+
+	assert.NoError(t, CleanupDownloadFolder(logger, folder))
+	_, err = os.Stat(folder)
+	assert.True(t, os.IsNotExist(err))
+
+	// the update download folder itself can be deleted, a missing folder is not an error
+	assert.NoError(t, CleanupDownloadFolder(logger, filepath.Join(dir, "update")))
+	_, err = os.Stat(filepath.Join(dir, "update"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, CleanupDownloadFolder(logger, filepath.Join(dir, "update")))
+}
+
+func TestCleanupDownloadFolderRefusesOtherFolders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadRoot = dir
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+
+	unrelated := filepath.Join(dir, "documents")
+	assert.NoError(t, os.MkdirAll(unrelated, appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "update"), appconfig.ReadWriteExecuteAccess))
+
+	for _, folder := range []string{
+		unrelated,
+		dir,
+		filepath.Join(dir, "update", "..", "documents"),
+		filepath.Join(dir, "update-backup"),
+	} {
+		err = CleanupDownloadFolder(logger, folder)
+		assert.Error(t, err, folder)
+		assert.Contains(t, err.Error(), "refusing to delete", folder)
+	}
+	_, err = os.Stat(unrelated)
+	assert.NoError(t, err)
+}
+
 func TestBuildUpdateCommand(t *testing.T) {
 	testCases := []struct {
 		cmd      string
@@ -395,6 +833,203 @@ func TestIsServiceRunning(t *testing.T) {
 	}
 }
 
+func TestIsServiceRunningForFreeBSD(t *testing.T) {
+	util := Utility{}
+	context := &InstanceContext{"us-east-1", PlatformFreeBSD, "12.1-RELEASE", PlatformFreeBSD, "amd64", "tar.gz"}
+	defer func() { execCommand = exec.Command }()
+
+	execCommand = fakeExecCommand
+	result, err := util.IsServiceRunning(logger, context)
+	assert.NoError(t, err)
+	assert.True(t, result)
+
+	// the status output does not report a running service
+	execCommand = fakeExecCommandWithError
+	result, err = util.IsServiceRunning(logger, context)
+	assert.NoError(t, err)
+	assert.False(t, result)
+
+	execCommand = missingExecCommand
+	_, err = util.IsServiceRunning(logger, context)
+	assert.Error(t, err)
+}
+
+func TestIsServiceRunningWithoutSystemctl(t *testing.T) {
+	util := Utility{}
+	context := &InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	defer func() { execCommand = exec.Command }()
+
+	for _, notFoundExecCommand := range []func(string, ...string) *exec.Cmd{
+		// executable is looked up in the PATH
+		func(command string, args ...string) *exec.Cmd { return exec.Command("nonexistent-"+command, args...) },
+		missingExecCommand,
+	} {
+		execCommand = notFoundExecCommand
+		result, err := util.IsServiceRunning(logger, context)
+		assert.False(t, result)
+		assert.Error(t, err)
+		assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	}
+}
+
+func TestIsServiceRunningWithStoppedService(t *testing.T) {
+	util := Utility{}
+	context := &InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	defer func() { execCommand = exec.Command }()
+
+	execCommand = func(command string, args ...string) *exec.Cmd { return fakeExecCommand("stopped") }
+	result, err := util.IsServiceRunning(logger, context)
+	assert.NoError(t, err)
+	assert.False(t, result)
+}
+
+func TestIsServiceRunningWithMissingUnitOnOldSystemD(t *testing.T) {
+	util := Utility{}
+	context := &InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	defer func() { execCommand = exec.Command }()
+
+	// the unit probe is not understood, the status of the missing unit exits like a stopped one and the snap unit
+	// is running
+	var commands [][]string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		commands = append(commands, append([]string{command}, args...))
+		switch {
+		case args[0] == "show" && len(commands) == 1:
+			return fakeExecCommand("unexpected")
+		case args[0] == "show":
+			return fakeExecCommand("notfound")
+		case args[1] == AgentSystemdUnit:
+			return fakeExecCommand("stopped")
+		}
+		return fakeExecCommand(command, args...)
+	}
+	result, err := util.IsServiceRunning(logger, context)
+
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, [][]string{
+		{"systemctl", "show", AgentSystemdUnit, "--property=LoadState"},
+		{"systemctl", "status", AgentSystemdUnit},
+		{"systemctl", "show", AgentSystemdUnit, "--property=LoadState"},
+		{"systemctl", "status", AgentSnapSystemdUnit},
+	}, commands)
+}
+
+func TestIsServiceRunningWithHungStatusCommand(t *testing.T) {
+	util := Utility{}
+	defer func() {
+		execCommand = exec.Command
+		serviceStatusTimeout = 30 * time.Second
+	}()
+	serviceStatusTimeout = 100 * time.Millisecond
+	execCommand = func(command string, args ...string) *exec.Cmd { return fakeExecCommand("hang") }
+
+	for _, context := range []*InstanceContext{
+		{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"},
+		{"us-east-1", PlatformFreeBSD, "12.1-RELEASE", PlatformFreeBSD, "amd64", "tar.gz"},
+	} {
+		start := time.Now()
+		result, err := util.IsServiceRunning(logger, context)
+
+		assert.False(t, result, context.Platform)
+		assert.Error(t, err, context.Platform)
+		assert.Equal(t, ErrorTimeout, GetErrorCode(err), context.Platform)
+		assert.True(t, time.Since(start) < 10*time.Second, context.Platform)
+	}
+}
+
+func TestIsSnapInstall(t *testing.T) {
+	snapRoot, err := ioutil.TempDir("", "snap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(snapRoot)
+	defer func() {
+		snapAgentPath = "/snap/amazon-ssm-agent"
+		execCommand = exec.Command
+		statFile = os.Stat
+	}()
+	statFile = os.Stat
+	snapAgentPath = snapRoot
+
+	// snap is not installed and there is no snap revision
+	execCommand = missingExecCommand
+	assert.False(t, IsSnapInstall(logger))
+
+	// snap list reports the agent snap
+	execCommand = fakeExecCommand
+	assert.True(t, IsSnapInstall(logger))
+
+	// the current revision of the snap is mounted
+	execCommand = missingExecCommand
+	assert.NoError(t, os.Mkdir(filepath.Join(snapRoot, "current"), 0700))
+	assert.True(t, IsSnapInstall(logger))
+}
+
+func TestIsServiceRunningForSnapInstall(t *testing.T) {
+	util := Utility{}
+	defer func() { execCommand = exec.Command }()
+
+	recorder := &recordingExecCommand{}
+	execCommand = recorder.execCommand
+	context := &InstanceContext{"us-east-1", PlatformUbuntu, "18.04", PlatformUbuntuSnap, "amd64", "tar.gz"}
+	result, err := util.IsServiceRunning(logger, context)
+
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, [][]string{
+		{"systemctl", "show", "snap.amazon-ssm-agent.amazon-ssm-agent.service", "--property=LoadState"},
+		{"systemctl", "status", "snap.amazon-ssm-agent.amazon-ssm-agent.service"},
+	}, recorder.commands)
+}
+
+func TestIsServiceRunningWithSystemDUnitPresent(t *testing.T) {
+	util := Utility{}
+	defer func() { execCommand = exec.Command }()
+
+	// the platform version guesses upstart but systemd manages the unit
+	recorder := &recordingExecCommand{}
+	execCommand = recorder.execCommand
+	context := &InstanceContext{"us-east-1", PlatformRedHat, "6.5", "linux", "amd64", "tar.gz"}
+	result, err := util.IsServiceRunning(logger, context)
+
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, [][]string{
+		{"systemctl", "show", "amazon-ssm-agent.service", "--property=LoadState"},
+		{"systemctl", "status", "amazon-ssm-agent.service"},
+	}, recorder.commands)
+}
+
+func TestIsServiceRunningWithSystemDUnitAbsent(t *testing.T) {
+	util := Utility{}
+	defer func() { execCommand = exec.Command }()
+
+	// the platform version guesses systemd but the unit is disabled and the agent runs standalone
+	var commands [][]string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		commands = append(commands, append([]string{command}, args...))
+		if command == "systemctl" && args[0] == "show" {
+			return fakeExecCommand("notfound")
+		}
+		return fakeExecCommand(command, args...)
+	}
+	context := &InstanceContext{"us-east-1", PlatformRedHat, "7.1", "linux", "amd64", "tar.gz"}
+	result, err := util.IsServiceRunning(logger, context)
+
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, [][]string{
+		{"systemctl", "show", "amazon-ssm-agent.service", "--property=LoadState"},
+		{"systemctl", "show", "snap.amazon-ssm-agent.amazon-ssm-agent.service", "--property=LoadState"},
+		{"status", "amazon-ssm-agent"},
+	}, commands)
+}
+
+func TestIsRcServiceRunning(t *testing.T) {
+	assert.True(t, isRcServiceRunning("amazon_ssm_agent is running as pid 1234."))
+	assert.False(t, isRcServiceRunning("amazon_ssm_agent is not running."))
+	assert.False(t, isRcServiceRunning(""))
+}
+
 func TestIsServiceRunningWithErrorMessageFromCommandExec(t *testing.T) {
 	util := Utility{}
 	testCases := []struct {
@@ -460,13 +1095,225 @@ func TestExeCommandSucceeded(t *testing.T) {
 	}
 }
 
+func TestExeCommandWritesStdoutAndStderrToSeparateFiles(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{}
+	// run twice to verify both files are opened in append mode
+	for i := 0; i < 2; i++ {
+		err = util.ExeCommand(logger, "writeboth", outputRoot, outputRoot, "stdout", "stderr", false)
+		assert.NoError(t, err)
+	}
+
+	stdoutContent, err := ioutil.ReadFile(UpdateStdOutPath(outputRoot, "stdout"))
+	assert.NoError(t, err)
+	stderrContent, err := ioutil.ReadFile(UpdateStdErrPath(outputRoot, "stderr"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, strings.Count(string(stdoutContent), "standard output"))
+	assert.NotContains(t, string(stdoutContent), "standard error")
+	assert.Equal(t, 2, strings.Count(string(stderrContent), "standard error"))
+	assert.NotContains(t, string(stderrContent), "standard output")
+}
+
+func TestExeCommandTruncatesOutputOverLimit(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{MaxOutputSize: 64 * 1024}
+	// the command keeps running after the limit and succeeds
+	assert.NoError(t, util.ExeCommand(logger, "flood", outputRoot, outputRoot, "stdout", "stderr", false))
+
+	marker := fmt.Sprintf(outputTruncatedMarker, util.MaxOutputSize)
+	for _, path := range []string{UpdateStdOutPath(outputRoot, "stdout"), UpdateStdErrPath(outputRoot, "stderr")} {
+		content, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, int(util.MaxOutputSize)+len(marker), len(content), path)
+		assert.True(t, strings.HasSuffix(string(content), marker), path)
+		assert.NotContains(t, string(content), "done", path)
+	}
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	assert.Equal(t, DefaultMaxOutputSize, (&Utility{}).maxOutputSize())
+	assert.Equal(t, DefaultMaxOutputSize, (&Utility{MaxOutputSize: -1}).maxOutputSize())
+	assert.Equal(t, int64(1024), (&Utility{MaxOutputSize: 1024}).maxOutputSize())
+}
+
+func TestExeCommandWithTimeout(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{CustomUpdateExecutionTimeoutInSeconds: 60}
+	assert.NoError(t, util.ExeCommandWithTimeout(logger, "writeboth", outputRoot, outputRoot, "stdout", "stderr", 10*time.Second))
+	content, err := ioutil.ReadFile(UpdateStdOutPath(outputRoot, "stdout"))
+	assert.NoError(t, err)
+	assert.Equal(t, "standard output\n", string(content))
+
+	// the command is killed after the timeout rather than the update execution timeout of the utility
+	start := time.Now()
+	err = util.ExeCommandWithTimeout(logger, "hang", outputRoot, outputRoot, "stdout", "stderr", 500*time.Millisecond)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 30*time.Second, "command was not killed after the timeout")
+}
+
+func TestExeCommandWithWritersStreamsOutput(t *testing.T) {
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{}
+	var stdout, stderr bytes.Buffer
+	err := util.ExeCommandWithWriters(logger, "writeboth", "", &stdout, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "standard output\n", stdout.String())
+	assert.True(t, strings.HasSuffix(stderr.String(), "standard error\n"), stderr.String())
+	assert.NotContains(t, stderr.String(), "standard output")
+
+	// a nil writer discards the stream, the other stream can be tee'd to several writers
+	var tee bytes.Buffer
+	stdout.Reset()
+	err = util.ExeCommandWithWriters(logger, "writeboth", "", io.MultiWriter(&stdout, &tee), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "standard output\n", stdout.String())
+	assert.Equal(t, "standard output\n", tee.String())
+
+	stderr.Reset()
+	err = util.ExeCommandWithWriters(logger, "exitcode", "", nil, &stderr)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Exit Status: 2")
+	assert.Contains(t, stderr.String(), "dependency problems")
+}
+
+func TestExeCommandLogsAndReturnsCommand(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+
+	util := Utility{}
+	mockLog := log.NewMockLog()
+	err = util.ExeCommand(mockLog, "exitcode -source /tmp/agent -token abc123", outputRoot, outputRoot, "stdout", "stderr", false)
+	assert.Error(t, err)
+
+	commandLine := strings.Join(setPlatformSpecificCommand([]string{"exitcode", "-source", "/tmp/agent", "-token", redactedValue}), " ")
+	mockLog.AssertCalled(t, "Debugf", "Running command %v", []interface{}{commandLine})
+	assert.Contains(t, err.Error(), commandLine)
+	assert.Contains(t, err.Error(), "Exit Status: 2")
+	assert.NotContains(t, err.Error(), "abc123")
+}
+
+func TestExeCommandAsyncReturnsCommandOnStartFailure(t *testing.T) {
+	execCommand = fakeExecCommand
+	cmdStart = func(*exec.Cmd) error { return fmt.Errorf("start failed") }
+
+	util := Utility{}
+	mockLog := log.NewMockLog()
+	err := util.ExeCommand(mockLog, "update -password=secret", "temp", appconfig.UpdaterArtifactsRoot, "stdout", "stderr", true)
+	assert.Error(t, err)
+
+	mockLog.AssertCalled(t, "Debugf", "Starting command %v", []interface{}{"update -password=" + redactedValue})
+	assert.Contains(t, err.Error(), "update -password="+redactedValue)
+	assert.Contains(t, err.Error(), "start failed")
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestRedactSensitiveFlags(t *testing.T) {
+	testCases := []struct {
+		parts    []string
+		expected string
+	}{
+		{[]string{"install.sh", "-v"}, "install.sh -v"},
+		{[]string{"register", "-code", "abc", "-id", "123"}, "register -code **** -id 123"},
+		{[]string{"register", "--Token=abc", "--region=us-east-1"}, "register --Token=**** --region=us-east-1"},
+		{[]string{"register", "-password"}, "register -password"},
+		{[]string{"login", "-secretkey", "abc", "value"}, "login -secretkey **** value"},
+	}
+
+	for _, test := range testCases {
+		assert.Equal(t, test.expected, redactSensitiveFlags(test.parts))
+	}
+}
+
+func TestExeCommandWithEmptyCommand(t *testing.T) {
+	testCases := []struct {
+		cmd     string
+		isAsync bool
+	}{
+		{"", true},
+		{"", false},
+		{"   ", true},
+		{"   ", false},
+	}
+
+	util := Utility{}
+
+	for _, test := range testCases {
+		err := util.ExeCommand(logger, test.cmd, "temp", appconfig.UpdaterArtifactsRoot, "stdout", "stderr", test.isAsync)
+		assert.Error(t, err)
+		assert.Equal(t, ErrorUnexpected, GetErrorCode(err))
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	testCases := []struct {
+		cmd      string
+		expected []string
+	}{
+		{"-update -target.version 5.0.0", []string{"-update", "-target.version", "5.0.0"}},
+		{"  install.sh   -v  ", []string{"install.sh", "-v"}},
+		{"install.sh 'path with spaces/file'", []string{"install.sh", "path with spaces/file"}},
+		{"install.sh \"/opt/my dir/agent\" -v", []string{"install.sh", "/opt/my dir/agent", "-v"}},
+		{"echo \"say \\\"hi\\\"\"", []string{"echo", "say \"hi\""}},
+		{"echo 'it\"s' \"it's\"", []string{"echo", "it\"s", "it's"}},
+		{"echo pre\"fix value\"post", []string{"echo", "prefix valuepost"}},
+		{"echo \"\"", []string{"echo", ""}},
+		{"C:\\Program\\updater.exe -update", []string{"C:\\Program\\updater.exe", "-update"}},
+	}
+
+	for _, test := range testCases {
+		parts, err := splitCommand(test.cmd)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, parts)
+	}
+}
+
+func TestSplitCommandWithUnterminatedQuote(t *testing.T) {
+	for _, cmd := range []string{"echo 'unterminated", "echo \"unterminated"} {
+		_, err := splitCommand(cmd)
+		assert.Error(t, err)
+	}
+}
+
 func TestKillProcess(t *testing.T) {
 	// Stub exec.Command
 	var cmd = fakeExecCommand("-update", "-target.version 5.0.0")
 	cmd.Process = &os.Process{}
 
 	timer := time.NewTimer(time.Duration(1) * time.Millisecond)
-	killProcessOnTimeout(logger, cmd, timer)
+	killProcessOnTimeout(logger, cmd, &processTree{}, timer)
 }
 
 func TestSetExeOutErrCannotCreateFolder(t *testing.T) {
@@ -533,13 +1380,47 @@ func TestExecCommandHelperProcess(*testing.T) {
 	if testError {
 		fmt.Fprintf(os.Stderr, "Error")
 	} else {
-		switch cmd {
+		switch filepath.Base(cmd) {
 		case "systemctl":
-			fmt.Println("Active: active (running)")
+			if len(args) > 0 && args[0] == "show" {
+				fmt.Println("LoadState=loaded")
+			} else {
+				fmt.Println("Active: active (running)")
+			}
+		case "notfound":
+			fmt.Println("LoadState=not-found")
 		case "status":
 			fmt.Println("amazon-ssm-agent start/running")
+		case "service":
+			fmt.Println("amazon_ssm_agent is running as pid 1234.")
 		case "update":
 			fmt.Println("test update")
+		case "writeboth":
+			fmt.Fprintln(os.Stdout, "standard output")
+			fmt.Fprintln(os.Stderr, "standard error")
+		case "stopped":
+			fmt.Println("Active: inactive (dead)")
+			os.Exit(3)
+		case "hang":
+			time.Sleep(time.Minute)
+		case "exitcode":
+			fmt.Fprintln(os.Stderr, "dependency problems")
+			os.Exit(2)
+		case "printpath":
+			fmt.Println(os.Getenv("PATH"))
+		case "flood":
+			// writes 1 MB to each output in small chunks like a chatty installer
+			line := strings.Repeat("x", 1023) + "\n"
+			for i := 0; i < 1024; i++ {
+				fmt.Fprint(os.Stdout, line)
+				fmt.Fprint(os.Stderr, line)
+			}
+			fmt.Println("done")
+		case "amazon-ssm-agent":
+			fmt.Println("SSM Agent version: 2.3.100.0")
+		case "oldagent":
+			fmt.Fprintln(os.Stderr, "flag provided but not defined: -version")
+			os.Exit(2)
 		}
 	}
 }
@@ -554,7 +1435,7 @@ func TestIsDiskSpaceSufficientForUpdateWithSufficientSpace(t *testing.T) {
 	}
 
 	util := Utility{}
-	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger)
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger, 0)
 
 	assert.NoError(t, err)
 	assert.True(t, isSufficient)
@@ -570,12 +1451,32 @@ func TestIsDiskSpaceSufficientForUpdateWithInsufficientSpace(t *testing.T) {
 	}
 
 	util := Utility{}
-	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger)
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger, 0)
 
 	assert.NoError(t, err)
 	assert.False(t, isSufficient)
 }
 
+func TestIsDiskSpaceSufficientForUpdateWithArtifactSize(t *testing.T) {
+	artifactSize := int64(50 * 1024 * 1024)
+	getDiskSpaceInfo = func() (fileutil.DiskSpaceInfo, error) {
+		return fileutil.DiskSpaceInfo{
+			AvailBytes: MinimumDiskSpaceForUpdate + artifactSize,
+			FreeBytes:  0,
+			TotalBytes: 0,
+		}, nil
+	}
+
+	util := Utility{}
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger, artifactSize)
+	assert.NoError(t, err)
+	assert.True(t, isSufficient)
+
+	isSufficient, err = util.IsDiskSpaceSufficientForUpdate(logger, artifactSize+1)
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+}
+
 func TestIsDiskSpaceSufficientForUpdateWithDiskSpaceLoadFail(t *testing.T) {
 	getDiskSpaceInfo = func() (fileutil.DiskSpaceInfo, error) {
 		return fileutil.DiskSpaceInfo{
@@ -586,9 +1487,126 @@ func TestIsDiskSpaceSufficientForUpdateWithDiskSpaceLoadFail(t *testing.T) {
 	}
 
 	util := Utility{}
-	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger)
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdate(logger, 0)
 
 	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "failed to load the disk space")
+	assert.False(t, isSufficient)
+}
+
+func TestIsDiskSpaceSufficientForUpdateInFolderChecksFolderVolume(t *testing.T) {
+	downloadVolume, err := ioutil.TempDir("", "downloadvolume")
+	assert.NoError(t, err)
+	defer os.RemoveAll(downloadVolume)
+	defer func() { getDiskSpaceInfoForPath = fileutil.GetDiskSpaceInfoForPath }()
+
+	// the root volume is full, the download volume is not
+	checkedPath := ""
+	getDiskSpaceInfoForPath = func(path string) (fileutil.DiskSpaceInfo, error) {
+		checkedPath = path
+		if path == downloadVolume {
+			return fileutil.DiskSpaceInfo{AvailBytes: MinimumDiskSpaceForUpdate}, nil
+		}
+		return fileutil.DiskSpaceInfo{AvailBytes: 0}, nil
+	}
+
+	util := Utility{}
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdateInFolder(logger, downloadVolume, 0)
+	assert.NoError(t, err)
+	assert.True(t, isSufficient)
+	assert.Equal(t, downloadVolume, checkedPath)
+
+	isSufficient, err = util.IsDiskSpaceSufficientForUpdateInFolder(logger, "/", 0)
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+	assert.Equal(t, "/", checkedPath)
+
+	isSufficient, err = util.IsDiskSpaceSufficientForUpdateInFolder(logger, downloadVolume, 1)
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+}
+
+func TestIsDiskSpaceSufficientForUpdateInFolderChecksClosestExistingParent(t *testing.T) {
+	downloadVolume, err := ioutil.TempDir("", "downloadvolume")
+	assert.NoError(t, err)
+	defer os.RemoveAll(downloadVolume)
+	defer func() { getDiskSpaceInfoForPath = fileutil.GetDiskSpaceInfoForPath }()
+
+	checkedPath := ""
+	getDiskSpaceInfoForPath = func(path string) (fileutil.DiskSpaceInfo, error) {
+		checkedPath = path
+		return fileutil.DiskSpaceInfo{AvailBytes: MinimumDiskSpaceForUpdate}, nil
+	}
+
+	util := Utility{}
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdateInFolder(logger, filepath.Join(downloadVolume, "update", "amazon-ssm-agent"), 0)
+	assert.NoError(t, err)
+	assert.True(t, isSufficient)
+	assert.Equal(t, downloadVolume, checkedPath)
+}
+
+func TestIsDiskSpaceSufficientForUpdateInFolderWithDiskSpaceLoadFail(t *testing.T) {
+	defer func() { getDiskSpaceInfoForPath = fileutil.GetDiskSpaceInfoForPath }()
+	getDiskSpaceInfoForPath = func(path string) (fileutil.DiskSpaceInfo, error) {
+		return fileutil.DiskSpaceInfo{}, fmt.Errorf("mock error - failed to load the disk space")
+	}
+
+	util := Utility{}
+	isSufficient, err := util.IsDiskSpaceSufficientForUpdateInFolder(logger, "/", 0)
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "failed to load the disk space")
+	assert.False(t, isSufficient)
+}
+
+func TestIsMemorySufficientForUpdate(t *testing.T) {
+	defer func() { getAvailableMemory = availableMemory }()
+	getAvailableMemory = func() (int64, error) { return 256 * 1024 * 1024, nil }
+
+	util := Utility{}
+	// the default minimum memory
+	isSufficient, err := util.IsMemorySufficientForUpdate(logger, 0)
+	assert.NoError(t, err)
+	assert.True(t, isSufficient)
+
+	isSufficient, err = util.IsMemorySufficientForUpdate(logger, 256*1024*1024)
+	assert.NoError(t, err)
+	assert.True(t, isSufficient)
+
+	isSufficient, err = util.IsMemorySufficientForUpdate(logger, 256*1024*1024+1)
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+
+	// the minimum memory of the utility
+	util = Utility{MinimumMemoryForUpdate: 512 * 1024 * 1024}
+	isSufficient, err = util.IsMemorySufficientForUpdate(logger, 0)
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+}
+
+func TestIsMemorySufficientForUpdateWithInsufficientMemory(t *testing.T) {
+	defer func() { getAvailableMemory = availableMemory }()
+	getAvailableMemory = func() (int64, error) { return DefaultMinimumMemoryForUpdate - 1, nil }
+
+	util := Utility{}
+	isSufficient, err := util.IsMemorySufficientForUpdate(logger, 0)
+
+	assert.NoError(t, err)
+	assert.False(t, isSufficient)
+}
+
+func TestIsMemorySufficientForUpdateWithMemoryLoadFail(t *testing.T) {
+	defer func() { getAvailableMemory = availableMemory }()
+	getAvailableMemory = func() (int64, error) { return 0, fmt.Errorf("mock error - failed to load the memory") }
+
+	util := Utility{}
+	isSufficient, err := util.IsMemorySufficientForUpdate(logger, 0)
+
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "failed to load the memory")
 	assert.False(t, isSufficient)
 }
 
@@ -654,3 +1672,381 @@ func TestCompareVersion(t *testing.T) {
 	assert.NotNil(t, err)
 
 }
+
+func TestCheckDowngrade(t *testing.T) {
+	testCases := []struct {
+		currentVersion string
+		targetVersion  string
+		allowDowngrade bool
+		expectedCode   ErrorCode
+	}{
+		{"2.3.842.0", "2.3.842.0", false, ""},
+		{"2.3.842.0", "2.3.842.0", true, ""},
+		{"2.3.842.0", "2.3.900.0", false, ""},
+		{"2.3.842.0", "2.3.900.0", true, ""},
+		{"2.3.842.0", "2.3.800.0", false, ErrorAttemptToDowngrade},
+		{"2.3.842.0", "2.3.800.0", true, ""},
+		{"2.3.842.0", "invalid", false, ErrorInvalidTargetVersion},
+	}
+
+	for _, test := range testCases {
+		err := CheckDowngrade(logger, test.currentVersion, test.targetVersion, test.allowDowngrade)
+		assert.Equal(t, test.expectedCode, GetErrorCode(err), "%v to %v allowDowngrade=%v", test.currentVersion, test.targetVersion, test.allowDowngrade)
+	}
+}
+
+func TestVerifyApprovedVersion(t *testing.T) {
+	defer func() {
+		loadAppConfig = appconfig.Config
+		readFile = ioutil.ReadFile
+	}()
+	useAgentConfig := func(agent appconfig.AgentInfo) {
+		loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+			return appconfig.SsmagentConfig{Agent: agent}, nil
+		}
+	}
+	readFile = func(filename string) ([]byte, error) {
+		if filename == "approved.txt" {
+			return []byte("# approved by change 42\n3.0.100.0\r\n\n3.0.200.0\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	testCases := []struct {
+		name          string
+		agent         appconfig.AgentInfo
+		targetVersion string
+		expectedCode  ErrorCode
+	}{
+		{"absent list", appconfig.AgentInfo{}, "3.0.300.0", ""},
+		{"empty list", appconfig.AgentInfo{ApprovedUpdateVersions: []string{" "}}, "3.0.300.0", ""},
+		{"allowed", appconfig.AgentInfo{ApprovedUpdateVersions: []string{"3.0.100.0", "3.0.300.0"}}, "3.0.300.0", ""},
+		{"disallowed", appconfig.AgentInfo{ApprovedUpdateVersions: []string{"3.0.100.0"}}, "3.0.300.0", ErrorInvalidTargetVersion},
+		{"allowed by file", appconfig.AgentInfo{ApprovedUpdateVersionsPath: "approved.txt"}, "3.0.200.0", ""},
+		{"disallowed by file", appconfig.AgentInfo{ApprovedUpdateVersionsPath: "approved.txt"}, "3.0.300.0", ErrorInvalidTargetVersion},
+		{"unreadable file", appconfig.AgentInfo{ApprovedUpdateVersionsPath: "missing.txt"}, "3.0.100.0", ErrorInvalidTargetVersion},
+	}
+
+	for _, test := range testCases {
+		useAgentConfig(test.agent)
+		err := VerifyApprovedVersion(logger, test.targetVersion)
+		assert.Equal(t, test.expectedCode, GetErrorCode(err), test.name)
+	}
+
+	// the configuration cannot restrict the update when it cannot be loaded
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		return appconfig.SsmagentConfig{}, fmt.Errorf("invalid appconfig")
+	}
+	assert.NoError(t, VerifyApprovedVersion(logger, "3.0.300.0"))
+}
+
+func TestWaitForServiceRunning(t *testing.T) {
+	calls := 0
+	isServiceRunning := func(log log.T, i *InstanceContext) (bool, error) {
+		calls++
+		return calls > 3, nil
+	}
+
+	result, err := waitForServiceRunning(logger, isServiceRunning, &InstanceContext{}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.Equal(t, 4, calls)
+}
+
+func TestWaitForServiceRunningTimeout(t *testing.T) {
+	calls := 0
+	isServiceRunning := func(log log.T, i *InstanceContext) (bool, error) {
+		calls++
+		return false, nil
+	}
+
+	result, err := waitForServiceRunning(logger, isServiceRunning, &InstanceContext{}, 50*time.Millisecond, 10*time.Millisecond)
+
+	assert.False(t, result)
+	assert.Equal(t, ErrorTimeout, GetErrorCode(err))
+	assert.True(t, calls > 1)
+	assert.True(t, calls <= 6)
+}
+
+func TestWaitForServiceRunningWrapsLastError(t *testing.T) {
+	calls := 0
+	isServiceRunning := func(log log.T, i *InstanceContext) (bool, error) {
+		calls++
+		return false, fmt.Errorf("status check %v failed", calls)
+	}
+
+	result, err := waitForServiceRunning(logger, isServiceRunning, &InstanceContext{}, 30*time.Millisecond, 10*time.Millisecond)
+
+	assert.False(t, result)
+	assert.Equal(t, ErrorCannotStartService, GetErrorCode(err))
+	assert.Contains(t, err.Error(), fmt.Sprintf("status check %v failed", calls))
+}
+
+func TestJitteredIntervalStaysWithinBounds(t *testing.T) {
+	defer func() { pollJitterRand = rand.New(rand.NewSource(time.Now().UnixNano())) }()
+
+	interval := 100 * time.Millisecond
+	lower := time.Duration(float64(interval) * (1 - serviceRunningPollJitter))
+	upper := time.Duration(float64(interval) * (1 + serviceRunningPollJitter))
+
+	pollJitterRand = rand.New(rand.NewSource(1))
+	intervals := []time.Duration{}
+	distinct := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		wait := jitteredInterval(interval)
+		assert.True(t, wait >= lower && wait <= upper, "interval %v is outside [%v, %v]", wait, lower, upper)
+		intervals = append(intervals, wait)
+		distinct[wait] = true
+	}
+	assert.True(t, len(distinct) > 1)
+
+	// the same seed produces the same intervals
+	pollJitterRand = rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, intervals[i], jitteredInterval(interval))
+	}
+}
+
+func TestInstanceRegion(t *testing.T) {
+	defer func() {
+		loadAppConfig = appconfig.Config
+		getRegion = RegionStub
+	}()
+	getRegion = func() (string, error) { return "us-west-2", nil }
+
+	// appconfig provides the region and the metadata is not queried
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		config := appconfig.SsmagentConfig{}
+		config.Agent.Region = "eu-west-1"
+		return config, nil
+	}
+	util := Utility{}
+	region, err := util.instanceRegion(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+
+	// utility region takes precedence over appconfig
+	util = Utility{Region: "ap-south-1"}
+	region, err = util.instanceRegion(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "ap-south-1", region)
+
+	// blank overrides fall back to the metadata
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		config := appconfig.SsmagentConfig{}
+		config.Agent.Region = " "
+		return config, nil
+	}
+	util = Utility{Region: " "}
+	region, err = util.instanceRegion(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", region)
+
+	// appconfig cannot be loaded
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		return appconfig.SsmagentConfig{}, fmt.Errorf("failed to load appconfig")
+	}
+	region, err = util.instanceRegion(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", region)
+}
+
+func TestCreateInstanceContextWithRegionOverride(t *testing.T) {
+	defer func() {
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+		getPlatformVersion = PlatformVersionStub
+		loadAppConfig = appconfig.Config
+	}()
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return appconfig.SsmagentConfig{}, nil }
+	metadataRetrySleep = func(time.Duration) {}
+	defer func() { metadataRetrySleep = time.Sleep }()
+	getRegion = func() (string, error) { return "", fmt.Errorf("metadata is not reachable") }
+	getPlatformName = func(log log.T) (string, error) { return "Amazon Linux", nil }
+	getPlatformVersion = func(log log.T) (string, error) { return "2", nil }
+
+	util := Utility{Region: "us-gov-west-1"}
+	context, err := util.CreateInstanceContext(logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "us-gov-west-1", context.Region)
+
+	// without the override the metadata lookup failure is reported
+	util = Utility{}
+	_, err = util.CreateInstanceContext(logger)
+	assert.Error(t, err)
+}
+
+func TestValidateRegion(t *testing.T) {
+	for _, region := range []string{"us-east-1", "eu-west-3", "ap-southeast-2", "us-gov-west-1", "cn-north-1", "cn-northwest-1", "us-isob-east-1"} {
+		assert.NoError(t, ValidateRegion(region), region)
+	}
+	for _, region := range []string{"", "region", "US-EAST-1", "us-east", "us_east_1", "useast1", "us-east-1/../x", " us-east-1"} {
+		assert.Error(t, ValidateRegion(region), region)
+	}
+}
+
+func TestCreateInstanceContextWithMalformedRegion(t *testing.T) {
+	defer func() {
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+		getPlatformVersion = PlatformVersionStub
+		loadAppConfig = appconfig.Config
+	}()
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return appconfig.SsmagentConfig{}, nil }
+	getRegion = func() (string, error) { return "us-east-1/..", nil }
+	getPlatformName = func(log log.T) (string, error) { return "Amazon Linux", nil }
+	getPlatformVersion = func(log log.T) (string, error) { return "2", nil }
+
+	util := Utility{}
+	_, err := util.CreateInstanceContext(logger)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid region")
+
+	// a malformed override is rejected as well
+	util = Utility{Region: "US-EAST-1"}
+	_, err = util.CreateInstanceContext(logger)
+	assert.Error(t, err)
+}
+
+func TestWaitForMetadataReady(t *testing.T) {
+	var sleeps []time.Duration
+	metadataRetrySleep = func(interval time.Duration) { sleeps = append(sleeps, interval) }
+	defer func() {
+		metadataRetrySleep = time.Sleep
+		getRegion = RegionStub
+	}()
+	lookups := 0
+	getRegion = func() (string, error) {
+		lookups++
+		if lookups < 3 {
+			return "", fmt.Errorf("instance metadata is unreachable")
+		}
+		return "us-east-1", nil
+	}
+
+	assert.NoError(t, WaitForMetadataReady(logger, time.Minute))
+	assert.Equal(t, 3, lookups)
+	assert.Equal(t, []time.Duration{metadataReadyPollInterval, metadataReadyPollInterval}, sleeps)
+}
+
+func TestWaitForMetadataReadyTimesOut(t *testing.T) {
+	defer func() {
+		metadataReadyPollInterval = time.Second
+		getRegion = RegionStub
+	}()
+	metadataReadyPollInterval = 10 * time.Millisecond
+	getRegion = func() (string, error) { return "", nil }
+
+	err := WaitForMetadataReady(logger, 50*time.Millisecond)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorTimeout, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "instance metadata is not ready")
+}
+
+func TestCreateInstanceContextRetriesMetadata(t *testing.T) {
+	var sleeps []time.Duration
+	metadataRetrySleep = func(interval time.Duration) { sleeps = append(sleeps, interval) }
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return appconfig.SsmagentConfig{}, nil }
+	defer func() {
+		metadataRetrySleep = time.Sleep
+		loadAppConfig = appconfig.Config
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+		getPlatformVersion = PlatformVersionStub
+	}()
+
+	regionCalls, nameCalls, versionCalls := 0, 0, 0
+	getRegion = func() (string, error) {
+		if regionCalls++; regionCalls < 3 {
+			return "", fmt.Errorf("metadata is not ready")
+		}
+		return "us-east-1", nil
+	}
+	getPlatformName = func(log log.T) (string, error) {
+		if nameCalls++; nameCalls < 2 {
+			return "", fmt.Errorf("platform name is not ready")
+		}
+		return "Amazon Linux", nil
+	}
+	getPlatformVersion = func(log log.T) (string, error) {
+		versionCalls++
+		return "2", nil
+	}
+
+	util := Utility{MetadataRetryInterval: 100 * time.Millisecond}
+	context, err := util.CreateInstanceContext(logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", context.Region)
+	assert.Equal(t, PlatformLinux, context.Platform)
+	assert.Equal(t, 3, regionCalls)
+	assert.Equal(t, 2, nameCalls)
+	assert.Equal(t, 1, versionCalls)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond}, sleeps)
+}
+
+func TestCreateInstanceContextRetriesExhausted(t *testing.T) {
+	sleepCount := 0
+	metadataRetrySleep = func(time.Duration) { sleepCount++ }
+	defer func() {
+		metadataRetrySleep = time.Sleep
+		getRegion = RegionStub
+		getPlatformName = PlatformNameStub
+	}()
+	getRegion = func() (string, error) { return "us-east-1", nil }
+
+	nameCalls := 0
+	getPlatformName = func(log log.T) (string, error) {
+		nameCalls++
+		return "", fmt.Errorf("attempt %v failed", nameCalls)
+	}
+
+	util := Utility{MetadataRetryCount: 2}
+	_, err := util.CreateInstanceContext(logger)
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, nameCalls)
+	assert.Equal(t, 2, sleepCount)
+	assert.Contains(t, err.Error(), "failed to get platform name after 3 attempts")
+	assert.Contains(t, err.Error(), "attempt 1 failed; attempt 2 failed; attempt 3 failed")
+
+	// retries are disabled
+	nameCalls, sleepCount = 0, 0
+	util = Utility{MetadataRetryCount: -1}
+	_, err = util.CreateInstanceContext(logger)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, nameCalls)
+	assert.Equal(t, 0, sleepCount)
+}
+
+func TestUpdateExecutionTimeout(t *testing.T) {
+	defer func() { loadAppConfig = appconfig.Config }()
+
+	// appconfig provides a custom timeout
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		config := appconfig.SsmagentConfig{}
+		config.Agent.UpdateExecutionTimeoutSeconds = 600
+		return config, nil
+	}
+	util := Utility{}
+	assert.Equal(t, 600, util.updateExecutionTimeout(logger))
+
+	// per-call timeout takes precedence over appconfig
+	util = Utility{CustomUpdateExecutionTimeoutInSeconds: 20}
+	assert.Equal(t, 20, util.updateExecutionTimeout(logger))
+
+	// appconfig does not provide a timeout
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		return appconfig.SsmagentConfig{}, nil
+	}
+	util = Utility{}
+	assert.Equal(t, DefaultUpdateExecutionTimeoutInSeconds, util.updateExecutionTimeout(logger))
+
+	// appconfig cannot be loaded
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) {
+		return appconfig.SsmagentConfig{}, fmt.Errorf("failed to load appconfig")
+	}
+	assert.Equal(t, DefaultUpdateExecutionTimeoutInSeconds, util.updateExecutionTimeout(logger))
+}
@@ -17,8 +17,14 @@
 package updateutil
 
 import (
+	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"syscall"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
 )
 
 const (
@@ -60,11 +66,20 @@ const (
 
 	// OutputBucketNameCmd represents the command argument for output bucket name
 	OutputBucketNameCmd = "output.bucket"
+
+	// DryRunCmd represents the command argument for running the update without installing
+	DryRunCmd = "dry.run"
+
+	// InstallTimeoutCmd represents the command argument for the timeout of the install script in seconds
+	InstallTimeoutCmd = "install.timeout"
+
+	// UninstallTimeoutCmd represents the command argument for the timeout of the uninstall script in seconds
+	UninstallTimeoutCmd = "uninstall.timeout"
 )
 
 const (
 	// CompressFormat represents the compress format for linux platform
-	CompressFormat = "tar.gz"
+	CompressFormat = CompressFormatTarGz
 )
 const (
 	// installer script for linux
@@ -73,14 +88,83 @@ const (
 	UninstallScript = "uninstall.sh"
 )
 
+// agentBinaryPaths represents the locations of the agent binary for linux platform
+var agentBinaryPaths = []string{"/usr/bin/amazon-ssm-agent", "/snap/bin/amazon-ssm-agent"}
+
+// renameConflictErrors represents the errors of a rename over a file that is in use by another process
+var renameConflictErrors = []syscall.Errno{syscall.EBUSY, syscall.ETXTBSY, syscall.EEXIST}
+
 func prepareProcess(command *exec.Cmd) {
 	// make the process the leader of its process group
 	// (otherwise we cannot kill it properly)
 	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
+var lookupUser = user.Lookup
+
+// agentBinaryPath returns the path of the installed agent binary
+func agentBinaryPath(context *InstanceContext) string {
+	switch context.InstallerName {
+	case PlatformUbuntuSnap:
+		return filepath.Join(snapAgentPath, "current", "amazon-ssm-agent")
+	case PlatformFreeBSD:
+		return "/usr/local/bin/amazon-ssm-agent"
+	}
+	return "/usr/bin/amazon-ssm-agent"
+}
+
+// sanitizedPath is the PATH of the commands ExeCommand runs when the inherited PATH is not used
+func sanitizedPath() string {
+	return "/usr/sbin:/usr/bin:/sbin:/bin"
+}
+
+// setCommandUser makes the command run with the uid and gid of the user, the command is not changed when
+// no user is provided
+func setCommandUser(log log.T, command *exec.Cmd, userName string) error {
+	if userName == "" {
+		return nil
+	}
+
+	runAs, err := lookupUser(userName)
+	if err != nil {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "failed to find user %v to run the command as", userName)
+	}
+	uid, err := strconv.ParseUint(runAs.Uid, 10, 32)
+	if err != nil {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "invalid uid %v of user %v", runAs.Uid, userName)
+	}
+	gid, err := strconv.ParseUint(runAs.Gid, 10, 32)
+	if err != nil {
+		return NewUpdateError(ErrorEnvironmentIssue, err, "invalid gid %v of user %v", runAs.Gid, userName)
+	}
+
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	log.Debugf("Running command as user %v (uid %v, gid %v)", userName, uid, gid)
+	return nil
+}
+
+// processTree is not needed on unix, killing the process is sufficient
+type processTree struct{}
+
+func prepareProcessTree(command *exec.Cmd) {
+}
+
+func trackProcessTree(log log.T, command *exec.Cmd) *processTree {
+	return &processTree{}
+}
+
+func (tree *processTree) kill(log log.T, command *exec.Cmd) error {
+	return command.Process.Kill()
+}
+
+func (tree *processTree) close(log log.T) {
+}
+
 func agentStatusOutput() ([]byte, error) {
-	return execCommand("status", "amazon-ssm-agent").Output()
+	return statusCommandOutput(execCommand("status", AgentServiceName))
 }
 
 func agentExpectedStatus() string {
@@ -90,3 +174,8 @@ func agentExpectedStatus() string {
 func setPlatformSpecificCommand(parts []string) []string {
 	return parts
 }
+
+// isExecutable returns true if any of the execute bits of the file is set
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
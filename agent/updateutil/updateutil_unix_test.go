@@ -0,0 +1,197 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractPackage(t *testing.T) {
+	testCases := []struct {
+		fileName       string
+		compressFormat string
+	}{
+		{"package.tar.gz", CompressFormatTarGz},
+		{"package.tar.xz", CompressFormatTarXz},
+		// compress format is detected from the file name when the context does not specify one
+		{"package.tar.gz", ""},
+		{"package.tar.xz", ""},
+	}
+
+	for _, test := range testCases {
+		dest, err := ioutil.TempDir("", "extractpackage")
+		assert.NoError(t, err)
+
+		context := &InstanceContext{CompressFormat: test.compressFormat}
+		err = ExtractPackage(logger, context, filepath.Join("testdata", test.fileName), dest)
+		assert.NoError(t, err, "%v with %v", test.fileName, test.compressFormat)
+
+		content, err := ioutil.ReadFile(filepath.Join(dest, "install.sh"))
+		assert.NoError(t, err)
+		assert.Equal(t, "install\n", string(content))
+		content, err = ioutil.ReadFile(filepath.Join(dest, "bin", "amazon-ssm-agent"))
+		assert.NoError(t, err)
+		assert.Equal(t, "agent binary\n", string(content))
+
+		info, err := os.Stat(filepath.Join(dest, "install.sh"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+		os.RemoveAll(dest)
+	}
+}
+
+func TestExtractPackageWithMismatchedCompressFormat(t *testing.T) {
+	dest, err := ioutil.TempDir("", "extractpackage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dest)
+
+	context := &InstanceContext{CompressFormat: CompressFormatTarXz}
+	err = ExtractPackage(logger, context, filepath.Join("testdata", "package.tar.gz"), dest)
+	assert.Error(t, err)
+}
+
+func TestExeCommandWithSanitizedPath(t *testing.T) {
+	outputRoot, err := ioutil.TempDir("", "exeoutput")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputRoot)
+	defer func() {
+		execCommand = exec.Command
+		cmdStart = (*exec.Cmd).Start
+	}()
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cmd := fakeExecCommand(command, args...)
+		cmd.Env = append(cmd.Env, "PATH=/opt/unexpected/bin:/usr/bin")
+		return cmd
+	}
+	cmdStart = (*exec.Cmd).Start
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+
+	testCases := []struct {
+		util         Utility
+		stdout       string
+		expectedPath string
+	}{
+		{Utility{UseSanitizedPath: true}, "sanitized", "/usr/sbin:/usr/bin:/sbin:/bin"},
+		// the inherited PATH is kept by default
+		{Utility{}, "inherited", "/opt/unexpected/bin:/usr/bin"},
+	}
+
+	for _, test := range testCases {
+		err = test.util.ExeCommand(logger, "printpath", outputRoot, outputRoot, test.stdout, "stderr", false)
+		assert.NoError(t, err)
+
+		content, err := ioutil.ReadFile(UpdateStdOutPath(outputRoot, test.stdout))
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedPath, strings.TrimSpace(string(content)))
+	}
+}
+
+func TestVerifyExtractedArtifactsWithoutExecuteBit(t *testing.T) {
+	defer useTestInstallers()()
+	updateRoot, err := ioutil.TempDir("", "extracted")
+	assert.NoError(t, err)
+	defer os.RemoveAll(updateRoot)
+	installerPath := InstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0")
+	writeExecutable(t, installerPath)
+	writeExecutable(t, UnInstallerFilePath(updateRoot, "amazon-ssm-agent", "3.0.0.0"))
+	assert.NoError(t, os.Chmod(installerPath, 0644))
+
+	err = VerifyExtractedArtifacts(updateRoot, "amazon-ssm-agent", "3.0.0.0")
+	assert.Equal(t, ErrorInvalidPackage, GetErrorCode(err))
+	assert.Contains(t, err.Error(), installerPath)
+}
+
+func TestCreateUpdateDownloadFolderWithSymlinkLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "b"), filepath.Join(dir, "a")))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "b")))
+	downloadRoot = filepath.Join(dir, "a")
+	mkDirAll = os.MkdirAll
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+
+	util := Utility{}
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "symlink loop")
+
+	// a symlink to a location that does not exist
+	downloadRoot = dir
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "update")))
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestCreateUpdateDownloadFolderWithoutWritePermission(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the permissions are not enforced for root")
+	}
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Chmod(dir, 0700)
+	downloadRoot = dir
+	mkDirAll = os.MkdirAll
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+	util := Utility{}
+
+	// the update folder cannot be created
+	assert.NoError(t, os.Chmod(dir, 0500))
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+
+	// the update folder exists but cannot be written to
+	assert.NoError(t, os.Chmod(dir, 0700))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "update"), 0500))
+	defer os.Chmod(filepath.Join(dir, "update"), 0700)
+	_, err = util.CreateUpdateDownloadFolder()
+	assert.Error(t, err)
+	assert.Equal(t, ErrorEnvironmentIssue, GetErrorCode(err))
+}
+
+func TestCleanupDownloadFolderRefusesLinkOutsideOfUpdateFolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	downloadRoot = dir
+	defer func() { downloadRoot = appconfig.DownloadRoot }()
+
+	unrelated := filepath.Join(dir, "documents")
+	assert.NoError(t, os.MkdirAll(filepath.Join(unrelated, "folder"), appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "update"), appconfig.ReadWriteExecuteAccess))
+	assert.NoError(t, os.Symlink(unrelated, filepath.Join(dir, "update", "link")))
+
+	err = CleanupDownloadFolder(logger, filepath.Join(dir, "update", "link", "folder"))
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(unrelated, "folder"))
+	assert.NoError(t, err)
+}
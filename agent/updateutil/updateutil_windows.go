@@ -17,11 +17,17 @@
 package updateutil
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/jobobject"
+	"github.com/aws/amazon-ssm-agent/agent/log"
 	"github.com/aws/amazon-ssm-agent/agent/platform"
 )
 
@@ -64,11 +70,20 @@ const (
 
 	// OutputBucketNameCmd represents the command argument for output bucket name
 	OutputBucketNameCmd = "output-bucket"
+
+	// DryRunCmd represents the command argument for running the update without installing
+	DryRunCmd = "dry-run"
+
+	// InstallTimeoutCmd represents the command argument for the timeout of the install script in seconds
+	InstallTimeoutCmd = "install-timeout"
+
+	// UninstallTimeoutCmd represents the command argument for the timeout of the uninstall script in seconds
+	UninstallTimeoutCmd = "uninstall-timeout"
 )
 
 const (
 	// CompressFormat represents the compress format for windows platform
-	CompressFormat = "zip"
+	CompressFormat = CompressFormatZip
 )
 
 const (
@@ -80,12 +95,142 @@ const (
 )
 
 var getPlatformSku = platform.PlatformSku
+var createJobObject = jobobject.CreateKillOnCloseJobObject
+var assignProcessToJob = jobobject.AssignProcessToJob
+var resumeProcess = resumeSuspendedProcess
+
+var ntResumeProcess = syscall.NewLazyDLL("ntdll.dll").NewProc("NtResumeProcess")
+
+const (
+	// createSuspended is the process creation flag that starts the process with its main thread suspended
+	createSuspended = 0x00000004
+
+	// processSuspendResume is the access right needed to resume the process
+	processSuspendResume = 0x0800
+)
+
+// agentBinaryPaths represents the locations of the agent binary for windows platform
+var agentBinaryPaths = []string{filepath.Join(appconfig.DefaultProgramFolder, "amazon-ssm-agent.exe")}
+
+// errorSharingViolation is returned when the file is opened by another process without sharing access
+const errorSharingViolation syscall.Errno = 32
+
+// renameConflictErrors represents the errors of a rename over a file that is in use by another process,
+// windows denies the access to a file that is open without the delete sharing mode
+var renameConflictErrors = []syscall.Errno{syscall.ERROR_ACCESS_DENIED, errorSharingViolation}
 
 func prepareProcess(command *exec.Cmd) {
 }
 
+// agentBinaryPath returns the path of the installed agent binary
+func agentBinaryPath(context *InstanceContext) string {
+	return filepath.Join(appconfig.DefaultProgramFolder, "amazon-ssm-agent.exe")
+}
+
+// sanitizedPath is the PATH of the commands ExeCommand runs when the inherited PATH is not used
+func sanitizedPath() string {
+	systemRoot := os.Getenv("SystemRoot")
+	return strings.Join([]string{
+		filepath.Join(systemRoot, "System32"),
+		systemRoot,
+		filepath.Join(systemRoot, "System32", "Wbem"),
+		filepath.Join(systemRoot, "System32", "WindowsPowerShell", "v1.0"),
+	}, string(os.PathListSeparator))
+}
+
+// setCommandUser is not supported on windows, the command always runs as the agent user
+func setCommandUser(log log.T, command *exec.Cmd, userName string) error {
+	if userName != "" {
+		log.Debugf("Ignoring user %v, running commands as another user is not supported on windows", userName)
+	}
+	return nil
+}
+
+// processTree holds the job object the process and its children are attached to,
+// the job object is created with kill on close so closing it terminates the whole process tree
+type processTree struct {
+	job       syscall.Handle
+	closeOnce sync.Once
+}
+
+// prepareProcessTree makes the command start suspended, so it cannot start child processes before trackProcessTree
+// attached it to the job object
+func prepareProcessTree(command *exec.Cmd) {
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.CreationFlags |= createSuspended
+}
+
+// trackProcessTree attaches the started process to a new job object and resumes it when it was started suspended,
+// the process still runs when it cannot be attached and it is killed when it cannot be resumed
+func trackProcessTree(log log.T, command *exec.Cmd) *processTree {
+	tree := attachProcessTree(log, command)
+	if command.SysProcAttr == nil || command.SysProcAttr.CreationFlags&createSuspended == 0 {
+		return tree
+	}
+	if err := resumeProcess(uint32(command.Process.Pid)); err != nil {
+		log.Warnf("failed to resume process, killing it, %v", err)
+		if err = tree.kill(log, command); err != nil {
+			log.Warnf("failed to kill process, %v", err)
+		}
+	}
+	return tree
+}
+
+// attachProcessTree attaches the started process to a new job object
+func attachProcessTree(log log.T, command *exec.Cmd) *processTree {
+	tree := &processTree{}
+	job, err := createJobObject()
+	if err != nil {
+		log.Warnf("failed to create job object, child processes will not be killed on timeout, %v", err)
+		return tree
+	}
+	if err = assignProcessToJob(job, uint32(command.Process.Pid)); err != nil {
+		log.Warnf("failed to attach process to job object, child processes will not be killed on timeout, %v", err)
+		syscall.CloseHandle(job)
+		return tree
+	}
+	tree.job = job
+	return tree
+}
+
+// resumeSuspendedProcess resumes the threads of the process started with createSuspended
+func resumeSuspendedProcess(pid uint32) error {
+	handle, err := syscall.OpenProcess(processSuspendResume, false, pid)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(handle)
+
+	if status, _, _ := ntResumeProcess.Call(uintptr(handle)); status != 0 {
+		return fmt.Errorf("NtResumeProcess failed with status 0x%x", status)
+	}
+	return nil
+}
+
+func (tree *processTree) kill(log log.T, command *exec.Cmd) error {
+	if tree.job == 0 {
+		return command.Process.Kill()
+	}
+	// closing the job object terminates the process and all its children
+	tree.close(log)
+	return nil
+}
+
+func (tree *processTree) close(log log.T) {
+	tree.closeOnce.Do(func() {
+		if tree.job == 0 {
+			return
+		}
+		if err := syscall.CloseHandle(tree.job); err != nil {
+			log.Warnf("failed to close job object, %v", err)
+		}
+	})
+}
+
 func agentStatusOutput() ([]byte, error) {
-	return execCommand("sc", "query", "AmazonSSMAgent").Output()
+	return statusCommandOutput(execCommand("sc", "query", AgentWindowsServiceName))
 }
 
 func agentExpectedStatus() string {
@@ -96,3 +241,8 @@ func setPlatformSpecificCommand(parts []string) []string {
 	cmd := filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsPowerShell", "v1.0", "powershell.exe") + " -ExecutionPolicy unrestricted"
 	return append(strings.Split(cmd, " "), parts...)
 }
+
+// isExecutable returns true for all the files, the scripts are run with powershell and do not need an execute bit
+func isExecutable(info os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/aws/amazon-ssm-agent/agent/jobobject"
+	"github.com/stretchr/testify/assert"
+)
+
+var isProcessInJob = syscall.NewLazyDLL("kernel32.dll").NewProc("IsProcessInJob")
+
+func startSleepingProcess(t *testing.T) *exec.Cmd {
+	command := exec.Command("powershell.exe", "-Command", "Start-Sleep -Seconds 30")
+	assert.NoError(t, command.Start())
+	return command
+}
+
+func TestTrackProcessTreeAttachesProcessToJobObject(t *testing.T) {
+	createJobObject = jobobject.CreateKillOnCloseJobObject
+	assignProcessToJob = jobobject.AssignProcessToJob
+
+	command := startSleepingProcess(t)
+	tree := trackProcessTree(logger, command)
+	assert.NotEqual(t, syscall.Handle(0), tree.job)
+
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(command.Process.Pid))
+	assert.NoError(t, err)
+	defer syscall.CloseHandle(handle)
+
+	var inJob int32
+	r1, _, e1 := isProcessInJob.Call(uintptr(handle), uintptr(tree.job), uintptr(unsafe.Pointer(&inJob)))
+	assert.NotEqual(t, uintptr(0), r1, "IsProcessInJob failed %v", e1)
+	assert.NotEqual(t, int32(0), inJob)
+
+	// killing the tree terminates the process attached to the job object
+	assert.NoError(t, tree.kill(logger, command))
+	assert.Error(t, command.Wait())
+}
+
+func TestTrackProcessTreeResumesSuspendedProcessInJobObject(t *testing.T) {
+	createJobObject = jobobject.CreateKillOnCloseJobObject
+	assignProcessToJob = jobobject.AssignProcessToJob
+
+	command := exec.Command("powershell.exe", "-Command", "Start-Sleep -Seconds 30")
+	prepareProcessTree(command)
+	assert.NoError(t, command.Start())
+	tree := trackProcessTree(logger, command)
+	assert.NotEqual(t, syscall.Handle(0), tree.job)
+
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(command.Process.Pid))
+	assert.NoError(t, err)
+	defer syscall.CloseHandle(handle)
+
+	var inJob int32
+	r1, _, e1 := isProcessInJob.Call(uintptr(handle), uintptr(tree.job), uintptr(unsafe.Pointer(&inJob)))
+	assert.NotEqual(t, uintptr(0), r1, "IsProcessInJob failed %v", e1)
+	assert.NotEqual(t, int32(0), inJob)
+
+	assert.NoError(t, tree.kill(logger, command))
+	assert.Error(t, command.Wait())
+}
+
+func TestTrackProcessTreeKillsProcessThatCannotBeResumed(t *testing.T) {
+	createJobObject = jobobject.CreateKillOnCloseJobObject
+	assignProcessToJob = jobobject.AssignProcessToJob
+	resumeProcess = func(pid uint32) error {
+		return fmt.Errorf("resume process error")
+	}
+	defer func() { resumeProcess = resumeSuspendedProcess }()
+
+	command := exec.Command("powershell.exe", "-Command", "Start-Sleep -Seconds 30")
+	prepareProcessTree(command)
+	assert.NoError(t, command.Start())
+	tree := trackProcessTree(logger, command)
+	defer tree.close(logger)
+
+	// the suspended process is killed instead of being left hanging
+	assert.Error(t, command.Wait())
+}
+
+func TestTrackProcessTreeWithJobObjectCreationFailure(t *testing.T) {
+	createJobObject = func() (syscall.Handle, error) {
+		return 0, fmt.Errorf("create job object error")
+	}
+	defer func() { createJobObject = jobobject.CreateKillOnCloseJobObject }()
+
+	command := startSleepingProcess(t)
+	tree := trackProcessTree(logger, command)
+	assert.Equal(t, syscall.Handle(0), tree.job)
+
+	// the process is still killed without a job object
+	assert.NoError(t, tree.kill(logger, command))
+	command.Wait()
+}
+
+func TestVerifyInstalledVersionWithSpaceInBinaryPath(t *testing.T) {
+	defer func() { execCommand = exec.Command }()
+	var commands []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		commands = append(commands, command)
+		return fakeExecCommand("amazon-ssm-agent", args...)
+	}
+	context := &InstanceContext{"us-east-1", PlatformWindows, "10", PlatformWindows, "amd64", "zip"}
+	util := Utility{}
+	binaryPath := agentBinaryPath(context)
+
+	assert.NoError(t, util.VerifyInstalledVersion(logger, context, "2.3.100.0"))
+
+	// the binary is run directly with its path unchanged rather than through powershell
+	assert.Contains(t, binaryPath, " ")
+	assert.Equal(t, []string{binaryPath}, commands)
+}
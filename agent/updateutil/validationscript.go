@@ -0,0 +1,72 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/aws/amazon-ssm-agent/agent/log"
+)
+
+const (
+	// ValidationStdoutFileName represents the file name of the validation script standard output
+	ValidationStdoutFileName = "validationstdout"
+
+	// ValidationStderrFileName represents the file name of the validation script standard error
+	ValidationStderrFileName = "validationstderr"
+)
+
+var validationOutputRoot = appconfig.UpdaterArtifactsRoot
+
+// GetValidationScriptPath returns the UpdateValidationScriptPath of the appconfig, no script is run when it is empty
+func GetValidationScriptPath(log log.T) string {
+	config, err := loadAppConfig(false)
+	if err != nil {
+		log.Debugf("failed to load appconfig, no validation script is run, %v", err)
+		return ""
+	}
+	return config.Agent.UpdateValidationScriptPath
+}
+
+// RunValidationScript runs the post install validation script, the update fails with ErrorInstallFailed when the
+// script cannot be run or exits with a non-zero code. Nothing is run when no script is configured. The update
+// execution timeout is used when timeout is 0.
+func RunValidationScript(log log.T, scriptPath string, context *InstanceContext, timeout time.Duration) (err error) {
+	if scriptPath == "" {
+		log.Debugf("No validation script is configured, skipping post install validation")
+		return nil
+	}
+	if _, err = statFile(scriptPath); err != nil {
+		return NewUpdateError(ErrorInstallFailed, err, "validation script %v cannot be found", scriptPath)
+	}
+
+	log.Infof("Running validation script %v on %v %v", scriptPath, context.Platform, context.PlatformVersion)
+	util := &Utility{CustomUpdateExecutionTimeoutInSeconds: int(timeout / time.Second)}
+	if err = util.ExeCommand(
+		log,
+		scriptPath,
+		filepath.Dir(scriptPath),
+		UpdateOutputDirectory(validationOutputRoot),
+		ValidationStdoutFileName,
+		ValidationStderrFileName,
+		false); err != nil {
+		return NewUpdateError(ErrorInstallFailed, err, "validation script %v failed", scriptPath)
+	}
+
+	log.Infof("Validation script %v succeeded", scriptPath)
+	return nil
+}
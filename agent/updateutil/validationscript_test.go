@@ -0,0 +1,101 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ssm-agent/agent/appconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// prepareValidationScript creates the script in a temporary folder used as the validation output root
+func prepareValidationScript(t *testing.T, scriptName string) (root string, scriptPath string) {
+	root, err := ioutil.TempDir("", "validationscript")
+	assert.NoError(t, err)
+	scriptPath = filepath.Join(root, scriptName)
+	assert.NoError(t, ioutil.WriteFile(scriptPath, []byte{}, 0700))
+
+	validationOutputRoot = root
+	statFile = os.Stat
+	mkDirAll = os.MkdirAll
+	openFile = os.OpenFile
+	execCommand = fakeExecCommand
+	cmdStart = (*exec.Cmd).Start
+	return root, scriptPath
+}
+
+func TestRunValidationScriptPass(t *testing.T) {
+	root, scriptPath := prepareValidationScript(t, "writeboth")
+	defer os.RemoveAll(root)
+	defer func() { validationOutputRoot = appconfig.UpdaterArtifactsRoot }()
+
+	context := &InstanceContext{Platform: PlatformLinux, PlatformVersion: "2"}
+	err := RunValidationScript(logger, scriptPath, context, 10*time.Second)
+	assert.NoError(t, err)
+
+	stdout, err := ioutil.ReadFile(UpdateStdOutPath(UpdateOutputDirectory(root), ValidationStdoutFileName))
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(stdout), "standard output"))
+}
+
+func TestRunValidationScriptFail(t *testing.T) {
+	root, scriptPath := prepareValidationScript(t, "exitcode")
+	defer os.RemoveAll(root)
+	defer func() { validationOutputRoot = appconfig.UpdaterArtifactsRoot }()
+
+	context := &InstanceContext{Platform: PlatformLinux, PlatformVersion: "2"}
+	err := RunValidationScript(logger, scriptPath, context, 10*time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+
+	stderr, err := ioutil.ReadFile(UpdateStdErrPath(UpdateOutputDirectory(root), ValidationStderrFileName))
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(stderr), "dependency problems"))
+}
+
+func TestRunValidationScriptMissingScript(t *testing.T) {
+	root, _ := prepareValidationScript(t, "writeboth")
+	defer os.RemoveAll(root)
+	defer func() { validationOutputRoot = appconfig.UpdaterArtifactsRoot }()
+
+	context := &InstanceContext{Platform: PlatformLinux, PlatformVersion: "2"}
+
+	// no script is configured
+	assert.NoError(t, RunValidationScript(logger, "", context, 10*time.Second))
+
+	// the configured script does not exist
+	err := RunValidationScript(logger, filepath.Join(root, "missing"), context, 10*time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, ErrorInstallFailed, GetErrorCode(err))
+}
+
+func TestGetValidationScriptPath(t *testing.T) {
+	defer func() { loadAppConfig = appconfig.Config }()
+
+	config := appconfig.DefaultConfig()
+	config.Agent.UpdateValidationScriptPath = "/opt/validate.sh"
+	loadAppConfig = func(reload bool) (appconfig.SsmagentConfig, error) { return config, nil }
+	assert.Equal(t, "/opt/validate.sh", GetValidationScriptPath(logger))
+
+	config.Agent.UpdateValidationScriptPath = ""
+	assert.Empty(t, GetValidationScriptPath(logger))
+}
@@ -18,8 +18,52 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
 )
 
+// VerifyApprovedVersion returns an UpdateError with ErrorInvalidTargetVersion when the agent configuration lists
+// approved update versions, in ApprovedUpdateVersions or the ApprovedUpdateVersionsPath file, and the target
+// version is not one of them. Without approved versions any target version is allowed.
+func VerifyApprovedVersion(log log.T, targetVersion string) error {
+	config, err := loadAppConfig(false)
+	if err != nil {
+		log.Debugf("failed to load appconfig, the target version is not restricted, %v", err)
+		return nil
+	}
+
+	approved := make([]string, 0, len(config.Agent.ApprovedUpdateVersions))
+	for _, version := range config.Agent.ApprovedUpdateVersions {
+		if version = strings.TrimSpace(version); version != "" {
+			approved = append(approved, version)
+		}
+	}
+	if config.Agent.ApprovedUpdateVersionsPath != "" {
+		content, err := readFile(config.Agent.ApprovedUpdateVersionsPath)
+		if err != nil {
+			return NewUpdateError(ErrorInvalidTargetVersion, err,
+				"failed to read the approved versions %v", config.Agent.ApprovedUpdateVersionsPath)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if version := strings.TrimSpace(line); version != "" && !strings.HasPrefix(version, "#") {
+				approved = append(approved, version)
+			}
+		}
+	}
+
+	if len(approved) == 0 {
+		return nil
+	}
+	for _, version := range approved {
+		if version == strings.TrimSpace(targetVersion) {
+			log.Infof("Target version %v is approved", targetVersion)
+			return nil
+		}
+	}
+	return NewUpdateError(ErrorInvalidTargetVersion, nil,
+		"target version %v is not approved, the approved versions are %v", targetVersion, strings.Join(approved, ", "))
+}
+
 // VersionCompare compares two version strings
 func VersionCompare(versionl string, versionr string) (result int, err error) {
 	if versionl, err = versionOrdinal(strings.TrimSpace(versionl)); err != nil {
@@ -71,3 +115,22 @@ func versionOrdinal(version string) (string, error) {
 	}
 	return string(vo), nil
 }
+
+// CheckDowngrade returns an UpdateError with ErrorAttemptToDowngrade when the target version is lower
+// than the current version and downgrade is not allowed
+func CheckDowngrade(log log.T, currentVersion string, targetVersion string, allowDowngrade bool) (err error) {
+	compareResult := 0
+	if compareResult, err = VersionCompare(targetVersion, currentVersion); err != nil {
+		return NewUpdateError(ErrorInvalidTargetVersion, err, "failed to compare target version %v with current version %v", targetVersion, currentVersion)
+	}
+
+	if compareResult < 0 {
+		if !allowDowngrade {
+			return NewUpdateError(ErrorAttemptToDowngrade, nil,
+				"updating to an older version %v from %v, please enable allow downgrade to proceed", targetVersion, currentVersion)
+		}
+		log.Infof("Downgrading from %v to %v is allowed", currentVersion, targetVersion)
+	}
+
+	return nil
+}
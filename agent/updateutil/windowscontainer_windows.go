@@ -0,0 +1,60 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// containerControlKey holds containerTypeValue, the value is only set in the Windows container images
+	containerControlKey = `SYSTEM\CurrentControlSet\Control`
+	containerTypeValue  = "ContainerType"
+)
+
+var isWindowsContainer = windowsContainer
+
+// windowsContainer returns true when the agent runs in a Windows container instead of on Windows Server
+func windowsContainer(log log.T) bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, containerControlKey, registry.QUERY_VALUE)
+	if err != nil {
+		log.Debugf("failed to open %v, %v", containerControlKey, err)
+		return false
+	}
+	defer key.Close()
+
+	_, _, err = key.GetIntegerValue(containerTypeValue)
+	return err == nil
+}
+
+// platformServiceRunning checks the agent process in a Windows container, the agent is the entrypoint of the
+// container and is not registered with the service control manager. handled is false on Windows Server where the
+// service control manager is queried.
+func platformServiceRunning(log log.T, i *InstanceContext) (result bool, handled bool) {
+	if !isWindowsContainer(log) {
+		return false, false
+	}
+
+	executable, err := findRunningAgentExecutable(log, i)
+	if err != nil {
+		log.Debugf("agent process is not running in the container, %v", err)
+		return false, true
+	}
+	log.Debugf("agent process %v is running in the container", executable)
+	return true, true
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may not
+// use this file except in compliance with the License. A copy of the
+// License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build windows
+
+// Package updateutil contains updater specific utilities.
+package updateutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/amazon-ssm-agent/agent/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubWindowsEnvironment replaces the container detection and the agent process lookup
+func stubWindowsEnvironment(container bool, processErr error) (lookups *int, restore func()) {
+	originalContainer, originalFind := isWindowsContainer, findRunningAgentExecutable
+	lookups = new(int)
+	isWindowsContainer = func(log log.T) bool { return container }
+	findRunningAgentExecutable = func(log log.T, context *InstanceContext) (string, error) {
+		*lookups++
+		return `C:\Program Files\Amazon\SSM\amazon-ssm-agent.exe`, processErr
+	}
+	return lookups, func() {
+		isWindowsContainer, findRunningAgentExecutable = originalContainer, originalFind
+	}
+}
+
+func TestPlatformServiceRunningInContainer(t *testing.T) {
+	context := &InstanceContext{"us-east-1", PlatformWindows, "10.0.17763", PlatformWindows, "amd64", "zip"}
+
+	lookups, restore := stubWindowsEnvironment(true, nil)
+	running, handled := platformServiceRunning(logger, context)
+	restore()
+	assert.True(t, handled)
+	assert.True(t, running)
+	assert.Equal(t, 1, *lookups)
+
+	_, restore = stubWindowsEnvironment(true, fmt.Errorf("no amazon-ssm-agent process is running"))
+	running, handled = platformServiceRunning(logger, context)
+	restore()
+	assert.True(t, handled)
+	assert.False(t, running)
+}
+
+func TestPlatformServiceRunningOnWindowsServer(t *testing.T) {
+	context := &InstanceContext{"us-east-1", PlatformWindows, "10.0.17763", PlatformWindows, "amd64", "zip"}
+	lookups, restore := stubWindowsEnvironment(false, nil)
+	defer restore()
+
+	// the service control manager is queried on Windows Server
+	_, handled := platformServiceRunning(logger, context)
+	assert.False(t, handled)
+	assert.Equal(t, 0, *lookups)
+}